@@ -0,0 +1,218 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+// rtio-gateway serves the HTTP gateway apart from the device hubs, calls
+// are routed to the hub holding the device session.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/admin"
+	"github.com/mkrainbow/rtio/internal/audit"
+	"github.com/mkrainbow/rtio/internal/httpaccess/server/httpgw"
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/pkg/config"
+	"github.com/mkrainbow/rtio/pkg/drain"
+	"github.com/mkrainbow/rtio/pkg/health"
+	"github.com/mkrainbow/rtio/pkg/logsettings"
+
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	httpAddr := flag.String("httpaccess.addr", "0.0.0.0:17917", "Address for http conntection.")
+	adminAddr := flag.String("admin.addr", "0.0.0.0:17117", "Address for admin endpoints /metrics, /healthz and /readyz, empty to disable.")
+	adminToken := flag.String("admin.token", "", "Bearer token of admin endpoints changing state, such as /jwt/revocations, which are served on a loopback admin.addr only if empty.")
+	hubAddrs := flag.String("backend.rpc.addrs", "localhost:17018", "Backend RPC addresses of the device hubs, separated by commas.")
+	hubDNS := flag.String("backend.rpc.dns", "", "DNS name and port (host:port) resolved to the device hubs periodically.")
+
+	enableHubTLS := flag.Bool("enable.backend.rpc.tls", false, "Enable TLS to the device hubs.")
+	hubCAFile := flag.String("backend.rpc.tls.ca", "", "CA file verifying the device hubs, system CAs if empty.")
+	hubCertFile := flag.String("backend.rpc.tls.certfile", "", "Client cert file for mTLS to the device hubs.")
+	hubKeyFile := flag.String("backend.rpc.tls.keyfile", "", "Client key file for mTLS to the device hubs.")
+	hubServerName := flag.String("backend.rpc.tls.servername", "", "Server name verified in hub certs, the host of the address if empty.")
+	hubToken := flag.String("backend.rpc.token", "", "Bearer token for the device hubs with caller authentication.")
+	clusterToken := flag.String("cluster.token", "", "Token of the hub cluster, so clustered hubs answer for their own sessions only.")
+
+	logFormat := flag.String("log.format", "text", "Log format, text or json.")
+	logLevel := flag.String("log.level", "warn", "Log level, debug, info, warn, error.")
+
+	enableHTTPS := flag.Bool("enable.https", false, "Enable https gateway.")
+	httpsCertFile := flag.String("https.certfile", "", "TLS cert file.")
+	httpsKeyFile := flag.String("https.keyfile", "", "TLS key file.")
+
+	enableJWT := flag.Bool("enable.jwt", false, "Enable the JWT validation.")
+	ed25519 := flag.String("jwt.ed25519", "", "The public key (pem) for JWT.")
+	jwks := flag.String("jwt.jwks", "", "JWKS file path or URL, keys for RS256, ES256 and EdDSA selected by kid.")
+	jwksRefresh := flag.Int("jwt.jwks.refresh", 300, "JWKS refresh interval in seconds.")
+	jwtIssuer := flag.String("jwt.issuer", "", "Expected JWT issuer (iss), not validated if empty.")
+	jwtAudience := flag.String("jwt.audience", "", "Expected JWT audience (aud), not validated if empty.")
+	jwtLeeway := flag.Int("jwt.leeway", 10, "Clock skew in seconds allowed when validating JWT exp, nbf and iat.")
+	jwtRevocations := flag.String("jwt.revocations", "", "JWT revocation list file (json) by jti or subject, updated by the admin API, in memory only if empty.")
+	introspectionURL := flag.String("jwt.introspection.url", "", "RFC 7662 token introspection endpoint checking JWTs after validation, disabled if empty.")
+	introspectionClientID := flag.String("jwt.introspection.clientid", "", "Client ID of HTTP Basic auth to the introspection endpoint.")
+	introspectionClientSecret := flag.String("jwt.introspection.clientsecret", "", "Client secret of HTTP Basic auth to the introspection endpoint.")
+	introspectionTimeout := flag.Int("jwt.introspection.timeout", 5000, "Timeout in ms of a request to the introspection endpoint.")
+	introspectionCacheTTL := flag.Int("jwt.introspection.cache.ttl", 60, "Seconds to cache introspection results, not beyond the token exp, 0 to disable.")
+
+	enableAPIKey := flag.Bool("enable.apikey", false, "Enable API key authentication for http callers.")
+	apiKeyStore := flag.String("apikey.store", "apikeys.json", "API key store file, managed by 'rtio apikey' subcommand.")
+	policyFile := flag.String("httpaccess.policy", "", "Policy file (json) for device, URI and method access of http callers.")
+
+	auditFile := flag.String("audit.file", "", "Audit log file (json lines, hash chained) of copost and obget requests, disabled if empty.")
+	auditMaxSize := flag.Int("audit.file.maxsize", 100, "Megabytes of the audit file before it is rotated, 0 to never rotate.")
+	auditMaxBackups := flag.Int("audit.file.maxbackups", 0, "Rotated audit files kept, oldest removed, 0 to keep all.")
+
+	shutdownGrace := flag.Int("shutdown.grace", 15, "Seconds to drain requests in flight on SIGTERM, 0 to stop at once.")
+	shutdownDelay := flag.Int("shutdown.delay", 5, "Seconds reporting not ready on SIGTERM before draining, for load balancers to stop sending new work.")
+	printVersion := flag.Bool("version", false, "Print version as JSON.")
+
+	flag.Parse()
+
+	if *printVersion {
+		fmt.Printf(`{"version":"%s", "id":"%s", "build_time":"%s"}`+"\n", Ver, ID, Time)
+		os.Exit(0)
+	}
+
+	config.StringKV.Set("admin.addr", *adminAddr)
+	config.StringKV.Set("admin.token", *adminToken)
+	config.StringKV.Set("httpaccess.policy", *policyFile)
+	config.BoolKV.Set("enable.apikey", *enableAPIKey)
+	config.StringKV.Set("apikey.store", *apiKeyStore)
+	config.StringKV.Set("cluster.token", *clusterToken)
+	config.StringKV.Set("audit.file", *auditFile)
+	config.IntKV.Set("audit.file.maxsize", *auditMaxSize)
+	config.IntKV.Set("audit.file.maxbackups", *auditMaxBackups)
+
+	logsettings.Set(*logFormat, *logLevel)
+
+	if *enableJWT {
+		if *ed25519 == "" && *jwks == "" {
+			log.Error().Msg("JWT public key and JWKS are empty")
+			return
+		}
+		config.BoolKV.Set("enable.jwt", true)
+		config.StringKV.Set("jwt.ed25519", *ed25519)
+		config.StringKV.Set("jwt.jwks", *jwks)
+		config.IntKV.Set("jwt.jwks.refresh", *jwksRefresh)
+		config.StringKV.Set("jwt.issuer", *jwtIssuer)
+		config.StringKV.Set("jwt.audience", *jwtAudience)
+		config.IntKV.Set("jwt.leeway", *jwtLeeway)
+		config.StringKV.Set("jwt.revocations", *jwtRevocations)
+		config.StringKV.Set("jwt.introspection.url", *introspectionURL)
+		config.StringKV.Set("jwt.introspection.clientid", *introspectionClientID)
+		config.StringKV.Set("jwt.introspection.clientsecret", *introspectionClientSecret)
+		config.IntKV.Set("jwt.introspection.timeout", *introspectionTimeout)
+		config.IntKV.Set("jwt.introspection.cache.ttl", *introspectionCacheTTL)
+	}
+
+	hubs := httpgw.HubPoolOptions{DNSName: *hubDNS, Token: *hubToken}
+	for _, addr := range strings.Split(*hubAddrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			hubs.Addrs = append(hubs.Addrs, addr)
+		}
+	}
+	if len(hubs.Addrs) == 0 && hubs.DNSName == "" {
+		log.Error().Msg("backend.rpc.addrs and backend.rpc.dns are empty")
+		return
+	}
+	if *enableHubTLS {
+		var err error
+		hubs.TLS, err = rpcauth.LoadClientTLSConfig(*hubCAFile, *hubCertFile, *hubKeyFile, *hubServerName)
+		if err != nil {
+			log.Error().Err(err).Msg("Load hub TLS error")
+			return
+		}
+	}
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	adminCtx, adminCancel := context.WithCancel(context.Background())
+	defer adminCancel()
+
+	go func() {
+		<-sigCtx.Done()
+		stop()
+		log.Info().Int("delay", *shutdownDelay).Int("grace", *shutdownGrace).Msg("rtio-gateway shutting down")
+		health.SetShuttingDown()
+		if *shutdownDelay > 0 {
+			time.Sleep(time.Duration(*shutdownDelay) * time.Second)
+		}
+		if *shutdownGrace > 0 {
+			graceCtx, graceCancel := context.WithTimeout(context.Background(), time.Duration(*shutdownGrace)*time.Second)
+			drain.Drain(graceCtx)
+			graceCancel()
+		}
+		cancel()
+	}()
+	log.Info().Msg("rtio-gateway starting ...")
+
+	adminWait := &sync.WaitGroup{}
+	if *adminAddr != "" {
+		if err := admin.InitAdminServer(adminCtx, *adminAddr, adminWait); err != nil {
+			log.Error().Err(err).Msg("Init Admin Server error")
+			return
+		}
+	}
+
+	// records until the gateway stopped
+	auditCtx, auditCancel := context.WithCancel(context.Background())
+	defer auditCancel()
+	if err := audit.Init(auditCtx); err != nil {
+		log.Error().Err(err).Msg("Init audit log error")
+		return
+	}
+
+	wait := &sync.WaitGroup{}
+	certFile, keyFile := "", ""
+	if *enableHTTPS {
+		if *httpsCertFile == "" || *httpsKeyFile == "" {
+			log.Error().Msg("TLS certfile or keyfile is empty")
+			return
+		}
+		certFile, keyFile = *httpsCertFile, *httpsKeyFile
+	}
+	if err := httpgw.InitStandaloneGateway(ctx, hubs, *httpAddr, wait, certFile, keyFile); err != nil {
+		log.Error().Err(err).Msg("Init Gateway error")
+		return
+	}
+
+	wait.Wait()
+	auditCancel()
+	adminCancel()
+	adminWait.Wait()
+	log.Info().Msg("rtio-gateway stoped")
+}
+
+// version infomation
+var (
+	Ver  string
+	ID   string
+	Time string
+)
@@ -0,0 +1,130 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/httpaccess/server/httpgw"
+	"github.com/mkrainbow/rtio/pkg/logsettings"
+)
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func apiKeyUsage() {
+	fmt.Fprintf(os.Stderr, `Usage of %s apikey:
+
+  %s apikey create -store FILE -name NAME -devices PATTERNS [-uris PATTERNS] [-methods METHODS] [-expires DURATION] [-rate N]
+  %s apikey list   -store FILE
+  %s apikey revoke -store FILE -id ID
+`, os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+}
+
+// runAPIKey handles 'rtio apikey' subcommand, returns exit code.
+func runAPIKey(args []string) int {
+	if len(args) < 1 {
+		apiKeyUsage()
+		return 2
+	}
+	fs := flag.NewFlagSet("apikey "+args[0], flag.ExitOnError)
+	store := fs.String("store", "apikeys.json", "API key store file.")
+	name := fs.String("name", "", "Key name, for display only.")
+	devices := fs.String("devices", "", "Comma-separated device ID patterns, '*' suffix for prefix match.")
+	uris := fs.String("uris", "", "Comma-separated URI patterns, empty for all.")
+	methods := fs.String("methods", "", "Comma-separated methods (copost, obget), empty for all.")
+	expires := fs.Duration("expires", 0, "Key lifetime, such as 720h, 0 for never.")
+	rate := fs.Int("rate", 0, "Requests per second, 0 for unlimited.")
+	id := fs.String("id", "", "Key ID to revoke.")
+	fs.Parse(args[1:])
+	logsettings.Set("text", "warn")
+
+	s, err := httpgw.LoadAPIKeyStore(*store)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load store:", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "create":
+		if *devices == "" {
+			fmt.Fprintln(os.Stderr, "-devices is required")
+			return 2
+		}
+		scope := httpgw.AccessScope{
+			Devices: splitList(*devices),
+			URIs:    splitList(*uris),
+			Methods: splitList(*methods),
+		}
+		var exp time.Time
+		if *expires > 0 {
+			exp = time.Now().Add(*expires)
+		}
+		key, k, err := s.Create(*name, scope, exp, *rate)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "create key:", err)
+			return 1
+		}
+		if err := s.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "save store:", err)
+			return 1
+		}
+		fmt.Printf("id:  %s\nkey: %s\n", k.ID, key)
+		fmt.Println("The key is shown only once, keep it safe.")
+	case "list":
+		keys := s.List()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Created < keys[j].Created })
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tDEVICES\tURIS\tMETHODS\tEXPIRES\tRATE\tREVOKED")
+		for _, k := range keys {
+			exp := "never"
+			if k.Expires != 0 {
+				exp = time.Unix(k.Expires, 0).Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%t\n", k.ID, k.Name,
+				strings.Join(k.Scope.Devices, ","), strings.Join(k.Scope.URIs, ","),
+				strings.Join(k.Scope.Methods, ","), exp, k.Rate, k.Revoked)
+		}
+		w.Flush()
+	case "revoke":
+		if err := s.Revoke(*id); err != nil {
+			fmt.Fprintln(os.Stderr, "revoke key:", err)
+			return 1
+		}
+		if err := s.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "save store:", err)
+			return 1
+		}
+		fmt.Println("revoked:", *id)
+	default:
+		apiKeyUsage()
+		return 2
+	}
+	return 0
+}
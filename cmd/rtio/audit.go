@@ -0,0 +1,69 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mkrainbow/rtio/internal/audit"
+)
+
+func auditUsage() {
+	fmt.Fprintf(os.Stderr, `Usage of %s audit:
+
+  %s audit verify -file FILE [-prev HASH]
+`, os.Args[0], os.Args[0])
+}
+
+// runAudit handles 'rtio audit' subcommand, returns exit code.
+func runAudit(args []string) int {
+	if len(args) < 1 || args[0] != "verify" {
+		auditUsage()
+		return 2
+	}
+	fs := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	path := fs.String("file", "audit.jsonl", "Audit file, verified after its rotated files.")
+	prev := fs.String("prev", "", "Hash of the record before the oldest file, when older files removed.")
+	fs.Parse(args[1:])
+
+	// a broken file is reported, the next file is verified from its last
+	// good record, which a gap marker chains from
+	hash, total, code := *prev, 0, 0
+	for _, file := range audit.Files(*path) {
+		f, err := os.Open(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "open:", err)
+			return 1
+		}
+		last, n, err := audit.Verify(f, hash)
+		f.Close()
+		total += n
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			code = 1
+		}
+		if last != nil {
+			hash = last.Hash
+		}
+	}
+	fmt.Printf("records: %d\nlast:    %s\n", total, hash)
+	return code
+}
@@ -0,0 +1,105 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/registry"
+	"github.com/mkrainbow/rtio/pkg/logsettings"
+)
+
+func claimUsage() {
+	fmt.Fprintf(os.Stderr, `Usage of %s claim:
+
+  %s claim add    -claims FILE -batch BATCH [-token TOKEN] [-uses N] [-expire DURATION]
+  %s claim remove -claims FILE -batch BATCH
+  %s claim list   -claims FILE
+`, os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+}
+
+// runClaim handles 'rtio claim' subcommand, returns exit code.
+func runClaim(args []string) int {
+	if len(args) < 1 {
+		claimUsage()
+		return 2
+	}
+	fs := flag.NewFlagSet("claim "+args[0], flag.ExitOnError)
+	path := fs.String("claims", "claims.json", "Claim tokens file (json).")
+	batch := fs.String("batch", "", "Device batch of the claim token.")
+	token := fs.String("token", "", "Claim token, generated if empty.")
+	uses := fs.Int("uses", 0, "Devices enrolled by the token at most, 0 for unlimited.")
+	expire := fs.Duration("expire", 0, "Expiry of the token from now, such as 720h, 0 for never.")
+	fs.Parse(args[1:])
+	logsettings.Set("text", "warn")
+
+	c, err := registry.LoadClaims(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load claims:", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "add":
+		var expireAt time.Time
+		if *expire > 0 {
+			expireAt = time.Now().Add(*expire)
+		}
+		claimToken, err := c.Add(*batch, *token, *uses, expireAt)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "add claim:", err)
+			return 1
+		}
+		if err := c.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "save claims:", err)
+			return 1
+		}
+		fmt.Printf("batch: %s\ntoken: %s\n", *batch, claimToken)
+		fmt.Println("The token is shown only once, keep it safe.")
+	case "remove":
+		if err := c.Remove(*batch); err != nil {
+			fmt.Fprintln(os.Stderr, "remove claim:", err)
+			return 1
+		}
+		if err := c.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "save claims:", err)
+			return 1
+		}
+		fmt.Println("removed:", *batch)
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "BATCH\tUSED\tMAX\tEXPIRE\tCREATED")
+		for _, cl := range c.List() {
+			max := "-"
+			if cl.MaxUses > 0 {
+				max = fmt.Sprint(cl.MaxUses)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", cl.Batch, cl.Used, max, formatUnix(cl.Expire), formatUnix(cl.Created))
+		}
+		w.Flush()
+	default:
+		claimUsage()
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/registry"
+	"github.com/mkrainbow/rtio/pkg/logsettings"
+)
+
+func deviceUsage() {
+	fmt.Fprintf(os.Stderr, `Usage of %s device:
+
+  %s device add    -registry FILE [-id ID] [-secret SECRET] [-hash bcrypt|argon2id|scrypt]
+  %s device remove -registry FILE -id ID
+  %s device list   -registry FILE
+  %s device rotate -registry FILE -id ID [-secret SECRET] [-hash bcrypt|argon2id|scrypt]
+`, os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+}
+
+func formatUnix(sec int64) string {
+	if sec == 0 {
+		return "-"
+	}
+	return time.Unix(sec, 0).Format(time.RFC3339)
+}
+
+// runDevice handles 'rtio device' subcommand, returns exit code.
+func runDevice(args []string) int {
+	if len(args) < 1 {
+		deviceUsage()
+		return 2
+	}
+	fs := flag.NewFlagSet("device "+args[0], flag.ExitOnError)
+	path := fs.String("registry", "devices.json", "Device registry file, json or csv by extension.")
+	id := fs.String("id", "", "Device ID, generated by add if empty.")
+	secret := fs.String("secret", "", "Device secret, generated if empty.")
+	hash := fs.String("hash", registry.HashBcrypt, "Secret hash algorithm, bcrypt, argon2id or scrypt.")
+	fs.Parse(args[1:])
+	logsettings.Set("text", "warn")
+
+	r, err := registry.LoadRegistry(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load registry:", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "add":
+		deviceID, deviceSecret, err := r.Add(*id, *secret, *hash)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "add device:", err)
+			return 1
+		}
+		if err := r.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "save registry:", err)
+			return 1
+		}
+		fmt.Printf("id:     %s\nsecret: %s\n", deviceID, deviceSecret)
+		fmt.Println("The secret is shown only once, keep it safe.")
+	case "remove":
+		if err := r.Remove(*id); err != nil {
+			fmt.Fprintln(os.Stderr, "remove device:", err)
+			return 1
+		}
+		if err := r.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "save registry:", err)
+			return 1
+		}
+		fmt.Println("removed:", *id)
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCREATED\tROTATED")
+		for _, d := range r.List() {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", d.ID, formatUnix(d.Created), formatUnix(d.Rotated))
+		}
+		w.Flush()
+	case "rotate":
+		deviceSecret, err := r.Rotate(*id, *secret, *hash)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "rotate secret:", err)
+			return 1
+		}
+		if err := r.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "save registry:", err)
+			return 1
+		}
+		fmt.Printf("id:     %s\nsecret: %s\n", *id, deviceSecret)
+		fmt.Println("The secret is shown only once, keep it safe.")
+	default:
+		deviceUsage()
+		return 2
+	}
+	return 0
+}
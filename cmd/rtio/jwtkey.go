@@ -0,0 +1,95 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/httpaccess/server/httpgw"
+	"github.com/mkrainbow/rtio/pkg/logsettings"
+)
+
+func jwtKeyUsage() {
+	fmt.Fprintf(os.Stderr, `Usage of %s jwtkey:
+
+  %s jwtkey rotate -keys FILE [-prepublish DURATION] [-overlap DURATION]
+  %s jwtkey prune  -keys FILE
+  %s jwtkey list   -keys FILE
+`, os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+}
+
+// runJWTKey handles 'rtio jwtkey' subcommand, returns exit code.
+func runJWTKey(args []string) int {
+	if len(args) < 1 {
+		jwtKeyUsage()
+		return 2
+	}
+	fs := flag.NewFlagSet("jwtkey "+args[0], flag.ExitOnError)
+	path := fs.String("keys", "jwtkeys.json", "JWT issuer key store file.")
+	prepublish := fs.Duration("prepublish", 0, "Delay of the new key signing, published in the JWKS meanwhile, such as 10m, at least the JWKS refresh interval of verifiers.")
+	overlap := fs.Duration("overlap", 0, "Keys in use stay published for it after the new key signs, at least the longest JWT lifetime, jwtissuer.ttl.max if 0.")
+	ttlMax := fs.Duration("ttl.max", 24*time.Hour, "Longest JWT lifetime, as jwtissuer.ttl.max, the default of -overlap.")
+	fs.Parse(args[1:])
+	logsettings.Set("text", "warn")
+
+	s, err := httpgw.LoadIssuerKeyStore(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load keys:", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "rotate":
+		if *overlap <= 0 {
+			*overlap = *ttlMax
+		}
+		k, err := s.Rotate(*prepublish, *overlap)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "rotate key:", err)
+			return 1
+		}
+		if err := s.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "save keys:", err)
+			return 1
+		}
+		fmt.Printf("kid:       %s\nactivates: %s\n", k.Kid, formatUnix(k.Activates))
+	case "prune":
+		n := s.Prune()
+		if err := s.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "save keys:", err)
+			return 1
+		}
+		fmt.Println("pruned:", n)
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KID\tCREATED\tACTIVATES\tEXPIRES")
+		for _, k := range s.List() {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", k.Kid, formatUnix(k.Created), formatUnix(k.Activates), formatUnix(k.Expires))
+		}
+		w.Flush()
+	default:
+		jwtKeyUsage()
+		return 2
+	}
+	return 0
+}
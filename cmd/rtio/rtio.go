@@ -28,13 +28,19 @@ import (
 	"sync"
 	"syscall"
 	"text/template"
+	"time"
 
+	"github.com/mkrainbow/rtio/internal/admin"
+	"github.com/mkrainbow/rtio/internal/audit"
 	"github.com/mkrainbow/rtio/internal/devicehub/server/apprpc"
 	"github.com/mkrainbow/rtio/internal/devicehub/server/backendconn"
 	"github.com/mkrainbow/rtio/internal/devicehub/server/configer"
 	"github.com/mkrainbow/rtio/internal/devicehub/server/devicetcp"
 	"github.com/mkrainbow/rtio/internal/httpaccess/server/httpgw"
+	"github.com/mkrainbow/rtio/internal/upgrade"
 	"github.com/mkrainbow/rtio/pkg/config"
+	"github.com/mkrainbow/rtio/pkg/drain"
+	"github.com/mkrainbow/rtio/pkg/health"
 	"github.com/mkrainbow/rtio/pkg/logsettings"
 
 	"github.com/google/gops/agent"
@@ -42,15 +48,60 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		os.Exit(runAPIKey(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "device" {
+		os.Exit(runDevice(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "claim" {
+		os.Exit(runClaim(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "jwtkey" {
+		os.Exit(runJWTKey(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		os.Exit(runAudit(os.Args[2:]))
+	}
+
 	tcpAddr := flag.String("deviceaccess.addr", "0.0.0.0:17017", "Address for device conntection.")
 	httpAddr := flag.String("httpaccess.addr", "0.0.0.0:17917", "Address for http conntection.")
 	rpcAddr := flag.String("backend.rpc.addr", "0.0.0.0:17018", "Address for app-server conntection (optional).")
+	adminAddr := flag.String("admin.addr", "0.0.0.0:17117", "Address for admin endpoints /metrics, /healthz and /readyz, empty to disable.")
+	adminToken := flag.String("admin.token", "", "Bearer token of admin endpoints changing state, such as /jwt/revocations, which are served on a loopback admin.addr only if empty.")
 
 	logFormat := flag.String("log.format", "text", "Log format, text or json.")
 	logLevel := flag.String("log.level", "warn", "Log level, debug, info, warn, error.")
 	deviceVerifier := flag.String("backend.deviceverifier", "http://localhost:17217/deviceverifier", "Service address device verifier .")
 	hubConfiger := flag.String("backend.hubconfiger", "http://localhost:17317/hubconfiger", "Service address for hub config.")
 
+	deviceServiceTimeout := flag.Int("deviceservice.timeout", 5000, "Timeout in ms of a request to device services.")
+	deviceServiceCA := flag.String("deviceservice.tls.ca", "", "CA for grpcs:// device services, the system CAs if empty.")
+
+	deviceRegistry := flag.String("device.registry", "", "Device registry file or directory (json or csv) verifying devices instead of backend.deviceverifier, managed by 'device' subcommand.")
+	deviceClaims := flag.String("device.claims", "", "Claim tokens file (json) enrolling devices into device.registry, managed by 'claim' subcommand.")
+	deviceClaimsHash := flag.String("device.claims.hash", "bcrypt", "Secret hash algorithm of enrolled devices, bcrypt, argon2id or scrypt.")
+	deviceProvisioner := flag.String("backend.deviceprovisioner", "", "Service address of device provisioner enrolling devices by claim tokens, instead of device.claims.")
+	provisionerTimeout := flag.Int("deviceprovisioner.timeout", 5000, "Timeout in ms of a request to the device provisioner.")
+	enrollInsecure := flag.Bool("deviceenroll.insecure", false, "Allow enrollment over non-TLS, such as behind a TLS terminating proxy, credentials are sent in plain.")
+	verifierChain := flag.String("deviceverifier.chain", "", "Device verifiers tried in order, separated by commas, 'registry' or http(s):// and grpc(s):// URLs. Empty for device.registry if set, otherwise backend.deviceverifier.")
+	verifierTimeout := flag.Int("deviceverifier.timeout", 5000, "Timeout in ms of a request to device verifiers.")
+	verifierCA := flag.String("deviceverifier.tls.ca", "", "CA for https:// and grpcs:// device verifiers, the system CAs if empty.")
+	verifierCacheTTL := flag.Int("deviceverifier.cache.ttl", 0, "Seconds to cache passed device verifications, removed devices and old secrets pass until it expires, 0 to disable.")
+	verifierNegativeTTL := flag.Int("deviceverifier.cache.negativettl", 10, "Seconds to cache rejected device verifications, 0 to disable.")
+	verifierFailures := flag.Int("deviceverifier.breaker.failures", 5, "Consecutive failures opening the circuit of a device verifier URL, 0 to disable.")
+	verifierCooldown := flag.Int("deviceverifier.breaker.cooldown", 10, "Seconds the circuit of a device verifier stays open before a retry.")
+	verifierFailOpen := flag.Bool("deviceverifier.failopen", false, "Pass devices when the device verifiers fail or their circuits are open, instead of rejecting them.")
+	lockoutFailures := flag.Int("deviceverify.lockout.failures", 5, "Consecutive verify failures of a device ID from an IP locking it out there, 0 to disable.")
+	lockoutIPFailures := flag.Int("deviceverify.lockout.ip.failures", 50, "Consecutive verify failures from an IP locking it out, 0 to disable.")
+	lockoutBase := flag.Int("deviceverify.lockout.base", 10, "Seconds of the first lockout, doubled by each further failure.")
+	lockoutMax := flag.Int("deviceverify.lockout.max", 3600, "Upper bound in seconds of lockouts, failures are forgotten after it.")
+	verifyConcurrency := flag.Int("deviceverify.concurrency", 256, "Concurrent device verifies, further ones wait in the queue, 0 for unlimited.")
+	verifyQueue := flag.Int("deviceverify.queue", 4096, "Device verifies waiting in the queue, further ones are told to retry later.")
+	verifyQueueTimeout := flag.Int("deviceverify.queue.timeout", 5000, "Milliseconds a device verify waits in the queue before told to retry later.")
+	unverifiedMax := flag.Int("deviceaccess.unverified.max", 20000, "Accepted connections not verified yet, further ones are shed with retry-after, 0 for unlimited.")
+	acceptRate := flag.Int("deviceaccess.accept.rate", 0, "Connections accepted per second, further ones are shed with retry-after, 0 for unlimited.")
+	retryAfter := flag.Int("deviceaccess.retryafter", 10, "Seconds of the retry-after hint to shed devices, jittered up to twice.")
 	disableDeviceVerify := flag.Bool("disable.deviceverify", false, "Disable the backend device verify config service.")
 	disableHubConfiger := flag.Bool("disable.hubconfiger", false, "Disable the backend hub config service.")
 
@@ -58,12 +109,59 @@ func main() {
 	hubCertFile := flag.String("hub.tls.certfile", "", "TLS cert file for device hub.")
 	hubKeyFile := flag.String("hub.tls.keyfile", "", "TLS key file for device hub.")
 
+	enableRPCTLS := flag.Bool("enable.backend.rpc.tls", false, "Enable TLS on the backend RPC.")
+	rpcCertFile := flag.String("backend.rpc.tls.certfile", "", "TLS cert file for the backend RPC.")
+	rpcKeyFile := flag.String("backend.rpc.tls.keyfile", "", "TLS key file for the backend RPC.")
+	rpcClientCA := flag.String("backend.rpc.tls.clientca", "", "CA file verifying client certs of backend RPC callers (mTLS), empty to disable.")
+	rpcCA := flag.String("backend.rpc.tls.ca", "", "CA file verifying the backend RPC cert for the gateway and cluster peers, system CAs if empty.")
+	rpcServerName := flag.String("backend.rpc.tls.servername", "", "Server name verified in the backend RPC cert for the gateway and cluster peers.")
+	rpcCallers := flag.String("backend.rpc.callers", "", "Callers file (json) with tokens, client cert names and permissions, enables backend RPC authentication.")
+	rpcToken := flag.String("backend.rpc.token", "", "Bearer token of the gateway and cluster peers calling the backend RPC.")
+
 	enableHTTPS := flag.Bool("enable.https", false, "Enable https gateway.")
 	httpsCertFile := flag.String("https.certfile", "", "TLS cert file.")
 	httpsKeyFile := flag.String("https.keyfile", "", "TLS key file.")
 
 	enableJWT := flag.Bool("enable.jwt", false, "Enable the JWT validation.")
 	ed25519 := flag.String("jwt.ed25519", "", "The public key (pem) for JWT.")
+	jwks := flag.String("jwt.jwks", "", "JWKS file path or URL, keys for RS256, ES256 and EdDSA selected by kid.")
+	jwksRefresh := flag.Int("jwt.jwks.refresh", 300, "JWKS refresh interval in seconds.")
+	jwtIssuer := flag.String("jwt.issuer", "", "Expected JWT issuer (iss), not validated if empty.")
+	jwtAudience := flag.String("jwt.audience", "", "Expected JWT audience (aud), not validated if empty.")
+	jwtLeeway := flag.Int("jwt.leeway", 10, "Clock skew in seconds allowed when validating JWT exp, nbf and iat.")
+	jwtRevocations := flag.String("jwt.revocations", "", "JWT revocation list file (json) by jti or subject, updated by the admin API, in memory only if empty.")
+	introspectionURL := flag.String("jwt.introspection.url", "", "RFC 7662 token introspection endpoint checking JWTs after validation, disabled if empty.")
+	introspectionClientID := flag.String("jwt.introspection.clientid", "", "Client ID of HTTP Basic auth to the introspection endpoint.")
+	introspectionClientSecret := flag.String("jwt.introspection.clientsecret", "", "Client secret of HTTP Basic auth to the introspection endpoint.")
+	introspectionTimeout := flag.Int("jwt.introspection.timeout", 5000, "Timeout in ms of a request to the introspection endpoint.")
+	introspectionCacheTTL := flag.Int("jwt.introspection.cache.ttl", 60, "Seconds to cache introspection results, not beyond the token exp, 0 to disable.")
+
+	enableJWTIssuer := flag.Bool("enable.jwtissuer", false, "Enable the JWT issuer on the gateway, issuing tokens to API key callers.")
+	jwtIssuerKeys := flag.String("jwtissuer.keys", "jwtkeys.json", "JWT issuer signing key store, managed by 'jwtkey' subcommand, a key is generated if empty.")
+	jwtIssuerTTL := flag.Int("jwtissuer.ttl", 3600, "Lifetime in seconds of issued JWTs, when the request sets no expires_in.")
+	jwtIssuerTTLMax := flag.Int("jwtissuer.ttl.max", 86400, "Upper bound in seconds of issued JWT lifetimes.")
+
+	enableAPIKey := flag.Bool("enable.apikey", false, "Enable API key authentication for http callers.")
+	apiKeyStore := flag.String("apikey.store", "apikeys.json", "API key store file, managed by 'apikey' subcommand.")
+	policyFile := flag.String("httpaccess.policy", "", "Policy file (json) for device, URI and method access of http callers.")
+
+	shutdownGrace := flag.Int("shutdown.grace", 15, "Seconds to drain device sessions and requests in flight on SIGTERM, 0 to stop at once.")
+	shutdownDelay := flag.Int("shutdown.delay", 5, "Seconds reporting not ready on SIGTERM before draining, for load balancers to stop sending new work.")
+	clusterNode := flag.String("cluster.node", "", "Address of this node's backend RPC reachable by peers, enables cluster mode if not empty.")
+	clusterPeers := flag.String("cluster.peers", "", "Backend RPC addresses of the cluster nodes, separated by commas.")
+	clusterToken := flag.String("cluster.token", "", "Token shared by the cluster nodes, required in cluster mode.")
+	upgradeSessions := flag.Bool("upgrade.sessions", false, "Hand device sessions (no TLS) over to the new binary on SIGUSR2 upgrade, instead of draining them.")
+
+	copostTimeout := flag.Int("copost.timeout", 10000, "Milliseconds to wait for the device response of copost, when the request sets no timeout.")
+	obgetTimeout := flag.Int("obget.timeout", 20000, "Milliseconds to wait for the device to establish obget, when the request sets no timeout.")
+	timeoutMin := flag.Int("request.timeout.min", 100, "Lower bound in milliseconds of request timeouts.")
+	timeoutMax := flag.Int("request.timeout.max", 120000, "Upper bound in milliseconds of request timeouts, at most 120000.")
+	streamInFlight := flag.Int("copost.stream.inflight", 64, "CoPosts in flight per CoPostStream of the backend RPC, further requests wait.")
+	timeoutURIs := flag.String("request.timeout.uris", "", "File (json) of default copost and obget timeouts by URI.")
+	idempotencyWindow := flag.Int("copost.idempotency.window", 0, "Seconds to keep CoPost results for retries with the same id or Idempotency-Key, 0 to disable.")
+	auditFile := flag.String("audit.file", "", "Audit log file (json lines, hash chained) of copost and obget requests, disabled if empty.")
+	auditMaxSize := flag.Int("audit.file.maxsize", 100, "Megabytes of the audit file before it is rotated, 0 to never rotate.")
+	auditMaxBackups := flag.Int("audit.file.maxbackups", 0, "Rotated audit files kept, oldest removed, 0 to keep all.")
 
 	completionBash := flag.Bool("completion-bash", false, "Print bash autocomplete script.")
 	printVersion := flag.Bool("version", false, "Print version as JSON.")
@@ -86,19 +184,92 @@ func main() {
 	config.StringKV.Set("backend.deviceverifier", *deviceVerifier)
 	config.StringKV.Set("backend.hubconfiger", *hubConfiger)
 	config.BoolKV.Set("disable.deviceverify", *disableDeviceVerify)
+	config.IntKV.Set("deviceverify.lockout.failures", *lockoutFailures)
+	config.IntKV.Set("deviceverify.lockout.ip.failures", *lockoutIPFailures)
+	config.IntKV.Set("deviceverify.lockout.base", *lockoutBase)
+	config.IntKV.Set("deviceverify.lockout.max", *lockoutMax)
+	config.IntKV.Set("deviceverify.concurrency", *verifyConcurrency)
+	config.IntKV.Set("deviceverify.queue", *verifyQueue)
+	config.IntKV.Set("deviceverify.queue.timeout", *verifyQueueTimeout)
+	config.IntKV.Set("deviceaccess.unverified.max", *unverifiedMax)
+	config.IntKV.Set("deviceaccess.accept.rate", *acceptRate)
+	config.IntKV.Set("deviceaccess.retryafter", *retryAfter)
+	config.StringKV.Set("device.registry", *deviceRegistry)
+	config.StringKV.Set("device.claims", *deviceClaims)
+	config.StringKV.Set("device.claims.hash", *deviceClaimsHash)
+	config.StringKV.Set("backend.deviceprovisioner", *deviceProvisioner)
+	config.IntKV.Set("deviceprovisioner.timeout", *provisionerTimeout)
+	config.BoolKV.Set("deviceenroll.insecure", *enrollInsecure)
+	config.StringKV.Set("deviceverifier.chain", *verifierChain)
+	config.IntKV.Set("deviceverifier.timeout", *verifierTimeout)
+	config.StringKV.Set("deviceverifier.tls.ca", *verifierCA)
+	config.IntKV.Set("deviceverifier.cache.ttl", *verifierCacheTTL)
+	config.IntKV.Set("deviceverifier.cache.negativettl", *verifierNegativeTTL)
+	config.IntKV.Set("deviceverifier.breaker.failures", *verifierFailures)
+	config.IntKV.Set("deviceverifier.breaker.cooldown", *verifierCooldown)
+	config.BoolKV.Set("deviceverifier.failopen", *verifierFailOpen)
+	config.IntKV.Set("deviceservice.timeout", *deviceServiceTimeout)
+	config.StringKV.Set("audit.file", *auditFile)
+	config.IntKV.Set("audit.file.maxsize", *auditMaxSize)
+	config.IntKV.Set("audit.file.maxbackups", *auditMaxBackups)
+	config.StringKV.Set("deviceservice.tls.ca", *deviceServiceCA)
 	config.BoolKV.Set("disable.hubconfiger", *disableHubConfiger)
+	config.StringKV.Set("admin.addr", *adminAddr)
+	config.StringKV.Set("admin.token", *adminToken)
+	config.StringKV.Set("httpaccess.policy", *policyFile)
+	config.BoolKV.Set("enable.apikey", *enableAPIKey)
+	config.StringKV.Set("apikey.store", *apiKeyStore)
+	config.BoolKV.Set("enable.jwtissuer", *enableJWTIssuer)
+	config.StringKV.Set("jwtissuer.keys", *jwtIssuerKeys)
+	config.IntKV.Set("jwtissuer.ttl", *jwtIssuerTTL)
+	config.IntKV.Set("jwtissuer.ttl.max", *jwtIssuerTTLMax)
+	config.StringKV.Set("jwt.issuer", *jwtIssuer)
+	config.StringKV.Set("jwt.audience", *jwtAudience)
+	config.IntKV.Set("copost.idempotency.window", *idempotencyWindow)
+	config.IntKV.Set("copost.timeout", *copostTimeout)
+	config.IntKV.Set("obget.timeout", *obgetTimeout)
+	config.IntKV.Set("request.timeout.min", *timeoutMin)
+	config.IntKV.Set("request.timeout.max", *timeoutMax)
+	config.StringKV.Set("request.timeout.uris", *timeoutURIs)
+	config.IntKV.Set("copost.stream.inflight", *streamInFlight)
+	config.StringKV.Set("cluster.node", *clusterNode)
+	config.StringKV.Set("cluster.peers", *clusterPeers)
+	config.StringKV.Set("cluster.token", *clusterToken)
+	config.BoolKV.Set("enable.backend.rpc.tls", *enableRPCTLS)
+	config.StringKV.Set("backend.rpc.tls.certfile", *rpcCertFile)
+	config.StringKV.Set("backend.rpc.tls.keyfile", *rpcKeyFile)
+	config.StringKV.Set("backend.rpc.tls.clientca", *rpcClientCA)
+	config.StringKV.Set("backend.rpc.tls.ca", *rpcCA)
+	config.StringKV.Set("backend.rpc.tls.servername", *rpcServerName)
+	config.StringKV.Set("backend.rpc.callers", *rpcCallers)
+	config.StringKV.Set("backend.rpc.token", *rpcToken)
 
 	// set log format and level
 	logsettings.Set(*logFormat, *logLevel)
 
+	// inherit listeners when started by an upgrade
+	if err := upgrade.Init(); err != nil {
+		log.Error().Err(err).Msg("upgrade init error")
+		return
+	}
+
 	// enable jwt
 	if *enableJWT {
-		if *ed25519 == "" {
-			log.Error().Msg("JWT public key is empty")
+		if *ed25519 == "" && *jwks == "" && !*enableJWTIssuer {
+			log.Error().Msg("JWT public key and JWKS are empty")
 			return
 		}
 		config.BoolKV.Set("enable.jwt", true)
 		config.StringKV.Set("jwt.ed25519", *ed25519)
+		config.StringKV.Set("jwt.jwks", *jwks)
+		config.IntKV.Set("jwt.jwks.refresh", *jwksRefresh)
+		config.IntKV.Set("jwt.leeway", *jwtLeeway)
+		config.StringKV.Set("jwt.revocations", *jwtRevocations)
+		config.StringKV.Set("jwt.introspection.url", *introspectionURL)
+		config.StringKV.Set("jwt.introspection.clientid", *introspectionClientID)
+		config.StringKV.Set("jwt.introspection.clientsecret", *introspectionClientSecret)
+		config.IntKV.Set("jwt.introspection.timeout", *introspectionTimeout)
+		config.IntKV.Set("jwt.introspection.cache.ttl", *introspectionCacheTTL)
 	}
 
 	// show configs
@@ -111,11 +282,75 @@ func main() {
 	}
 	defer agent.Close()
 
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// admin outlives the servers, probes see not ready during shutdown
+	adminCtx, adminCancel := context.WithCancel(context.Background())
+	defer adminCancel()
+
+	upgradeChan := make(chan os.Signal, 1)
+	signal.Notify(upgradeChan, syscall.SIGUSR2)
+	defer signal.Stop(upgradeChan)
+	upgraded := make(chan struct{})
+	go func() {
+		for range upgradeChan {
+			log.Info().Bool("sessions", *upgradeSessions).Msg("rtio upgrading")
+			if err := upgrade.Upgrade(ctx, *upgradeSessions); err != nil {
+				log.Error().Err(err).Msg("upgrade failed, keep serving")
+				continue
+			}
+			close(upgraded)
+			return
+		}
+	}()
+
+	go func() {
+		delay := *shutdownDelay
+		select {
+		case <-sigCtx.Done():
+		case <-upgraded:
+			// probes are answered by the new process on the same listener
+			adminCancel()
+			delay = 0
+		}
+		stop() // a second signal terminates at once
+		log.Info().Int("delay", delay).Int("grace", *shutdownGrace).Msg("rtio shutting down")
+		// report not ready before draining
+		health.SetShuttingDown()
+		if delay > 0 {
+			time.Sleep(time.Duration(delay) * time.Second)
+		}
+		if *shutdownGrace > 0 {
+			graceCtx, graceCancel := context.WithTimeout(context.Background(), time.Duration(*shutdownGrace)*time.Second)
+			drain.Drain(graceCtx)
+			graceCancel()
+		}
+		cancel()
+	}()
 	log.Info().Msg("rtio starting ...")
 
-	backendconn.InitBackendConnn()
+	adminWait := &sync.WaitGroup{}
+	if *adminAddr != "" {
+		if err := admin.InitAdminServer(adminCtx, *adminAddr, adminWait); err != nil {
+			log.Error().Err(err).Msg("Init Admin Server error")
+			return
+		}
+	}
+
+	// records until the servers stopped
+	auditCtx, auditCancel := context.WithCancel(context.Background())
+	defer auditCancel()
+	if err := audit.Init(auditCtx); err != nil {
+		log.Error().Err(err).Msg("Init audit log error")
+		return
+	}
+
+	if err := backendconn.InitBackendConnn(ctx); err != nil {
+		log.Error().Err(err).Msg("Init backend error")
+		return
+	}
 
 	wait := &sync.WaitGroup{}
 	sessionMap := &devicetcp.SessionMap{}
@@ -154,18 +389,33 @@ func main() {
 		}
 	}
 
+	// take over sessions from the old process
+	go func() {
+		if err := upgrade.Ready(ctx); err != nil {
+			log.Error().Err(err).Msg("upgrade ready error")
+		}
+	}()
+
 	if !*disableHubConfiger {
 		configer.HubConfigerInit(ctx, wait)
 	}
 
 	log.Debug().Msg("rtio wait for subroutes")
 	wait.Wait()
+	auditCancel()
+	adminCancel()
+	adminWait.Wait()
 	log.Info().Msg("rtio stoped")
 }
 func printUsage() {
 	fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n\n", os.Args[0])
 	fmt.Fprintln(flag.CommandLine.Output(), `  Generate a bash completion script with '-completion-bash'.Source it directly in your shell using:
     source <(`+os.Args[0]+` -completion-bash)`)
+	fmt.Fprintln(flag.CommandLine.Output(), `  Manage API keys with '`+os.Args[0]+` apikey create|list|revoke'.`)
+	fmt.Fprintln(flag.CommandLine.Output(), `  Manage the device registry with '`+os.Args[0]+` device add|remove|list|rotate'.`)
+	fmt.Fprintln(flag.CommandLine.Output(), `  Manage the claim tokens of enrollment with '`+os.Args[0]+` claim add|remove|list'.`)
+	fmt.Fprintln(flag.CommandLine.Output(), `  Manage the signing keys of the JWT issuer with '`+os.Args[0]+` jwtkey rotate|prune|list'.`)
+	fmt.Fprintln(flag.CommandLine.Output(), `  Verify the hash chain of audit files with '`+os.Args[0]+` audit verify'.`)
 	fmt.Fprintln(flag.CommandLine.Output())
 	flag.PrintDefaults()
 }
@@ -23,9 +23,12 @@ import (
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -36,6 +39,7 @@ const (
 	RTIOCodeOk                  = "OK"
 	RTIOCodeBadRequest          = "BAD_REQUEST"
 	RTIOCodeMethodNotAllowed    = "METHOD_NOT_ALLOWED"
+	RTIOCodeContinue            = "CONTINUE"
 )
 
 var (
@@ -214,6 +218,50 @@ func handlerDD(w http.ResponseWriter, r *http.Request) {
 	httpWriteRTIOResp(w, resp)
 }
 
+// handlerOB serves an observation by the device as server-sent events, the
+// first event establishes it.
+func handlerOB(w http.ResponseWriter, r *http.Request) {
+
+	req, err := httpGetRTIOReq(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Error().Err(err).Msg("Failed to get req")
+		return
+	}
+	resp := &RTIOResp{
+		ID:   req.ID,
+		Code: RTIOCodeContinue,
+	}
+	if req.Method != "obget" {
+		resp.Code = RTIOCodeMethodNotAllowed
+		httpWriteRTIOResp(w, resp)
+		return
+	}
+	log.Info().Uint32("id", req.ID).Str("deviceid", req.DeviceID).Msg("observation established")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for i := 0; i < 10; i++ {
+		if i > 0 {
+			select {
+			case <-r.Context().Done():
+				log.Info().Uint32("id", req.ID).Msg("observation canceled")
+				return
+			case <-t.C:
+			}
+		}
+		buf := []byte("deviceservice: notify " + strconv.Itoa(i))
+		resp.Data = base64.StdEncoding.EncodeToString(buf)
+		event, _ := json.Marshal(resp)
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", event); err != nil {
+			return
+		}
+		w.(http.Flusher).Flush()
+	}
+	log.Info().Uint32("id", req.ID).Msg("observation terminated")
+}
+
 func main() {
 	httpAddr := flag.String("http.addr", "0.0.0.0:17517", "address for http conntection")
 	flag.Parse()
@@ -224,6 +272,7 @@ func main() {
 
 	http.HandleFunc("/deviceservice/aa/bb", handlerBB)
 	http.HandleFunc("/deviceservice/aa/cc", handlerCC)
+	http.HandleFunc("/deviceservice/aa/ob", handlerOB)
 	// http.HandleFunc("/deviceservice/aa/dd", handlerDD)
 
 	err := http.ListenAndServe(*httpAddr, nil)
@@ -131,6 +131,7 @@ func handler(w http.ResponseWriter, r *http.Request) {
 		"deviceservicemap": {
 			"/aa/bb": "http://localhost:17517/deviceservice/aa/bb",
 			"/aa/cc": "http://localhost:17517/deviceservice/aa/cc",
+			"/aa/ob": "http://localhost:17517/deviceservice/aa/ob",
 			"/aa/dd": "http://localhost:17518/deviceservice/aa/dd" 
 		}  
 	}`
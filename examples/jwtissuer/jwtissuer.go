@@ -86,8 +86,8 @@ func verifyRTIOReq(req *RTIOReq) error {
 		log.Error().Err(ErrHTTPJSONInvalidMethod).Str("method", req.Method).Msg("method error")
 		return ErrHTTPJSONInvalidMethod
 	}
-	if len(req.DeviceID) > 604800 {
-		return ErrHTTPJSONInvalidDeviceID
+	if req.Expires > 604800 {
+		return ErrHTTPJSONInvalidExpires
 	}
 	if len(req.DeviceID) < RTIODeviceIDLenMin ||
 		len(req.DeviceID) > RTIODeviceIDLenMax {
@@ -141,6 +141,8 @@ func (s *rtioHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if err == ErrHTTPJSONInvalidMethod {
 			resp.Code = RTIOCodeMethodNotAllowed
+		} else {
+			resp.Code = RTIOCodeBadRequest
 		}
 		log.Error().Err(err).Msg("Failed to verifyJSONReq")
 		httpWriteRTIOResp(w, resp)
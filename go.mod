@@ -8,6 +8,7 @@ require (
 	github.com/google/gops v0.3.27
 	github.com/mkrainbow/rtio-device-sdk-go v0.8.0
 	github.com/rs/zerolog v1.28.0
+	golang.org/x/crypto v0.31.0
 	google.golang.org/grpc v1.65.0
 	google.golang.org/protobuf v1.34.1
 	gotest.tools v2.2.0+incompatible
@@ -0,0 +1,165 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+// Package admin serves operational endpoints, such as metrics and health, on an admin port.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/mkrainbow/rtio/internal/upgrade"
+	"github.com/mkrainbow/rtio/pkg/config"
+	"github.com/mkrainbow/rtio/pkg/health"
+	"github.com/mkrainbow/rtio/pkg/metrics"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	MetricsPath   = "/metrics"
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// serveLiveness reports the process is able to serve http.
+func serveLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// readinessHandler reports 503 when any check fails, with one line for each check.
+func readinessHandler(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ready, results := checker.Check()
+		var sb strings.Builder
+		for _, result := range results {
+			if result.Err != nil {
+				fmt.Fprintf(&sb, "[-]%s failed: %s\n", result.Name, result.Err)
+			} else {
+				fmt.Fprintf(&sb, "[+]%s ok\n", result.Name)
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			sb.WriteString("not ready\n")
+		} else {
+			sb.WriteString("ok\n")
+		}
+		w.Write([]byte(sb.String()))
+	}
+}
+
+// handlers are the endpoints registered by other packages, such as after the
+// admin server started.
+var handlers = http.NewServeMux()
+
+// Handle registers an admin endpoint, the admin port should not be public.
+func Handle(pattern string, handler http.Handler) {
+	handlers.Handle(pattern, handler)
+}
+
+// loopback reports whether addr listens on loopback only, or is empty with
+// the admin server disabled.
+func loopback(addr string) bool {
+	if addr == "" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// HandleAuthorized registers an admin endpoint changing state, which needs
+// the bearer token admin.token. Without the token, it is registered only if
+// admin.addr is loopback, false if not registered.
+func HandleAuthorized(pattern string, handler http.Handler) bool {
+	token := config.StringKV.GetWithDefault("admin.token", "")
+	if token == "" {
+		if !loopback(config.StringKV.GetWithDefault("admin.addr", "")) {
+			return false
+		}
+		handlers.Handle(pattern, handler)
+		return true
+	}
+	handlers.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			log.Warn().Str("path", r.URL.Path).Str("remote", r.RemoteAddr).Msg("admin unauthorized")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	return true
+}
+
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, metrics.Handler())
+	mux.HandleFunc(LivenessPath, serveLiveness)
+	mux.HandleFunc(ReadinessPath, readinessHandler(health.Default))
+	mux.Handle("/", handlers)
+	return mux
+}
+
+func InitAdminServer(ctx context.Context, addr string, wait *sync.WaitGroup) error {
+
+	listener, err := upgrade.Listen("admin", addr)
+	if err != nil {
+		log.Error().Err(err).Msg("admin listen failed")
+		return err
+	}
+	adminServer := &http.Server{
+		Handler: newMux(),
+	}
+	log.Info().Str("adminaddr", addr).Msg("admin started")
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		err := adminServer.Serve(listener)
+		if err != nil {
+			if err == http.ErrServerClosed {
+				log.Info().Msg("admin http closed")
+				return
+			}
+			log.Error().Err(err).Msg("admin serve failed")
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		log.Info().Msg("admin ctx down")
+		adminServer.Shutdown(context.Background())
+	}()
+
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mkrainbow/rtio/pkg/config"
+	"github.com/mkrainbow/rtio/pkg/health"
+
+	"gotest.tools/assert"
+)
+
+func TestReadiness(t *testing.T) {
+
+	checker := health.NewChecker()
+	handler := readinessHandler(checker)
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, ReadinessPath, nil))
+		return w
+	}
+
+	w := get()
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, w.Body.String(), "ok\n")
+
+	var listenerErr error
+	checker.Register("deviceaccess", func() error { return listenerErr })
+	checker.Register("hubconfiger", func() error { return nil })
+	w = get()
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, w.Body.String(), "[+]deviceaccess ok\n[+]hubconfiger ok\nok\n")
+
+	listenerErr = errors.New("ErrListenerNotAccepting")
+	w = get()
+	assert.Equal(t, w.Code, http.StatusServiceUnavailable)
+	assert.Equal(t, w.Body.String(), "[-]deviceaccess failed: ErrListenerNotAccepting\n[+]hubconfiger ok\nnot ready\n")
+
+	listenerErr = nil
+	checker.SetShuttingDown()
+	w = get()
+	assert.Equal(t, w.Code, http.StatusServiceUnavailable)
+	assert.Equal(t, w.Body.String(), "[+]deviceaccess ok\n[+]hubconfiger ok\n[-]shutdown failed: ErrShuttingDown\nnot ready\n")
+
+	w = httptest.NewRecorder()
+	serveLiveness(w, httptest.NewRequest(http.MethodGet, LivenessPath, nil))
+	assert.Equal(t, w.Code, http.StatusOK)
+}
+
+func TestHandle(t *testing.T) {
+
+	mux := newMux()
+	Handle("/test/registered", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test/registered", nil))
+	assert.Equal(t, w.Code, http.StatusAccepted)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test/unknown", nil))
+	assert.Equal(t, w.Code, http.StatusNotFound)
+}
+
+func TestHandleAuthorized(t *testing.T) {
+
+	mux := newMux()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	serve := func(path, token string) int {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// without a token, only a loopback admin server serves it
+	config.StringKV.Set("admin.addr", "0.0.0.0:17317")
+	defer config.StringKV.Set("admin.addr", "")
+	assert.Equal(t, HandleAuthorized("/test/public", ok), false)
+	assert.Equal(t, serve("/test/public", ""), http.StatusNotFound)
+	config.StringKV.Set("admin.addr", "127.0.0.1:17317")
+	assert.Equal(t, HandleAuthorized("/test/loopback", ok), true)
+	assert.Equal(t, serve("/test/loopback", ""), http.StatusAccepted)
+
+	config.StringKV.Set("admin.token", "secret")
+	defer config.StringKV.Set("admin.token", "")
+	assert.Equal(t, HandleAuthorized("/test/token", ok), true)
+	assert.Equal(t, serve("/test/token", ""), http.StatusUnauthorized)
+	assert.Equal(t, serve("/test/token", "wrong"), http.StatusUnauthorized)
+	assert.Equal(t, serve("/test/token", "secret"), http.StatusAccepted)
+
+	assert.Equal(t, loopback(""), true)
+	assert.Equal(t, loopback("localhost:17317"), true)
+	assert.Equal(t, loopback("[::1]:17317"), true)
+	assert.Equal(t, loopback(":17317"), false)
+}
@@ -0,0 +1,306 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+// Package audit records the commands sent to devices, and the requests by
+// devices, in an append-only log. Each record is chained to the previous one
+// by its SHA-256 hash, so a record altered, removed or inserted is detected
+// by Verify.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/config"
+	"github.com/mkrainbow/rtio/pkg/metrics"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Sources of records.
+const (
+	SourceRPC    = "apprpc" // AccessService of the hub
+	SourceHTTP   = "httpgw" // HTTP gateway
+	SourceDevice = "device" // requests by devices to device services
+	SourceAudit  = "audit"  // resume markers of the logger
+)
+
+// Resume markers, the first record of a logger resuming a chain. A gap marker
+// chains from the last good record before a torn or altered tail.
+const (
+	MethodResume = "resume"
+	CodeResumed  = "OK"
+	CodeGap      = "GAP"
+)
+
+var (
+	ErrChainBroken = errors.New("ErrAuditChainBroken")
+	ErrRecord      = errors.New("ErrAuditRecord")
+
+	metricRecords = metrics.NewCounterVec("rtio_audit_records_total", "Audit records by source.", "source")
+	metricErrors  = metrics.NewCounter("rtio_audit_errors_total", "Audit records failed to write, lost.")
+)
+
+const hashField = `,"hash":"`
+
+// Record is an audit record. Time, Seq, Prev and Hash are set by the logger,
+// the payload is recorded by its hash and size only.
+type Record struct {
+	Time          time.Time `json:"time"`
+	Seq           uint64    `json:"seq"`
+	Source        string    `json:"source"`
+	Caller        string    `json:"caller,omitempty"` // such as "jwt:sub", "apikey:id" or the rpc caller name
+	ID            uint32    `json:"id"`               // request id
+	DeviceID      string    `json:"deviceid"`
+	Method        string    `json:"method"`
+	URI           string    `json:"uri"`
+	PayloadSHA256 string    `json:"payload_sha256"`
+	PayloadSize   int       `json:"payload_size"`
+	Sealed        bool      `json:"sealed,omitempty"`
+	Code          string    `json:"code"`
+	LatencyMs     int64     `json:"latency_ms"`
+	Prev          string    `json:"prev"`           // hash of the previous record
+	Hash          string    `json:"hash,omitempty"` // SHA-256 of the line without hash
+
+	Payload []byte        `json:"-"`
+	Latency time.Duration `json:"-"`
+}
+
+// Sink stores the lines of records, each a JSON object without newline.
+// Write is called by one goroutine at a time, in the order of the chain.
+type Sink interface {
+	Write(line []byte) error
+	Close() error
+}
+
+// tailer is a sink able to tell its last lines, oldest first, the chain
+// resumes from the last good one.
+type tailer interface {
+	Tail() ([][]byte, error)
+}
+
+// segmenter is a sink able to start a new segment, such as a new file, so a
+// torn last line is not joined with the next one.
+type segmenter interface {
+	NewSegment() error
+}
+
+// Logger chains the records and writes them to the sink.
+type Logger struct {
+	mu   sync.Mutex
+	sink Sink
+	seq  uint64
+	prev string
+}
+
+// NewLogger resumes the chain from the last good line of the sink if it
+// tells. It starts a new segment with a resume marker, a gap marker if lines
+// after the last good one are torn or altered, which Verify reports.
+func NewLogger(sink Sink) (*Logger, error) {
+	l := &Logger{sink: sink}
+	t, ok := sink.(tailer)
+	if !ok {
+		return l, nil
+	}
+	lines, err := t.Tail()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read audit tail, resuming with a gap")
+	}
+	if err == nil && len(lines) == 0 {
+		return l, nil
+	}
+	code := CodeResumed
+	if err != nil {
+		code = CodeGap
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		r, err := verifyLine(lines[i])
+		if err == nil {
+			l.seq, l.prev = r.Seq, r.Hash
+			break
+		}
+		code = CodeGap
+	}
+	if code == CodeGap {
+		log.Warn().Uint64("seq", l.seq).Str("prev", l.prev).Msg("Audit tail is torn or altered, resuming with a gap")
+	}
+	if s, ok := sink.(segmenter); ok {
+		if err := s.NewSegment(); err != nil {
+			return nil, err
+		}
+	}
+	l.Log(&Record{Source: SourceAudit, Method: MethodResume, Code: code})
+	return l, nil
+}
+
+// seal encodes the record with its hash, the hash is of the line before it.
+func seal(r *Record) ([]byte, error) {
+	r.Hash = ""
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	r.Hash = hex.EncodeToString(sum[:])
+	line := make([]byte, 0, len(body)+len(hashField)+len(r.Hash)+2)
+	line = append(line, body[:len(body)-1]...)
+	line = append(line, hashField...)
+	line = append(line, r.Hash...)
+	return append(line, '"', '}'), nil
+}
+
+// verifyLine checks the hash of a line and decodes it.
+func verifyLine(line []byte) (*Record, error) {
+	i := bytes.LastIndex(line, []byte(hashField))
+	if i < 0 || !bytes.HasSuffix(line, []byte(`"}`)) {
+		return nil, ErrRecord
+	}
+	hash := string(line[i+len(hashField) : len(line)-2])
+	body := append(line[:i:i], '}')
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != hash {
+		return nil, ErrRecord
+	}
+	r := &Record{}
+	if err := json.Unmarshal(line, r); err != nil || r.Hash != hash {
+		return nil, ErrRecord
+	}
+	return r, nil
+}
+
+// Log records r, a record failed to write is logged and lost, the chain goes
+// on from the last record written.
+func (l *Logger) Log(r *Record) {
+	sum := sha256.Sum256(r.Payload)
+	r.PayloadSHA256 = hex.EncodeToString(sum[:])
+	r.PayloadSize = len(r.Payload)
+	r.LatencyMs = r.Latency.Milliseconds()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r.Time = time.Now().UTC()
+	r.Seq = l.seq + 1
+	r.Prev = l.prev
+	line, err := seal(r)
+	if err == nil {
+		err = l.sink.Write(line)
+	}
+	if err != nil {
+		metricErrors.Inc()
+		log.Error().Err(err).Str("source", r.Source).Str("deviceid", r.DeviceID).Msg("Failed to write audit record")
+		return
+	}
+	l.seq, l.prev = r.Seq, r.Hash
+	metricRecords.WithLabelValues(r.Source).Inc()
+}
+
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sink.Close()
+}
+
+// Verify checks the records of r are chained from prev, "" for the first
+// file, returns the last record, to verify the next file from its hash.
+func Verify(r io.Reader, prev string) (*Record, int, error) {
+	var last *Record
+	n := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		rec, err := verifyLine(line)
+		if err != nil {
+			return last, n, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		if last != nil && rec.Seq != last.Seq+1 || prev != "" && rec.Prev != prev {
+			return last, n, fmt.Errorf("line %d, seq %d: %w", n+1, rec.Seq, ErrChainBroken)
+		}
+		last, prev = rec, rec.Hash
+		n++
+	}
+	return last, n, scanner.Err()
+}
+
+var std atomic.Pointer[Logger]
+
+// Log records r by the logger set by Init or SetSink, nothing if none.
+func Log(r *Record) {
+	if l := std.Load(); l != nil {
+		l.Log(r)
+	}
+}
+
+// Enabled tells whether records are logged, to skip building them.
+func Enabled() bool {
+	return std.Load() != nil
+}
+
+// SetSink logs the records to sink, such as a pluggable store, instead of
+// the file. The sink is closed when ctx done.
+func SetSink(ctx context.Context, sink Sink) error {
+	l, err := NewLogger(sink)
+	if err != nil {
+		return err
+	}
+	if old := std.Swap(l); old != nil {
+		old.Close()
+	}
+	go func() {
+		<-ctx.Done()
+		if std.CompareAndSwap(l, nil) {
+			l.Close()
+		}
+	}()
+	return nil
+}
+
+// Init logs the records to the rotating file audit.file if set.
+func Init(ctx context.Context) error {
+	path := config.StringKV.GetWithDefault("audit.file", "")
+	if path == "" {
+		return nil
+	}
+	sink, err := OpenFileSink(path,
+		int64(config.IntKV.GetWithDefault("audit.file.maxsize", 100))<<20,
+		config.IntKV.GetWithDefault("audit.file.maxbackups", 0))
+	if err != nil {
+		log.Error().Err(err).Str("file", path).Msg("Failed to open audit file")
+		return err
+	}
+	if err := SetSink(ctx, sink); err != nil {
+		sink.Close()
+		log.Error().Err(err).Str("file", path).Msg("Failed to resume audit chain")
+		return err
+	}
+	log.Info().Str("file", path).Msg("Audit log enabled")
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+type memSink struct {
+	lines [][]byte
+}
+
+func (s *memSink) Write(line []byte) error {
+	s.lines = append(s.lines, bytes.Clone(line))
+	return nil
+}
+func (s *memSink) Close() error { return nil }
+
+func (s *memSink) join() string {
+	return string(bytes.Join(s.lines, []byte("\n")))
+}
+
+func TestLoggerChain(t *testing.T) {
+	sink := &memSink{}
+	l, err := NewLogger(sink)
+	assert.NilError(t, err)
+	for i := 0; i < 3; i++ {
+		l.Log(&Record{Source: SourceRPC, Caller: "app", DeviceID: "dev1", Method: "copost", URI: "/led",
+			Payload: []byte("on"), Code: "CODE_OK", Latency: 20 * time.Millisecond})
+	}
+	last, n, err := Verify(strings.NewReader(sink.join()), "")
+	assert.NilError(t, err)
+	assert.Equal(t, n, 3)
+	assert.Equal(t, last.Seq, uint64(3))
+	assert.Equal(t, last.PayloadSize, 2)
+	assert.Equal(t, last.LatencyMs, int64(20))
+	sum := sha256.Sum256([]byte("on"))
+	assert.Equal(t, last.PayloadSHA256, hex.EncodeToString(sum[:]))
+	assert.Assert(t, !bytes.Contains(sink.lines[0], []byte("on\"")))
+
+	// altered
+	altered := bytes.Replace(sink.lines[1], []byte(`"dev1"`), []byte(`"dev2"`), 1)
+	lines := [][]byte{sink.lines[0], altered, sink.lines[2]}
+	_, n, err = Verify(bytes.NewReader(bytes.Join(lines, []byte("\n"))), "")
+	assert.Assert(t, errors.Is(err, ErrRecord))
+	assert.Equal(t, n, 1)
+
+	// removed
+	lines = [][]byte{sink.lines[0], sink.lines[2]}
+	_, _, err = Verify(bytes.NewReader(bytes.Join(lines, []byte("\n"))), "")
+	assert.Assert(t, errors.Is(err, ErrChainBroken))
+
+	// not chained from the previous file
+	_, _, err = Verify(bytes.NewReader(sink.lines[1]), "bad")
+	assert.Assert(t, errors.Is(err, ErrChainBroken))
+}
+
+func TestFileSinkRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := OpenFileSink(path, 1024, 0)
+	assert.NilError(t, err)
+	l, err := NewLogger(sink)
+	assert.NilError(t, err)
+	for i := 0; i < 10; i++ {
+		l.Log(&Record{Source: SourceHTTP, DeviceID: "dev1", Method: "copost", URI: "/led", Code: "OK"})
+	}
+	assert.NilError(t, l.Close())
+
+	// resumed from the last record, after a resume marker in a new file
+	sink, err = OpenFileSink(path, 1024, 0)
+	assert.NilError(t, err)
+	l, err = NewLogger(sink)
+	assert.NilError(t, err)
+	assert.Equal(t, l.seq, uint64(11))
+	l.Log(&Record{Source: SourceDevice, DeviceID: "dev1", Method: "copost", URI: "/aa", Code: "StatusCode_OK"})
+	assert.NilError(t, l.Close())
+
+	verifyFiles := func() (int, []error) {
+		prev, total, errs := "", 0, []error{}
+		for _, file := range Files(path) {
+			buf, err := os.ReadFile(file)
+			assert.NilError(t, err)
+			last, n, err := Verify(bytes.NewReader(buf), prev)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if last != nil {
+				prev = last.Hash
+			}
+			total += n
+		}
+		return total, errs
+	}
+	total, errs := verifyFiles()
+	assert.Equal(t, len(errs), 0)
+	assert.Equal(t, total, 12)
+
+	// a torn last line resumes with a gap marker, reported by Verify
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	assert.NilError(t, err)
+	_, err = f.WriteString(`{"time":"2025-01-02T10:00:00Z","seq":13,"sou`)
+	assert.NilError(t, err)
+	f.Close()
+	sink, err = OpenFileSink(path, 1024, 0)
+	assert.NilError(t, err)
+	l, err = NewLogger(sink)
+	assert.NilError(t, err)
+	assert.Equal(t, l.seq, uint64(13))
+	assert.NilError(t, l.Close())
+	buf, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	marker, n, err := Verify(bytes.NewReader(buf), "")
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+	assert.Equal(t, marker.Code, CodeGap)
+	total, errs = verifyFiles()
+	assert.Equal(t, len(errs), 1)
+	assert.Assert(t, errors.Is(errs[0], ErrRecord))
+	assert.Equal(t, total, 13)
+}
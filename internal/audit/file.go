@@ -0,0 +1,175 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package audit
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const backupTimeFormat = "20060102T150405.000000000"
+
+// FileSink writes JSON lines to a file opened for append only. Over maxSize
+// bytes, the file is renamed with the time as suffix and a new one opened.
+// maxBackups limits the renamed files, oldest removed, 0 keeps all.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func OpenFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size = f, info.Size()
+	return nil
+}
+
+// backups are the renamed files of path, oldest first.
+func backups(path string) []string {
+	files, _ := filepath.Glob(path + ".*")
+	sort.Strings(files)
+	return files
+}
+
+// Files are the renamed files of the audit file and itself, in the order of
+// the chain.
+func Files(path string) []string {
+	return append(backups(path), path)
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.file.Close()
+	if err := os.Rename(s.path, s.path+"."+time.Now().UTC().Format(backupTimeFormat)); err != nil {
+		return err
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	if s.maxBackups > 0 {
+		files := backups(s.path)
+		for i := 0; i < len(files)-s.maxBackups; i++ {
+			if err := os.Remove(files[i]); err != nil {
+				log.Error().Err(err).Str("file", files[i]).Msg("Failed to remove audit backup")
+			}
+		}
+	}
+	log.Info().Str("file", s.path).Msg("Audit file rotated")
+	return nil
+}
+
+func (s *FileSink) Write(line []byte) error {
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line))+1 > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(append(line, '\n'))
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.file.Sync()
+	return s.file.Close()
+}
+
+// NewSegment rotates the file if not empty, so the records of this process
+// start a new file.
+func (s *FileSink) NewSegment() error {
+	if s.size == 0 {
+		return nil
+	}
+	return s.rotate()
+}
+
+// Tail reads the last lines of the file, or of the newest backup if the file
+// is empty, to resume the chain. A torn last line is included.
+func (s *FileSink) Tail() ([][]byte, error) {
+	files := Files(s.path)
+	for i := len(files) - 1; i >= 0; i-- {
+		lines, err := tail(files[i])
+		if err != nil || len(lines) > 0 {
+			return lines, err
+		}
+	}
+	return nil, nil
+}
+
+// tail reads the lines in the tail of the file, records are far less than
+// the tail.
+func tail(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	const tailSize = 64 << 10
+	off := info.Size() - tailSize
+	if off < 0 {
+		off = 0
+	}
+	buf := make([]byte, info.Size()-off)
+	if _, err := f.ReadAt(buf, off); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if off > 0 {
+		// the first line is cut by the tail
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+			buf = buf[i+1:]
+		}
+	}
+	lines := make([][]byte, 0)
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
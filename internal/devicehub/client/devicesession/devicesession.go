@@ -28,9 +28,11 @@ import (
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+	"github.com/mkrainbow/rtio/pkg/envelope"
 	ru "github.com/mkrainbow/rtio/pkg/rtioutil"
 	"github.com/mkrainbow/rtio/pkg/timekv"
 
@@ -42,6 +44,7 @@ const (
 	DeviceHeartbeatSecondsDefault = 300
 	DeviceConnectMaxTimes         = 20
 	DeviceConnectIntervalSeconds  = 3
+	ObGetNotifyBufferSize         = 16 // notifications of an ObGet not received yet
 )
 
 // Error Code for the Connection.
@@ -58,6 +61,8 @@ var (
 	ErrSendRespChannClose   = errors.New("ErrSendRespChannClose")
 	ErrHeaderIDNotExist     = errors.New("ErrHeaderIDNotExist")
 	ErrConnectTimesExceeded = errors.New("ErrConnectTimesExceeded")
+	ErrServerGoaway         = errors.New("ErrServerGoaway")
+	ErrServerTryLater       = errors.New("ErrServerTryLater")
 )
 
 // ConnectOptions holds the options for establishing a connection to a server.
@@ -71,18 +76,26 @@ type ConnnectOptions struct {
 type DeviceSession struct {
 	deviceID            string
 	deviceSecret        string
+	secretLock          sync.Mutex
+	secretHandler       func(newSecret string) error // persists the secret rotated by the server
 	serverAddr          string
 	connectOptions      *ConnnectOptions
 	outgoingChan        chan []byte
 	errChan             chan error
 	regPostHandlerMap   map[uint32]func(req []byte) ([]byte, error)
 	regObGetHandlerMap  map[uint32]func(ctx context.Context, req []byte) (<-chan []byte, error)
+	keyring             *envelope.Keyring // keys of the sealed handlers
+	sealedURIs          map[uint32]string // uri of the sealed handlers, by digest
 	sendIDStore         *timekv.TimeKV
 	rollingHeaderID     uint16
 	rollingHeaderIDLock sync.Mutex
+	rollingObserverID   uint16
+	rollingObserverLock sync.Mutex
+	observations        sync.Map // ObGet by the device, by observer id
 	conn                net.Conn
 	heartbeatSeconds    uint16
 	reconnectTimes      uint16
+	retryAfter          atomic.Uint32 // seconds told by the server, waited before the next reconnect
 }
 
 // Connect establishes a connection to a server with the provided device credentials.
@@ -231,6 +244,7 @@ func newDeviceSession(conn net.Conn, deviceID, deviceSecret, serverAddr string,
 		sendIDStore:        timekv.NewTimeKV(time.Second * 120),
 		regPostHandlerMap:  make(map[uint32]func(req []byte) ([]byte, error), 1),
 		regObGetHandlerMap: make(map[uint32]func(ctx context.Context, req []byte) (<-chan []byte, error), 1),
+		sealedURIs:         make(map[uint32]string),
 		conn:               conn,
 		heartbeatSeconds:   DeviceHeartbeatSecondsDefault,
 		reconnectTimes:     0,
@@ -249,6 +263,20 @@ func (s *DeviceSession) genHeaderID() uint16 {
 	return s.rollingHeaderID
 }
 
+func (s *DeviceSession) genObserverID() uint16 {
+	s.rollingObserverLock.Lock()
+	defer s.rollingObserverLock.Unlock()
+	for {
+		s.rollingObserverID++
+		if s.rollingObserverID == (uint16)(0) {
+			s.rollingObserverID = 1
+		}
+		if _, ok := s.observations.Load(s.rollingObserverID); !ok {
+			return s.rollingObserverID
+		}
+	}
+}
+
 func (s *DeviceSession) verify() error {
 	headerID, err := ru.GenUint16ID()
 	if err != nil {
@@ -262,7 +290,7 @@ func (s *DeviceSession) verify() error {
 		},
 		CapLevel:     1,
 		DeviceID:     s.deviceID,
-		DeviceSecret: s.deviceSecret,
+		DeviceSecret: s.secret(),
 	}
 
 	buf, err := dp.EncodeVerifyReq(req)
@@ -578,6 +606,114 @@ func (s *DeviceSession) observe(obID uint16, cancal context.CancelFunc, notifyRe
 	}
 }
 
+// observation is an ObGet by the device, notified by the server.
+type observation struct {
+	ctx        context.Context
+	conn       net.Conn // established on
+	notifyChan chan []byte
+}
+
+func (s *DeviceSession) sendObEstabReq(obID uint16, headerID uint16, uri uint32, data []byte) (<-chan []byte, error) {
+	req := &dp.ObGetEstabReq{
+		HeaderID: headerID,
+		Method:   dp.Method_ObservedGet,
+		ObID:     obID,
+		URI:      uri,
+		Data:     data,
+	}
+	log.Info().Uint16("obid", obID).Uint16("headerid", headerID).Uint32("uri", uri).Msg("send ObEstabReq")
+	buf := make([]byte, int(dp.HeaderLen+dp.HeaderLen_ObGetEstabReq)+len(data))
+	if err := dp.EncodeObGetEstabReq_OverDeviceSendReq(req, buf); err != nil {
+		log.Error().Uint16("obid", obID).Err(err).Msg("send ObEstabReq")
+		return nil, err
+	}
+	respChan := make(chan []byte, 1)
+	s.sendIDStore.Set(timekv.Key(headerID), &timekv.Value{C: respChan})
+	s.outgoingChan <- buf
+	return respChan, nil
+}
+func (s *DeviceSession) receiveObEstabResp(ctx context.Context, obID, headerID uint16, respChan <-chan []byte, timeout time.Duration) (dp.StatusCode, error) {
+	defer s.sendIDStore.Del(timekv.Key(headerID))
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case sendRespBody, ok := <-respChan:
+		if !ok {
+			log.Error().Uint16("obid", obID).Err(ErrSendRespChannClose).Msg("receive ObEstabResp")
+			return dp.StatusCode_Unknown, ErrSendRespChannClose
+		}
+		resp, err := dp.DecodeObGetEstabResp(headerID, sendRespBody)
+		if err != nil {
+			log.Error().Uint16("obid", obID).Err(err).Msg("receive ObEstabResp")
+			return dp.StatusCode_Unknown, err
+		}
+		if resp.ObID != obID {
+			log.Error().Uint16("obid", obID).Uint16("resp.obid", resp.ObID).Err(ErrObserverNotMatch).Msg("receive ObEstabResp")
+			return dp.StatusCode_Unknown, ErrObserverNotMatch
+		}
+		if resp.Method != dp.Method_ObservedGet {
+			log.Error().Uint16("obid", obID).Err(ErrMethodNotMatch).Msg("receive ObEstabResp")
+			return dp.StatusCode_MethodNotAllowed, nil
+		}
+		return resp.Code, nil
+	case <-t.C:
+		log.Error().Uint16("obid", obID).Err(ErrSendTimeout).Msg("receive ObEstabResp")
+		return dp.StatusCode_Unknown, ErrSendTimeout
+	case <-ctx.Done():
+		return dp.StatusCode_Unknown, ErrCanceled
+	}
+}
+
+// obGetNotifyHandler passes a notification to the observation, answers
+// Terminate when it is canceled or not found. It runs on the incoming route,
+// so a notification is dropped rather than waiting for a receiver behind.
+func (s *DeviceSession) obGetNotifyHandler(header *dp.Header, reqBuf []byte) error {
+	req, err := dp.DecodeObGetNotifyReq(header.ID, reqBuf)
+	if err != nil {
+		log.Error().Err(err).Msg("obGet notify")
+		return err
+	}
+	resp := &dp.ObGetNotifyResp{
+		HeaderID: req.HeaderID,
+		Method:   req.Method,
+		ObID:     req.ObID,
+		Code:     dp.StatusCode_Terminate,
+	}
+	if v, ok := s.observations.Load(req.ObID); ok {
+		ob := v.(*observation)
+		if req.Code == dp.StatusCode_Continue && ob.ctx.Err() == nil {
+			select {
+			case ob.notifyChan <- req.Data:
+				resp.Code = dp.StatusCode_Continue
+			case <-ob.ctx.Done():
+			default:
+				log.Warn().Uint16("obid", req.ObID).Msg("obGet notify dropped, notifications not received")
+				resp.Code = dp.StatusCode_Continue
+			}
+		}
+		if resp.Code != dp.StatusCode_Continue {
+			s.endObservation(req.ObID)
+		}
+	} else {
+		log.Info().Uint16("obid", req.ObID).Msg("obGet notify, observation not found and terminate it")
+	}
+	buf := make([]byte, dp.HeaderLen+dp.HeaderLen_ObGetNotifyResp)
+	if err := dp.EncodeObGetNotifyResp_OverServerSendResp(resp, buf); err != nil {
+		log.Error().Uint16("obid", req.ObID).Err(err).Msg("obGet notify")
+		return err
+	}
+	s.outgoingChan <- buf
+	return nil
+}
+
+// endObservation closes the notifications, only by the incomming route.
+func (s *DeviceSession) endObservation(obID uint16) {
+	if v, ok := s.observations.LoadAndDelete(obID); ok {
+		close(v.(*observation).notifyChan)
+		log.Info().Uint16("obid", obID).Msg("observation terminated")
+	}
+}
+
 func (s *DeviceSession) obGetReqHandler(header *dp.Header, reqBuf []byte) error {
 	req, err := dp.DecodeObGetEstabReq(header.ID, reqBuf)
 	if err != nil {
@@ -599,9 +735,16 @@ func (s *DeviceSession) obGetReqHandler(header *dp.Header, reqBuf []byte) error
 			log.Error().Uint16("obid", req.ObID).Err(err).Msg("obGet")
 			return err
 		}
+	} else if data, err := s.openSealed(req.URI, req.Sealed, req.Data); err != nil {
+		log.Warn().Uint16("obid", req.ObID).Uint32("uri", req.URI).Err(err).Msg("obGet, open sealed")
+		resp.Code = dp.StatusCode_BadRequest
+		if err := dp.EncodeObGetEstabResp_OverServerSendResp(resp, respBuf); err != nil {
+			log.Error().Uint16("obid", req.ObID).Err(err).Msg("obGet")
+			return err
+		}
 	} else {
 		ctx, cancle := context.WithCancel(context.Background())
-		respChan, err := handler(ctx, req.Data)
+		respChan, err := handler(ctx, data)
 		if err != nil {
 			resp.Code = dp.StatusCode_InternalServerError
 			cancle()
@@ -629,6 +772,10 @@ func (s *DeviceSession) coPostReqHandler(header *dp.Header, reqBuf []byte) error
 		HeaderID: req.HeaderID,
 		Method:   req.Method,
 	}
+	if req.URI == secretRotationURI && s.secretHandler != nil {
+		resp.Code, resp.Data = s.rotateSecret(req.Data)
+		return s.sendCoResp(resp)
+	}
 	handler, ok := s.regPostHandlerMap[req.URI]
 
 	if !ok {
@@ -640,8 +787,12 @@ func (s *DeviceSession) coPostReqHandler(header *dp.Header, reqBuf []byte) error
 			return err
 		}
 		s.outgoingChan <- buf
+	} else if data, err := s.openSealed(req.URI, req.Sealed, req.Data); err != nil {
+		log.Warn().Uint16("headerid", req.HeaderID).Uint32("uri", req.URI).Err(err).Msg("CoPost, open sealed")
+		resp.Code = dp.StatusCode_BadRequest
+		return s.sendCoResp(resp)
 	} else {
-		data, err := handler(req.Data)
+		data, err := handler(data)
 		if err != nil {
 			resp.Code = dp.StatusCode_InternalServerError
 			return err
@@ -675,6 +826,13 @@ func (s *DeviceSession) serverSendRequest(header *dp.Header) error {
 
 	switch method {
 	case dp.Method_ObservedGet:
+		if !dp.IsObGetEstabReq(bodyBuf) {
+			if err := s.obGetNotifyHandler(header, bodyBuf); err != nil {
+				log.Error().Err(err).Msg("handle server request")
+				return err
+			}
+			break
+		}
 		err := s.obGetReqHandler(header, bodyBuf)
 		if err != nil {
 			log.Error().Err(err).Msg("handle server request")
@@ -714,7 +872,15 @@ func (s *DeviceSession) deviceSendRespone(header *dp.Header) error {
 }
 
 func (s *DeviceSession) tcpIncomming(ctx context.Context, errChan chan<- error) {
+	conn := s.conn
 	defer func() {
+		// observations end with the connection
+		s.observations.Range(func(k, v any) bool {
+			if v.(*observation).conn == conn {
+				s.endObservation(k.(uint16))
+			}
+			return true
+		})
 		log.Debug().Msg("Incomming route exit")
 	}()
 
@@ -741,6 +907,11 @@ func (s *DeviceSession) tcpIncomming(ctx context.Context, errChan chan<- error)
 			case dp.MsgType_DeviceVerifyResp:
 				if header.Code == dp.Code_Success {
 					log.Info().Msg("verify pass")
+				} else if header.Code == dp.Code_TryLater {
+					s.readRetryAfter(header)
+					log.Warn().Uint32("retryafter", s.retryAfter.Load()).Msg("verify, server busy or locked out")
+					errChan <- ErrServerTryLater
+					return
 				} else {
 					log.Error().Uint8("resp.code", uint8(header.Code)).Msg("verify fail")
 					errChan <- ErrVerifyFailed
@@ -766,6 +937,12 @@ func (s *DeviceSession) tcpIncomming(ctx context.Context, errChan chan<- error)
 					errChan <- err
 					return
 				}
+			case dp.MsgType_ServerGoaway:
+				// server is shutting down or shedding load, reconnect (to another node)
+				s.readRetryAfter(header)
+				log.Info().Uint32("retryafter", s.retryAfter.Load()).Msg("server goaway")
+				errChan <- ErrServerGoaway
+				return
 			default:
 				errChan <- ErrDataType
 				return
@@ -775,6 +952,17 @@ func (s *DeviceSession) tcpIncomming(ctx context.Context, errChan chan<- error)
 	}
 }
 
+// readRetryAfter reads the retry-after body of a VerifyResp or Goaway.
+func (s *DeviceSession) readRetryAfter(header *dp.Header) {
+	bodyBuf := make([]byte, header.BodyLen)
+	if _, err := io.ReadFull(s.conn, bodyBuf); err != nil {
+		return
+	}
+	if retryAfter, err := dp.DecodeRetryAfterBody(header, bodyBuf); err == nil {
+		s.retryAfter.Store(uint32(retryAfter))
+	}
+}
+
 func (s *DeviceSession) tcpOutgoing(ctx context.Context, heartbeat *time.Ticker, errChan chan<- error) {
 	defer func() {
 		log.Debug().Msg("Outgoing route exit")
@@ -860,7 +1048,11 @@ func (s *DeviceSession) recover(ctx context.Context, errChan chan error) {
 			return
 		case err := <-errChan:
 			log.Error().Err(err).Msg("reconnect later for recover")
-			time.AfterFunc(time.Second*s.getReconnectInterval(6), func() {
+			interval := time.Second * s.getReconnectInterval(6)
+			if retryAfter := time.Second * time.Duration(s.retryAfter.Swap(0)); retryAfter > interval {
+				interval = retryAfter
+			}
+			time.AfterFunc(interval, func() {
 				s.reconnect(ctx, s.serverAddr, errChan)
 			})
 		}
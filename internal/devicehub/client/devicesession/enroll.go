@@ -0,0 +1,149 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicesession
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+	ru "github.com/mkrainbow/rtio/pkg/rtioutil"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Default Settings for enrollment.
+const (
+	DeviceEnrollTimeoutSeconds = 30
+)
+
+// Enroll gets the device ID and secret by the claim token of the device
+// batch, then the device connects with them. They should be persisted, a
+// claim token may be used a limited number of times. The serial is optional,
+// such as the hardware serial number. ErrServerTryLater when the server asks
+// to retry later.
+func Enroll(ctx context.Context, claimToken, serial, serverAddr string) (string, string, error) {
+	dialer := &net.Dialer{Timeout: time.Second * 60}
+	conn, err := dialer.DialContext(ctx, "tcp", serverAddr)
+	if err != nil {
+		log.Error().Err(err).Msg("Enroll, connect server error")
+		return "", "", err
+	}
+	defer conn.Close()
+	return enroll(ctx, conn, claimToken, serial)
+}
+
+// EnrollWithTLS enrolls over a TLS-encrypted connection, recommended as the
+// secret is sent to the device.
+func EnrollWithTLS(ctx context.Context, claimToken, serial, serverAddr, caFile string) (string, string, error) {
+	caCert, err := os.ReadFile(caFile)
+	if err != nil {
+		log.Error().Err(err).Msg("read CA file error")
+		return "", "", err
+	}
+	caCertPool := x509.NewCertPool()
+	if ok := caCertPool.AppendCertsFromPEM(caCert); !ok {
+		log.Error().Msg("append CA cert error")
+		return "", "", fmt.Errorf("failed to append CA cert")
+	}
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: time.Second * 60}, Config: &tls.Config{RootCAs: caCertPool}}
+	conn, err := dialer.DialContext(ctx, "tcp", serverAddr)
+	if err != nil {
+		log.Error().Err(err).Msg("Enroll, connect server error")
+		return "", "", err
+	}
+	defer conn.Close()
+	return enroll(ctx, conn, claimToken, serial)
+}
+
+func enroll(ctx context.Context, conn net.Conn, claimToken, serial string) (string, string, error) {
+	deadline := time.Now().Add(time.Second * DeviceEnrollTimeoutSeconds)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	headerID, err := ru.GenUint16ID()
+	if err != nil {
+		return "", "", err
+	}
+	buf, err := dp.EncodeEnrollReq(&dp.EnrollReq{
+		Header: &dp.Header{
+			Version: dp.Version,
+			Type:    dp.MsgType_DeviceVerifyReq,
+			ID:      headerID,
+		},
+		ClaimToken: claimToken,
+		Serial:     serial,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := ru.WriteFull(conn, buf); err != nil {
+		log.Error().Err(err).Msg("Enroll, write")
+		return "", "", err
+	}
+
+	for {
+		headBuf := make([]byte, dp.HeaderLen)
+		if _, err := io.ReadFull(conn, headBuf); err != nil {
+			log.Error().Err(err).Msg("Enroll, read header")
+			return "", "", err
+		}
+		header, err := dp.DecodeHeader(headBuf)
+		if err != nil {
+			return "", "", err
+		}
+		body := make([]byte, header.BodyLen)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			log.Error().Err(err).Msg("Enroll, read body")
+			return "", "", err
+		}
+		switch header.Type {
+		case dp.MsgType_DeviceVerifyResp:
+		case dp.MsgType_ServerGoaway:
+			return "", "", ErrServerGoaway
+		default:
+			continue
+		}
+		if header.ID != headerID {
+			return "", "", ErrHeaderIDNotExist
+		}
+		switch header.Code {
+		case dp.Code_Success:
+			resp, err := dp.DecodeEnrollRespBody(header, body)
+			if err != nil {
+				return "", "", err
+			}
+			log.Info().Str("deviceid", resp.DeviceID).Msg("Enroll, enrolled")
+			return resp.DeviceID, resp.DeviceSecret, nil
+		case dp.Code_TryLater:
+			return "", "", ErrServerTryLater
+		default:
+			log.Error().Uint8("code", uint8(header.Code)).Msg("Enroll, failed")
+			return "", "", ErrVerifyFailed
+		}
+	}
+}
@@ -115,3 +115,40 @@ func (s *DeviceSession) CoPost(ctx context.Context, uri string, Req []byte, time
 	}
 	return data, transToSDKError(statusCode)
 }
+
+// ObGet observes the resource of the server at the specified URI, the
+// notifications are received from the returned channel. It is closed when the
+// server terminates the observation or the connection is lost. Cancel ctx to
+// terminate, it is answered to the next notification. Up to
+// ObGetNotifyBufferSize notifications wait to be received, further ones are
+// dropped until the channel is drained.
+func (s *DeviceSession) ObGet(ctx context.Context, uri string, req []byte, timeout time.Duration) (<-chan []byte, error) {
+	headerID := s.genHeaderID()
+	obID := s.genObserverID()
+	ob := &observation{
+		ctx:        ctx,
+		conn:       s.conn,
+		notifyChan: make(chan []byte, ObGetNotifyBufferSize),
+	}
+	s.observations.Store(obID, ob)
+	respChan, err := s.sendObEstabReq(obID, headerID, rtioutil.URIHash(uri), req)
+	if err != nil {
+		s.observations.Delete(obID)
+		log.Error().Err(err).Msg("ObGet")
+		return nil, ErrInternel
+	}
+	statusCode, err := s.receiveObEstabResp(ctx, obID, headerID, respChan, timeout)
+	if err != nil {
+		s.observations.Delete(obID)
+		log.Error().Err(err).Msg("ObGet")
+		if err == ErrSendTimeout {
+			return nil, ErrRequestTimeout
+		}
+		return nil, ErrInternel
+	}
+	if statusCode != dp.StatusCode_Continue {
+		s.observations.Delete(obID)
+		return nil, transToSDKError(statusCode)
+	}
+	return ob.notifyChan, nil
+}
@@ -0,0 +1,111 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicesession
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mkrainbow/rtio/pkg/envelope"
+	ru "github.com/mkrainbow/rtio/pkg/rtioutil"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrKeyringNotSet = errors.New("ErrKeyringNotSet")
+	ErrNotSealed     = errors.New("ErrNotSealed")
+)
+
+// SetKeyring sets the keys of the sealed handlers, the envelopes of this device
+// are opened and sealed by its keys in the keyring. Not Thread-safe, set before Serve.
+func (s *DeviceSession) SetKeyring(keyring *envelope.Keyring) {
+	s.keyring = keyring
+}
+
+// RegisterSealedCoPostHandler registers a handler for sealed CoPOST requests to
+// the specified URI, the handler gets the opened request and its response is
+// sealed. Unsealed requests are answered BadRequest. Not Thread-safe.
+func (s *DeviceSession) RegisterSealedCoPostHandler(uri string, handler func(req []byte) ([]byte, error)) error {
+	if s.keyring == nil {
+		return ErrKeyringNotSet
+	}
+	err := s.RegisterCoPostHandler(uri, func(req []byte) ([]byte, error) {
+		resp, err := handler(req)
+		if err != nil {
+			return nil, err
+		}
+		return s.keyring.Seal(envelope.FromDevice, s.deviceID, uri, resp)
+	})
+	if err != nil {
+		return err
+	}
+	s.sealedURIs[ru.URIHash(uri)] = uri
+	return nil
+}
+
+// RegisterSealedObGetHandler registers a handler for sealed ObGET requests to
+// the specified URI, the handler gets the opened request and its notifications
+// are sealed. Unsealed requests are answered BadRequest. Not Thread-safe.
+func (s *DeviceSession) RegisterSealedObGetHandler(uri string, handler func(ctx context.Context, req []byte) (<-chan []byte, error)) error {
+	if s.keyring == nil {
+		return ErrKeyringNotSet
+	}
+	err := s.RegisterObGetHandler(uri, func(ctx context.Context, req []byte) (<-chan []byte, error) {
+		notifyChan, err := handler(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		sealedChan := make(chan []byte)
+		go func() {
+			defer close(sealedChan)
+			for data := range notifyChan {
+				env, err := s.keyring.Seal(envelope.FromDevice, s.deviceID, uri, data)
+				if err != nil {
+					log.Error().Str("uri", uri).Err(err).Msg("seal notification")
+					return
+				}
+				select {
+				case sealedChan <- env:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return sealedChan, nil
+	})
+	if err != nil {
+		return err
+	}
+	s.sealedURIs[ru.URIHash(uri)] = uri
+	return nil
+}
+
+// openSealed opens the request data for a sealed handler, the data of other
+// handlers is returned as is.
+func (s *DeviceSession) openSealed(uriDigest uint32, sealed bool, data []byte) ([]byte, error) {
+	uri, ok := s.sealedURIs[uriDigest]
+	if !ok {
+		return data, nil
+	}
+	if !sealed {
+		return nil, ErrNotSealed
+	}
+	return s.keyring.Open(envelope.ToDevice, s.deviceID, uri, data)
+}
@@ -0,0 +1,70 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicesession
+
+import (
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+	ru "github.com/mkrainbow/rtio/pkg/rtioutil"
+
+	"github.com/rs/zerolog/log"
+)
+
+var secretRotationURI = ru.URIHash(dp.URI_SecretRotation)
+
+// SetSecretHandler sets the handler persisting the secret rotated by the server,
+// the rotation is acked only when it returns nil. Without the handler the
+// rotation is answered not found. Not Thread-safe, set before Serve.
+func (s *DeviceSession) SetSecretHandler(handler func(newSecret string) error) {
+	s.secretHandler = handler
+}
+
+func (s *DeviceSession) secret() string {
+	s.secretLock.Lock()
+	defer s.secretLock.Unlock()
+	return s.deviceSecret
+}
+
+// rotateSecret opens the new secret by the current one, persists it by the
+// handler and answers the ack.
+func (s *DeviceSession) rotateSecret(data []byte) (dp.StatusCode, []byte) {
+	s.secretLock.Lock()
+	defer s.secretLock.Unlock()
+	newSecret, err := dp.OpenSecret(s.deviceID, s.deviceSecret, data)
+	if err != nil {
+		log.Error().Err(err).Msg("rotateSecret, open")
+		return dp.StatusCode_BadRequest, nil
+	}
+	if err := s.secretHandler(newSecret); err != nil {
+		log.Error().Err(err).Msg("rotateSecret, handler")
+		return dp.StatusCode_InternalServerError, nil
+	}
+	s.deviceSecret = newSecret
+	log.Info().Msg("rotateSecret, secret rotated")
+	return dp.StatusCode_OK, dp.SecretRotationAck(newSecret, data)
+}
+
+func (s *DeviceSession) sendCoResp(resp *dp.CoResp) error {
+	buf := make([]byte, int(dp.HeaderLen+dp.HeaderLen_CoResp)+len(resp.Data))
+	if err := dp.EncodeCoResp_OverServerSendResp(resp, buf); err != nil {
+		log.Error().Uint16("headerid", resp.HeaderID).Err(err).Msg("sendCoResp")
+		return err
+	}
+	s.outgoingChan <- buf
+	return nil
+}
@@ -24,6 +24,7 @@ import (
 	"os/signal"
 
 	ds "github.com/mkrainbow/rtio/internal/devicehub/client/devicesession"
+	"github.com/mkrainbow/rtio/pkg/envelope"
 	"github.com/mkrainbow/rtio/pkg/logsettings"
 
 	"strconv"
@@ -43,6 +44,16 @@ func copost128Handler(req []byte) ([]byte, error) {
 	return []byte("world!"), nil
 }
 
+func sealedHandler(req []byte) ([]byte, error) {
+	log.Info().Str("req", string(req)).Msg("opened")
+	return []byte("sealed world!"), nil
+}
+
+func secretHandler(newSecret string) error {
+	log.Info().Int("len", len(newSecret)).Msg("secret rotated, persist it here")
+	return nil
+}
+
 func obgetHandler(ctx context.Context, req []byte) (<-chan []byte, error) {
 	log.Info().Str("req", string(req)).Msg("")
 	respChan := make(chan []byte, 1)
@@ -74,7 +85,7 @@ func obgetHandler(ctx context.Context, req []byte) (<-chan []byte, error) {
 	return respChan, nil
 }
 
-func virtalDeviceRun(ctx context.Context, wait *sync.WaitGroup, deviceID, deviceSecret, serverAddr string) {
+func virtalDeviceRun(ctx context.Context, wait *sync.WaitGroup, deviceID, deviceSecret, serverAddr, envelopeMaster string) {
 	defer wait.Done()
 
 	log.Info().Str("deviceid", deviceID).Msg("virtalDeviceRun run")
@@ -89,7 +100,12 @@ func virtalDeviceRun(ctx context.Context, wait *sync.WaitGroup, deviceID, device
 		return
 	}
 	session.RegisterObGetHandler("/test", obgetHandler)
+	session.SetSecretHandler(secretHandler)
 	session.RegisterCoPostHandler("/test", copostHandler)
+	keyring := envelope.NewKeyring()
+	keyring.Add(deviceID, 1, envelope.DeriveKey([]byte(envelopeMaster), deviceID, 1))
+	session.SetKeyring(keyring)
+	session.RegisterSealedCoPostHandler("/sealed", sealedHandler)
 	session.RegisterCoPostHandler("/0123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456", copost128Handler)
 
 	session.Serve(ctx)
@@ -119,6 +135,7 @@ func virtalDeviceRun(ctx context.Context, wait *sync.WaitGroup, deviceID, device
 func main() {
 	logsettings.Set("text", "debug")
 	serverAddr := flag.String("server", "localhost:17017", "server address")
+	envelopeMaster := flag.String("envelope.master", "rtio-envelope-demo", "master key deriving the envelope key of /sealed")
 	flag.Parse()
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
@@ -126,7 +143,7 @@ func main() {
 
 	wait := &sync.WaitGroup{}
 	wait.Add(1)
-	go virtalDeviceRun(ctx, wait, "cfa09baa-4913-4ad7-a936-2e26f9671b05", "mb6bgso4EChvyzA05thF9+wH", *serverAddr)
+	go virtalDeviceRun(ctx, wait, "cfa09baa-4913-4ad7-a936-2e26f9671b05", "mb6bgso4EChvyzA05thF9+wH", *serverAddr, *envelopeMaster)
 
 	wait.Wait()
 	log.Error().Msg("client exit")
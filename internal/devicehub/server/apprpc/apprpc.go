@@ -22,12 +22,21 @@ import (
 	"context"
 	"errors"
 	"net"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/mkrainbow/rtio/internal/devicehub/server/cluster"
 	"github.com/mkrainbow/rtio/internal/devicehub/server/devicetcp"
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/internal/upgrade"
+	"github.com/mkrainbow/rtio/pkg/config"
 	"github.com/mkrainbow/rtio/pkg/deviceproto"
 	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+	"github.com/mkrainbow/rtio/pkg/drain"
+	"github.com/mkrainbow/rtio/pkg/health"
+	"github.com/mkrainbow/rtio/pkg/metrics"
 	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
 	"github.com/mkrainbow/rtio/pkg/rtioutil"
 
@@ -38,10 +47,23 @@ import (
 type AccessServer struct {
 	devicehub.UnimplementedAccessServiceServer
 	sessions *devicetcp.SessionMap
+	idem     *idempotencyCache // nil when idempotency disabled
+	cluster  *cluster.Node     // nil when cluster disabled
+	timeouts *requestTimeouts
+	// CoPosts in flight per CoPostStream
+	streamInFlight int
 }
 
 var (
 	ErrNotFoundDevice = errors.New("ErrNotFoundDevice")
+
+	metricRequests = metrics.NewCounterVec("rtio_rpc_requests_total", "AccessService requests by method and result code.", "method", "code")
+	metricDuration = metrics.NewHistogramVec("rtio_rpc_request_duration_seconds",
+		"AccessService latency by method and result code, for obget until observation established.", nil, "method", "code")
+)
+
+const (
+	DeviceListLimitMax = 1000
 )
 
 func transToRPCCode(code dp.StatusCode) devicehub.Code {
@@ -69,57 +91,117 @@ func transToRPCCode(code dp.StatusCode) devicehub.Code {
 	return devicehub.Code_CODE_INTERNAL_SERVER_ERROR
 }
 
+func observeRequest(method string, code devicehub.Code, start time.Time) {
+	metricRequests.WithLabelValues(method, code.String()).Inc()
+	metricDuration.WithLabelValues(method, code.String()).ObserveSince(start)
+}
+
 func (s *AccessServer) CoPost(ctx context.Context, req *devicehub.CoReq) (*devicehub.CoResp, error) {
 
+	start := time.Now()
+	if err := rpcauth.AuthorizeDevice(ctx, req.DeviceId); err != nil {
+		auditCoPost(ctx, req, devicehub.Code_CODE_FORBIDDEN, start)
+		return nil, err
+	}
+	key, ok := idempotencyKey(ctx, req)
+	if s.idem == nil || !ok {
+		resp := s.coPost(ctx, req)
+		observeRequest("copost", resp.Code, start)
+		auditCoPost(ctx, req, resp.Code, start)
+		return resp, nil
+	}
+	resp, shared, err := s.idem.do(ctx, key, requestSum(req), func() *devicehub.CoResp {
+		return s.coPost(ctx, req)
+	})
+	if err != nil {
+		log.Warn().Uint32("reqid", req.Id).Str("key", key).Err(err).Msg("Post")
+		resp = &devicehub.CoResp{Id: req.Id, Code: devicehub.Code_CODE_BAD_REQUEST}
+	}
+	observeRequest("copost", resp.Code, start)
+	auditCoPost(ctx, req, resp.Code, start)
+	if shared {
+		log.Info().Uint32("reqid", req.Id).Str("key", key).Str("code", resp.Code.String()).Msg("Post deduplicated")
+		return &devicehub.CoResp{Id: req.Id, Code: resp.Code, Data: resp.Data}, nil
+	}
+	return resp, nil
+}
+
+func (s *AccessServer) coPost(ctx context.Context, req *devicehub.CoReq) *devicehub.CoResp {
+
 	resp := &devicehub.CoResp{
 		Id: req.Id,
 	}
+	if req.Uri == dp.URI_SecretRotation {
+		log.Error().Uint32("reqid", req.Id).Str("uri", req.Uri).Msg("Post, uri reserved")
+		resp.Code = devicehub.Code_CODE_BAD_REQUEST
+		return resp
+	}
 	session, ok := s.sessions.Get(req.DeviceId)
 	if !ok {
+		if node, ok := s.owner(ctx, req.DeviceId); ok {
+			return s.forwardCoPost(ctx, node, req)
+		}
 		log.Warn().Uint32("reqid", req.Id).Err(devicetcp.ErrSessionNotFound).Msg("Post")
 		resp.Code = devicehub.Code_CODE_DEVICEID_OFFLINE
-		return resp, nil
+		return resp
 	}
 	if len(req.Data) > int(session.BodyCapSize-dp.HeaderLen_CoResp) {
 		log.Error().Uint32("reqid", req.Id).Err(devicetcp.ErrOverCapacity).Msg("Post")
 		resp.Code = devicehub.Code_CODE_BAD_REQUEST
-		return resp, nil
+		return resp
 	}
 	uri := rtioutil.URIHash(req.Uri)
-	code, data, err := session.Send(ctx, uri, dp.Method_ConstrainedPost, req.Data, 10*time.Second)
+	code, data, err := session.Send(ctx, uri, dp.Method_ConstrainedPost, req.Sealed, req.Data, s.timeouts.get(ctx, false, req.Uri, req.TimeoutMs))
 	if err != nil {
 		if err == devicetcp.ErrSendTimeout {
 			log.Error().Err(err).Msg("Post")
 			resp.Code = devicehub.Code_CODE_REQUEST_TIMEOUT
-			return resp, nil
+			return resp
+		}
+		if err == devicetcp.ErrSessionDraining {
+			log.Warn().Err(err).Msg("Post")
+			resp.Code = devicehub.Code_CODE_DEVICEID_OFFLINE
+			return resp
 		}
 		log.Error().Err(err).Msg("Post")
 		resp.Code = devicehub.Code_CODE_INTERNAL_SERVER_ERROR
-		return resp, nil
+		return resp
 	}
 	resp.Code = transToRPCCode(code)
 	if resp.Code == devicehub.Code_CODE_OK {
 		resp.Data = data
 	}
-	return resp, nil
+	return resp
 }
 
 func (s *AccessServer) ObGet(req *devicehub.ObGetReq, stream devicehub.AccessService_ObGetServer) error {
 
+	start := time.Now()
+	if err := rpcauth.AuthorizeDevice(stream.Context(), req.DeviceId); err != nil {
+		auditObGet(stream.Context(), req, devicehub.Code_CODE_FORBIDDEN, start)
+		return err
+	}
 	resp := &devicehub.ObGetResp{
 		Id:  req.Id,
 		Fid: 0,
 	}
 	session, ok := s.sessions.Get(req.DeviceId)
 	if !ok {
+		if node, ok := s.owner(stream.Context(), req.DeviceId); ok {
+			return s.forwardObGet(node, req, &auditFirstStream{AccessService_ObGetServer: stream, req: req, start: start})
+		}
 		log.Warn().Uint32("reqid", req.Id).Err(devicetcp.ErrSessionNotFound).Msg("Obsevation init")
 		resp.Code = devicehub.Code_CODE_DEVICEID_OFFLINE
+		observeRequest("obget", resp.Code, start)
+		auditObGet(stream.Context(), req, resp.Code, start)
 		stream.Send(resp)
 		return nil
 	}
 	if len(req.Data) > int(session.BodyCapSize-dp.HeaderLen_ObGetEstabReq) {
 		log.Error().Uint32("reqid", req.Id).Err(devicetcp.ErrOverCapacity).Msg("Obsevation init")
 		resp.Code = devicehub.Code_CODE_BAD_REQUEST
+		observeRequest("obget", resp.Code, start)
+		auditObGet(stream.Context(), req, resp.Code, start)
 		stream.Send(resp)
 		return nil
 	}
@@ -127,6 +209,8 @@ func (s *AccessServer) ObGet(req *devicehub.ObGetReq, stream devicehub.AccessSer
 	ob, err := session.CreateObserva()
 	if err != nil {
 		log.Error().Uint32("reqid", req.Id).Err(err).Msg("Obsevation create")
+		observeRequest("obget", devicehub.Code_CODE_TOO_MANY_OBSERVERS, start)
+		auditObGet(stream.Context(), req, devicehub.Code_CODE_TOO_MANY_OBSERVERS, start)
 		return err
 	}
 	defer session.DestroyObserva(ob.ObserverID)
@@ -134,14 +218,18 @@ func (s *AccessServer) ObGet(req *devicehub.ObGetReq, stream devicehub.AccessSer
 	log.Info().Uint32("reqid", req.Id).Uint16("obid", ob.ObserverID).Msg("Obsevation created")
 
 	uri := rtioutil.URIHash(req.Uri)
-	statusCode, err := session.ObGetEstablish(stream.Context(), uri, ob, req.Data, time.Second*20)
+	statusCode, err := session.ObGetEstablish(stream.Context(), uri, ob, req.Sealed, req.Data, s.timeouts.get(stream.Context(), true, req.Uri, req.TimeoutMs))
 	if err != nil {
 		log.Error().Uint32("reqid", req.GetId()).Err(err).Msg("Obsevation establish")
 		if devicetcp.ErrSendTimeout == err {
 			resp.Code = devicehub.Code_CODE_DEVICEID_TIMEOUT
+		} else if devicetcp.ErrSessionDraining == err {
+			resp.Code = devicehub.Code_CODE_DEVICEID_OFFLINE
 		} else {
 			resp.Code = devicehub.Code_CODE_INTERNAL_SERVER_ERROR
 		}
+		observeRequest("obget", resp.Code, start)
+		auditObGet(stream.Context(), req, resp.Code, start)
 		stream.Send(resp)
 		return nil
 	}
@@ -149,10 +237,14 @@ func (s *AccessServer) ObGet(req *devicehub.ObGetReq, stream devicehub.AccessSer
 	if statusCode != dp.StatusCode_Continue {
 		resp.Code = transToRPCCode(statusCode)
 		log.Info().Uint32("reqid", req.GetId()).Err(err).Str("devcie.status", statusCode.String()).Msg("Obsevation establish result (exclude Continue):")
+		observeRequest("obget", resp.Code, start)
+		auditObGet(stream.Context(), req, resp.Code, start)
 		stream.Send(resp)
 		return nil
 	}
 
+	observeRequest("obget", devicehub.Code_CODE_CONTINUE, start)
+	auditObGet(stream.Context(), req, devicehub.Code_CODE_CONTINUE, start)
 	obGetNotifyServe(ob, req, stream)
 	return nil
 }
@@ -172,6 +264,15 @@ func obGetNotifyServe(ob *devicetcp.Observa, req *devicehub.ObGetReq, stream dev
 		case <-stream.Context().Done():
 			log.Info().Uint32("reqid", req.Id).Msg("ObGet stream context done")
 			return
+		case <-ob.TerminateChan:
+			log.Info().Uint32("reqid", req.Id).Msg("ObGet device session draining")
+			resp := &devicehub.ObGetResp{
+				Id:   req.Id,
+				Fid:  ob.FrameID,
+				Code: devicehub.Code_CODE_TERMINATE,
+			}
+			stream.Send(resp)
+			return
 		case notifyReq, ok := <-ob.NotifyChan:
 			resp := &devicehub.ObGetResp{
 				Id:  req.Id,
@@ -199,13 +300,52 @@ func obGetNotifyServe(ob *devicetcp.Observa, req *devicehub.ObGetReq, stream dev
 func InitRPCServer(ctx context.Context, addr string,
 	sessionMap *devicetcp.SessionMap, wait *sync.WaitGroup) error {
 
-	listener, err := net.Listen("tcp", addr)
+	listener, err := upgrade.Listen("rpc", addr)
 	if err != nil {
 		log.Error().Err(err).Msg("listen failed")
 		return err
 	}
-	s := grpc.NewServer()
-	devicehub.RegisterAccessServiceServer(s, &AccessServer{sessions: sessionMap})
+	opts, err := serverOptions()
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	s := grpc.NewServer(opts...)
+	accessServer := &AccessServer{sessions: sessionMap}
+	if accessServer.timeouts, err = loadRequestTimeouts(); err != nil {
+		listener.Close()
+		return err
+	}
+	accessServer.streamInFlight = config.IntKV.GetWithDefault("copost.stream.inflight", CoPostStreamInFlightDefault)
+	if window := config.IntKV.GetWithDefault("copost.idempotency.window", 0); window > 0 {
+		log.Info().Int("window", window).Msg("CoPost idempotency enabled")
+		accessServer.idem = newIdempotencyCache(time.Duration(window) * time.Second)
+	}
+	if node := config.StringKV.GetWithDefault("cluster.node", ""); node != "" {
+		accessServer.cluster, err = cluster.NewNode(ctx, node, config.StringKV.GetWithDefault("cluster.peers", ""))
+		if err != nil {
+			log.Error().Err(err).Msg("cluster init failed")
+			listener.Close()
+			return err
+		}
+		accessServer.cluster.Register(s)
+		sessionMap.SetDirectory(accessServer.cluster.Directory)
+	}
+	devicehub.RegisterAccessServiceServer(s, accessServer)
+	registerHealthServer(ctx, s, health.Default)
+	drain.Register("rpc", func(ctx context.Context) {
+		// stop accepting, wait for RPCs, ObGet streams end when observations terminated
+		done := make(chan struct{})
+		go func() {
+			s.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			s.Stop()
+		}
+	})
 
 	go func() {
 		<-ctx.Done()
@@ -236,17 +376,75 @@ func InitRPCServer(ctx context.Context, addr string,
 
 func (s *AccessServer) DeviceQuery(ctx context.Context, req *devicehub.DeviceQueryReq) (*devicehub.DeviceQueryResp, error) {
 
+	if err := rpcauth.AuthorizeDevice(ctx, req.DeviceId); err != nil {
+		return nil, err
+	}
+
 	resp := &devicehub.DeviceQueryResp{
 		Id: req.Id,
 	}
 	session, ok := s.sessions.Get(req.DeviceId)
 	if !ok {
+		if node, ok := s.owner(ctx, req.DeviceId); ok {
+			return s.forwardDeviceQuery(ctx, node, req)
+		}
 		log.Warn().Uint32("reqid", req.Id).Err(devicetcp.ErrSessionNotFound).Msg("Get")
 		resp.Code = devicehub.Code_CODE_NOT_FOUNT
 		return resp, nil
 	}
 	resp.BodyCapSize = uint32(session.BodyCapSize)
 	resp.RemoteAddr = session.RemoteAddr.String()
+	resp.ConnectTime = session.ConnectTime.Unix()
+	resp.Code = devicehub.Code_CODE_OK
+	return resp, nil
+}
+
+// matchFilters reports whether the device matches a pattern of every filter.
+func matchFilters(filters []*devicehub.DevicePatterns, deviceID string) bool {
+	for _, f := range filters {
+		matched := false
+		for _, p := range f.Patterns {
+			if rpcauth.MatchPattern(p, deviceID) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// DeviceList lists the online devices ordered by ID, filtered before the
+// limit, so that the first ones allowed are listed.
+func (s *AccessServer) DeviceList(ctx context.Context, req *devicehub.DeviceListReq) (*devicehub.DeviceListResp, error) {
+
+	resp := &devicehub.DeviceListResp{
+		Id: req.Id,
+	}
+	limit := int(req.Limit)
+	if limit == 0 || limit > DeviceListLimitMax {
+		limit = DeviceListLimitMax
+	}
+	caller, authed := rpcauth.CallerFrom(ctx)
+	s.sessions.Range(func(deviceID string, session *devicetcp.Session) bool {
+		if !strings.HasPrefix(deviceID, req.Prefix) || (authed && !caller.AllowDevice(deviceID)) ||
+			!matchFilters(req.Filters, deviceID) {
+			return true
+		}
+		resp.Devices = append(resp.Devices, &devicehub.DeviceInfo{
+			DeviceId:    deviceID,
+			BodyCapSize: uint32(session.BodyCapSize),
+			RemoteAddr:  session.RemoteAddr.String(),
+			ConnectTime: session.ConnectTime.Unix(),
+		})
+		return true
+	})
+	sort.Slice(resp.Devices, func(i, j int) bool { return resp.Devices[i].DeviceId < resp.Devices[j].DeviceId })
+	if len(resp.Devices) > limit {
+		resp.Devices = resp.Devices[:limit]
+	}
 	resp.Code = devicehub.Code_CODE_OK
 	return resp, nil
 }
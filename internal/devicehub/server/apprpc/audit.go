@@ -0,0 +1,78 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/audit"
+	"github.com/mkrainbow/rtio/internal/devicehub/server/cluster"
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+)
+
+// auditRequest records a CoPost or ObGet by the caller. Requests forwarded by
+// peers with the cluster token are recorded by the peer, the forwarded mark
+// of other callers is ignored, see cluster.Forwarded.
+func auditRequest(ctx context.Context, method string, id uint32, deviceID, uri string,
+	data []byte, sealed bool, code devicehub.Code, start time.Time) {
+	if !audit.Enabled() || cluster.Forwarded(ctx) {
+		return
+	}
+	r := &audit.Record{
+		Source:   audit.SourceRPC,
+		ID:       id,
+		DeviceID: deviceID,
+		Method:   method,
+		URI:      uri,
+		Payload:  data,
+		Sealed:   sealed,
+		Code:     code.String(),
+		Latency:  time.Since(start),
+	}
+	if c, ok := rpcauth.CallerFrom(ctx); ok {
+		r.Caller = c.Name
+	}
+	audit.Log(r)
+}
+
+func auditCoPost(ctx context.Context, req *devicehub.CoReq, code devicehub.Code, start time.Time) {
+	auditRequest(ctx, "copost", req.Id, req.DeviceId, req.Uri, req.Data, req.Sealed, code, start)
+}
+
+func auditObGet(ctx context.Context, req *devicehub.ObGetReq, code devicehub.Code, start time.Time) {
+	auditRequest(ctx, "obget", req.Id, req.DeviceId, req.Uri, req.Data, req.Sealed, code, start)
+}
+
+// auditFirstStream records an ObGet forwarded to the owner by its first frame.
+type auditFirstStream struct {
+	devicehub.AccessService_ObGetServer
+	req     *devicehub.ObGetReq
+	start   time.Time
+	audited bool
+}
+
+func (s *auditFirstStream) Send(resp *devicehub.ObGetResp) error {
+	if !s.audited {
+		s.audited = true
+		auditObGet(s.Context(), s.req, resp.Code, s.start)
+	}
+	return s.AccessService_ObGetServer.Send(resp)
+}
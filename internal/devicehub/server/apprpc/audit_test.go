@@ -0,0 +1,64 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/audit"
+	"github.com/mkrainbow/rtio/internal/devicehub/server/cluster"
+	"github.com/mkrainbow/rtio/pkg/config"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"google.golang.org/grpc/metadata"
+	"gotest.tools/assert"
+)
+
+type countSink struct {
+	lines int
+}
+
+func (s *countSink) Write(line []byte) error {
+	s.lines++
+	return nil
+}
+
+func (s *countSink) Close() error { return nil }
+
+func TestAuditForwarded(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := &countSink{}
+	assert.NilError(t, audit.SetSink(ctx, sink))
+	config.StringKV.Set("cluster.token", "peer-secret")
+	defer config.StringKV.Set("cluster.token", "")
+	req := &devicehub.CoReq{Id: 1, DeviceId: "cfa09baa-4913-4ad7-a936-3e26f9671b09", Uri: "/led"}
+
+	// a forwarded mark without the cluster token is recorded
+	forged := metadata.NewIncomingContext(ctx, metadata.Pairs(cluster.ForwardedKey, "1"))
+	auditCoPost(forged, req, devicehub.Code_CODE_OK, time.Now())
+	assert.Equal(t, sink.lines, 1)
+
+	// the peer forwarding the call has recorded it
+	md, _ := metadata.FromOutgoingContext(cluster.ForwardContext(ctx))
+	auditCoPost(metadata.NewIncomingContext(ctx, md), req, devicehub.Code_CODE_OK, time.Now())
+	assert.Equal(t, sink.lines, 1)
+}
@@ -0,0 +1,56 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/pkg/config"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// serverOptions gets TLS and caller authentication of the rpc server, by config.
+func serverOptions() ([]grpc.ServerOption, error) {
+	opts := make([]grpc.ServerOption, 0, 3)
+	if config.BoolKV.GetWithDefault("enable.backend.rpc.tls", false) {
+		tlsConfig, err := rpcauth.LoadServerTLSConfig(
+			config.StringKV.GetWithDefault("backend.rpc.tls.certfile", ""),
+			config.StringKV.GetWithDefault("backend.rpc.tls.keyfile", ""),
+			config.StringKV.GetWithDefault("backend.rpc.tls.clientca", ""))
+		if err != nil {
+			log.Error().Err(err).Msg("rpc TLS init failed")
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		log.Info().Bool("mtls", tlsConfig.ClientCAs != nil).Msg("rpc TLS enabled")
+	}
+	if file := config.StringKV.GetWithDefault("backend.rpc.callers", ""); file != "" {
+		callers, err := rpcauth.LoadCallers(file)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(callers.UnaryInterceptor),
+			grpc.ChainStreamInterceptor(callers.StreamInterceptor))
+		log.Info().Msg("rpc caller authentication enabled")
+	}
+	return opts, nil
+}
@@ -0,0 +1,109 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/mkrainbow/rtio/pkg/metrics"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	CoPostStreamInFlightDefault = 64
+
+	metricStreamInFlight = metrics.NewGauge("rtio_rpc_copost_stream_inflight", "CoPosts in flight on all CoPostStream streams.")
+)
+
+// streamContext drops the idempotency key of the stream, and skips the
+// idempotency cache, since request ids are unique on the stream only.
+func streamContext(ctx context.Context) context.Context {
+	ctx = skipIdempotency(ctx)
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(IdempotencyKeyMetadata)) == 0 {
+		return ctx
+	}
+	md = md.Copy()
+	md.Delete(IdempotencyKeyMetadata)
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+func streamErrCode(err error) devicehub.Code {
+	if status.Code(err) == codes.PermissionDenied {
+		return devicehub.Code_CODE_FORBIDDEN
+	}
+	return devicehub.Code_CODE_INTERNAL_SERVER_ERROR
+}
+
+// CoPostStream serves many CoPosts on a stream, each as by CoPost. At most
+// streamInFlight are in flight, further requests are not read until one
+// completes, so the client is held back by flow control.
+func (s *AccessServer) CoPostStream(stream devicehub.AccessService_CoPostStreamServer) error {
+
+	ctx := streamContext(stream.Context())
+	inFlight := s.streamInFlight
+	if inFlight <= 0 {
+		inFlight = CoPostStreamInFlightDefault
+	}
+	slots := make(chan struct{}, inFlight)
+	sendLock := sync.Mutex{}
+	wait := sync.WaitGroup{}
+	defer wait.Wait() // no Send after return
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			log.Debug().Err(err).Msg("CoPostStream recv")
+			return err
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		metricStreamInFlight.Inc()
+		wait.Add(1)
+		go func(req *devicehub.CoReq) {
+			defer func() {
+				<-slots
+				metricStreamInFlight.Dec()
+				wait.Done()
+			}()
+			resp, err := s.CoPost(ctx, req)
+			if err != nil {
+				resp = &devicehub.CoResp{Id: req.Id, Code: streamErrCode(err)}
+			}
+			sendLock.Lock()
+			defer sendLock.Unlock()
+			if err := stream.Send(resp); err != nil {
+				log.Debug().Uint32("reqid", req.Id).Err(err).Msg("CoPostStream send")
+			}
+		}(req)
+	}
+}
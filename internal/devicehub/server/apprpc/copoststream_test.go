@@ -0,0 +1,101 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/devicetcp"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"gotest.tools/assert"
+)
+
+type fakeCoPostStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	reqs  chan *devicehub.CoReq
+	lock  sync.Mutex
+	resps []*devicehub.CoResp
+}
+
+func (s *fakeCoPostStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeCoPostStream) Recv() (*devicehub.CoReq, error) {
+	req, ok := <-s.reqs
+	if !ok {
+		return nil, io.EOF
+	}
+	return req, nil
+}
+
+func (s *fakeCoPostStream) Send(resp *devicehub.CoResp) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.resps = append(s.resps, resp)
+	return nil
+}
+
+func TestCoPostStream(t *testing.T) {
+
+	s := &AccessServer{sessions: &devicetcp.SessionMap{}, timeouts: newRequestTimeouts(), streamInFlight: 2}
+	stream := &fakeCoPostStream{ctx: context.Background(), reqs: make(chan *devicehub.CoReq)}
+	done := make(chan error)
+	go func() {
+		done <- s.CoPostStream(stream)
+	}()
+	for i := 1; i <= 10; i++ {
+		stream.reqs <- &devicehub.CoReq{Id: uint32(i), DeviceId: "cfa09baa-4913-4ad7-a936-3e26f9671b09", Uri: "/rainbow"}
+	}
+	close(stream.reqs)
+	assert.NilError(t, <-done)
+
+	// all answered before the stream ends
+	assert.Equal(t, len(stream.resps), 10)
+	seen := make(map[uint32]bool)
+	for _, resp := range stream.resps {
+		assert.Equal(t, resp.Code, devicehub.Code_CODE_DEVICEID_OFFLINE)
+		seen[resp.Id] = true
+	}
+	assert.Equal(t, len(seen), 10)
+}
+
+func TestStreamContextSkipsIdempotency(t *testing.T) {
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(IdempotencyKeyMetadata, "k1", "other", "v"))
+	ctx = streamContext(ctx)
+	req := &devicehub.CoReq{Id: 7, DeviceId: "dev"}
+	_, ok := idempotencyKey(ctx, req)
+	assert.Equal(t, ok, false)
+	md, _ := metadata.FromIncomingContext(ctx)
+	assert.DeepEqual(t, md.Get("other"), []string{"v"})
+	assert.Equal(t, len(md.Get(IdempotencyKeyMetadata)), 0)
+
+	// the skip mark is trusted from peers only
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(IdempotencySkipMetadata, "1"))
+	_, ok = idempotencyKey(ctx, req)
+	assert.Equal(t, ok, true)
+}
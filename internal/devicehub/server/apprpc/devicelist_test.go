@@ -0,0 +1,63 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/devicetcp"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"gotest.tools/assert"
+)
+
+func TestDeviceList(t *testing.T) {
+	s := &AccessServer{sessions: &devicetcp.SessionMap{}}
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	for i := 0; i < 20; i++ {
+		s.sessions.Set(fmt.Sprintf("dev-%02d", i), &devicetcp.Session{RemoteAddr: addr})
+		s.sessions.Set(fmt.Sprintf("other-%02d", i), &devicetcp.Session{RemoteAddr: addr})
+	}
+
+	// filtered and ordered before the limit
+	resp, err := s.DeviceList(context.Background(), &devicehub.DeviceListReq{
+		Limit: 3,
+		Filters: []*devicehub.DevicePatterns{
+			{Patterns: []string{"dev-1*", "other-05"}},
+			{Patterns: []string{"dev-*"}},
+		},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(resp.Devices), 3)
+	assert.Equal(t, resp.Devices[0].DeviceId, "dev-10")
+	assert.Equal(t, resp.Devices[2].DeviceId, "dev-12")
+
+	resp, err = s.DeviceList(context.Background(), &devicehub.DeviceListReq{Prefix: "other-", Limit: 2})
+	assert.NilError(t, err)
+	assert.Equal(t, len(resp.Devices), 2)
+	assert.Equal(t, resp.Devices[0].DeviceId, "other-00")
+
+	// an empty filter lists nothing
+	resp, err = s.DeviceList(context.Background(), &devicehub.DeviceListReq{Filters: []*devicehub.DevicePatterns{{}}})
+	assert.NilError(t, err)
+	assert.Equal(t, len(resp.Devices), 0)
+}
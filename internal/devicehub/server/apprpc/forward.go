@@ -0,0 +1,138 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"context"
+	"io"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/cluster"
+	"github.com/mkrainbow/rtio/pkg/metrics"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	metricForwarded = metrics.NewCounterVec("rtio_rpc_forwarded_total",
+		"AccessService requests forwarded to the node of the device, ok or error.", "method", "result")
+)
+
+// owner gets the node to forward to, when the device is on another node.
+// Forwarded calls are not forwarded again.
+func (s *AccessServer) owner(ctx context.Context, deviceID string) (string, bool) {
+	if s.cluster == nil || cluster.Forwarded(ctx) {
+		return "", false
+	}
+	return s.cluster.Owner(deviceID)
+}
+
+// forwardContext keeps the idempotency key and its caller, the owner
+// deduplicates retries arriving at different nodes.
+func forwardContext(ctx context.Context) context.Context {
+	out := metadata.AppendToOutgoingContext(cluster.ForwardContext(ctx),
+		IdempotencyCallerMetadata, idempotencyCaller(ctx))
+	if idempotencySkipped(ctx) {
+		out = metadata.AppendToOutgoingContext(out, IdempotencySkipMetadata, "1")
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(IdempotencyKeyMetadata); len(v) > 0 {
+			out = metadata.AppendToOutgoingContext(out, IdempotencyKeyMetadata, v[0])
+		}
+	}
+	return out
+}
+
+func (s *AccessServer) forwardCoPost(ctx context.Context, node string, req *devicehub.CoReq) *devicehub.CoResp {
+	client, err := s.cluster.Client(node)
+	if err == nil {
+		var resp *devicehub.CoResp
+		if resp, err = client.CoPost(forwardContext(ctx), req); err == nil {
+			metricForwarded.WithLabelValues("copost", "ok").Inc()
+			return resp
+		}
+	}
+	log.Error().Uint32("reqid", req.Id).Str("node", node).Err(err).Msg("Post forward")
+	metricForwarded.WithLabelValues("copost", "error").Inc()
+	return &devicehub.CoResp{Id: req.Id, Code: devicehub.Code_CODE_DEVICEID_OFFLINE}
+}
+
+// forwardObGet relays the stream of the owner until it ends.
+func (s *AccessServer) forwardObGet(node string, req *devicehub.ObGetReq, stream devicehub.AccessService_ObGetServer) error {
+	client, err := s.cluster.Client(node)
+	var upstream devicehub.AccessService_ObGetClient
+	if err == nil {
+		upstream, err = client.ObGet(forwardContext(stream.Context()), req)
+	}
+	if err != nil {
+		log.Error().Uint32("reqid", req.Id).Str("node", node).Err(err).Msg("ObGet forward")
+		metricForwarded.WithLabelValues("obget", "error").Inc()
+		return stream.Send(&devicehub.ObGetResp{Id: req.Id, Code: devicehub.Code_CODE_DEVICEID_OFFLINE})
+	}
+	metricForwarded.WithLabelValues("obget", "ok").Inc()
+
+	var fid uint32
+	for {
+		resp, err := upstream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if stream.Context().Err() != nil {
+				return nil
+			}
+			// the owner is gone, as if the device session done
+			log.Warn().Uint32("reqid", req.Id).Str("node", node).Err(err).Msg("ObGet forward stream")
+			return stream.Send(&devicehub.ObGetResp{Id: req.Id, Fid: fid, Code: devicehub.Code_CODE_DEVICEID_OFFLINE})
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+		fid = resp.Fid + 1
+	}
+}
+
+func (s *AccessServer) forwardDeviceQuery(ctx context.Context, node string, req *devicehub.DeviceQueryReq) (*devicehub.DeviceQueryResp, error) {
+	client, err := s.cluster.Client(node)
+	if err == nil {
+		var resp *devicehub.DeviceQueryResp
+		if resp, err = client.DeviceQuery(forwardContext(ctx), req); err == nil {
+			metricForwarded.WithLabelValues("devicequery", "ok").Inc()
+			return resp, nil
+		}
+	}
+	log.Error().Uint32("reqid", req.Id).Str("node", node).Err(err).Msg("DeviceQuery forward")
+	metricForwarded.WithLabelValues("devicequery", "error").Inc()
+	return &devicehub.DeviceQueryResp{Id: req.Id, Code: devicehub.Code_CODE_NOT_FOUNT}, nil
+}
+
+func (s *AccessServer) forwardRotateDeviceSecret(ctx context.Context, node string, req *devicehub.RotateDeviceSecretReq) *devicehub.RotateDeviceSecretResp {
+	client, err := s.cluster.Client(node)
+	if err == nil {
+		var resp *devicehub.RotateDeviceSecretResp
+		if resp, err = client.RotateDeviceSecret(forwardContext(ctx), req); err == nil {
+			metricForwarded.WithLabelValues("rotatedevicesecret", "ok").Inc()
+			return resp
+		}
+	}
+	log.Error().Uint32("reqid", req.Id).Str("node", node).Err(err).Msg("RotateDeviceSecret forward")
+	metricForwarded.WithLabelValues("rotatedevicesecret", "error").Inc()
+	return &devicehub.RotateDeviceSecretResp{Id: req.Id, Code: devicehub.Code_CODE_INTERNAL_SERVER_ERROR}
+}
@@ -0,0 +1,66 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/health"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	HealthUpdateInterval = time.Second
+)
+
+func updateHealth(hs *grpchealth.Server, checker *health.Checker) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if checker.Ready() {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	hs.SetServingStatus("", status)
+	hs.SetServingStatus(devicehub.AccessService_ServiceDesc.ServiceName, status)
+}
+
+// registerHealthServer serves grpc.health.v1 with the process readiness,
+// NOT_SERVING after ctx done.
+func registerHealthServer(ctx context.Context, s *grpc.Server, checker *health.Checker) {
+	hs := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(s, hs)
+	updateHealth(hs, checker)
+
+	go func() {
+		t := time.NewTicker(HealthUpdateInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				hs.Shutdown()
+				return
+			case <-t.C:
+				updateHealth(hs, checker)
+			}
+		}
+	}()
+}
@@ -0,0 +1,191 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/cluster"
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	IdempotencyKeyMetadata = "idempotency-key"
+	IdempotencyKeyLenMax   = 128
+	// IdempotencyCallerMetadata is the caller of a call forwarded to the
+	// owner node, trusted from peers only.
+	IdempotencyCallerMetadata = "rtio-idempotency-caller"
+	// IdempotencySkipMetadata marks a call forwarded from a CoPostStream,
+	// which is not deduplicated, trusted from peers only.
+	IdempotencySkipMetadata = "rtio-idempotency-skip"
+)
+
+var (
+	ErrIdempotencyKeyReused = errors.New("ErrIdempotencyKeyReused")
+)
+
+type coPostCall struct {
+	done   chan struct{}
+	sum    []byte // of the request, see requestSum
+	resp   *devicehub.CoResp
+	expire time.Time
+}
+
+// idempotencyCache deduplicates CoPost by (caller, device, key), a retry
+// joins the in-flight call or gets the cached response within the window. A
+// key reused for another request is rejected.
+type idempotencyCache struct {
+	window    time.Duration
+	calls     map[string]*coPostCall
+	lastSweep time.Time
+	lock      sync.Mutex
+}
+
+func newIdempotencyCache(window time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		window: window,
+		calls:  make(map[string]*coPostCall),
+	}
+}
+
+// idempotencyCaller gets the authenticated caller the keys are scoped by,
+// empty if authentication disabled.
+func idempotencyCaller(ctx context.Context) string {
+	if cluster.Forwarded(ctx) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(IdempotencyCallerMetadata); len(v) > 0 {
+				return v[0]
+			}
+		}
+	}
+	if c, ok := rpcauth.CallerFrom(ctx); ok {
+		return c.Name
+	}
+	return ""
+}
+
+type skipIdempotencyKey struct{}
+
+// skipIdempotency marks the requests of ctx not deduplicated.
+func skipIdempotency(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipIdempotencyKey{}, true)
+}
+
+// idempotencySkipped reports whether the requests of ctx are not
+// deduplicated, by skipIdempotency or by the peer forwarding it.
+func idempotencySkipped(ctx context.Context) bool {
+	if ctx.Value(skipIdempotencyKey{}) != nil {
+		return true
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(IdempotencySkipMetadata)) > 0 {
+		return cluster.Forwarded(ctx)
+	}
+	return false
+}
+
+// idempotencyKey gets key from metadata, or else the request id, scoped by
+// the caller and the device. False if neither is given, the id 0 is not a key.
+func idempotencyKey(ctx context.Context, req *devicehub.CoReq) (string, bool) {
+	if idempotencySkipped(ctx) {
+		return "", false
+	}
+	scope := strconv.Quote(idempotencyCaller(ctx)) + "/" + req.DeviceId
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(IdempotencyKeyMetadata); len(v) > 0 && len(v[0]) > 0 && len(v[0]) <= IdempotencyKeyLenMax {
+			return scope + "/k/" + v[0], true
+		}
+	}
+	if req.Id == 0 {
+		return "", false
+	}
+	return scope + "/i/" + strconv.FormatUint(uint64(req.Id), 10), true
+}
+
+// requestSum is the hash of the uri and data, a key reused for another
+// request has another sum.
+func requestSum(req *devicehub.CoReq) []byte {
+	h := sha256.New()
+	h.Write([]byte(req.Uri))
+	h.Write([]byte{0})
+	h.Write(req.Data)
+	return h.Sum(nil)
+}
+
+// shouldCache is false when the request surely did not reach the device, a retry can resend it.
+func shouldCache(code devicehub.Code) bool {
+	return code != devicehub.Code_CODE_DEVICEID_OFFLINE && code != devicehub.Code_CODE_BAD_REQUEST
+}
+
+func (c *idempotencyCache) sweepLocked(now time.Time) {
+	if now.Sub(c.lastSweep) < time.Second {
+		return
+	}
+	c.lastSweep = now
+	for k, call := range c.calls {
+		if call.resp != nil && now.After(call.expire) {
+			delete(c.calls, k)
+		}
+	}
+}
+
+// do calls f once for key, the others with same key and sum wait and get its
+// response. A call with same key and another sum gets ErrIdempotencyKeyReused.
+func (c *idempotencyCache) do(ctx context.Context, key string, sum []byte, f func() *devicehub.CoResp) (*devicehub.CoResp, bool, error) {
+	c.lock.Lock()
+	now := time.Now()
+	c.sweepLocked(now)
+	if call, ok := c.calls[key]; ok && (call.resp == nil || now.Before(call.expire)) {
+		c.lock.Unlock()
+		if !bytes.Equal(call.sum, sum) {
+			return nil, false, ErrIdempotencyKeyReused
+		}
+		select {
+		case <-call.done:
+			return call.resp, true, nil
+		case <-ctx.Done():
+			log.Warn().Str("key", key).Msg("CoPost idempotency wait ctx done")
+			return &devicehub.CoResp{Code: devicehub.Code_CODE_REQUEST_TIMEOUT}, true, nil
+		}
+	}
+	call := &coPostCall{done: make(chan struct{}), sum: sum}
+	c.calls[key] = call
+	c.lock.Unlock()
+
+	resp := f()
+
+	c.lock.Lock()
+	call.resp = resp
+	call.expire = time.Now().Add(c.window)
+	if !shouldCache(resp.Code) {
+		delete(c.calls, key)
+	}
+	c.lock.Unlock()
+	close(call.done)
+	return resp, false, nil
+}
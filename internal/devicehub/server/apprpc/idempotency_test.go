@@ -0,0 +1,130 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"google.golang.org/grpc/metadata"
+	"gotest.tools/assert"
+)
+
+func TestIdempotencyJoinInFlight(t *testing.T) {
+
+	c := newIdempotencyCache(time.Second)
+	sum := requestSum(&devicehub.CoReq{Uri: "/led", Data: []byte("on")})
+	var calls atomic.Int32
+	release := make(chan struct{})
+	f := func() *devicehub.CoResp {
+		calls.Add(1)
+		<-release
+		return &devicehub.CoResp{Code: devicehub.Code_CODE_OK, Data: []byte("done")}
+	}
+
+	wait := &sync.WaitGroup{}
+	sharedCount := atomic.Int32{}
+	for i := 0; i < 5; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			resp, shared, _ := c.do(context.Background(), "dev/i/1", sum, f)
+			assert.Equal(t, resp.Code, devicehub.Code_CODE_OK)
+			if shared {
+				sharedCount.Add(1)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wait.Wait()
+	assert.Equal(t, calls.Load(), int32(1))
+	assert.Equal(t, sharedCount.Load(), int32(4))
+
+	// cached within window
+	resp, shared, err := c.do(context.Background(), "dev/i/1", sum, f)
+	assert.NilError(t, err)
+	assert.Equal(t, shared, true)
+	assert.Equal(t, string(resp.Data), "done")
+	assert.Equal(t, calls.Load(), int32(1))
+
+	// the key reused for another request
+	other := requestSum(&devicehub.CoReq{Uri: "/led", Data: []byte("off")})
+	_, _, err = c.do(context.Background(), "dev/i/1", other, f)
+	assert.Equal(t, err, ErrIdempotencyKeyReused)
+	assert.Equal(t, calls.Load(), int32(1))
+}
+
+func TestIdempotencyExpireAndOffline(t *testing.T) {
+
+	c := newIdempotencyCache(10 * time.Millisecond)
+	sum := requestSum(&devicehub.CoReq{Uri: "/led", Data: []byte("on")})
+	var calls atomic.Int32
+	code := devicehub.Code_CODE_DEVICEID_OFFLINE
+	f := func() *devicehub.CoResp {
+		calls.Add(1)
+		return &devicehub.CoResp{Code: code}
+	}
+
+	// offline is not cached, retry resends
+	c.do(context.Background(), "dev/i/2", sum, f)
+	c.do(context.Background(), "dev/i/2", sum, f)
+	assert.Equal(t, calls.Load(), int32(2))
+
+	code = devicehub.Code_CODE_OK
+	c.do(context.Background(), "dev/i/2", sum, f)
+	c.do(context.Background(), "dev/i/2", sum, f)
+	assert.Equal(t, calls.Load(), int32(3))
+
+	time.Sleep(20 * time.Millisecond)
+	c.do(context.Background(), "dev/i/2", sum, f)
+	assert.Equal(t, calls.Load(), int32(4))
+}
+
+func TestIdempotencyKey(t *testing.T) {
+
+	req := &devicehub.CoReq{Id: 7, DeviceId: "dev"}
+	key, ok := idempotencyKey(context.Background(), req)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, key, `""/dev/i/7`)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(IdempotencyKeyMetadata, "retry-1"))
+	key, _ = idempotencyKey(ctx, req)
+	assert.Equal(t, key, `""/dev/k/retry-1`)
+
+	// no key and id 0, not deduplicated
+	_, ok = idempotencyKey(context.Background(), &devicehub.CoReq{DeviceId: "dev"})
+	assert.Equal(t, ok, false)
+
+	// scoped by the caller, a forged caller of a forwarded call is ignored
+	sum := sha256.Sum256([]byte("token1"))
+	ctx = callerContext(t, `{"callers":[{"name":"app1","token_sha256":"`+hex.EncodeToString(sum[:])+`","devices":["*"]}]}`, "token1")
+	key, _ = idempotencyKey(ctx, req)
+	assert.Equal(t, key, `"app1"/dev/i/7`)
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(IdempotencyCallerMetadata, "app1"))
+	key, _ = idempotencyKey(ctx, req)
+	assert.Equal(t, key, `""/dev/i/7`)
+}
@@ -0,0 +1,124 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/backendconn"
+	"github.com/mkrainbow/rtio/internal/devicehub/server/devicetcp"
+	"github.com/mkrainbow/rtio/internal/devicehub/server/registry"
+	"github.com/mkrainbow/rtio/internal/devicehub/server/verifier"
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/pkg/config"
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RotateDeviceSecret pushes a new secret to the connected device, and stores
+// it to the verifier after the device acked. The device is rotated back when
+// the verifier failed to store it. Only admin callers may rotate, so it is
+// refused when caller authentication is disabled. The secret is returned only
+// if generated by the hub, a secret given by the caller is not echoed.
+func (s *AccessServer) RotateDeviceSecret(ctx context.Context, req *devicehub.RotateDeviceSecretReq) (*devicehub.RotateDeviceSecretResp, error) {
+
+	if err := rpcauth.AuthorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if err := rpcauth.AuthorizeDevice(ctx, req.DeviceId); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	generated := req.NewSecret == ""
+	resp := s.rotateDeviceSecret(ctx, req)
+	resp.NewSecret = ""
+	// on timeout, the device may have stored the secret without the ack received
+	if generated && (resp.Code == devicehub.Code_CODE_OK || resp.Code == devicehub.Code_CODE_REQUEST_TIMEOUT) {
+		resp.NewSecret = req.NewSecret
+	}
+	observeRequest("rotatedevicesecret", resp.Code, start)
+	return resp, nil
+}
+
+func (s *AccessServer) rotateDeviceSecret(ctx context.Context, req *devicehub.RotateDeviceSecretReq) *devicehub.RotateDeviceSecretResp {
+
+	resp := &devicehub.RotateDeviceSecretResp{
+		Id: req.Id,
+	}
+	if req.NewSecret == "" {
+		secret, err := registry.NewSecret()
+		if err != nil {
+			log.Error().Uint32("reqid", req.Id).Err(err).Msg("RotateDeviceSecret")
+			resp.Code = devicehub.Code_CODE_INTERNAL_SERVER_ERROR
+			return resp
+		}
+		req.NewSecret = secret
+	}
+	if len(req.NewSecret) < int(dp.DeviceSecretLenMin) || len(req.NewSecret) > int(dp.DeviceSecretLenMax) {
+		log.Error().Uint32("reqid", req.Id).Int("len", len(req.NewSecret)).Msg("RotateDeviceSecret, secret length invalid")
+		resp.Code = devicehub.Code_CODE_BAD_REQUEST
+		return resp
+	}
+	session, ok := s.sessions.Get(req.DeviceId)
+	if !ok {
+		if node, ok := s.owner(ctx, req.DeviceId); ok {
+			return s.forwardRotateDeviceSecret(ctx, node, req)
+		}
+		log.Warn().Uint32("reqid", req.Id).Err(devicetcp.ErrSessionNotFound).Msg("RotateDeviceSecret")
+		resp.Code = devicehub.Code_CODE_DEVICEID_OFFLINE
+		return resp
+	}
+	v, err := backendconn.GetDeviceVerifier()
+	if err != nil || config.BoolKV.GetWithDefault("disable.deviceverify", false) {
+		log.Warn().Uint32("reqid", req.Id).Msg("RotateDeviceSecret, device verifier disabled")
+		resp.Code = devicehub.Code_CODE_METHOD_NOT_ALLOWED
+		return resp
+	}
+
+	timeout := s.timeouts.get(ctx, false, dp.URI_SecretRotation, req.TimeoutMs)
+	old, err := session.RotateSecret(ctx, req.NewSecret, timeout)
+	if err != nil {
+		switch err {
+		case devicetcp.ErrSendTimeout:
+			resp.Code = devicehub.Code_CODE_REQUEST_TIMEOUT
+		case devicetcp.ErrSessionDraining:
+			resp.Code = devicehub.Code_CODE_DEVICEID_OFFLINE
+		case devicetcp.ErrSecretUnknown, devicetcp.ErrSecretRotationNotSupported:
+			resp.Code = devicehub.Code_CODE_METHOD_NOT_ALLOWED
+		default:
+			resp.Code = devicehub.Code_CODE_INTERNAL_SERVER_ERROR
+		}
+		log.Error().Uint32("reqid", req.Id).Str("deviceid", req.DeviceId).Err(err).Msg("RotateDeviceSecret")
+		return resp
+	}
+	if err := verifier.UpdateSecret(v, req.DeviceId, req.NewSecret); err != nil {
+		log.Error().Uint32("reqid", req.Id).Str("deviceid", req.DeviceId).Err(err).Msg("RotateDeviceSecret, failed to store secret")
+		if _, err := session.RotateSecret(ctx, old, timeout); err != nil {
+			log.Error().Uint32("reqid", req.Id).Str("deviceid", req.DeviceId).Err(err).Msg("RotateDeviceSecret, failed to rotate back")
+		}
+		resp.Code = devicehub.Code_CODE_INTERNAL_SERVER_ERROR
+		return resp
+	}
+	log.Info().Uint32("reqid", req.Id).Str("deviceid", req.DeviceId).Msg("RotateDeviceSecret")
+	resp.Code = devicehub.Code_CODE_OK
+	return resp
+}
@@ -0,0 +1,87 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/devicetcp"
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gotest.tools/assert"
+)
+
+// callerContext authenticates the token by the callers of the file content,
+// as the rpc server does.
+func callerContext(t *testing.T, callers, token string) context.Context {
+	file := filepath.Join(t.TempDir(), "callers.json")
+	assert.NilError(t, os.WriteFile(file, []byte(callers), 0600))
+	store, err := rpcauth.LoadCallers(file)
+	assert.NilError(t, err)
+	in := metadata.NewIncomingContext(context.Background(), metadata.Pairs(rpcauth.AuthorizationKey, rpcauth.BearerPrefix+token))
+	var ctx context.Context
+	_, err = store.UnaryInterceptor(in, nil, &grpc.UnaryServerInfo{FullMethod: "/devicehub.AccessService/RotateDeviceSecret"},
+		func(c context.Context, req any) (any, error) {
+			ctx = c
+			return nil, nil
+		})
+	assert.NilError(t, err)
+	return ctx
+}
+
+func TestRotateDeviceSecret(t *testing.T) {
+
+	s := &AccessServer{sessions: &devicetcp.SessionMap{}, timeouts: newRequestTimeouts()}
+	deviceID := "cfa09baa-4913-4ad7-a936-3e26f9671b09"
+	sum := sha256.Sum256([]byte("token1"))
+	hash := hex.EncodeToString(sum[:])
+
+	// admin only, refused when caller authentication disabled
+	_, err := s.RotateDeviceSecret(context.Background(), &devicehub.RotateDeviceSecretReq{Id: 1, DeviceId: deviceID})
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+	ctx := callerContext(t, `{"callers":[{"name":"app1","token_sha256":"`+hash+`","devices":["*"]}]}`, "token1")
+	_, err = s.RotateDeviceSecret(ctx, &devicehub.RotateDeviceSecretReq{Id: 1, DeviceId: deviceID})
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+
+	ctx = callerContext(t, `{"callers":[{"name":"ops","token_sha256":"`+hash+`","devices":["*"],"admin":true}]}`, "token1")
+	resp, err := s.RotateDeviceSecret(ctx, &devicehub.RotateDeviceSecretReq{Id: 1, DeviceId: deviceID, NewSecret: "short"})
+	assert.NilError(t, err)
+	assert.Equal(t, resp.Code, devicehub.Code_CODE_BAD_REQUEST)
+
+	resp, err = s.RotateDeviceSecret(ctx, &devicehub.RotateDeviceSecretReq{Id: 2, DeviceId: deviceID})
+	assert.NilError(t, err)
+	assert.Equal(t, resp.Code, devicehub.Code_CODE_DEVICEID_OFFLINE)
+	assert.Equal(t, resp.NewSecret, "")
+
+	// the rotation uri is not posted by apps
+	coResp, err := s.CoPost(ctx, &devicehub.CoReq{Id: 3, DeviceId: deviceID, Uri: dp.URI_SecretRotation})
+	assert.NilError(t, err)
+	assert.Equal(t, coResp.Code, devicehub.Code_CODE_BAD_REQUEST)
+}
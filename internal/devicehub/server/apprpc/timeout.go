@@ -0,0 +1,137 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/devicetcp"
+	"github.com/mkrainbow/rtio/pkg/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	CoPostTimeoutDefault = 10 * time.Second
+	ObGetTimeoutDefault  = 20 * time.Second // until observation established
+	RequestTimeoutMin    = 100 * time.Millisecond
+
+	ErrTimeoutsLoad = errors.New("ErrTimeoutsLoad")
+)
+
+// URITimeout is the default timeouts of URIs matching the pattern, exactly or
+// by prefix when ending with '*'. Milliseconds, 0 for the server default.
+type URITimeout struct {
+	URI    string `json:"uri"`
+	CoPost uint32 `json:"copost"`
+	ObGet  uint32 `json:"obget"`
+}
+
+type uriTimeoutsFile struct {
+	URIs []URITimeout `json:"uris"`
+}
+
+// requestTimeouts gets the timeout of a request, asked by the request or the
+// default of its URI, clamped to [min, max], and within the call deadline.
+type requestTimeouts struct {
+	copost time.Duration
+	obget  time.Duration
+	min    time.Duration
+	max    time.Duration
+	uris   []URITimeout // first match wins
+}
+
+func newRequestTimeouts() *requestTimeouts {
+	return &requestTimeouts{
+		copost: CoPostTimeoutDefault,
+		obget:  ObGetTimeoutDefault,
+		min:    RequestTimeoutMin,
+		max:    devicetcp.SendTimeoutMax,
+	}
+}
+
+func msOrDefault(ms int, def time.Duration) time.Duration {
+	if ms <= 0 {
+		return def
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// loadRequestTimeouts loads the timeouts set by config.
+func loadRequestTimeouts() (*requestTimeouts, error) {
+	t := newRequestTimeouts()
+	t.copost = msOrDefault(config.IntKV.GetWithDefault("copost.timeout", 0), t.copost)
+	t.obget = msOrDefault(config.IntKV.GetWithDefault("obget.timeout", 0), t.obget)
+	t.min = msOrDefault(config.IntKV.GetWithDefault("request.timeout.min", 0), t.min)
+	t.max = min(msOrDefault(config.IntKV.GetWithDefault("request.timeout.max", 0), t.max), devicetcp.SendTimeoutMax)
+	if t.min > t.max {
+		t.min = t.max
+	}
+
+	if file := config.StringKV.GetWithDefault("request.timeout.uris", ""); file != "" {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			log.Error().Err(err).Str("file", file).Msg("Failed to read URI timeouts")
+			return nil, ErrTimeoutsLoad
+		}
+		f := &uriTimeoutsFile{}
+		if err := json.Unmarshal(buf, f); err != nil {
+			log.Error().Err(err).Str("file", file).Msg("Failed to unmarshal URI timeouts")
+			return nil, ErrTimeoutsLoad
+		}
+		t.uris = f.URIs
+		log.Info().Int("uris", len(t.uris)).Str("file", file).Msg("URI timeouts loaded")
+	}
+	return t, nil
+}
+
+func matchURI(pattern, uri string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(uri, pattern[:len(pattern)-1])
+	}
+	return pattern == uri
+}
+
+func (t *requestTimeouts) get(ctx context.Context, obget bool, uri string, reqMs uint32) time.Duration {
+	d := t.copost
+	if obget {
+		d = t.obget
+	}
+	for _, u := range t.uris {
+		if matchURI(u.URI, uri) {
+			if obget {
+				d = msOrDefault(int(u.ObGet), d)
+			} else {
+				d = msOrDefault(int(u.CoPost), d)
+			}
+			break
+		}
+	}
+	d = msOrDefault(int(reqMs), d)
+	d = max(t.min, min(d, t.max))
+	if deadline, ok := ctx.Deadline(); ok {
+		d = min(d, time.Until(deadline))
+	}
+	return d
+}
@@ -0,0 +1,56 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package apprpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestRequestTimeouts(t *testing.T) {
+
+	rt := newRequestTimeouts()
+	rt.max = time.Minute
+	rt.uris = []URITimeout{
+		{URI: "/printer/*", CoPost: 60000},
+		{URI: "/printer/status", CoPost: 1000}, // shadowed by the first
+		{URI: "/dashboard", ObGet: 2000},
+	}
+	ctx := context.Background()
+
+	assert.Equal(t, rt.get(ctx, false, "/rainbow", 0), CoPostTimeoutDefault)
+	assert.Equal(t, rt.get(ctx, true, "/rainbow", 0), ObGetTimeoutDefault)
+	assert.Equal(t, rt.get(ctx, false, "/printer/status", 0), time.Minute)
+	assert.Equal(t, rt.get(ctx, true, "/printer/status", 0), ObGetTimeoutDefault)
+	assert.Equal(t, rt.get(ctx, true, "/dashboard", 0), 2*time.Second)
+
+	// asked by the request, clamped
+	assert.Equal(t, rt.get(ctx, false, "/rainbow", 30000), 30*time.Second)
+	assert.Equal(t, rt.get(ctx, false, "/rainbow", 600000), time.Minute)
+	assert.Equal(t, rt.get(ctx, false, "/rainbow", 1), RequestTimeoutMin)
+
+	// within the call deadline
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	d := rt.get(ctx, false, "/rainbow", 30000)
+	assert.Assert(t, d <= time.Second && d > 900*time.Millisecond)
+}
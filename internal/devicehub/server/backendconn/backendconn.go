@@ -19,8 +19,13 @@
 package backendconn
 
 import (
+	"context"
 	"errors"
+	"strings"
+	"time"
 
+	"github.com/mkrainbow/rtio/internal/devicehub/server/provisioner"
+	"github.com/mkrainbow/rtio/internal/devicehub/server/registry"
 	"github.com/mkrainbow/rtio/internal/devicehub/server/service"
 	"github.com/mkrainbow/rtio/internal/devicehub/server/verifier"
 	"github.com/mkrainbow/rtio/pkg/config"
@@ -29,34 +34,164 @@ import (
 )
 
 var (
-	verifyClient    *verifier.Client
+	verifyClient    verifier.Verifier
 	ErrVerifyClient = errors.New("Failed to get device verify client")
 
 	serviceClient    *service.Client
 	ErrServiceClient = errors.New("Failed to get device service client")
+
+	provisionerClient    provisioner.Provisioner
+	ErrProvisionerClient = errors.New("Failed to get device provisioner client")
+
+	deviceRegistry *registry.Registry // shared by the verifier and the provisioner
 )
 
-func InitBackendConnn() {
+// InitBackendConnn inits the backend clients, devices are verified by the
+// verifiers of config deviceverifier.chain in order.
+func InitBackendConnn(ctx context.Context) error {
 
-	disableVerify := config.BoolKV.GetWithDefault("disable.deviceverify", false)
-	if !disableVerify {
-		url, ok := config.StringKV.Get("backend.deviceverifier")
-		if !ok {
-			log.Error().Msg("device service URL empty")
+	if !config.BoolKV.GetWithDefault("disable.deviceverify", false) {
+		v, err := newDeviceVerifier(ctx)
+		if err != nil {
+			return err
 		}
-		verifyClient = verifier.NewClient(url)
+		verifyClient = v
+	}
+	p, err := newDeviceProvisioner(ctx)
+	if err != nil {
+		return err
 	}
+	provisionerClient = p
+
+	timeout := time.Duration(config.IntKV.GetWithDefault("deviceservice.timeout", 0)) * time.Millisecond
+	serviceClient = service.NewClient(timeout)
+	return nil
+}
 
-	serviceClient = service.NewClient()
+// verifierChain gets the verifiers, 'registry' for the device registry or URLs,
+// the device registry if set otherwise backend.deviceverifier by default.
+func verifierChain() []string {
+	if chain := config.StringKV.GetWithDefault("deviceverifier.chain", ""); chain != "" {
+		var l []string
+		for _, v := range strings.Split(chain, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				l = append(l, v)
+			}
+		}
+		return l
+	}
+	if config.StringKV.GetWithDefault("device.registry", "") != "" {
+		return []string{"registry"}
+	}
+	url, ok := config.StringKV.Get("backend.deviceverifier")
+	if !ok {
+		log.Error().Msg("device verifier URL empty")
+	}
+	return []string{url}
 }
 
-func GetDeviceVerifier() (*verifier.Client, error) {
+// loadRegistry loads the device registry of config device.registry once.
+func loadRegistry(ctx context.Context) (*registry.Registry, error) {
+	if deviceRegistry != nil {
+		return deviceRegistry, nil
+	}
+	path := config.StringKV.GetWithDefault("device.registry", "")
+	if path == "" {
+		log.Error().Msg("device.registry empty for the device registry")
+		return nil, ErrVerifyClient
+	}
+	r, err := registry.LoadRegistry(path)
+	if err != nil {
+		return nil, err
+	}
+	go r.ReloadLoop(ctx, 5*time.Second)
+	deviceRegistry = r
+	return r, nil
+}
+
+// newDeviceProvisioner gets the provisioner of backend.deviceprovisioner, or
+// enrolling into the device registry by the claims of device.claims, nil
+// when enrollment disabled.
+func newDeviceProvisioner(ctx context.Context) (provisioner.Provisioner, error) {
+	if url := config.StringKV.GetWithDefault("backend.deviceprovisioner", ""); url != "" {
+		timeout := time.Duration(config.IntKV.GetWithDefault("deviceprovisioner.timeout", 0)) * time.Millisecond
+		return provisioner.NewClient(url, timeout)
+	}
+	path := config.StringKV.GetWithDefault("device.claims", "")
+	if path == "" {
+		return nil, nil
+	}
+	claims, err := registry.LoadClaims(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := loadRegistry(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return provisioner.NewLocal(claims, r, config.StringKV.GetWithDefault("device.claims.hash", registry.HashBcrypt)), nil
+}
+
+// newDeviceVerifier chains the verifiers, each URL behind a circuit breaker,
+// then caches the results and applies the fail-open policy.
+func newDeviceVerifier(ctx context.Context) (verifier.Verifier, error) {
+	timeout := time.Duration(config.IntKV.GetWithDefault("deviceverifier.timeout", 0)) * time.Millisecond
+	failures := config.IntKV.GetWithDefault("deviceverifier.breaker.failures", 0)
+	cooldown := time.Duration(config.IntKV.GetWithDefault("deviceverifier.breaker.cooldown", 0)) * time.Second
+
+	var chain verifier.Chain
+	for _, name := range verifierChain() {
+		if name == "registry" {
+			r, err := loadRegistry(ctx)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, r)
+			continue
+		}
+		v, err := verifier.New(name, timeout)
+		if err != nil {
+			return nil, err
+		}
+		if failures > 0 {
+			v = verifier.NewBreaker(name, v, failures, cooldown)
+		}
+		chain = append(chain, v)
+	}
+
+	var v verifier.Verifier = chain
+	if len(chain) == 1 {
+		v = chain[0]
+	}
+	ttl := time.Duration(config.IntKV.GetWithDefault("deviceverifier.cache.ttl", 0)) * time.Second
+	negativeTTL := time.Duration(config.IntKV.GetWithDefault("deviceverifier.cache.negativettl", 0)) * time.Second
+	if ttl > 0 || negativeTTL > 0 {
+		v = verifier.NewCache(v, ttl, negativeTTL)
+	}
+	if config.BoolKV.GetWithDefault("deviceverifier.failopen", false) {
+		log.Warn().Msg("Device verifier fail-open, devices pass when verifiers fail")
+		v = verifier.FailOpen{Verifier: v}
+	}
+	return v, nil
+}
+
+func GetDeviceVerifier() (verifier.Verifier, error) {
 
 	if verifyClient != nil {
 		return verifyClient, nil
 	}
 	return nil, ErrVerifyClient
 }
+
+// GetDeviceProvisioner gets the provisioner of enrolling devices,
+// ErrProvisionerClient when enrollment disabled.
+func GetDeviceProvisioner() (provisioner.Provisioner, error) {
+
+	if provisionerClient != nil {
+		return provisionerClient, nil
+	}
+	return nil, ErrProvisionerClient
+}
 func GetServiceClient() (*service.Client, error) {
 
 	if serviceClient != nil {
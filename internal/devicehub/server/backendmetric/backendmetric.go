@@ -0,0 +1,38 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package backendmetric
+
+import (
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/metrics"
+)
+
+var metricDuration = metrics.NewHistogramVec("rtio_backend_request_duration_seconds",
+	"Backend request latency by backend and result.", nil, "backend", "result")
+
+// Observe records the latency of a backend request since start, such as of
+// the deviceservice, verifier, provisioner or hubconfiger.
+func Observe(backend string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	metricDuration.WithLabelValues(backend, result).ObserveSince(start)
+}
@@ -0,0 +1,206 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+// Package cluster runs hub nodes as a cluster. Each node registers the
+// devices of its sessions in a session directory, and AccessService calls for
+// devices on other nodes are forwarded to the owning node.
+package cluster
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/pkg/config"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ForwardedKey is the metadata key of calls forwarded by a node, which are not forwarded again.
+	ForwardedKey = "rtio-forwarded"
+	// PeerTokenKey is the metadata key of the cluster token, see Peer.
+	PeerTokenKey = "rtio-cluster-token"
+)
+
+var (
+	ErrNoPeerToken = errors.New("ErrNoPeerToken")
+)
+
+type Node struct {
+	Addr      string // rpc address advertised to peers
+	Directory Directory
+	lock      sync.Mutex
+	conns     map[string]*grpc.ClientConn
+}
+
+// NewNode creates the node with a StaticPeerDirectory, peers are rpc addresses
+// separated by commas.
+func NewNode(ctx context.Context, addr, peers string) (*Node, error) {
+	if peerToken() == "" {
+		log.Error().Msg("cluster.token is required in cluster mode")
+		return nil, ErrNoPeerToken
+	}
+	n := &Node{
+		Addr:  addr,
+		conns: make(map[string]*grpc.ClientConn),
+	}
+	peerAddrs := make([]string, 0)
+	for _, p := range strings.Split(peers, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			peerAddrs = append(peerAddrs, p)
+		}
+	}
+	dir, err := NewStaticPeerDirectory(addr, peerAddrs, func(addr string) (devicehub.ClusterServiceClient, error) {
+		conn, err := n.conn(addr)
+		if err != nil {
+			return nil, err
+		}
+		return devicehub.NewClusterServiceClient(conn), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	n.Directory = dir
+	log.Info().Str("node", addr).Strs("peers", peerAddrs).Msg("cluster enabled")
+	go dir.Run(ctx)
+	go func() {
+		<-ctx.Done()
+		n.close()
+	}()
+	return n, nil
+}
+
+func (n *Node) conn(addr string) (*grpc.ClientConn, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if conn, ok := n.conns[addr]; ok {
+		return conn, nil
+	}
+	dialOpts, err := rpcauth.InternalDialOptions()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.NewClient(addr, dialOpts...)
+	if err != nil {
+		log.Error().Err(err).Str("node", addr).Msg("dial node")
+		return nil, err
+	}
+	n.conns[addr] = conn
+	return conn, nil
+}
+
+func (n *Node) close() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	for addr, conn := range n.conns {
+		conn.Close()
+		delete(n.conns, addr)
+	}
+}
+
+// Owner gets the other node holding the device session, false if the device
+// is not known or is on this node.
+func (n *Node) Owner(deviceID string) (string, bool) {
+	node, ok := n.Directory.Lookup(deviceID)
+	if !ok || node == n.Addr {
+		return "", false
+	}
+	return node, true
+}
+
+// Client gets the AccessService client of the node.
+func (n *Node) Client(node string) (devicehub.AccessServiceClient, error) {
+	conn, err := n.conn(node)
+	if err != nil {
+		return nil, err
+	}
+	return devicehub.NewAccessServiceClient(conn), nil
+}
+
+func peerToken() string {
+	return config.StringKV.GetWithDefault("cluster.token", "")
+}
+
+// PeerContext adds the cluster token to the outgoing call, if configured.
+func PeerContext(ctx context.Context) context.Context {
+	if token := peerToken(); token != "" {
+		return metadata.AppendToOutgoingContext(ctx, PeerTokenKey, token)
+	}
+	return ctx
+}
+
+// ForwardContext marks the outgoing call forwarded, with the cluster token.
+func ForwardContext(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(PeerContext(ctx), ForwardedKey, "1")
+}
+
+// Peer reports whether the incoming call carries the cluster token, false if
+// no token is configured.
+func Peer(ctx context.Context) bool {
+	token := peerToken()
+	if token == "" {
+		return false
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	for _, t := range md.Get(PeerTokenKey) {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Forwarded reports whether the incoming call is forwarded by a peer. The
+// mark of callers without the cluster token is ignored.
+func Forwarded(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(ForwardedKey)) > 0 && Peer(ctx)
+}
+
+type syncServer struct {
+	devicehub.UnimplementedClusterServiceServer
+	dir *StaticPeerDirectory
+}
+
+func (s *syncServer) DirectorySync(ctx context.Context, req *devicehub.DirectorySyncReq) (*devicehub.DirectorySyncResp, error) {
+	if !Peer(ctx) {
+		log.Warn().Str("node", req.Node).Msg("directory sync without cluster token")
+		return nil, status.Error(codes.Unauthenticated, ErrNoPeerToken.Error())
+	}
+	s.dir.Apply(req)
+	return &devicehub.DirectorySyncResp{Code: devicehub.Code_CODE_OK}, nil
+}
+
+// Register serves ClusterService of the node on s.
+func (n *Node) Register(s *grpc.Server) {
+	if dir, ok := n.Directory.(*StaticPeerDirectory); ok {
+		devicehub.RegisterClusterServiceServer(s, &syncServer{dir: dir})
+	}
+}
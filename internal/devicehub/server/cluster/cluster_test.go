@@ -0,0 +1,58 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package cluster
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mkrainbow/rtio/pkg/config"
+
+	"google.golang.org/grpc/metadata"
+	"gotest.tools/assert"
+)
+
+// incoming turns the outgoing metadata of ctx into incoming metadata.
+func incoming(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func TestForwarded(t *testing.T) {
+	config.StringKV.Set("cluster.token", "")
+	ctx := incoming(ForwardContext(context.Background()))
+	assert.Equal(t, false, Peer(ctx))
+	assert.Equal(t, false, Forwarded(ctx))
+
+	config.StringKV.Set("cluster.token", "peer-secret")
+	defer config.StringKV.Set("cluster.token", "")
+	assert.Equal(t, false, Forwarded(ctx))
+
+	forged := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(ForwardedKey, "1", PeerTokenKey, "guess"))
+	assert.Equal(t, false, Forwarded(forged))
+
+	ctx = incoming(ForwardContext(context.Background()))
+	assert.Equal(t, true, Peer(ctx))
+	assert.Equal(t, true, Forwarded(ctx))
+
+	ctx = incoming(PeerContext(context.Background()))
+	assert.Equal(t, true, Peer(ctx))
+	assert.Equal(t, false, Forwarded(ctx))
+}
@@ -0,0 +1,275 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/metrics"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Directory maps device IDs to the node holding the device session.
+type Directory interface {
+	// Register records the device session is on this node.
+	Register(deviceID string)
+	Unregister(deviceID string)
+	// Lookup gets the rpc address of the node holding the device session.
+	Lookup(deviceID string) (node string, ok bool)
+}
+
+var (
+	SyncInterval     = 200 * time.Millisecond
+	FullSyncInterval = 30 * time.Second
+	NodeTTL          = 3 * FullSyncInterval // devices of a node are forgotten if not synced
+	SyncBatchMax     = 10000
+	SyncTimeout      = 5 * time.Second
+
+	metricSyncs = metrics.NewCounterVec("rtio_cluster_directory_syncs_total", "Directory syncs sent to peers, ok or error.", "result")
+)
+
+type peer struct {
+	addr    string
+	client  devicehub.ClusterServiceClient
+	added   map[string]struct{}
+	removed map[string]struct{}
+	full    bool // next sync sends all devices
+}
+
+func (p *peer) clear() {
+	p.added = make(map[string]struct{})
+	p.removed = make(map[string]struct{})
+}
+
+type remoteDevice struct {
+	node string
+}
+
+// StaticPeerDirectory keeps the directory in memory on every node. Each node
+// pushes changes of its devices to the static peers, and all its devices
+// periodically, so a restarted peer catches up.
+type StaticPeerDirectory struct {
+	node     string
+	peers    []*peer
+	lock     sync.Mutex
+	owned    map[string]struct{}     // devices on this node
+	remote   map[string]remoteDevice // devices on the other nodes
+	nodeSeen map[string]time.Time    // last sync received from the node
+}
+
+// NewStaticPeerDirectory node is the rpc address of this node advertised to
+// peers, dial returns the client of a peer.
+func NewStaticPeerDirectory(node string, peerAddrs []string, dial func(addr string) (devicehub.ClusterServiceClient, error)) (*StaticPeerDirectory, error) {
+	d := &StaticPeerDirectory{
+		node:     node,
+		owned:    make(map[string]struct{}),
+		remote:   make(map[string]remoteDevice),
+		nodeSeen: make(map[string]time.Time),
+	}
+	for _, addr := range peerAddrs {
+		if addr == node {
+			continue
+		}
+		client, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		p := &peer{addr: addr, client: client, full: true}
+		p.clear()
+		d.peers = append(d.peers, p)
+	}
+	metrics.NewGaugeFunc("rtio_cluster_directory_devices", "Devices on the other nodes known by the directory.", func() float64 {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		return float64(len(d.remote))
+	})
+	return d, nil
+}
+
+func (d *StaticPeerDirectory) Register(deviceID string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.owned[deviceID] = struct{}{}
+	for _, p := range d.peers {
+		delete(p.removed, deviceID)
+		p.added[deviceID] = struct{}{}
+	}
+}
+
+func (d *StaticPeerDirectory) Unregister(deviceID string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.owned, deviceID)
+	for _, p := range d.peers {
+		delete(p.added, deviceID)
+		p.removed[deviceID] = struct{}{}
+	}
+}
+
+func (d *StaticPeerDirectory) Lookup(deviceID string) (string, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.owned[deviceID]; ok {
+		return d.node, true
+	}
+	dev, ok := d.remote[deviceID]
+	if !ok || time.Since(d.nodeSeen[dev.node]) > NodeTTL {
+		return "", false
+	}
+	return dev.node, true
+}
+
+// Apply updates devices of the sending node.
+func (d *StaticPeerDirectory) Apply(req *devicehub.DirectorySyncReq) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.nodeSeen[req.Node] = time.Now()
+	if req.Full {
+		for id, dev := range d.remote {
+			if dev.node == req.Node {
+				delete(d.remote, id)
+			}
+		}
+	}
+	for _, id := range req.Added {
+		d.remote[id] = remoteDevice{node: req.Node}
+	}
+	for _, id := range req.Removed {
+		if dev, ok := d.remote[id]; ok && dev.node == req.Node { // may be moved to another node
+			delete(d.remote, id)
+		}
+	}
+}
+
+// expire forgets devices of nodes not synced in NodeTTL.
+func (d *StaticPeerDirectory) expire() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for node, seen := range d.nodeSeen {
+		if time.Since(seen) <= NodeTTL {
+			continue
+		}
+		log.Warn().Str("node", node).Msg("cluster node expired")
+		delete(d.nodeSeen, node)
+		for id, dev := range d.remote {
+			if dev.node == node {
+				delete(d.remote, id)
+			}
+		}
+	}
+}
+
+func keys(m map[string]struct{}) []string {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// takeSync gets the requests to send to the peer, all devices if full.
+func (d *StaticPeerDirectory) takeSync(p *peer, full bool) []*devicehub.DirectorySyncReq {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var added, removed []string
+	full = full || p.full
+	if full {
+		added = keys(d.owned)
+	} else {
+		added, removed = keys(p.added), keys(p.removed)
+	}
+	p.clear()
+	p.full = false
+
+	reqs := make([]*devicehub.DirectorySyncReq, 0)
+	for first := true; first || len(added) > 0 || len(removed) > 0; first = false {
+		req := &devicehub.DirectorySyncReq{Node: d.node, Full: full && first}
+		n := min(len(added), SyncBatchMax)
+		req.Added, added = added[:n], added[n:]
+		n = min(len(removed), SyncBatchMax-len(req.Added))
+		req.Removed, removed = removed[:n], removed[n:]
+		if !full && len(req.Added) == 0 && len(req.Removed) == 0 {
+			break
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs
+}
+
+func (d *StaticPeerDirectory) syncPeer(ctx context.Context, p *peer, full bool) {
+	for _, req := range d.takeSync(p, full) {
+		callCtx, cancel := context.WithTimeout(PeerContext(ctx), SyncTimeout)
+		_, err := p.client.DirectorySync(callCtx, req)
+		cancel()
+		if err != nil {
+			metricSyncs.WithLabelValues("error").Inc()
+			log.Debug().Err(err).Str("peer", p.addr).Msg("directory sync")
+			d.lock.Lock()
+			p.full = true // changes are lost, send all devices next time
+			d.lock.Unlock()
+			return
+		}
+		metricSyncs.WithLabelValues("ok").Inc()
+	}
+}
+
+// Run syncs with peers until ctx done.
+func (d *StaticPeerDirectory) Run(ctx context.Context) {
+	wait := &sync.WaitGroup{}
+	for _, p := range d.peers {
+		wait.Add(1)
+		go func(p *peer) {
+			defer wait.Done()
+			t := time.NewTicker(SyncInterval)
+			defer t.Stop()
+			lastFull := time.Time{}
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					full := time.Since(lastFull) >= FullSyncInterval
+					if full {
+						lastFull = time.Now()
+					}
+					d.syncPeer(ctx, p, full)
+				}
+			}
+		}(p)
+	}
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		t := time.NewTicker(FullSyncInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				d.expire()
+			}
+		}
+	}()
+	wait.Wait()
+}
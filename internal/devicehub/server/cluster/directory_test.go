@@ -0,0 +1,143 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"google.golang.org/grpc"
+	"gotest.tools/assert"
+)
+
+// fakePeer applies syncs to the directory of the peer.
+type fakePeer struct {
+	dir  *StaticPeerDirectory
+	down bool
+}
+
+func (p *fakePeer) DirectorySync(ctx context.Context, in *devicehub.DirectorySyncReq, opts ...grpc.CallOption) (*devicehub.DirectorySyncResp, error) {
+	if p.down {
+		return nil, errors.New("down")
+	}
+	p.dir.Apply(in)
+	return &devicehub.DirectorySyncResp{Code: devicehub.Code_CODE_OK}, nil
+}
+
+func newPair(t *testing.T) (a, b *StaticPeerDirectory, toB *fakePeer) {
+	toB = &fakePeer{}
+	toA := &fakePeer{}
+	var err error
+	a, err = NewStaticPeerDirectory("a:17018", []string{"a:17018", "b:17018"}, func(addr string) (devicehub.ClusterServiceClient, error) {
+		return toB, nil
+	})
+	assert.NilError(t, err)
+	b, err = NewStaticPeerDirectory("b:17018", []string{"a:17018", "b:17018"}, func(addr string) (devicehub.ClusterServiceClient, error) {
+		return toA, nil
+	})
+	assert.NilError(t, err)
+	toB.dir, toA.dir = b, a
+	return a, b, toB
+}
+
+func TestDirectorySync(t *testing.T) {
+	a, b, toB := newPair(t)
+	assert.Equal(t, len(a.peers), 1)
+	ctx := context.Background()
+
+	a.Register("dev1")
+	a.Register("dev2")
+	node, ok := a.Lookup("dev1")
+	assert.Assert(t, ok)
+	assert.Equal(t, node, "a:17018")
+
+	a.syncPeer(ctx, a.peers[0], false) // the first is full
+	node, ok = b.Lookup("dev1")
+	assert.Assert(t, ok)
+	assert.Equal(t, node, "a:17018")
+
+	a.Unregister("dev1")
+	a.syncPeer(ctx, a.peers[0], false)
+	_, ok = b.Lookup("dev1")
+	assert.Assert(t, !ok)
+	_, ok = b.Lookup("dev2")
+	assert.Assert(t, ok)
+
+	// changes lost while the peer is down are sent in the next full sync
+	toB.down = true
+	a.Unregister("dev2")
+	a.Register("dev3")
+	a.syncPeer(ctx, a.peers[0], false)
+	toB.down = false
+	a.syncPeer(ctx, a.peers[0], false)
+	_, ok = b.Lookup("dev2")
+	assert.Assert(t, !ok)
+	_, ok = b.Lookup("dev3")
+	assert.Assert(t, ok)
+}
+
+func TestDirectoryDeviceMoved(t *testing.T) {
+	_, b, _ := newPair(t)
+
+	b.Apply(&devicehub.DirectorySyncReq{Node: "a:17018", Added: []string{"dev1"}})
+	b.Apply(&devicehub.DirectorySyncReq{Node: "c:17018", Added: []string{"dev1"}})
+	// removed by the old node after the device reconnected to another
+	b.Apply(&devicehub.DirectorySyncReq{Node: "a:17018", Removed: []string{"dev1"}})
+	node, ok := b.Lookup("dev1")
+	assert.Assert(t, ok)
+	assert.Equal(t, node, "c:17018")
+
+	// full replaces devices of the node
+	b.Apply(&devicehub.DirectorySyncReq{Node: "c:17018", Full: true, Added: []string{"dev2"}})
+	_, ok = b.Lookup("dev1")
+	assert.Assert(t, !ok)
+}
+
+func TestDirectoryNodeExpire(t *testing.T) {
+	_, b, _ := newPair(t)
+
+	b.Apply(&devicehub.DirectorySyncReq{Node: "a:17018", Added: []string{"dev1"}})
+	b.nodeSeen["a:17018"] = time.Now().Add(-NodeTTL - time.Second)
+	_, ok := b.Lookup("dev1")
+	assert.Assert(t, !ok)
+	b.expire()
+	assert.Equal(t, len(b.remote), 0)
+}
+
+func TestDirectorySyncBatch(t *testing.T) {
+	a, _, _ := newPair(t)
+	old := SyncBatchMax
+	SyncBatchMax = 2
+	defer func() { SyncBatchMax = old }()
+
+	for _, id := range []string{"dev1", "dev2", "dev3"} {
+		a.Register(id)
+	}
+	reqs := a.takeSync(a.peers[0], true)
+	assert.Equal(t, len(reqs), 2)
+	assert.Assert(t, reqs[0].Full)
+	assert.Assert(t, !reqs[1].Full)
+	assert.Equal(t, len(reqs[0].Added)+len(reqs[1].Added), 3)
+
+	assert.Equal(t, len(a.takeSync(a.peers[0], false)), 0)
+}
@@ -29,18 +29,23 @@ import (
 	"net/http"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/mkrainbow/rtio/internal/devicehub/server/backendmetric"
 	"github.com/mkrainbow/rtio/pkg/config"
+	"github.com/mkrainbow/rtio/pkg/health"
 	"github.com/mkrainbow/rtio/pkg/rtioutil"
 )
 
 var (
 	ErrRequestIDNotMatch = errors.New("Failed to get device verify client")
+	ErrConfigNotLoaded   = errors.New("ErrConfigNotLoaded")
 
 	currentConfigDigest uint32
+	configLoaded        atomic.Bool
 )
 
 type Config struct {
@@ -90,8 +95,9 @@ func (c *Client) postRequest(req *ConfigReq) (*ConfigResp, error) {
 		log.Error().Err(err).Msg("Failed to NewRequest")
 		return nil, err
 	}
+	start := time.Now()
 	httpResp, err := c.client.Do(httpReq)
-
+	backendmetric.Observe("hubconfiger", start, err)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to post req")
 		return nil, err
@@ -167,7 +173,9 @@ func tryUpdateConfig(c *Client) {
 		for k, v := range c.DeviceServiceMap {
 			d := crc32.ChecksumIEEE([]byte(k))
 			config.StringKV.Set("deviceservice."+strconv.FormatUint(uint64(d), 16), v)
+			config.StringKV.Set("deviceservice.uri."+strconv.FormatUint(uint64(d), 16), k)
 		}
+		configLoaded.Store(true)
 
 		// show configs
 		for _, v := range config.StringKV.List() {
@@ -176,15 +184,26 @@ func tryUpdateConfig(c *Client) {
 	}
 }
 
+// checkConfigLoaded is the readiness check, config loaded at least once.
+func checkConfigLoaded() error {
+	if !configLoaded.Load() {
+		return ErrConfigNotLoaded
+	}
+	return nil
+}
+
 func HubConfigerInit(ctx context.Context, wait *sync.WaitGroup) {
 
 	currentConfigDigest = 0
+	configLoaded.Store(false)
+	health.Register("hubconfiger", checkConfigLoaded)
 	url, ok := config.StringKV.Get("backend.hubconfiger")
 	if !ok {
 		log.Error().Msg("hub configer URL empty, hubconfiger route exit")
 		return
 	}
 	httpclient := newHttpClient(url)
+	tryUpdateConfig(httpclient)
 
 	t := time.NewTicker(time.Second * 5)
 	defer t.Stop()
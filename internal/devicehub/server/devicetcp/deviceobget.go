@@ -0,0 +1,237 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicetcp
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/backendconn"
+	"github.com/mkrainbow/rtio/internal/devicehub/server/service"
+	"github.com/mkrainbow/rtio/pkg/config"
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+	"github.com/mkrainbow/rtio/pkg/rtioutil"
+	"github.com/mkrainbow/rtio/pkg/timekv"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	DeviceObNotifyTimeout = 20 * time.Second // device answers a notification
+)
+
+// deviceObserva is an observation by the device of a device service resource,
+// the observer id is generated by the device.
+type deviceObserva struct {
+	obID          uint16
+	terminateChan chan struct{} // session draining
+}
+
+// deviceObNotifier gets the notifications of an observation, by the device service.
+type deviceObNotifier func(ctx context.Context, dev *service.Device, uri string, data []byte) (<-chan []byte, error)
+
+func serviceObNotifier(url string) deviceObNotifier {
+	return func(ctx context.Context, dev *service.Device, uri string, data []byte) (<-chan []byte, error) {
+		c, err := backendconn.GetServiceClient()
+		if err != nil {
+			log.Error().Err(err).Msg("Falied to get client for service")
+			return nil, err
+		}
+		id, err := rtioutil.GenUint32ID()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to get uint32 id")
+			return nil, err
+		}
+		log.Info().Uint32("obgetid", id).Str("uri", uri).Msg("ObGet to device service")
+		return c.ObGet(ctx, id, url, dev, uri, data)
+	}
+}
+
+func (s *Session) receiveDeviceObEstabReq(ctx context.Context, header *dp.Header, buf []byte) error {
+	req, err := dp.DecodeObGetEstabReq(header.ID, buf)
+	if err != nil {
+		log.Error().Err(err).Msg("receive device ObEstabReq")
+		return err
+	}
+	resp := &dp.ObGetEstabResp{
+		HeaderID: req.HeaderID,
+		Method:   req.Method,
+		ObID:     req.ObID,
+	}
+	uriKey := strconv.FormatUint(uint64(req.URI), 16)
+	url, ok := config.StringKV.Get("deviceservice." + uriKey)
+	if !ok {
+		resp.Code = dp.StatusCode_NotFount
+		return s.sendDeviceObEstabResp(ctx, resp)
+	}
+	uri := config.StringKV.GetWithDefault("deviceservice.uri."+uriKey, "")
+	return s.establishDeviceOb(ctx, req, uri, serviceObNotifier(url))
+}
+
+// establishDeviceOb answers the establishment after the notifier, notifies
+// the device in background.
+func (s *Session) establishDeviceOb(ctx context.Context, req *dp.ObGetEstabReq, uri string, notifier deviceObNotifier) error {
+	resp := &dp.ObGetEstabResp{
+		HeaderID: req.HeaderID,
+		Method:   req.Method,
+		ObID:     req.ObID,
+	}
+	if req.ObID == 0 {
+		resp.Code = dp.StatusCode_BadRequest
+		return s.sendDeviceObEstabResp(ctx, resp)
+	}
+	if s.deviceObCount.Load() >= dp.OBGET_OBSERVERS_MAX {
+		resp.Code = dp.StatusCode_TooManyObservers
+		return s.sendDeviceObEstabResp(ctx, resp)
+	}
+	if err := s.enter(); err != nil { // held until the observation ends
+		resp.Code = dp.StatusCode_InternalServerError
+		return s.sendDeviceObEstabResp(ctx, resp)
+	}
+	ob := &deviceObserva{obID: req.ObID, terminateChan: make(chan struct{}, 1)}
+	if _, loaded := s.deviceObStore.LoadOrStore(ob.obID, ob); loaded {
+		s.leave()
+		log.Warn().Uint16("obid", req.ObID).Msg("device observation exists")
+		resp.Code = dp.StatusCode_BadRequest
+		return s.sendDeviceObEstabResp(ctx, resp)
+	}
+	s.deviceObCount.Add(1)
+	metricDeviceObservers.Inc()
+	go s.deviceObserve(ctx, ob, resp, uri, req.Data, notifier)
+	return nil
+}
+
+func (s *Session) deviceObserve(ctx context.Context, ob *deviceObserva, resp *dp.ObGetEstabResp, uri string,
+	data []byte, notifier deviceObNotifier) {
+
+	defer s.leave()
+	defer func() {
+		s.deviceObStore.Delete(ob.obID)
+		s.deviceObCount.Add(-1)
+		metricDeviceObservers.Dec()
+		log.Debug().Uint16("obid", ob.obID).Msg("device observation exit")
+	}()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dev := &service.Device{ID: s.deviceID, RemoteAddr: s.RemoteAddr.String(), ConnectTime: s.ConnectTime.Unix()}
+	notifyChan, err := notifier(ctx, dev, uri, data)
+	if err != nil {
+		resp.Code = dp.StatusCode_InternalServerError
+		if err == service.ErrBadRequest {
+			resp.Code = dp.StatusCode_BadRequest
+		}
+		s.sendDeviceObEstabResp(ctx, resp)
+		return
+	}
+	resp.Code = dp.StatusCode_Continue
+	if err := s.sendDeviceObEstabResp(ctx, resp); err != nil {
+		return
+	}
+	log.Info().Uint16("obid", ob.obID).Str("uri", uri).Msg("device observation created")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ob.terminateChan:
+			s.notifyDevice(ctx, ob.obID, dp.StatusCode_Terminate, nil)
+			return
+		case data, ok := <-notifyChan:
+			if !ok {
+				s.notifyDevice(ctx, ob.obID, dp.StatusCode_Terminate, nil)
+				return
+			}
+			if len(data) > int(s.BodyCapSize-dp.HeaderLen_ObGetNotifyReq) {
+				log.Warn().Uint16("obid", ob.obID).Int("len", len(data)).Msg("device observation, notification over capacity and dropped")
+				continue
+			}
+			code, err := s.notifyDevice(ctx, ob.obID, dp.StatusCode_Continue, data)
+			if err != nil || code != dp.StatusCode_Continue {
+				log.Debug().Uint16("obid", ob.obID).Str("status", code.String()).Msg("device observation terminated by device")
+				return
+			}
+		}
+	}
+}
+
+func (s *Session) sendDeviceObEstabResp(ctx context.Context, resp *dp.ObGetEstabResp) error {
+	log.Info().Uint16("obid", resp.ObID).Str("status", resp.Code.String()).Msg("send device ObEstabResp")
+	buf := make([]byte, dp.HeaderLen+dp.HeaderLen_ObGetEstabResp)
+	if err := dp.EncodeObGetEstabResp_OverDeviceSendResp(resp, buf); err != nil {
+		log.Error().Uint16("obid", resp.ObID).Err(err).Msg("send device ObEstabResp")
+		return err
+	}
+	select {
+	case s.outgoingChan <- buf:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// notifyDevice sends a notification and waits the device answers, Continue or Terminate.
+func (s *Session) notifyDevice(ctx context.Context, obID uint16, code dp.StatusCode, data []byte) (dp.StatusCode, error) {
+	headerID := s.genHeaderID()
+	req := &dp.ObGetNotifyReq{
+		HeaderID: headerID,
+		Method:   dp.Method_ObservedGet,
+		Code:     code,
+		ObID:     obID,
+		Data:     data,
+	}
+	buf := make([]byte, int(dp.HeaderLen+dp.HeaderLen_ObGetNotifyReq)+len(data))
+	if err := dp.EncodeObGetNotifyReq_OverServerSendReq(req, buf); err != nil {
+		log.Error().Uint16("obid", obID).Err(err).Msg("send device ObNotifyReq")
+		return dp.StatusCode_Unknown, err
+	}
+	respChan := make(chan []byte, 1)
+	s.sendIDStore.Set(timekv.Key(headerID), &timekv.Value{C: respChan})
+	defer s.sendIDStore.Del(timekv.Key(headerID))
+	select {
+	case s.outgoingChan <- buf:
+	case <-ctx.Done():
+		return dp.StatusCode_Unknown, ctx.Err()
+	}
+
+	t := time.NewTimer(DeviceObNotifyTimeout)
+	defer t.Stop()
+	select {
+	case body, ok := <-respChan:
+		if !ok {
+			return dp.StatusCode_Unknown, ErrSendRespChannClose
+		}
+		resp, err := dp.DecodeObGetNotifyResp(headerID, body)
+		if err != nil {
+			log.Error().Uint16("obid", obID).Err(err).Msg("receive device ObNotifyResp")
+			return dp.StatusCode_Unknown, err
+		}
+		if resp.ObID != obID {
+			log.Error().Uint16("obid", obID).Uint16("resp.obid", resp.ObID).Err(ErrObserverNotMatch).Msg("receive device ObNotifyResp")
+			return dp.StatusCode_Unknown, ErrObserverNotMatch
+		}
+		return resp.Code, nil
+	case <-t.C:
+		log.Error().Uint16("obid", obID).Err(ErrSendTimeout).Msg("receive device ObNotifyResp")
+		return dp.StatusCode_Unknown, ErrSendTimeout
+	case <-ctx.Done():
+		return dp.StatusCode_Unknown, ctx.Err()
+	}
+}
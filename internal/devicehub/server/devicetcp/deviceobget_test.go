@@ -0,0 +1,161 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicetcp
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/service"
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+
+	"gotest.tools/assert"
+)
+
+func readFrame(t *testing.T, peer net.Conn) (*dp.Header, []byte) {
+	buf := make([]byte, dp.HeaderLen)
+	_, err := io.ReadFull(peer, buf)
+	assert.NilError(t, err)
+	header, err := dp.DecodeHeader(buf)
+	assert.NilError(t, err)
+	body := make([]byte, header.BodyLen)
+	_, err = io.ReadFull(peer, body)
+	assert.NilError(t, err)
+	return header, body
+}
+
+// readNotify reads a notification as the device and answers it.
+func readNotify(t *testing.T, peer net.Conn, answer dp.StatusCode) *dp.ObGetNotifyReq {
+	header, body := readFrame(t, peer)
+	assert.Equal(t, header.Type, dp.MsgType_ServerSendReq)
+	assert.Assert(t, !dp.IsObGetEstabReq(body))
+	req, err := dp.DecodeObGetNotifyReq(header.ID, body)
+	assert.NilError(t, err)
+	buf := make([]byte, dp.HeaderLen+dp.HeaderLen_ObGetNotifyResp)
+	assert.NilError(t, dp.EncodeObGetNotifyResp_OverServerSendResp(&dp.ObGetNotifyResp{
+		HeaderID: header.ID,
+		Method:   dp.Method_ObservedGet,
+		Code:     answer,
+		ObID:     req.ObID,
+	}, buf))
+	_, err = peer.Write(buf)
+	assert.NilError(t, err)
+	return req
+}
+
+func TestDeviceObGet(t *testing.T) {
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	s := newSession(conn)
+	s.deviceID = "cfa09baa-4913-4ad7-a936-3e26f9671b09"
+	s.verifyPass = true
+	s.BodyCapSize = 512
+	s.RemoteAddr = conn.RemoteAddr()
+	s.ConnectTime = time.Now()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wait := &sync.WaitGroup{}
+	wait.Add(1)
+	go s.serve(ctx, wait, nil, func(string) {})
+
+	notifyChan := make(chan []byte)
+	uris := make(chan string, 2)
+	notifier := func(ctx context.Context, dev *service.Device, uri string, data []byte) (<-chan []byte, error) {
+		uris <- uri
+		return notifyChan, nil
+	}
+	req := &dp.ObGetEstabReq{HeaderID: 3, Method: dp.Method_ObservedGet, ObID: 7}
+	assert.NilError(t, s.establishDeviceOb(ctx, req, "/prices", notifier))
+
+	header, body := readFrame(t, peer)
+	assert.Equal(t, header.Type, dp.MsgType_DeviceSendResp)
+	assert.Equal(t, header.ID, uint16(3))
+	resp, err := dp.DecodeObGetEstabResp(header.ID, body)
+	assert.NilError(t, err)
+	assert.Equal(t, resp.Code, dp.StatusCode_Continue)
+	assert.Equal(t, resp.ObID, uint16(7))
+	assert.Equal(t, <-uris, "/prices")
+
+	// the observer id is in use
+	assert.NilError(t, s.establishDeviceOb(ctx, req, "/prices", notifier))
+	_, body = readFrame(t, peer)
+	resp, _ = dp.DecodeObGetEstabResp(3, body)
+	assert.Equal(t, resp.Code, dp.StatusCode_BadRequest)
+
+	go func() { notifyChan <- []byte("p1") }()
+	notify := readNotify(t, peer, dp.StatusCode_Continue)
+	assert.Equal(t, notify.Code, dp.StatusCode_Continue)
+	assert.Equal(t, notify.ObID, uint16(7))
+	assert.Equal(t, string(notify.Data), "p1")
+
+	// terminated by the service
+	close(notifyChan)
+	notify = readNotify(t, peer, dp.StatusCode_Terminate)
+	assert.Equal(t, notify.Code, dp.StatusCode_Terminate)
+
+	assert.Assert(t, waitUntil(ctx, func() bool { return s.deviceObCount.Load() == 0 && s.inflight.Load() == 0 }))
+	cancel()
+	wait.Wait()
+}
+
+func TestDeviceObGetTerminatedByDevice(t *testing.T) {
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	s := newSession(conn)
+	s.verifyPass = true
+	s.BodyCapSize = 512
+	s.RemoteAddr = conn.RemoteAddr()
+	s.ConnectTime = time.Now()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wait := &sync.WaitGroup{}
+	wait.Add(1)
+	go s.serve(ctx, wait, nil, func(string) {})
+
+	notifyChan := make(chan []byte, 1)
+	ended := make(chan struct{})
+	notifier := func(ctx context.Context, dev *service.Device, uri string, data []byte) (<-chan []byte, error) {
+		go func() {
+			<-ctx.Done()
+			close(ended)
+		}()
+		return notifyChan, nil
+	}
+	req := &dp.ObGetEstabReq{HeaderID: 1, Method: dp.Method_ObservedGet, ObID: 1}
+	assert.NilError(t, s.establishDeviceOb(ctx, req, "/prices", notifier))
+	readFrame(t, peer)
+
+	notifyChan <- []byte("p1")
+	readNotify(t, peer, dp.StatusCode_Terminate)
+	select {
+	case <-ended:
+	case <-time.After(time.Second):
+		t.Fatal("service observation not canceled")
+	}
+	cancel()
+	wait.Wait()
+}
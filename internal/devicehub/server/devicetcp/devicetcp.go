@@ -26,27 +26,33 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/mkrainbow/rtio/internal/upgrade"
+	"github.com/mkrainbow/rtio/pkg/drain"
+	"github.com/mkrainbow/rtio/pkg/health"
+
 	"github.com/armon/go-proxyproto"
 	"github.com/rs/zerolog/log"
 )
 
 type ServerTCP struct {
-	listener   *proxyproto.Listener
+	listener   net.Listener
 	sessions   *SessionMap
 	wait       *sync.WaitGroup
 	sessionNum int32
+	accepting  atomic.Bool
+	draining   atomic.Bool
 }
 
 func NewServerTCP(addr string, sessionMap *SessionMap) (*ServerTCP, error) {
 
-	netListener, err := net.Listen("tcp", addr)
+	listener, err := upgrade.Listen(HandoffName, addr)
 	if err != nil {
 		log.Error().Err(err).Msg("listen failed")
 		return nil, err
 	}
 
 	return &ServerTCP{
-		listener:   &proxyproto.Listener{Listener: netListener},
+		listener:   listener,
 		sessions:   sessionMap,
 		wait:       &sync.WaitGroup{},
 		sessionNum: 0,
@@ -62,11 +68,25 @@ func (s *ServerTCP) AddSession(ctx context.Context, deviceID string, session *Se
 		log.Debug().Msg("old session done")
 	}
 	atomic.AddInt32(&s.sessionNum, 1)
+	metricSessions.WithLabelValues("tcp").Inc()
 	s.sessions.Set(deviceID, session)
+	if s.draining.Load() { // verified while draining
+		session.startDrain()
+		session.sendGoaway()
+	}
 }
 func (s *ServerTCP) DelSession(deviceID string) {
 	s.sessions.Del(deviceID)
 	atomic.AddInt32(&s.sessionNum, -1)
+	metricSessions.WithLabelValues("tcp").Dec()
+}
+
+// checkAccepting is the readiness check of the device listener.
+func (s *ServerTCP) checkAccepting() error {
+	if !s.accepting.Load() {
+		return ErrListenerNotAccepting
+	}
+	return nil
 }
 
 func (s *ServerTCP) Shutdown() {
@@ -98,10 +118,17 @@ func (s *ServerTCP) Serve(c context.Context) {
 	s.wait.Add(1)
 	go func() {
 		defer s.wait.Done()
-		defer cancel()
+		defer func() {
+			// sessions are closed by drain, or by ctx
+			if !s.draining.Load() {
+				cancel()
+			}
+		}()
 
+		s.accepting.Store(true)
+		defer s.accepting.Store(false)
 		for s.listener != nil {
-			conn, err := s.listener.Accept()
+			raw, err := s.listener.Accept()
 			if err != nil {
 				if errors.Is(err, net.ErrClosed) {
 					log.Warn().Msg("listener error closed")
@@ -110,8 +137,15 @@ func (s *ServerTCP) Serve(c context.Context) {
 				}
 				break
 			}
+			if !admissions.admit() {
+				admissions.shed(raw)
+				continue
+			}
 			s.wait.Add(1)
-			session := newSession(conn)
+			// keep the raw conn for handoff, proxyproto.Conn hides it
+			session := newSession(proxyproto.NewConn(raw, 0))
+			session.raw = raw
+			session.admission = admissions
 			go session.serve(ctx, s.wait, s.AddSession, s.DelSession)
 		}
 		log.Info().Msg("listener closed")
@@ -132,6 +166,11 @@ func InitTCPServer(ctx context.Context, addr string,
 		log.Error().Err(err).Msg("NewServerTCP error")
 		return err
 	}
+	registerSessionMapMetrics(sessionMap)
+	initGuards(ctx)
+	health.Register("deviceaccess", s.checkAccepting)
+	drain.Register("deviceaccess", s.drain)
+	upgrade.RegisterHandoff(HandoffName, s.export, s.importSession(ctx))
 	wait.Add(1)
 	go func() {
 		defer wait.Done()
@@ -27,6 +27,10 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/mkrainbow/rtio/internal/upgrade"
+	"github.com/mkrainbow/rtio/pkg/drain"
+	"github.com/mkrainbow/rtio/pkg/health"
+
 	"github.com/rs/zerolog/log"
 )
 
@@ -37,6 +41,8 @@ type ServerTLS struct {
 	sessions   *SessionMap
 	wait       *sync.WaitGroup
 	sessionNum int32
+	accepting  atomic.Bool
+	draining   atomic.Bool
 }
 
 func NewServerTLS(addr string, sessionMap *SessionMap, certFile, keyFile string) (*ServerTLS, error) {
@@ -47,11 +53,12 @@ func NewServerTLS(addr string, sessionMap *SessionMap, certFile, keyFile string)
 		return nil, err
 	}
 	config := &tls.Config{Certificates: []tls.Certificate{cert}}
-	listener, err := tls.Listen("tcp", addr, config)
+	netListener, err := upgrade.Listen(HandoffName, addr)
 	if err != nil {
 		log.Error().Err(err).Msg("listen failed")
 		return nil, err
 	}
+	listener := tls.NewListener(netListener, config)
 	return &ServerTLS{
 		listener:   listener,
 		config:     config,
@@ -70,11 +77,25 @@ func (s *ServerTLS) AddSession(ctx context.Context, deviceID string, session *Se
 		log.Debug().Msg("old session done")
 	}
 	atomic.AddInt32(&s.sessionNum, 1)
+	metricSessions.WithLabelValues("tls").Inc()
 	s.sessions.Set(deviceID, session)
+	if s.draining.Load() { // verified while draining
+		session.startDrain()
+		session.sendGoaway()
+	}
 }
 func (s *ServerTLS) DelSession(deviceID string) {
 	s.sessions.Del(deviceID)
 	atomic.AddInt32(&s.sessionNum, -1)
+	metricSessions.WithLabelValues("tls").Dec()
+}
+
+// checkAccepting is the readiness check of the device listener.
+func (s *ServerTLS) checkAccepting() error {
+	if !s.accepting.Load() {
+		return ErrListenerNotAccepting
+	}
+	return nil
 }
 
 func (s *ServerTLS) Shutdown() {
@@ -106,8 +127,15 @@ func (s *ServerTLS) Serve(c context.Context) {
 	s.wait.Add(1)
 	go func() {
 		defer s.wait.Done()
-		defer cancel()
+		defer func() {
+			// sessions are closed by drain, or by ctx
+			if !s.draining.Load() {
+				cancel()
+			}
+		}()
 
+		s.accepting.Store(true)
+		defer s.accepting.Store(false)
 		for s.listener != nil {
 			conn, err := s.listener.Accept()
 			if err != nil {
@@ -118,8 +146,14 @@ func (s *ServerTLS) Serve(c context.Context) {
 				}
 				break
 			}
+			if !admissions.admit() {
+				admissions.shed(conn)
+				continue
+			}
 			s.wait.Add(1)
 			session := newSession(conn)
+			session.secure = true
+			session.admission = admissions
 			go session.serve(ctx, s.wait, s.AddSession, s.DelSession)
 		}
 		log.Info().Msg("listener closed")
@@ -145,6 +179,10 @@ func InitTLSServer(ctx context.Context,
 		log.Error().Err(err).Msg("NewServerTLS error")
 		return err
 	}
+	registerSessionMapMetrics(sessionMap)
+	initGuards(ctx)
+	health.Register("deviceaccess", s.checkAccepting)
+	drain.Register("deviceaccess", s.drain)
 	wait.Add(1)
 	go func() {
 		defer wait.Done()
@@ -0,0 +1,157 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicetcp
+
+import (
+	"context"
+	"time"
+
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DrainPollInterval = 100 * time.Millisecond
+)
+
+// enter counts a request in flight, fails when draining.
+func (s *Session) enter() error {
+	s.inflight.Add(1)
+	if s.draining.Load() {
+		s.inflight.Add(-1)
+		return ErrSessionDraining
+	}
+	return nil
+}
+func (s *Session) leave() {
+	s.inflight.Add(-1)
+}
+
+// startDrain rejects new requests and terminates observations, by apps and by devices.
+func (s *Session) startDrain() {
+	s.draining.Store(true)
+	s.observerStore.Range(func(k, v any) bool {
+		select {
+		case v.(*Observa).TerminateChan <- struct{}{}:
+		default:
+		}
+		return true
+	})
+	s.deviceObStore.Range(func(k, v any) bool {
+		select {
+		case v.(*deviceObserva).terminateChan <- struct{}{}:
+		default:
+		}
+		return true
+	})
+}
+
+func isGoaway(buf []byte) bool {
+	return len(buf) == int(dp.HeaderLen) && dp.MsgType(buf[0]>>4) == dp.MsgType_ServerGoaway
+}
+
+// isEnrolled tells the credentials of an enrollment, the device reconnects with them.
+func isEnrolled(buf []byte) bool {
+	return len(buf) > int(dp.HeaderLen) && dp.MsgType(buf[0]>>4) == dp.MsgType_DeviceVerifyResp &&
+		dp.RemoteCode(buf[0]&0x07) == dp.Code_Success
+}
+
+func isTryLater(buf []byte) bool {
+	return len(buf) > int(dp.HeaderLen) && dp.MsgType(buf[0]>>4) == dp.MsgType_DeviceVerifyResp &&
+		dp.RemoteCode(buf[0]&0x07) == dp.Code_TryLater
+}
+
+// sendGoaway asks the device to reconnect, the session closes after it is written.
+func (s *Session) sendGoaway() {
+	buf, err := dp.EncodeGoaway(&dp.Goaway{
+		Header: &dp.Header{
+			Version: dp.Version,
+			Type:    dp.MsgType_ServerGoaway,
+			ID:      s.genHeaderID(),
+		},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("send Goaway")
+		s.Cancel()
+		return
+	}
+	select {
+	case s.outgoingChan <- buf:
+	default:
+		log.Warn().Str("deviceid", s.deviceID).Msg("send Goaway, outgoing queue full")
+		s.Cancel()
+	}
+}
+
+func (m *SessionMap) count() (sessions, inflight int) {
+	m.Range(func(_ string, session *Session) bool {
+		sessions++
+		inflight += int(session.inflight.Load())
+		return true
+	})
+	return
+}
+
+// waitUntil polls cond until it is true or ctx done.
+func waitUntil(ctx context.Context, cond func() bool) bool {
+	t := time.NewTicker(DrainPollInterval)
+	defer t.Stop()
+	for !cond() {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-t.C:
+		}
+	}
+	return true
+}
+
+// Drain stops new requests and terminates observations, waits requests in flight,
+// then sends Goaway to devices and waits them closed.
+func (m *SessionMap) Drain(ctx context.Context) {
+	m.Range(func(_ string, session *Session) bool {
+		session.startDrain()
+		return true
+	})
+	if !waitUntil(ctx, func() bool { _, n := m.count(); return n == 0 }) {
+		_, n := m.count()
+		log.Warn().Int("inflight", n).Msg("drain timeout, requests in flight")
+	}
+	m.Range(func(_ string, session *Session) bool {
+		session.sendGoaway()
+		return true
+	})
+	if !waitUntil(ctx, func() bool { n, _ := m.count(); return n == 0 }) {
+		n, _ := m.count()
+		log.Warn().Int("sessions", n).Msg("drain timeout, sessions not closed")
+	}
+}
+
+func (s *ServerTCP) drain(ctx context.Context) {
+	s.draining.Store(true)
+	s.Shutdown()
+	s.sessions.Drain(ctx)
+}
+
+func (s *ServerTLS) drain(ctx context.Context) {
+	s.draining.Store(true)
+	s.Shutdown()
+	s.sessions.Drain(ctx)
+}
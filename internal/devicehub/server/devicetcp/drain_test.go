@@ -0,0 +1,92 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicetcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+
+	"gotest.tools/assert"
+)
+
+func TestSessionMapDrain(t *testing.T) {
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	sessionMap := &SessionMap{}
+	s := newSession(conn)
+	s.deviceID = "cfa09baa-4913-4ad7-a936-3e26f9671b09"
+	s.verifyPass = true
+	sessionMap.Set(s.deviceID, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wait := &sync.WaitGroup{}
+	wait.Add(1)
+	go s.serve(ctx, wait, nil, sessionMap.Del)
+
+	ob, err := s.CreateObserva()
+	assert.NilError(t, err)
+	assert.NilError(t, s.enter()) // a request in flight
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer drainCancel()
+	drained := make(chan struct{})
+	go func() {
+		sessionMap.Drain(drainCtx)
+		close(drained)
+	}()
+
+	select {
+	case <-ob.TerminateChan:
+	case <-time.After(time.Second):
+		t.Fatal("observation not terminated")
+	}
+	assert.Equal(t, s.enter(), ErrSessionDraining)
+
+	// goaway is sent after the request in flight finished
+	buf := make([]byte, dp.HeaderLen)
+	peer.SetReadDeadline(time.Now().Add(3 * DrainPollInterval))
+	_, err = io.ReadFull(peer, buf)
+	assert.Assert(t, errors.Is(err, os.ErrDeadlineExceeded))
+	peer.SetReadDeadline(time.Time{})
+	s.leave()
+	_, err = io.ReadFull(peer, buf)
+	assert.NilError(t, err)
+	header, err := dp.DecodeHeader(buf)
+	assert.NilError(t, err)
+	assert.Equal(t, header.Type, dp.MsgType_ServerGoaway)
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("drain not finished")
+	}
+	_, ok := sessionMap.Get(s.deviceID)
+	assert.Assert(t, !ok)
+	wait.Wait()
+}
@@ -0,0 +1,110 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicetcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/provisioner"
+	"github.com/mkrainbow/rtio/pkg/config"
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+
+	"github.com/rs/zerolog/log"
+)
+
+// claimKey is the lockout key of a claim token, not keeping it in plain.
+func claimKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "claim:" + hex.EncodeToString(sum[:8])
+}
+
+// receiveEnrollReq mints the credentials of a device enrolling by a claim
+// token, the session closes after they are sent.
+func (s *Session) receiveEnrollReq(ctx context.Context, header *dp.Header, body []byte) error {
+	req, err := dp.DecodeEnrollReqBody(header, body)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to decode enroll req body")
+		return s.sendVerifyResp(header, dp.Code_ParaInvalid)
+	}
+	// the credentials are sent in plain without tls
+	if !s.secure && !config.BoolKV.GetWithDefault("deviceenroll.insecure", false) {
+		log.Warn().Str("serial", req.Serial).Str("ip", remoteIP(s.RemoteAddr)).Msg("Enrollment refused over non-TLS")
+		metricEnroll.WithLabelValues("insecure").Inc()
+		return s.sendVerifyResp(header, dp.Code_VerifyFail)
+	}
+	p, err := getDeviceProvisioner()
+	if err != nil {
+		log.Warn().Err(err).Str("serial", req.Serial).Msg("Enrollment disabled")
+		metricEnroll.WithLabelValues("disabled").Inc()
+		return s.sendVerifyResp(header, dp.Code_VerifyFail)
+	}
+	ip := remoteIP(s.RemoteAddr)
+	key := claimKey(req.ClaimToken)
+	if guards != nil {
+		if d := guards.locked(ip, key); d > 0 {
+			log.Warn().Str("ip", ip).Dur("lockout", d).Msg("Enroll locked out")
+			metricShed.WithLabelValues("lockout").Inc()
+			return s.sendVerifyTryLater(header, retrySeconds(d))
+		}
+		if err := guards.acquire(ctx); err != nil {
+			log.Warn().Err(err).Msg("Verify queue busy")
+			metricShed.WithLabelValues("verify_queue").Inc()
+			return s.sendVerifyTryLater(header, retryHint(guards.retryAfter))
+		}
+	}
+	deviceID, deviceSecret, err := p.Enroll(req.ClaimToken, req.Serial)
+	if guards != nil {
+		guards.release()
+	}
+	if err == provisioner.ErrClaimRejected {
+		log.Warn().Str("ip", ip).Str("serial", req.Serial).Msg("Enroll rejected")
+		metricEnroll.WithLabelValues("fail").Inc()
+		if guards != nil {
+			guards.result(ip, key, false)
+		}
+		return s.sendVerifyResp(header, dp.Code_VerifyFail)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("call Enroll err")
+		metricEnroll.WithLabelValues("error").Inc()
+		return s.sendVerifyResp(header, dp.Code_UnkownErr)
+	}
+
+	respBuf, err := dp.EncodeEnrollResp(&dp.EnrollResp{
+		Header: &dp.Header{
+			Version: dp.Version,
+			Type:    dp.MsgType_DeviceVerifyResp,
+			ID:      header.ID,
+			Code:    dp.Code_Success,
+		},
+		DeviceID:     deviceID,
+		DeviceSecret: deviceSecret,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("deviceid", deviceID).Msg("Invalid credentials by provisioner")
+		metricEnroll.WithLabelValues("error").Inc()
+		return s.sendVerifyResp(header, dp.Code_UnkownErr)
+	}
+	log.Info().Str("deviceid", deviceID).Str("serial", req.Serial).Msg("Device enrolled")
+	metricEnroll.WithLabelValues("ok").Inc()
+	s.outgoingChan <- respBuf
+	return nil
+}
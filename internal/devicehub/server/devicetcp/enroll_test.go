@@ -0,0 +1,122 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicetcp
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/provisioner"
+	"github.com/mkrainbow/rtio/pkg/config"
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+
+	"gotest.tools/assert"
+)
+
+type fakeProvisioner struct{}
+
+func (fakeProvisioner) Enroll(claimToken, serial string) (string, string, error) {
+	if claimToken != "batch1-claim-token-0001" {
+		return "", "", provisioner.ErrClaimRejected
+	}
+	return "cfa09baa-4913-4ad7-a936-3e26f9671b09", "mb6bgso4EChvyzA05thF9+wH", nil
+}
+
+func enrollOverPipe(t *testing.T, peer net.Conn, id uint16, token string) (*dp.Header, []byte) {
+	buf, err := dp.EncodeEnrollReq(&dp.EnrollReq{
+		Header:     &dp.Header{Version: dp.Version, Type: dp.MsgType_DeviceVerifyReq, ID: id},
+		ClaimToken: token,
+		Serial:     "SN0001",
+	})
+	assert.NilError(t, err)
+	_, err = peer.Write(buf)
+	assert.NilError(t, err)
+	return readFrame(t, peer)
+}
+
+func TestEnroll(t *testing.T) {
+	oldGuards := guards
+	defer func() { guards = oldGuards }()
+	guards = newVerifyGuard(newLockout(2, 30*time.Second, time.Minute), newLockout(0, 0, 0), 1, 1, time.Second, time.Second)
+	old := getDeviceProvisioner
+	defer func() { getDeviceProvisioner = old }()
+	getDeviceProvisioner = func() (provisioner.Provisioner, error) { return fakeProvisioner{}, nil }
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	s := newSession(conn)
+	s.secure = true
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wait := &sync.WaitGroup{}
+	wait.Add(1)
+	go s.serve(ctx, wait, func(context.Context, string, *Session) {}, func(string) {})
+
+	header, _ := enrollOverPipe(t, peer, 1, "batch2-claim-token-0001")
+	assert.Equal(t, header.Code, dp.Code_VerifyFail)
+
+	header, body := enrollOverPipe(t, peer, 2, "batch1-claim-token-0001")
+	assert.Equal(t, header.Type, dp.MsgType_DeviceVerifyResp)
+	assert.Equal(t, header.Code, dp.Code_Success)
+	resp, err := dp.DecodeEnrollRespBody(header, body)
+	assert.NilError(t, err)
+	assert.Equal(t, resp.DeviceID, "cfa09baa-4913-4ad7-a936-3e26f9671b09")
+	assert.Equal(t, resp.DeviceSecret, "mb6bgso4EChvyzA05thF9+wH")
+	assert.Equal(t, s.verifyPass, false)
+
+	// closed, the device reconnects with the credentials
+	_, err = peer.Read(body)
+	assert.Equal(t, err, io.EOF)
+	wait.Wait()
+}
+
+func TestEnrollInsecure(t *testing.T) {
+	old := getDeviceProvisioner
+	defer func() { getDeviceProvisioner = old }()
+	getDeviceProvisioner = func() (provisioner.Provisioner, error) { return fakeProvisioner{}, nil }
+
+	serve := func() (net.Conn, context.CancelFunc) {
+		conn, peer := net.Pipe()
+		s := newSession(conn)
+		ctx, cancel := context.WithCancel(context.Background())
+		wait := &sync.WaitGroup{}
+		wait.Add(1)
+		go s.serve(ctx, wait, func(context.Context, string, *Session) {}, func(string) {})
+		return peer, cancel
+	}
+
+	// credentials are not sent over non-TLS
+	peer, cancel := serve()
+	header, _ := enrollOverPipe(t, peer, 1, "batch1-claim-token-0001")
+	assert.Equal(t, header.Code, dp.Code_VerifyFail)
+	peer.Close()
+	cancel()
+
+	config.BoolKV.Set("deviceenroll.insecure", true)
+	defer config.BoolKV.Set("deviceenroll.insecure", false)
+	peer, cancel = serve()
+	defer cancel()
+	defer peer.Close()
+	header, _ = enrollOverPipe(t, peer, 1, "batch1-claim-token-0001")
+	assert.Equal(t, header.Code, dp.Code_Success)
+}
@@ -0,0 +1,410 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicetcp
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/config"
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrVerifyBusy = errors.New("ErrVerifyBusy")
+)
+
+var (
+	ShedWriteTimeout  = 2 * time.Second // writing goaway to a shed connection
+	lockoutEntriesMax = 1000000
+)
+
+var (
+	guards     *verifyGuard // nil without protection, such as in tests
+	admissions *admission
+	guardsOnce sync.Once
+)
+
+// initGuards creates the verify guard and the admission from configs, shared
+// by the tcp and tls servers.
+func initGuards(ctx context.Context) {
+	guardsOnce.Do(func() {
+		retryAfter := time.Duration(config.IntKV.GetWithDefault("deviceaccess.retryafter", 10)) * time.Second
+		base := time.Duration(config.IntKV.GetWithDefault("deviceverify.lockout.base", 10)) * time.Second
+		max := time.Duration(config.IntKV.GetWithDefault("deviceverify.lockout.max", 3600)) * time.Second
+		guards = newVerifyGuard(
+			newLockout(config.IntKV.GetWithDefault("deviceverify.lockout.failures", 5), base, max),
+			newLockout(config.IntKV.GetWithDefault("deviceverify.lockout.ip.failures", 50), base, max),
+			config.IntKV.GetWithDefault("deviceverify.concurrency", 256),
+			config.IntKV.GetWithDefault("deviceverify.queue", 4096),
+			time.Duration(config.IntKV.GetWithDefault("deviceverify.queue.timeout", 5000))*time.Millisecond,
+			retryAfter)
+		admissions = newAdmission(
+			config.IntKV.GetWithDefault("deviceaccess.unverified.max", 20000),
+			config.IntKV.GetWithDefault("deviceaccess.accept.rate", 0),
+			retryAfter)
+		go guards.sweepLoop(ctx)
+	})
+}
+
+// retryHint jitters the retry-after between base and twice of it, spreading
+// the reconnections of shed devices.
+func retryHint(base time.Duration) uint16 {
+	sec := int64(base / time.Second)
+	if sec <= 0 {
+		sec = 1
+	}
+	hint := sec + rand.Int63n(sec+1)
+	if hint > 0xFFFF {
+		hint = 0xFFFF
+	}
+	return uint16(hint)
+}
+
+// retrySeconds rounds a lockout up to the seconds of retry-after.
+func retrySeconds(d time.Duration) uint16 {
+	sec := (d + time.Second - 1) / time.Second
+	if sec > 0xFFFF {
+		sec = 0xFFFF
+	}
+	return uint16(sec)
+}
+
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+type lockoutEntry struct {
+	failures    int
+	lastFail    time.Time
+	lockedUntil time.Time
+}
+
+// lockout counts consecutive verify failures by key, such as IP and device ID
+// or IP.
+// The key is locked out for base after failures ones, doubled by each further
+// failure up to max. Counters are forgotten after max without failure.
+type lockout struct {
+	failures int // 0 to disable
+	base     time.Duration
+	max      time.Duration
+	lock     sync.Mutex
+	entries  map[string]*lockoutEntry
+}
+
+func newLockout(failures int, base, max time.Duration) *lockout {
+	return &lockout{
+		failures: failures,
+		base:     base,
+		max:      max,
+		entries:  make(map[string]*lockoutEntry),
+	}
+}
+
+// locked returns the lockout left of the key, 0 if not locked.
+func (l *lockout) locked(key string, now time.Time) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if e, ok := l.entries[key]; ok && now.Before(e.lockedUntil) {
+		return e.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// fail counts a failure, returns the lockout started by it, 0 if none.
+func (l *lockout) fail(key string, now time.Time) time.Duration {
+	if l.failures <= 0 {
+		return 0
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	e, ok := l.entries[key]
+	if !ok || now.Sub(e.lastFail) > l.max {
+		if !ok && len(l.entries) >= lockoutEntriesMax {
+			l.sweepLocked(now)
+			if len(l.entries) >= lockoutEntriesMax {
+				return 0
+			}
+		}
+		e = &lockoutEntry{}
+		l.entries[key] = e
+	}
+	e.failures++
+	e.lastFail = now
+	if e.failures < l.failures {
+		return 0
+	}
+	d := l.max
+	if shift := e.failures - l.failures; shift < 32 {
+		if d = l.base << shift; d > l.max || d <= 0 {
+			d = l.max
+		}
+	}
+	e.lockedUntil = now.Add(d)
+	return d
+}
+
+// decay takes back a failure of the key on a pass, so that the failures of
+// a key shared by devices, such as an IP, are not only growing.
+func (l *lockout) decay(key string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	e, ok := l.entries[key]
+	if !ok {
+		return
+	}
+	if e.failures--; e.failures <= 0 {
+		delete(l.entries, key)
+	}
+}
+
+func (l *lockout) reset(key string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	delete(l.entries, key)
+}
+
+func (l *lockout) sweep(now time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.sweepLocked(now)
+}
+
+func (l *lockout) sweepLocked(now time.Time) {
+	for k, e := range l.entries {
+		if now.Sub(e.lastFail) > l.max && !now.Before(e.lockedUntil) {
+			delete(l.entries, k)
+		}
+	}
+}
+
+// verifyGuard locks out devices and IPs failing verification, and limits the
+// concurrent verifies, waiting in a queue, so that a reconnect storm, such as
+// after a power restore, does not overwhelm the verifiers.
+type verifyGuard struct {
+	devices      *lockout
+	ips          *lockout
+	sem          chan struct{} // nil for unlimited
+	queued       atomic.Int32
+	queueMax     int32
+	queueTimeout time.Duration
+	retryAfter   time.Duration
+}
+
+func newVerifyGuard(devices, ips *lockout, concurrency, queueMax int, queueTimeout, retryAfter time.Duration) *verifyGuard {
+	g := &verifyGuard{
+		devices:      devices,
+		ips:          ips,
+		queueMax:     int32(queueMax),
+		queueTimeout: queueTimeout,
+		retryAfter:   retryAfter,
+	}
+	if concurrency > 0 {
+		g.sem = make(chan struct{}, concurrency)
+	}
+	return g
+}
+
+// deviceKey keys the device lockout by IP and device ID, so that failures
+// from other IPs do not lock out the device.
+func deviceKey(ip, deviceID string) string {
+	return ip + "/" + deviceID
+}
+
+// locked returns the lockout left of the device or IP, 0 if not locked.
+func (g *verifyGuard) locked(ip, deviceID string) time.Duration {
+	now := time.Now()
+	d := g.devices.locked(deviceKey(ip, deviceID), now)
+	if ipd := g.ips.locked(ip, now); ipd > d {
+		d = ipd
+	}
+	return d
+}
+
+// result counts a verify result, a pass resets the failures of the device,
+// and takes back one of the IP shared by devices behind NAT.
+func (g *verifyGuard) result(ip, deviceID string, ok bool) {
+	if ok {
+		g.devices.reset(deviceKey(ip, deviceID))
+		g.ips.decay(ip)
+		return
+	}
+	now := time.Now()
+	if d := g.devices.fail(deviceKey(ip, deviceID), now); d > 0 {
+		log.Warn().Str("ip", ip).Str("deviceid", deviceID).Dur("lockout", d).Msg("Device locked out for verify failures")
+	}
+	if d := g.ips.fail(ip, now); d > 0 {
+		log.Warn().Str("ip", ip).Dur("lockout", d).Msg("IP locked out for verify failures")
+	}
+}
+
+// acquire waits a verify slot in the queue, ErrVerifyBusy when the queue is
+// full or waiting timeout.
+func (g *verifyGuard) acquire(ctx context.Context) error {
+	if g.sem == nil {
+		return nil
+	}
+	select {
+	case g.sem <- struct{}{}:
+		return nil
+	default:
+	}
+	if g.queued.Add(1) > g.queueMax {
+		g.queued.Add(-1)
+		return ErrVerifyBusy
+	}
+	metricVerifyQueued.Inc()
+	defer func() {
+		g.queued.Add(-1)
+		metricVerifyQueued.Dec()
+	}()
+	t := time.NewTimer(g.queueTimeout)
+	defer t.Stop()
+	select {
+	case g.sem <- struct{}{}:
+		return nil
+	case <-t.C:
+		return ErrVerifyBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *verifyGuard) release() {
+	if g.sem != nil {
+		<-g.sem
+	}
+}
+
+func (g *verifyGuard) sweepLoop(ctx context.Context) {
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			g.devices.sweep(now)
+			g.ips.sweep(now)
+		}
+	}
+}
+
+// admission sheds connections on accept, when too many are not verified yet
+// or over the accept rate, with a goaway telling the device when to retry.
+type admission struct {
+	unverifiedMax int32 // 0 for unlimited
+	unverified    atomic.Int32
+	rate          float64 // per second, 0 for unlimited
+	tokens        float64
+	last          time.Time
+	lock          sync.Mutex
+	retryAfter    time.Duration
+}
+
+func newAdmission(unverifiedMax, rate int, retryAfter time.Duration) *admission {
+	return &admission{
+		unverifiedMax: int32(unverifiedMax),
+		rate:          float64(rate),
+		tokens:        float64(rate),
+		last:          time.Now(),
+		retryAfter:    retryAfter,
+	}
+}
+
+// admit takes the connection as unverified, until done called. A nil
+// admission admits all.
+func (a *admission) admit() bool {
+	if a == nil {
+		return true
+	}
+	if a.rate > 0 {
+		a.lock.Lock()
+		now := time.Now()
+		a.tokens += now.Sub(a.last).Seconds() * a.rate
+		if a.tokens > a.rate { // burst of one second
+			a.tokens = a.rate
+		}
+		a.last = now
+		ok := a.tokens >= 1
+		if ok {
+			a.tokens--
+		}
+		a.lock.Unlock()
+		if !ok {
+			return false
+		}
+	}
+	if n := a.unverified.Add(1); a.unverifiedMax > 0 && n > a.unverifiedMax {
+		a.unverified.Add(-1)
+		return false
+	}
+	metricUnverified.Inc()
+	return true
+}
+
+func (a *admission) done() {
+	a.unverified.Add(-1)
+	metricUnverified.Dec()
+}
+
+// shed sends the goaway with retry-after and closes the connection, in
+// background not to block accepting.
+func (a *admission) shed(conn net.Conn) {
+	metricShed.WithLabelValues("admission").Inc()
+	go func() {
+		defer conn.Close()
+		buf, err := dp.EncodeGoaway(&dp.Goaway{
+			Header: &dp.Header{
+				Version: dp.Version,
+				Type:    dp.MsgType_ServerGoaway,
+				ID:      1,
+			},
+			RetryAfter: retryHint(a.retryAfter),
+		})
+		if err != nil {
+			return
+		}
+		conn.SetDeadline(time.Now().Add(ShedWriteTimeout))
+		conn.Write(buf)
+	}()
+}
+
+// admitted ends the admission of the session, on verify pass or close.
+func (s *Session) admitted() {
+	s.admitOnce.Do(func() {
+		if s.admission != nil {
+			s.admission.done()
+		}
+	})
+}
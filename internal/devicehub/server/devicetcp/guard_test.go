@@ -0,0 +1,196 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicetcp
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/verifier"
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+
+	"gotest.tools/assert"
+)
+
+func TestLockout(t *testing.T) {
+	l := newLockout(3, 10*time.Second, 60*time.Second)
+	now := time.Now()
+
+	assert.Equal(t, l.fail("dev1", now), time.Duration(0))
+	assert.Equal(t, l.fail("dev1", now), time.Duration(0))
+	assert.Equal(t, l.locked("dev1", now), time.Duration(0))
+	assert.Equal(t, l.fail("dev1", now), 10*time.Second)
+	assert.Equal(t, l.locked("dev1", now.Add(time.Second)), 9*time.Second)
+	assert.Equal(t, l.locked("dev2", now), time.Duration(0))
+
+	// doubled up to max
+	assert.Equal(t, l.fail("dev1", now), 20*time.Second)
+	assert.Equal(t, l.fail("dev1", now), 40*time.Second)
+	assert.Equal(t, l.fail("dev1", now), 60*time.Second)
+	assert.Equal(t, l.fail("dev1", now), 60*time.Second)
+
+	l.reset("dev1")
+	assert.Equal(t, l.locked("dev1", now), time.Duration(0))
+
+	// a pass takes back a failure
+	l.fail("ip1", now)
+	l.fail("ip1", now)
+	l.decay("ip1")
+	assert.Equal(t, l.fail("ip1", now), time.Duration(0))
+	l.decay("ip1")
+	l.decay("ip1")
+	l.decay("ip1")
+	_, ok := l.entries["ip1"]
+	assert.Equal(t, ok, false)
+
+	// failures forgotten after max
+	l.fail("dev2", now)
+	l.fail("dev2", now)
+	assert.Equal(t, l.fail("dev2", now.Add(61*time.Second)), time.Duration(0))
+	l.sweep(now.Add(200 * time.Second))
+	assert.Equal(t, len(l.entries), 0)
+}
+
+func TestVerifyGuardQueue(t *testing.T) {
+	g := newVerifyGuard(newLockout(0, 0, 0), newLockout(0, 0, 0), 1, 1, 50*time.Millisecond, time.Second)
+	ctx := context.Background()
+
+	assert.NilError(t, g.acquire(ctx))
+	// one waits in the queue, the next is busy at once
+	waited := make(chan error)
+	go func() { waited <- g.acquire(ctx) }()
+	for g.queued.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, g.acquire(ctx), ErrVerifyBusy)
+	g.release()
+	assert.NilError(t, <-waited)
+
+	// waiting timeout
+	assert.Equal(t, g.acquire(ctx), ErrVerifyBusy)
+	g.release()
+	assert.NilError(t, g.acquire(ctx))
+	g.release()
+}
+
+func TestAdmission(t *testing.T) {
+	a := newAdmission(2, 0, time.Second)
+	assert.Assert(t, a.admit())
+	assert.Assert(t, a.admit())
+	assert.Assert(t, !a.admit())
+	a.done()
+	assert.Assert(t, a.admit())
+
+	a = newAdmission(0, 2, time.Second)
+	assert.Assert(t, a.admit())
+	assert.Assert(t, a.admit())
+	assert.Assert(t, !a.admit())
+
+	conn, peer := net.Pipe()
+	a.shed(conn)
+	buf := make([]byte, dp.HeaderLen+2)
+	_, err := io.ReadFull(peer, buf)
+	assert.NilError(t, err)
+	header, err := dp.DecodeHeader(buf)
+	assert.NilError(t, err)
+	assert.Equal(t, header.Type, dp.MsgType_ServerGoaway)
+	retryAfter, err := dp.DecodeRetryAfterBody(header, buf[dp.HeaderLen:])
+	assert.NilError(t, err)
+	assert.Assert(t, retryAfter >= 1 && retryAfter <= 2)
+}
+
+func verifyOverPipe(t *testing.T, peer net.Conn, id uint16, secret string) *dp.Header {
+	buf, err := dp.EncodeVerifyReq(&dp.VerifydReq{
+		Header:       &dp.Header{Version: dp.Version, Type: dp.MsgType_DeviceVerifyReq, ID: id},
+		DeviceID:     "cfa09baa-4913-4ad7-a936-3e26f9671b09",
+		DeviceSecret: secret,
+	})
+	assert.NilError(t, err)
+	_, err = peer.Write(buf)
+	assert.NilError(t, err)
+	respBuf := make([]byte, dp.HeaderLen)
+	_, err = io.ReadFull(peer, respBuf)
+	assert.NilError(t, err)
+	header, err := dp.DecodeHeader(respBuf)
+	assert.NilError(t, err)
+	return header
+}
+
+type fakeVerifier struct{}
+
+func (fakeVerifier) Verify(deviceID, deviceSecret string) (bool, error) {
+	return deviceSecret == "mb6bgso4EChvyzA05thF9+wH", nil
+}
+
+func TestVerifyGuardResult(t *testing.T) {
+	g := newVerifyGuard(newLockout(2, 30*time.Second, time.Minute), newLockout(3, 30*time.Second, time.Minute), 0, 0, time.Second, time.Second)
+
+	// failures from another IP do not lock out the device
+	g.result("10.0.0.2", "dev1", false)
+	g.result("10.0.0.2", "dev1", false)
+	assert.Assert(t, g.locked("10.0.0.2", "dev1") > 0)
+	assert.Equal(t, g.locked("10.0.0.1", "dev1"), time.Duration(0))
+
+	// passes behind the same IP keep it from the lockout
+	g.result("10.0.0.3", "dev2", false)
+	g.result("10.0.0.3", "dev3", true)
+	g.result("10.0.0.3", "dev4", false)
+	g.result("10.0.0.3", "dev5", true)
+	g.result("10.0.0.3", "dev6", false)
+	assert.Equal(t, g.locked("10.0.0.3", "dev7"), time.Duration(0))
+}
+
+func TestVerifyLockout(t *testing.T) {
+	oldGuards := guards
+	defer func() { guards = oldGuards }()
+	guards = newVerifyGuard(newLockout(2, 30*time.Second, time.Minute), newLockout(0, 0, 0), 1, 1, time.Second, time.Second)
+	old := getDeviceVerifier
+	defer func() { getDeviceVerifier = old }()
+	getDeviceVerifier = func() (verifier.Verifier, error) { return fakeVerifier{}, nil }
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	s := newSession(conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wait := &sync.WaitGroup{}
+	wait.Add(1)
+	go s.serve(ctx, wait, func(context.Context, string, *Session) {}, func(string) {})
+
+	assert.Equal(t, verifyOverPipe(t, peer, 1, "wrong-secret-wrong-secret").Code, dp.Code_VerifyFail)
+	assert.Equal(t, verifyOverPipe(t, peer, 2, "wrong-secret-wrong-secret").Code, dp.Code_VerifyFail)
+
+	// locked out even with the right secret, told to retry after the lockout
+	header := verifyOverPipe(t, peer, 3, "mb6bgso4EChvyzA05thF9+wH")
+	assert.Equal(t, header.Code, dp.Code_TryLater)
+	body := make([]byte, header.BodyLen)
+	_, err := io.ReadFull(peer, body)
+	assert.NilError(t, err)
+	retryAfter, err := dp.DecodeRetryAfterBody(header, body)
+	assert.NilError(t, err)
+	assert.Equal(t, retryAfter, uint16(30))
+
+	// closed after the retry-after
+	_, err = peer.Read(body)
+	assert.Equal(t, err, io.EOF)
+}
@@ -0,0 +1,214 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicetcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/upgrade"
+	ru "github.com/mkrainbow/rtio/pkg/rtioutil"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	HandoffName = "deviceaccess"
+)
+
+var (
+	ErrSessionNotDetached = errors.New("ErrSessionNotDetached")
+)
+
+// sessionState is sent with the conn to the new process, which resumes the
+// session without verifying the device again.
+type sessionState struct {
+	DeviceID         string    `json:"deviceid"`
+	DeviceSecret     string    `json:"devicesecret,omitempty"`
+	BodyCapSize      uint16    `json:"bodycapsize"`
+	HeartbeatSeconds uint16    `json:"heartbeat"`
+	RemoteAddr       string    `json:"remoteaddr"`
+	ConnectTime      time.Time `json:"connecttime"`
+	Pending          []byte    `json:"pending,omitempty"`
+}
+
+// pendingConn reads bytes received by the old process first.
+type pendingConn struct {
+	net.Conn
+	pending []byte
+}
+
+func (c *pendingConn) Read(b []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(b, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// detach writes messages queued to the device and dups the conn, called by
+// serve after the routes exited. Nothing is buffered by the proxy protocol
+// reader, the header read fails at the deadline only when its buffer is empty.
+func (s *Session) detach() *os.File {
+	for len(s.outgoingChan) > 0 {
+		buf := <-s.outgoingChan
+		if n, err := ru.WriteFull(s.conn, buf); err != nil {
+			log.Error().Err(err).Int("writelen", n).Str("deviceid", s.deviceID).Msg("detach, WriteFull error")
+			return nil
+		}
+	}
+	tcpConn, ok := s.raw.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	f, err := tcpConn.File()
+	if err != nil {
+		log.Error().Err(err).Str("deviceid", s.deviceID).Msg("detach, dup conn")
+		return nil
+	}
+	return f
+}
+
+// pause waits requests in flight, stops the session between messages and
+// returns the dup of its conn. A message being read is read to its end.
+func (s *Session) pause(ctx context.Context) (*os.File, error) {
+	s.startDrain()
+	if !waitUntil(ctx, func() bool { return s.inflight.Load() == 0 }) {
+		return nil, ctx.Err()
+	}
+	s.frameLock.Lock()
+	s.pausing.Store(true)
+	if !s.inFrame {
+		s.raw.SetReadDeadline(time.Now())
+	}
+	s.frameLock.Unlock()
+	select {
+	case f := <-s.pausedChan:
+		if f == nil {
+			return nil, ErrSessionNotDetached
+		}
+		return f, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// beginFrame is called after a header read, the rest of the message is read
+// without the deadline of pause, which stops reading only between messages.
+func (s *Session) beginFrame() {
+	s.frameLock.Lock()
+	defer s.frameLock.Unlock()
+	s.inFrame = true
+	if s.pausing.Load() && s.raw != nil {
+		s.raw.SetReadDeadline(time.Time{})
+	}
+}
+
+// endFrame is called after a message handled, the next header read stops at
+// once if pausing.
+func (s *Session) endFrame() {
+	s.frameLock.Lock()
+	defer s.frameLock.Unlock()
+	s.inFrame = false
+	if s.pausing.Load() && s.raw != nil {
+		s.raw.SetReadDeadline(time.Now())
+	}
+}
+
+// export hands verified sessions over to the new process, the others are
+// left to drain.
+func (s *ServerTCP) export(ctx context.Context, send func(state []byte, f *os.File) error) {
+	s.draining.Store(true)
+	s.Shutdown()
+	wait := &sync.WaitGroup{}
+	s.sessions.Range(func(deviceID string, session *Session) bool {
+		if session.raw == nil {
+			return true
+		}
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			f, err := session.pause(ctx)
+			if err != nil {
+				log.Warn().Err(err).Str("deviceid", deviceID).Msg("export session")
+				return
+			}
+			defer f.Close()
+			state, err := json.Marshal(&sessionState{
+				DeviceID:         session.deviceID,
+				DeviceSecret:     session.secret(),
+				BodyCapSize:      session.BodyCapSize,
+				HeartbeatSeconds: session.heartbeatSeconds,
+				RemoteAddr:       session.RemoteAddr.String(),
+				ConnectTime:      session.ConnectTime,
+				Pending:          session.pending,
+			})
+			if err == nil {
+				err = send(state, f)
+			}
+			if err != nil {
+				log.Error().Err(err).Str("deviceid", deviceID).Msg("export session")
+			}
+		}()
+		return true
+	})
+	wait.Wait()
+}
+
+// importSession resumes sessions exported by the old process.
+func (s *ServerTCP) importSession(ctx context.Context) upgrade.ImportFunc {
+	return func(state []byte, f *os.File) error {
+		defer f.Close()
+		st := &sessionState{}
+		if err := json.Unmarshal(state, st); err != nil {
+			return err
+		}
+		raw, err := net.FileConn(f)
+		if err != nil {
+			return err
+		}
+		var conn net.Conn = raw
+		if len(st.Pending) > 0 {
+			conn = &pendingConn{Conn: raw, pending: st.Pending}
+		}
+		session := newSession(conn)
+		session.raw = raw
+		session.verifyPass = true
+		session.deviceID = st.DeviceID
+		session.deviceSecret = st.DeviceSecret
+		session.BodyCapSize = st.BodyCapSize
+		session.heartbeatSeconds = st.HeartbeatSeconds
+		session.ConnectTime = st.ConnectTime
+		session.RemoteAddr = raw.RemoteAddr()
+		if addr, err := net.ResolveTCPAddr("tcp", st.RemoteAddr); err == nil {
+			session.RemoteAddr = addr // may be from proxy protocol
+		}
+		log.Info().Str("deviceid", st.DeviceID).Msg("import session")
+		s.AddSession(ctx, session.deviceID, session)
+		s.wait.Add(1)
+		go session.serve(ctx, s.wait, s.AddSession, s.DelSession)
+		return nil
+	}
+}
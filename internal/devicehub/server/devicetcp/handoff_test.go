@@ -0,0 +1,154 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicetcp
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+
+	"github.com/armon/go-proxyproto"
+	"gotest.tools/assert"
+)
+
+func TestSessionPause(t *testing.T) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer listener.Close()
+	device, err := net.Dial("tcp", listener.Addr().String())
+	assert.NilError(t, err)
+	defer device.Close()
+	raw, err := listener.Accept()
+	assert.NilError(t, err)
+
+	sessionMap := &SessionMap{}
+	s := newSession(proxyproto.NewConn(raw, 0))
+	s.raw = raw
+	s.deviceID = "cfa09baa-4913-4ad7-a936-3e26f9671b09"
+	s.verifyPass = true
+	sessionMap.Set(s.deviceID, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wait := &sync.WaitGroup{}
+	wait.Add(1)
+	go s.serve(ctx, wait, nil, sessionMap.Del)
+
+	// part of a header is read before paused
+	_, err = device.Write([]byte{0x11, 0x00})
+	assert.NilError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	pauseCtx, pauseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer pauseCancel()
+	f, err := s.pause(pauseCtx)
+	assert.NilError(t, err)
+	defer f.Close()
+	wait.Wait()
+	assert.DeepEqual(t, s.pending, []byte{0x11, 0x00})
+	_, ok := sessionMap.Get(s.deviceID)
+	assert.Assert(t, !ok)
+
+	// the device conn is kept by the dup after the session closed
+	conn, err := net.FileConn(f)
+	assert.NilError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("x"))
+	assert.NilError(t, err)
+	buf := make([]byte, 1)
+	device.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = io.ReadFull(device, buf)
+	assert.NilError(t, err)
+	assert.Equal(t, string(buf), "x")
+}
+
+func TestSessionPauseInFrame(t *testing.T) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer listener.Close()
+	device, err := net.Dial("tcp", listener.Addr().String())
+	assert.NilError(t, err)
+	defer device.Close()
+	raw, err := listener.Accept()
+	assert.NilError(t, err)
+
+	s := newSession(proxyproto.NewConn(raw, 0))
+	s.raw = raw
+	s.deviceID = "cfa09baa-4913-4ad7-a936-3e26f9671b09"
+	s.verifyPass = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wait := &sync.WaitGroup{}
+	wait.Add(1)
+	go s.serve(ctx, wait, nil, func(string) {})
+
+	// the header of a ping is read, its body not yet
+	buf, err := dp.EncodePingReq(&dp.PingReq{
+		Header:  &dp.Header{Version: dp.Version, Type: dp.MsgType_DevicePingReq, ID: 1, BodyLen: 2},
+		Timeout: 60,
+	})
+	assert.NilError(t, err)
+	_, err = device.Write(buf[:dp.HeaderLen+1])
+	assert.NilError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	pauseCtx, pauseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer pauseCancel()
+	paused := make(chan struct{})
+	var f *os.File
+	go func() {
+		f, err = s.pause(pauseCtx)
+		close(paused)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	_, werr := device.Write(buf[dp.HeaderLen+1:])
+	assert.NilError(t, werr)
+
+	// the ping is handled, then paused between messages
+	<-paused
+	assert.NilError(t, err)
+	defer f.Close()
+	wait.Wait()
+	assert.Equal(t, len(s.pending), 0)
+	assert.Equal(t, s.heartbeatSeconds, uint16(60))
+	header, _ := readFrame(t, device)
+	assert.Equal(t, header.Type, dp.MsgType_DevicePingResp)
+}
+
+func TestPendingConn(t *testing.T) {
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	c := &pendingConn{Conn: conn, pending: []byte{1, 2}}
+	go peer.Write([]byte{3, 4})
+
+	buf := make([]byte, 4)
+	_, err := io.ReadFull(c, buf)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, buf, []byte{1, 2, 3, 4})
+}
@@ -0,0 +1,63 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicetcp
+
+import (
+	"net"
+
+	"github.com/mkrainbow/rtio/pkg/metrics"
+)
+
+var (
+	metricSessions          = metrics.NewGaugeVec("rtio_device_sessions", "Verified device sessions.", "transport")
+	metricVerify            = metrics.NewCounterVec("rtio_device_verify_total", "Device verify results, ok, fail or error.", "result")
+	metricObservers         = metrics.NewGauge("rtio_device_observers", "Active observations of all sessions.")
+	metricDeviceObservers   = metrics.NewGauge("rtio_device_initiated_observers", "Active observations by devices of device services.")
+	metricHeartbeatTimeouts = metrics.NewCounter("rtio_device_heartbeat_timeouts_total", "Sessions closed for heartbeat timeout.")
+	metricBytesIn           = metrics.NewCounter("rtio_device_received_bytes_total", "Bytes received from devices.")
+	metricBytesOut          = metrics.NewCounter("rtio_device_sent_bytes_total", "Bytes sent to devices.")
+	metricShed              = metrics.NewCounterVec("rtio_device_shed_total", "Connections and verifies shed with retry-after, by reason.", "reason")
+	metricEnroll            = metrics.NewCounterVec("rtio_device_enroll_total", "Device enrollments by claim token, ok, fail, disabled, insecure or error.", "result")
+	metricVerifyQueued      = metrics.NewGauge("rtio_device_verify_queued", "Verifies waiting for a slot of the concurrent verify limit.")
+	metricUnverified        = metrics.NewGauge("rtio_device_unverified_conns", "Accepted connections not verified yet.")
+)
+
+// registerSessionMapMetrics registers gauges computed from sessions when collecting.
+func registerSessionMapMetrics(sessionMap *SessionMap) {
+	metrics.NewGaugeFunc("rtio_device_outgoing_queue_depth", "Messages waiting in outgoing queues of all sessions.", func() float64 {
+		return float64(sessionMap.OutgoingQueueDepth())
+	})
+}
+
+// meteredConn counts bytes read and written.
+type meteredConn struct {
+	net.Conn
+}
+
+func (c *meteredConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	metricBytesIn.Add(float64(n))
+	return n, err
+}
+
+func (c *meteredConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	metricBytesOut.Add(float64(n))
+	return n, err
+}
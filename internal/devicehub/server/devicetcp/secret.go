@@ -0,0 +1,84 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicetcp
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"time"
+
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+	"github.com/mkrainbow/rtio/pkg/rtioutil"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrSecretUnknown              = errors.New("ErrSecretUnknown")
+	ErrSecretRotationNotSupported = errors.New("ErrSecretRotationNotSupported")
+	ErrSecretRotationAck          = errors.New("ErrSecretRotationAck")
+)
+
+func (s *Session) secret() string {
+	s.secretLock.Lock()
+	defer s.secretLock.Unlock()
+	return s.deviceSecret
+}
+
+// RotateSecret posts the new secret sealed by the current one to the device,
+// which acks after persisting it. Returns the old secret, for the caller to
+// rotate back when failing to store the new one. Rotations are serialized,
+// the secret stays readable by others while the device answers.
+func (s *Session) RotateSecret(ctx context.Context, newSecret string, timeout time.Duration) (string, error) {
+	s.rotateLock.Lock()
+	defer s.rotateLock.Unlock()
+	old := s.secret()
+	if old == "" {
+		return "", ErrSecretUnknown
+	}
+	data, err := dp.SealSecret(s.deviceID, old, newSecret)
+	if err != nil {
+		log.Error().Err(err).Str("deviceid", s.deviceID).Msg("Failed to seal secret")
+		return "", err
+	}
+	code, ack, err := s.Send(ctx, rtioutil.URIHash(dp.URI_SecretRotation), dp.Method_ConstrainedPost, false, data, timeout)
+	if err != nil {
+		log.Error().Err(err).Str("deviceid", s.deviceID).Msg("Failed to send secret")
+		return "", err
+	}
+	switch code {
+	case dp.StatusCode_OK:
+	case dp.StatusCode_NotFount, dp.StatusCode_MethodNotAllowed:
+		log.Warn().Str("deviceid", s.deviceID).Str("code", code.String()).Msg("Secret rotation not supported by device")
+		return "", ErrSecretRotationNotSupported
+	default:
+		log.Error().Str("deviceid", s.deviceID).Str("code", code.String()).Msg("Secret rotation failed by device")
+		return "", ErrSecretRotationAck
+	}
+	if !hmac.Equal(ack, dp.SecretRotationAck(newSecret, data)) {
+		log.Error().Str("deviceid", s.deviceID).Msg("Secret rotation ack not match")
+		return "", ErrSecretRotationAck
+	}
+	s.secretLock.Lock()
+	s.deviceSecret = newSecret
+	s.secretLock.Unlock()
+	log.Info().Str("deviceid", s.deviceID).Msg("Secret rotated by device")
+	return old, nil
+}
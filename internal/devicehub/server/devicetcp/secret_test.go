@@ -0,0 +1,115 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package devicetcp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+	"github.com/mkrainbow/rtio/pkg/rtioutil"
+
+	"gotest.tools/assert"
+)
+
+// answerSecret reads the rotation as the device and answers it.
+func answerSecret(t *testing.T, peer net.Conn, deviceID, secret string, code dp.StatusCode, ack func(string, []byte) []byte) string {
+	header, body := readFrame(t, peer)
+	assert.Equal(t, header.Type, dp.MsgType_ServerSendReq)
+	req, err := dp.DecodeCoReq(header.ID, body)
+	assert.NilError(t, err)
+	assert.Equal(t, req.URI, rtioutil.URIHash(dp.URI_SecretRotation))
+	newSecret, err := dp.OpenSecret(deviceID, secret, req.Data)
+	assert.NilError(t, err)
+	resp := &dp.CoResp{HeaderID: header.ID, Method: req.Method, Code: code}
+	if code == dp.StatusCode_OK {
+		resp.Data = ack(newSecret, req.Data)
+	}
+	buf := make([]byte, int(dp.HeaderLen+dp.HeaderLen_CoResp)+len(resp.Data))
+	assert.NilError(t, dp.EncodeCoResp_OverServerSendResp(resp, buf))
+	_, err = peer.Write(buf)
+	assert.NilError(t, err)
+	return newSecret
+}
+
+func TestRotateSecret(t *testing.T) {
+	const (
+		deviceID  = "cfa09baa-4913-4ad7-a936-3e26f9671b09"
+		secret    = "mb6bgso4EChvyzA05thF9+wH"
+		newSecret = "Pq0Hk2t8W1xYz9abCdEfGhIj"
+	)
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	s := newSession(conn)
+	s.deviceID = deviceID
+	s.verifyPass = true
+	s.BodyCapSize = 512
+	s.RemoteAddr = conn.RemoteAddr()
+	s.ConnectTime = time.Now()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wait := &sync.WaitGroup{}
+	wait.Add(1)
+	go s.serve(ctx, wait, nil, func(string) {})
+
+	// secret unknown, such as verification disabled
+	_, err := s.RotateSecret(ctx, newSecret, time.Second)
+	assert.Equal(t, err, ErrSecretUnknown)
+	s.deviceSecret = secret
+
+	// not supported by the device
+	go answerSecret(t, peer, deviceID, secret, dp.StatusCode_NotFount, nil)
+	_, err = s.RotateSecret(ctx, newSecret, time.Second)
+	assert.Equal(t, err, ErrSecretRotationNotSupported)
+
+	// ack not proving the new secret
+	go answerSecret(t, peer, deviceID, secret, dp.StatusCode_OK, func(string, []byte) []byte { return []byte("ack") })
+	_, err = s.RotateSecret(ctx, newSecret, time.Second)
+	assert.Equal(t, err, ErrSecretRotationAck)
+	assert.Equal(t, s.secret(), secret)
+
+	// the secret is readable, such as by a handoff, while the device answers
+	got := make(chan string, 1)
+	inFlight := make(chan string, 1)
+	go func() {
+		got <- answerSecret(t, peer, deviceID, secret, dp.StatusCode_OK, func(newSecret string, data []byte) []byte {
+			inFlight <- s.secret()
+			return dp.SecretRotationAck(newSecret, data)
+		})
+	}()
+	old, err := s.RotateSecret(ctx, newSecret, time.Second)
+	assert.NilError(t, err)
+	assert.Equal(t, old, secret)
+	assert.Equal(t, <-inFlight, secret)
+	assert.Equal(t, <-got, newSecret)
+	assert.Equal(t, s.secret(), newSecret)
+
+	// sealed by the new secret next time
+	go answerSecret(t, peer, deviceID, newSecret, dp.StatusCode_OK, dp.SecretRotationAck)
+	old, err = s.RotateSecret(ctx, secret, time.Second)
+	assert.NilError(t, err)
+	assert.Equal(t, old, newSecret)
+
+	cancel()
+	wait.Wait()
+}
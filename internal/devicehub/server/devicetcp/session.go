@@ -23,11 +23,13 @@ import (
 	"errors"
 	"io"
 	"net"
+	"os"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/mkrainbow/rtio/internal/audit"
 	"github.com/mkrainbow/rtio/internal/devicehub/server/backendconn"
 	"github.com/mkrainbow/rtio/internal/devicehub/server/service"
 	"github.com/mkrainbow/rtio/pkg/config"
@@ -44,7 +46,11 @@ const (
 )
 
 var (
+	getDeviceVerifier    = backendconn.GetDeviceVerifier    // replaced in tests
+	getDeviceProvisioner = backendconn.GetDeviceProvisioner // replaced in tests
+
 	OutgoingChanSize = 10
+	SendTimeoutMax   = 120 * time.Second // requests waiting longer are dropped from the send store
 
 	ErrRtioInternalServerError   = errors.New("ErrRtioInternalServerError")
 	ErrSessionNotFound           = errors.New("ErrSessionNotFound")
@@ -61,6 +67,10 @@ var (
 	ErrMethodNotAllowed          = errors.New("ErrMethodNotAllowed")
 	ErrResourceNotFound          = errors.New("ErrResourceNotFound")
 	ErrMethodNotMatch            = errors.New("ErrMethodNotMatch")
+	ErrListenerNotAccepting      = errors.New("ErrListenerNotAccepting")
+	ErrSessionDraining           = errors.New("ErrSessionDraining")
+	ErrSessionGoaway             = errors.New("ErrSessionGoaway")
+	ErrSessionPaused             = errors.New("ErrSessionPaused")
 )
 
 type Message struct {
@@ -70,7 +80,12 @@ type Message struct {
 
 type Session struct {
 	deviceID              string
+	deviceSecret          string     // verified secret, for the secret rotation
+	secretLock            sync.Mutex // deviceSecret
+	rotateLock            sync.Mutex // one rotation at a time, not taken by readers of the secret
 	conn                  net.Conn
+	raw                   net.Conn // tcp conn under proxy protocol, nil for tls
+	secure                bool     // over tls
 	outgoingChan          chan []byte
 	sendIDStore           *timekv.TimeKV
 	observerStore         sync.Map
@@ -79,23 +94,36 @@ type Session struct {
 	rollingObserverID     uint16 // rolling number for observer id
 	rollingObserverIDLock sync.Mutex
 	observerCount         atomic.Int32
+	deviceObStore         sync.Map // observations by the device, by observer id of the device
+	deviceObCount         atomic.Int32
 	BodyCapSize           uint16
 	heartbeatSeconds      uint16
 	RemoteAddr            net.Addr
+	ConnectTime           time.Time
 	verifyPass            bool
+	draining              atomic.Bool
+	inflight              atomic.Int32 // Send and ObGetEstablish in progress
+	pausing               atomic.Bool  // stop reading for handoff
+	frameLock             sync.Mutex   // pausing and inFrame, for the read deadline
+	inFrame               bool         // reading a message after its header
+	pending               []byte       // read but not handled when paused
+	pausedChan            chan *os.File
+	admission             *admission // nil when not admitted by the accept loop
+	admitOnce             sync.Once
 	cancel                context.CancelFunc
 	done                  chan struct{}
 }
 
 func newSession(conn net.Conn) *Session {
 	s := &Session{
-		conn:             conn,
+		conn:             &meteredConn{Conn: conn},
 		outgoingChan:     make(chan []byte, OutgoingChanSize),
 		verifyPass:       false,
 		done:             make(chan struct{}, 1),
+		pausedChan:       make(chan *os.File, 1),
 		heartbeatSeconds: HEARTBEAT_SECONDS_DEFAULT,
 	}
-	s.sendIDStore = timekv.NewTimeKV(time.Second * 120)
+	s.sendIDStore = timekv.NewTimeKV(SendTimeoutMax)
 	s.rollingHeaderID = 0
 	s.rollingObserverID = 0
 	s.observerCount.Store(0)
@@ -107,6 +135,7 @@ type Observa struct { // Observation
 	FrameID         uint32
 	NotifyChan      chan *dp.ObGetNotifyReq
 	SessionDoneChan chan struct{}
+	TerminateChan   chan struct{} // session draining, terminate the observation
 }
 
 func calcuCheckSenconds(heartbeat uint16) time.Duration {
@@ -140,9 +169,11 @@ func (s *Session) CreateObserva() (*Observa, error) {
 		FrameID:         0,
 		NotifyChan:      make(chan *dp.ObGetNotifyReq, 1),
 		SessionDoneChan: make(chan struct{}, 1),
+		TerminateChan:   make(chan struct{}, 1),
 	}
 	s.observerStore.Store(ob.ObserverID, ob)
 	s.observerCount.Add(1)
+	metricObservers.Inc()
 	log.Debug().Uint16("obid", ob.ObserverID).Int32("obcount", s.observerCount.Load()).Msg("create observa")
 	return ob, nil
 }
@@ -151,14 +182,16 @@ func (s *Session) DestroyObserva(id uint16) {
 		ob := v.(*Observa)
 		close(ob.NotifyChan)
 		s.observerCount.Add(-1)
+		metricObservers.Dec()
 		log.Debug().Uint16("obid", ob.ObserverID).Int32("obcount", s.observerCount.Load()).Msg("destroy observa")
 	}
 }
 
-func (s *Session) sendObEstabReq(ob *Observa, uri uint32, headerID uint16, data []byte) (<-chan []byte, error) {
+func (s *Session) sendObEstabReq(ob *Observa, uri uint32, headerID uint16, sealed bool, data []byte) (<-chan []byte, error) {
 	req := &dp.ObGetEstabReq{
 		HeaderID: headerID,
 		Method:   dp.Method_ObservedGet,
+		Sealed:   sealed,
 		ObID:     ob.ObserverID,
 		URI:      uri,
 		Data:     data,
@@ -244,10 +277,17 @@ func (s *Session) sendObNotifyResp(resp *dp.ObGetNotifyResp) error {
 	s.outgoingChan <- buf
 	return nil
 }
-func (s *Session) ObGetEstablish(ctx context.Context, uri uint32, ob *Observa, data []byte, timeout time.Duration) (dp.StatusCode, error) {
 
+// ObGetEstablish establishes the observation on the device, sealed marks data
+// as an envelope passed through opaque.
+func (s *Session) ObGetEstablish(ctx context.Context, uri uint32, ob *Observa, sealed bool, data []byte, timeout time.Duration) (dp.StatusCode, error) {
+
+	if err := s.enter(); err != nil {
+		return dp.StatusCode_Unknown, err
+	}
+	defer s.leave()
 	headerID := s.genHeaderID()
-	respChan, err := s.sendObEstabReq(ob, uri, headerID, data)
+	respChan, err := s.sendObEstabReq(ob, uri, headerID, sealed, data)
 	if err != nil {
 		return dp.StatusCode_Unknown, err
 	}
@@ -258,14 +298,15 @@ func (s *Session) ObGetEstablish(ctx context.Context, uri uint32, ob *Observa, d
 	return statusCode, nil
 }
 
-func (s *Session) sendCoReq(uri uint32, method dp.Method, headerID uint16, data []byte) (<-chan []byte, error) {
+func (s *Session) sendCoReq(uri uint32, method dp.Method, headerID uint16, sealed bool, data []byte) (<-chan []byte, error) {
 	req := &dp.CoReq{
 		HeaderID: headerID,
 		Method:   method,
+		Sealed:   sealed,
 		URI:      uri,
 		Data:     data,
 	}
-	log.Info().Uint16("headerid", headerID).Uint32("uri", uri).Msg("send CoReq")
+	log.Info().Uint16("headerid", headerID).Uint32("uri", uri).Bool("sealed", sealed).Msg("send CoReq")
 	buf := make([]byte, dp.HeaderLen+dp.HeaderLen_CoReq+uint16(len(data)))
 	if err := dp.EncodeCoReq_OverServerSendReq(req, buf); err != nil {
 		log.Error().Uint16("headerid", headerID).Err(err).Msg("send CoReq")
@@ -305,9 +346,15 @@ func (s *Session) receiveCoResp(headerID uint16, respChan <-chan []byte, timeout
 	}
 }
 
-func (s *Session) Send(ctx context.Context, uri uint32, method dp.Method, data []byte, timeout time.Duration) (dp.StatusCode, []byte, error) {
+// Send sends a request to the device and waits the response, sealed marks data
+// as an envelope passed through opaque.
+func (s *Session) Send(ctx context.Context, uri uint32, method dp.Method, sealed bool, data []byte, timeout time.Duration) (dp.StatusCode, []byte, error) {
+	if err := s.enter(); err != nil {
+		return dp.StatusCode_Unknown, nil, err
+	}
+	defer s.leave()
 	headerID := s.genHeaderID()
-	respChan, err := s.sendCoReq(uri, method, headerID, data)
+	respChan, err := s.sendCoReq(uri, method, headerID, sealed, data)
 	if err != nil {
 		return dp.StatusCode_Unknown, nil, err
 	}
@@ -334,6 +381,9 @@ func (s *Session) receiveVerifyReq(ctx context.Context, header *dp.Header) (bool
 		log.Error().Int("readLen", readLen).Err(err).Msg("Failed to read buf")
 		return false, err
 	}
+	if dp.IsEnrollReqBody(reqBodyBuf) {
+		return false, s.receiveEnrollReq(ctx, header, reqBodyBuf)
+	}
 	req, err := dp.DecodeVerifyReqBody(header, reqBodyBuf)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to decode req body")
@@ -346,19 +396,40 @@ func (s *Session) receiveVerifyReq(ctx context.Context, header *dp.Header) (bool
 	// device verify
 	if !config.BoolKV.GetWithDefault("disable.deviceverify", false) {
 
-		verifyClient, err := backendconn.GetDeviceVerifier()
+		verifyClient, err := getDeviceVerifier()
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to get device verify client")
 			return false, s.sendVerifyResp(header, dp.Code_UnkownErr)
 		}
+		ip := remoteIP(s.RemoteAddr)
+		if guards != nil {
+			if d := guards.locked(ip, req.DeviceID); d > 0 {
+				log.Warn().Str("deviceid", req.DeviceID).Str("ip", ip).Dur("lockout", d).Msg("Verify locked out")
+				metricShed.WithLabelValues("lockout").Inc()
+				return false, s.sendVerifyTryLater(header, retrySeconds(d))
+			}
+			if err := guards.acquire(ctx); err != nil {
+				log.Warn().Err(err).Str("deviceid", req.DeviceID).Msg("Verify queue busy")
+				metricShed.WithLabelValues("verify_queue").Inc()
+				return false, s.sendVerifyTryLater(header, retryHint(guards.retryAfter))
+			}
+		}
 		ok, err := verifyClient.Verify(req.DeviceID, req.DeviceSecret)
+		if guards != nil {
+			guards.release()
+		}
 		if err != nil {
 			log.Error().Err(err).Msg("call Verify err")
+			metricVerify.WithLabelValues("error").Inc()
 			err = s.sendVerifyResp(header, dp.Code_UnkownErr)
 			return s.verifyPass, err
 		}
+		if guards != nil {
+			guards.result(ip, req.DeviceID, ok)
+		}
 		if !ok {
 			log.Warn().Err(err).Str("deviceid", req.DeviceID).Msg("Validation Failed")
+			metricVerify.WithLabelValues("fail").Inc()
 			err = s.sendVerifyResp(header, dp.Code_VerifyFail)
 			return false, err
 		}
@@ -370,9 +441,12 @@ func (s *Session) receiveVerifyReq(ctx context.Context, header *dp.Header) (bool
 		err = s.sendVerifyResp(header, dp.Code_UnkownErr)
 		return false, err
 	}
+	metricVerify.WithLabelValues("ok").Inc()
+	s.admitted()
 	s.verifyPass = true
 	s.BodyCapSize = capSize
 	s.deviceID = req.DeviceID
+	s.deviceSecret = req.DeviceSecret
 	err = s.sendVerifyResp(header, dp.Code_Success)
 	if err != nil {
 		return false, err
@@ -399,6 +473,26 @@ func (s *Session) sendVerifyResp(header *dp.Header, code dp.RemoteCode) error {
 	return nil
 }
 
+// sendVerifyTryLater tells the device when to retry verifying, the session
+// closes after it is written.
+func (s *Session) sendVerifyTryLater(header *dp.Header, retryAfter uint16) error {
+	respBuf, err := dp.EncodeVerifyResp(&dp.VerifyResp{
+		Header: &dp.Header{
+			Version: dp.Version,
+			Type:    dp.MsgType_DeviceVerifyResp,
+			ID:      header.ID,
+			Code:    dp.Code_TryLater,
+		},
+		RetryAfter: retryAfter,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("send VerifyResp")
+		return err
+	}
+	s.outgoingChan <- respBuf
+	return nil
+}
+
 func (s *Session) devicePingProcess(header *dp.Header) error {
 
 	bodyBuf := make([]byte, header.BodyLen)
@@ -469,6 +563,7 @@ func (s *Session) serverSendRespone(header *dp.Header) error {
 }
 
 func (s *Session) receiveCoReq(header *dp.Header, buf []byte) error {
+	start := time.Now()
 	req, err := dp.DecodeCoReq(header.ID, buf)
 	if err != nil {
 		log.Error().Err(err).Msg("receive CoReq")
@@ -479,7 +574,8 @@ func (s *Session) receiveCoReq(header *dp.Header, buf []byte) error {
 		Method:   req.Method,
 	}
 
-	url, ok := config.StringKV.Get("deviceservice." + strconv.FormatUint(uint64(req.URI), 16))
+	uriKey := strconv.FormatUint(uint64(req.URI), 16)
+	url, ok := config.StringKV.Get("deviceservice." + uriKey)
 
 	if ok {
 		c, err := backendconn.GetServiceClient()
@@ -487,7 +583,9 @@ func (s *Session) receiveCoReq(header *dp.Header, buf []byte) error {
 			id, err := rtioutil.GenUint32ID()
 			if err == nil {
 				log.Info().Uint16("headerid", req.HeaderID).Uint32("postid", id).Uint32("uri", req.URI).Msg("Post to device service")
-				data, err := c.Post(id, url, s.deviceID, req.Data)
+				dev := &service.Device{ID: s.deviceID, RemoteAddr: s.RemoteAddr.String(), ConnectTime: s.ConnectTime.Unix()}
+				uri := config.StringKV.GetWithDefault("deviceservice.uri."+uriKey, "")
+				data, err := c.Post(id, url, dev, uri, req.Data)
 				if err == nil {
 					resp.Data = data
 					resp.Code = dp.StatusCode_OK
@@ -509,6 +607,7 @@ func (s *Session) receiveCoReq(header *dp.Header, buf []byte) error {
 	} else {
 		resp.Code = dp.StatusCode_NotFount
 	}
+	s.auditCoReq(req, uriKey, resp.Code, start)
 
 	err = s.sendCoResp(resp)
 	if err != nil {
@@ -516,6 +615,30 @@ func (s *Session) receiveCoReq(header *dp.Header, buf []byte) error {
 	}
 	return nil
 }
+
+// auditCoReq records a request by the device, the uri is the digest in hex
+// when not mapped to a device service.
+func (s *Session) auditCoReq(req *dp.CoReq, uriKey string, code dp.StatusCode, start time.Time) {
+	if !audit.Enabled() {
+		return
+	}
+	method := "copost"
+	if req.Method == dp.Method_ConstrainedGet {
+		method = "coget"
+	}
+	audit.Log(&audit.Record{
+		Source:   audit.SourceDevice,
+		Caller:   "device:" + s.deviceID,
+		ID:       uint32(req.HeaderID),
+		DeviceID: s.deviceID,
+		Method:   method,
+		URI:      config.StringKV.GetWithDefault("deviceservice.uri."+uriKey, uriKey),
+		Payload:  req.Data,
+		Code:     code.String(),
+		Latency:  time.Since(start),
+	})
+}
+
 func (s *Session) sendCoResp(resp *dp.CoResp) error {
 	log.Info().Uint16("headerid", resp.HeaderID).Str("status", resp.Code.String()).Msg("send CoResp")
 	buf := make([]byte, dp.HeaderLen+dp.HeaderLen_CoResp+uint16(len(resp.Data)))
@@ -527,7 +650,7 @@ func (s *Session) sendCoResp(resp *dp.CoResp) error {
 	return nil
 }
 
-func (s *Session) deviceSendRequest(header *dp.Header) error {
+func (s *Session) deviceSendRequest(ctx context.Context, header *dp.Header) error {
 
 	bodyBuf := make([]byte, header.BodyLen)
 	readLen, err := io.ReadFull(s.conn, bodyBuf)
@@ -550,6 +673,13 @@ func (s *Session) deviceSendRequest(header *dp.Header) error {
 			return err
 		}
 	case dp.Method_ObservedGet:
+		if dp.IsObGetEstabReq(bodyBuf) {
+			if err := s.receiveDeviceObEstabReq(ctx, header, bodyBuf); err != nil {
+				log.Error().Err(err).Msg("handle device request")
+				return err
+			}
+			break
+		}
 		err := s.receiveObNotifyReq(header, bodyBuf)
 		if err != nil {
 			log.Error().Err(err).Msg("handle device request")
@@ -577,6 +707,10 @@ func (s *Session) tcpIncomming(serveCtx context.Context, addSession func(context
 			readLen, err := io.ReadFull(s.conn, headBuf)
 			log.Debug().Int("readlen", readLen).Hex("buf", headBuf).Msg("Incomming route, read header")
 			if err != nil {
+				if s.pausing.Load() && errors.Is(err, os.ErrDeadlineExceeded) {
+					s.pending = headBuf[:readLen]
+					err = ErrSessionPaused
+				}
 				errChan <- err
 				return
 			}
@@ -586,6 +720,7 @@ func (s *Session) tcpIncomming(serveCtx context.Context, addSession func(context
 				return
 			}
 
+			s.beginFrame()
 			switch header.Type {
 			case dp.MsgType_DeviceVerifyReq:
 				if ok, err := s.receiveVerifyReq(serveCtx, header); err != nil {
@@ -606,7 +741,7 @@ func (s *Session) tcpIncomming(serveCtx context.Context, addSession func(context
 				log.Debug().Uint16("heartbeat", s.heartbeatSeconds).Msg("Incomming route, ping req")
 				heartbeatTimer.Reset(time.Second * calcuCheckSenconds(s.heartbeatSeconds))
 			case dp.MsgType_DeviceSendReq:
-				if err := s.deviceSendRequest(header); err != nil {
+				if err := s.deviceSendRequest(serveCtx, header); err != nil {
 					errChan <- err
 					return
 				}
@@ -622,12 +757,13 @@ func (s *Session) tcpIncomming(serveCtx context.Context, addSession func(context
 				errChan <- ErrDataType
 				return
 			}
-
+			s.endFrame()
 		}
 	}
 }
-func (s *Session) tcpOutgoing(serveCtx context.Context, errChan chan<- error) {
+func (s *Session) tcpOutgoing(serveCtx context.Context, errChan chan<- error, outgoingDone chan<- struct{}) {
 	defer func() {
+		close(outgoingDone)
 		log.Debug().Msg("Outgoing route exit")
 	}()
 
@@ -643,6 +779,10 @@ func (s *Session) tcpOutgoing(serveCtx context.Context, errChan chan<- error) {
 				errChan <- err
 				return
 			}
+			if isGoaway(buf) || isTryLater(buf) || isEnrolled(buf) {
+				errChan <- ErrSessionGoaway
+				return
+			}
 		}
 	}
 }
@@ -651,16 +791,23 @@ func (s *Session) serve(ctx context.Context, wait *sync.WaitGroup,
 	delSession func(string)) {
 	var serveCtx context.Context
 	serveCtx, s.cancel = context.WithCancel(ctx)
+	defer s.cancel() // ends observations by the device
 	serveLogger := log.With().Str("client_ip", s.conn.RemoteAddr().String()).Logger()
 	serveLogger.Info().Msg("start serving")
 	defer func() {
 		serveLogger.Info().Msg("stop service for this conn")
 	}()
 
-	s.RemoteAddr = s.conn.RemoteAddr()
+	if s.RemoteAddr == nil {
+		s.RemoteAddr = s.conn.RemoteAddr()
+	}
+	if s.ConnectTime.IsZero() {
+		s.ConnectTime = time.Now()
+	}
 
 	defer wait.Done()
 	defer s.conn.Close()
+	defer s.admitted()
 	defer func() {
 		// close all observations
 		s.observerStore.Range(func(k, v any) bool {
@@ -672,6 +819,12 @@ func (s *Session) serve(ctx context.Context, wait *sync.WaitGroup,
 		if s.verifyPass {
 			delSession(s.deviceID)
 		}
+		if s.pausing.Load() { // not detached
+			select {
+			case s.pausedChan <- nil:
+			default:
+			}
+		}
 		s.done <- struct{}{}
 	}()
 
@@ -680,7 +833,11 @@ func (s *Session) serve(ctx context.Context, wait *sync.WaitGroup,
 	heartbeatTimer := time.NewTicker(time.Second * calcuCheckSenconds(s.heartbeatSeconds))
 	defer heartbeatTimer.Stop()
 	errChan := make(chan error, 2)
-	go s.tcpOutgoing(serveCtx, errChan)
+	outgoingDone := make(chan struct{})
+	if s.verifyPass { // resumed by handoff
+		verifyTimer.Stop()
+	}
+	go s.tcpOutgoing(serveCtx, errChan, outgoingDone)
 	go s.tcpIncomming(serveCtx, addSession, verifyTimer, heartbeatTimer, errChan)
 
 	storeTicker := time.NewTicker(time.Second * 5)
@@ -694,10 +851,16 @@ func (s *Session) serve(ctx context.Context, wait *sync.WaitGroup,
 			return
 		case <-heartbeatTimer.C:
 			log.Debug().Err(ErrSessionHeartbeatTimeout).Msg("Incomming route heartbeatTimer timeout")
+			metricHeartbeatTimeouts.Inc()
 			errChan <- ErrSessionHeartbeatTimeout
 			return
 		case err := <-errChan:
 			s.cancel()
+			if err == ErrSessionPaused {
+				<-outgoingDone
+				s.pausedChan <- s.detach()
+				return
+			}
 			log.Warn().Err(err).Msg("serve done when error")
 			return
 		case <-serveCtx.Done():
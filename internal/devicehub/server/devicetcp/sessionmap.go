@@ -24,13 +24,37 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// Directory is told the devices of sessions on this node, see cluster.
+type Directory interface {
+	Register(deviceID string)
+	Unregister(deviceID string)
+}
+
 type SessionMap struct {
-	store sync.Map
+	store     sync.Map
+	dirLock   sync.RWMutex
+	directory Directory
+}
+
+// SetDirectory registers the devices of sessions to dir, existing and later.
+func (s *SessionMap) SetDirectory(dir Directory) {
+	s.dirLock.Lock()
+	defer s.dirLock.Unlock()
+	s.directory = dir
+	s.Range(func(deviceID string, _ *Session) bool {
+		dir.Register(deviceID)
+		return true
+	})
 }
 
 func (s *SessionMap) Set(deviceID string, value *Session) {
 	log.Debug().Str("deviceid", deviceID).Msg("Set")
+	s.dirLock.RLock()
+	defer s.dirLock.RUnlock()
 	s.store.Store(deviceID, value)
+	if s.directory != nil {
+		s.directory.Register(deviceID)
+	}
 }
 func (s *SessionMap) Get(deviceID string) (*Session, bool) {
 	v, ok := s.store.Load(deviceID)
@@ -42,5 +66,27 @@ func (s *SessionMap) Get(deviceID string) (*Session, bool) {
 }
 func (s *SessionMap) Del(deviceID string) {
 	log.Debug().Str("deviceid", deviceID).Msg("Del")
+	s.dirLock.RLock()
+	defer s.dirLock.RUnlock()
 	s.store.Delete(deviceID)
+	if s.directory != nil {
+		s.directory.Unregister(deviceID)
+	}
+}
+
+// Range calls f for each session no order, stops if f returns false.
+func (s *SessionMap) Range(f func(deviceID string, session *Session) bool) {
+	s.store.Range(func(k, v any) bool {
+		return f(k.(string), v.(*Session))
+	})
+}
+
+// OutgoingQueueDepth gets messages waiting to send of all sessions.
+func (s *SessionMap) OutgoingQueueDepth() int {
+	n := 0
+	s.Range(func(_ string, session *Session) bool {
+		n += len(session.outgoingChan)
+		return true
+	})
+	return n
 }
@@ -0,0 +1,195 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package provisioner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/backendmetric"
+	"github.com/mkrainbow/rtio/internal/devicehub/server/registry"
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/pkg/config"
+	"github.com/mkrainbow/rtio/pkg/rtioutil"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrClaimRejected   = errors.New("ErrClaimRejected")
+	ErrProvisionerCode = errors.New("ErrProvisionerCode")
+)
+
+const (
+	TimeoutDefault = 5 * time.Second
+)
+
+// Provisioner mints the device ID and secret of a device enrolling by a claim
+// token, ErrClaimRejected when the token is unknown, expired or used up.
+type Provisioner interface {
+	Enroll(claimToken, serial string) (deviceID, deviceSecret string, err error)
+}
+
+type Client struct {
+	client *http.Client
+	url    string
+}
+
+type EnrollReq struct {
+	ID         uint32 `json:"id"`
+	Method     string `json:"method"`
+	ClaimToken string `json:"claimtoken"`
+	Serial     string `json:"serial,omitempty"`
+}
+
+type EnrollResp struct {
+	ID           int    `json:"id"`
+	Code         string `json:"code"`
+	DeviceID     string `json:"deviceid"`
+	DeviceSecret string `json:"devicesecret"`
+}
+
+// NewClient creates the http provisioner, https certs are verified by the CA
+// of config deviceverifier.tls.ca, the system CAs if empty.
+func NewClient(url string, timeout time.Duration) (*Client, error) {
+	if timeout <= 0 {
+		timeout = TimeoutDefault
+	}
+	tlsConfig, err := rpcauth.LoadClientTLSConfig(config.StringKV.GetWithDefault("deviceverifier.tls.ca", ""), "", "", "")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load device provisioner CA")
+		return nil, err
+	}
+	return &Client{
+		client: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}, Timeout: timeout},
+		url:    url,
+	}, nil
+}
+
+func (c *Client) Enroll(claimToken, serial string) (string, string, error) {
+	id, err := rtioutil.GenUint32ID()
+	if err != nil {
+		log.Error().Err(err).Msg("GenUint32ID err")
+		return "", "", err
+	}
+	buf, err := json.Marshal(&EnrollReq{ID: id, Method: "enroll", ClaimToken: claimToken, Serial: serial})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to Marshal req")
+		return "", "", err
+	}
+	start := time.Now()
+	httpResp, err := c.client.Post(c.url, "application/json", bytes.NewBuffer(buf))
+	backendmetric.Observe("provisioner", start, err)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to post req")
+		return "", "", err
+	}
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read body")
+		return "", "", err
+	}
+	resp := &EnrollResp{}
+	if err := json.Unmarshal(body, resp); err != nil {
+		log.Error().Err(err).Str("body", string(body)).Msg("Failed to Unmarshal resp")
+		return "", "", err
+	}
+
+	switch resp.Code {
+	case "OK":
+		return resp.DeviceID, resp.DeviceSecret, nil
+	case "VERIFICATION_FAILED", "NOT_FOUND":
+		log.Warn().Str("serial", serial).Str("code", resp.Code).Msg("Claim rejected")
+		return "", "", ErrClaimRejected
+	}
+	log.Error().Str("serial", serial).Str("code", resp.Code).Msg("Failed to enroll device")
+	return "", "", ErrProvisionerCode
+}
+
+// Local enrolls devices into the device registry by the claim tokens of the
+// claims file. A serial enrolling again by its token, such as after the
+// response was lost, gets the same device ID with a new secret.
+type Local struct {
+	claims    *registry.Claims
+	registry  *registry.Registry
+	algorithm string
+	lock      sync.Mutex // one enrollment at a time, not to mint a serial twice
+}
+
+func NewLocal(claims *registry.Claims, r *registry.Registry, algorithm string) *Local {
+	return &Local{claims: claims, registry: r, algorithm: algorithm}
+}
+
+func (l *Local) Enroll(claimToken, serial string) (string, string, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	batch, deviceID, err := l.claims.Use(claimToken, serial)
+	if err != nil {
+		switch err {
+		case registry.ErrClaimNotFound, registry.ErrClaimExpired, registry.ErrClaimExhausted:
+			log.Warn().Err(err).Str("serial", serial).Msg("Claim rejected")
+			return "", "", ErrClaimRejected
+		}
+		return "", "", err
+	}
+	if deviceID != "" {
+		return l.reenroll(batch, serial, deviceID)
+	}
+	deviceID, deviceSecret, err := l.registry.Add("", "", l.algorithm)
+	if err == nil {
+		err = l.registry.Save()
+	}
+	if err != nil {
+		log.Error().Err(err).Str("batch", batch).Msg("Failed to add enrolled device")
+		if deviceID != "" {
+			l.registry.Remove(deviceID)
+		}
+		return "", "", err
+	}
+	if err := l.claims.Bind(batch, serial, deviceID); err != nil {
+		log.Warn().Err(err).Str("batch", batch).Str("serial", serial).Msg("Failed to record enrolled serial")
+	}
+	log.Info().Str("batch", batch).Str("serial", serial).Str("deviceid", deviceID).Msg("Device enrolled")
+	return deviceID, deviceSecret, nil
+}
+
+// reenroll rotates the secret of the device enrolled by the serial before,
+// a device removed from the registry is not enrolled again.
+func (l *Local) reenroll(batch, serial, deviceID string) (string, string, error) {
+	deviceSecret, err := l.registry.Rotate(deviceID, "", l.algorithm)
+	if err == registry.ErrDeviceNotFound {
+		log.Warn().Str("batch", batch).Str("serial", serial).Str("deviceid", deviceID).Msg("Enrolled device removed")
+		return "", "", ErrClaimRejected
+	}
+	if err == nil {
+		err = l.registry.Save()
+	}
+	if err != nil {
+		log.Error().Err(err).Str("batch", batch).Str("deviceid", deviceID).Msg("Failed to rotate re-enrolled device")
+		return "", "", err
+	}
+	log.Info().Str("batch", batch).Str("serial", serial).Str("deviceid", deviceID).Msg("Device re-enrolled")
+	return deviceID, deviceSecret, nil
+}
@@ -0,0 +1,107 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package provisioner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/registry"
+
+	"gotest.tools/assert"
+)
+
+func TestClientEnroll(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &EnrollReq{}
+		json.NewDecoder(r.Body).Decode(req)
+		resp := &EnrollResp{ID: int(req.ID), Code: "VERIFICATION_FAILED"}
+		switch {
+		case req.Method != "enroll":
+			resp.Code = "METHOD_NOT_ALLOWED"
+		case req.ClaimToken == "batch1-claim-token-0001":
+			resp.Code = "OK"
+			resp.DeviceID = "cfa09baa-4913-4ad7-a936-3e26f9671b09"
+			resp.DeviceSecret = "mb6bgso4EChvyzA05thF9+wH"
+		case req.ClaimToken == "":
+			resp.Code = "INTERNAL_SERVER_ERROR"
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL, 0)
+	assert.NilError(t, err)
+	id, secret, err := c.Enroll("batch1-claim-token-0001", "SN0001")
+	assert.NilError(t, err)
+	assert.Equal(t, "cfa09baa-4913-4ad7-a936-3e26f9671b09", id)
+	assert.Equal(t, "mb6bgso4EChvyzA05thF9+wH", secret)
+	_, _, err = c.Enroll("batch2-claim-token-0001", "")
+	assert.Equal(t, ErrClaimRejected, err)
+	_, _, err = c.Enroll("", "")
+	assert.Equal(t, ErrProvisionerCode, err)
+}
+
+func TestLocalEnroll(t *testing.T) {
+	dir := t.TempDir()
+	claims, err := registry.LoadClaims(filepath.Join(dir, "claims.json"))
+	assert.NilError(t, err)
+	token, err := claims.Add("batch1", "", 1, time.Now().Add(time.Hour))
+	assert.NilError(t, err)
+	assert.NilError(t, claims.Save())
+	r, err := registry.LoadRegistry(filepath.Join(dir, "devices.json"))
+	assert.NilError(t, err)
+
+	l := NewLocal(claims, r, registry.HashBcrypt)
+	id, secret, err := l.Enroll(token, "SN0001")
+	assert.NilError(t, err)
+	ok, err := r.Verify(id, secret)
+	assert.NilError(t, err)
+	assert.Equal(t, true, ok)
+
+	// saved for the verifier of another process
+	r2, err := registry.LoadRegistry(filepath.Join(dir, "devices.json"))
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(r2.List()))
+
+	// the same serial again gets the same ID with a new secret, not a use
+	id2, secret2, err := l.Enroll(token, "SN0001")
+	assert.NilError(t, err)
+	assert.Equal(t, id, id2)
+	assert.Assert(t, secret != secret2)
+	ok, err = r.Verify(id, secret)
+	assert.NilError(t, err)
+	assert.Equal(t, false, ok)
+	assert.Equal(t, 1, len(r.List()))
+
+	_, _, err = l.Enroll(token, "SN0002")
+	assert.Equal(t, ErrClaimRejected, err)
+
+	// a removed device is not enrolled again
+	assert.NilError(t, r.Remove(id))
+	assert.NilError(t, r.Save())
+	_, _, err = l.Enroll(token, "SN0001")
+	assert.Equal(t, ErrClaimRejected, err)
+	_, _, err = l.Enroll("unknown-claim-token-0001", "")
+	assert.Equal(t, ErrClaimRejected, err)
+}
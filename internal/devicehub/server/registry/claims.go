@@ -0,0 +1,283 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/filestore"
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrClaimNotFound  = errors.New("ErrClaimNotFound")
+	ErrClaimExists    = errors.New("ErrClaimExists")
+	ErrClaimExpired   = errors.New("ErrClaimExpired")
+	ErrClaimExhausted = errors.New("ErrClaimExhausted")
+	ErrClaimInvalid   = errors.New("ErrClaimInvalid")
+)
+
+const (
+	ClaimTokenLen = 24 // bytes, base64url encoded in 32 chars
+)
+
+// Claim is the claim token of a batch of devices enrolling by it, only the
+// SHA-256 of the token is stored as it is random.
+type Claim struct {
+	Batch     string `json:"batch"`
+	TokenHash string `json:"token_hash"`
+	MaxUses   int    `json:"max_uses,omitempty"` // 0 for unlimited
+	Used      int    `json:"used"`
+	Expire    int64  `json:"expire,omitempty"` // unix seconds, 0 for never
+	Created   int64  `json:"created,omitempty"`
+	// device IDs enrolled by the token, by serial
+	Devices map[string]string `json:"devices,omitempty"`
+}
+
+type claimsFile struct {
+	Claims []*Claim `json:"claims"`
+}
+
+// Claims is the claim tokens of a json file. The file is read on each use,
+// so the changes by 'rtio claim' apply at once.
+type Claims struct {
+	path    string
+	claims  map[string]*Claim // by batch
+	changes map[string]*Claim // not saved yet, nil for removed
+	lock    sync.Mutex
+}
+
+// LoadClaims loads the claims from path, an absent file has no claims.
+func LoadClaims(path string) (*Claims, error) {
+	c := &Claims{path: path, changes: make(map[string]*Claim)}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Claims) read() (map[string]*Claim, error) {
+	claims := make(map[string]*Claim)
+	buf, err := os.ReadFile(c.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Error().Err(err).Str("file", c.path).Msg("Failed to read claims")
+		return nil, ErrRegistryLoad
+	}
+	if err == nil {
+		f := &claimsFile{}
+		if err := json.Unmarshal(buf, f); err != nil {
+			log.Error().Err(err).Str("file", c.path).Msg("Failed to parse claims")
+			return nil, ErrRegistryLoad
+		}
+		for _, cl := range f.Claims {
+			claims[cl.Batch] = cl
+		}
+	}
+	return claims, nil
+}
+
+func (c *Claims) load() error {
+	claims, err := c.read()
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.apply(claims)
+	return nil
+}
+
+// apply sets the claims read from the file, with the changes not saved.
+func (c *Claims) apply(claims map[string]*Claim) {
+	for batch, cl := range c.changes {
+		if cl == nil {
+			delete(claims, batch)
+		} else {
+			claims[batch] = cl
+		}
+	}
+	c.claims = claims
+}
+
+// update locks the file, reads it again with the changes applied, and writes
+// it after f, so changes by others meanwhile, such as uses counted by other
+// hubs, are kept. Nothing is written if f fails.
+func (c *Claims) update(f func() error) error {
+	unlock, err := filestore.Lock(c.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	claims, err := c.read()
+	if err != nil {
+		return err
+	}
+	c.apply(claims)
+	if err := f(); err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(&claimsFile{Claims: c.list()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := filestore.WriteFile(c.path, buf, 0600); err != nil {
+		return err
+	}
+	c.changes = make(map[string]*Claim)
+	return nil
+}
+
+// Save writes the changes by Add and Remove to the file.
+func (c *Claims) Save() error {
+	return c.update(func() error { return nil })
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Add adds the claim token of a batch, a random token when empty, returns the
+// token, which is not recoverable from the file.
+func (c *Claims) Add(batch, token string, maxUses int, expire time.Time) (string, error) {
+	if batch == "" || maxUses < 0 {
+		return "", ErrClaimInvalid
+	}
+	if token == "" {
+		b, err := randBytes(ClaimTokenLen)
+		if err != nil {
+			return "", err
+		}
+		token = base64.RawURLEncoding.EncodeToString(b)
+	}
+	if len(token) < int(dp.ClaimTokenLenMin) || len(token) > int(dp.ClaimTokenLenMax) || strings.Contains(token, ":") {
+		return "", ErrClaimInvalid
+	}
+	cl := &Claim{Batch: batch, TokenHash: hashToken(token), MaxUses: maxUses, Created: time.Now().Unix()}
+	if !expire.IsZero() {
+		cl.Expire = expire.Unix()
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.claims[batch]; ok {
+		return "", ErrClaimExists
+	}
+	c.claims[batch] = cl
+	c.changes[batch] = cl
+	return token, nil
+}
+
+func (c *Claims) Remove(batch string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.claims[batch]; !ok {
+		return ErrClaimNotFound
+	}
+	delete(c.claims, batch)
+	c.changes[batch] = nil
+	return nil
+}
+
+func (c *Claims) list() []*Claim {
+	l := make([]*Claim, 0, len(c.claims))
+	for _, cl := range c.claims {
+		l = append(l, cl)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Batch < l[j].Batch })
+	return l
+}
+
+// List claims ordered by batch.
+func (c *Claims) List() []*Claim {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.list()
+}
+
+func (c *Claims) find(token string) *Claim {
+	hash := hashToken(token)
+	for _, cl := range c.claims {
+		if cl.TokenHash == hash {
+			return cl
+		}
+	}
+	return nil
+}
+
+// Use counts a use of the claim token after checking its expiry and uses,
+// returns the batch. A serial enrolled by the token before returns its
+// device ID without counting, so a device retrying gets the same ID.
+func (c *Claims) Use(token, serial string) (batch, deviceID string, err error) {
+	err = c.update(func() error {
+		cl := c.find(token)
+		if cl == nil {
+			return ErrClaimNotFound
+		}
+		if cl.Expire != 0 && time.Now().Unix() >= cl.Expire {
+			return ErrClaimExpired
+		}
+		batch = cl.Batch
+		if deviceID = cl.Devices[serial]; serial != "" && deviceID != "" {
+			return nil
+		}
+		if cl.MaxUses != 0 && cl.Used >= cl.MaxUses {
+			return ErrClaimExhausted
+		}
+		cl.Used++
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return batch, deviceID, nil
+}
+
+// Bind records the device enrolled by the serial of a batch, for Use of the
+// same serial again.
+func (c *Claims) Bind(batch, serial, deviceID string) error {
+	if serial == "" {
+		return nil
+	}
+	return c.update(func() error {
+		cl, ok := c.claims[batch]
+		if !ok {
+			return ErrClaimNotFound
+		}
+		if cl.Devices == nil {
+			cl.Devices = make(map[string]string)
+		}
+		cl.Devices[serial] = deviceID
+		return nil
+	})
+}
@@ -0,0 +1,173 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package registry
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Secret hash algorithms, the hash string tells its algorithm and parameters.
+const (
+	HashBcrypt   = "bcrypt"   // $2a$10$...
+	HashArgon2id = "argon2id" // $argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>
+	HashScrypt   = "scrypt"   // $scrypt$ln=15,r=8,p=1$<salt>$<hash>
+)
+
+const (
+	BcryptCost     = 10
+	Argon2Memory   = 64 * 1024 // KiB
+	Argon2Time     = 1
+	Argon2Threads  = 4
+	ScryptLogN     = 15
+	ScryptR        = 8
+	ScryptP        = 1
+	hashSaltLen    = 16
+	hashKeyLen     = 32
+	hashMaxMemory  = 1024 * 1024 // KiB, bounds parameters read from the registry
+	hashMaxScryptN = 20
+)
+
+var (
+	ErrHashAlgorithm = errors.New("ErrHashAlgorithm")
+	ErrHashInvalid   = errors.New("ErrHashInvalid")
+)
+
+var b64 = base64.RawStdEncoding
+
+func randBytes(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// HashSecret hashes the device secret with a random salt.
+func HashSecret(secret, algorithm string) (string, error) {
+	switch algorithm {
+	case HashBcrypt, "":
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	case HashArgon2id:
+		salt, err := randBytes(hashSaltLen)
+		if err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(secret), salt, Argon2Time, Argon2Memory, Argon2Threads, hashKeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+			Argon2Memory, Argon2Time, Argon2Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	case HashScrypt:
+		salt, err := randBytes(hashSaltLen)
+		if err != nil {
+			return "", err
+		}
+		key, err := scrypt.Key([]byte(secret), salt, 1<<ScryptLogN, ScryptR, ScryptP, hashKeyLen)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", ScryptLogN, ScryptR, ScryptP,
+			b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	}
+	return "", ErrHashAlgorithm
+}
+
+// hashAlgorithm tells the algorithm of a hash made by HashSecret.
+func hashAlgorithm(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return HashArgon2id
+	case strings.HasPrefix(hash, "$scrypt$"):
+		return HashScrypt
+	}
+	return HashBcrypt
+}
+
+// splitHash gets the params, salt and key of an argon2id or scrypt hash.
+func splitHash(hash string, fields int) ([]string, []byte, []byte, error) {
+	seg := strings.Split(hash, "$")
+	if len(seg) != fields {
+		return nil, nil, nil, ErrHashInvalid
+	}
+	salt, err := b64.DecodeString(seg[fields-2])
+	if err != nil {
+		return nil, nil, nil, ErrHashInvalid
+	}
+	key, err := b64.DecodeString(seg[fields-1])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, ErrHashInvalid
+	}
+	return seg, salt, key, nil
+}
+
+// CheckSecret tells whether the secret matches the hash.
+func CheckSecret(hash, secret string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	case strings.HasPrefix(hash, "$argon2id$"):
+		seg, salt, key, err := splitHash(hash, 6)
+		if err != nil {
+			return false, err
+		}
+		var version int
+		var memory, time uint32
+		var threads uint8
+		if _, err := fmt.Sscanf(seg[2], "v=%d", &version); err != nil || version != argon2.Version {
+			return false, ErrHashInvalid
+		}
+		if _, err := fmt.Sscanf(seg[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil ||
+			memory > hashMaxMemory || time == 0 || threads == 0 {
+			return false, ErrHashInvalid
+		}
+		got := argon2.IDKey([]byte(secret), salt, time, memory, threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(got, key) == 1, nil
+	case strings.HasPrefix(hash, "$scrypt$"):
+		seg, salt, key, err := splitHash(hash, 5)
+		if err != nil {
+			return false, err
+		}
+		var logN, r, p int
+		if _, err := fmt.Sscanf(seg[2], "ln=%d,r=%d,p=%d", &logN, &r, &p); err != nil ||
+			logN < 1 || logN > hashMaxScryptN {
+			return false, ErrHashInvalid
+		}
+		got, err := scrypt.Key([]byte(secret), salt, 1<<logN, r, p, len(key))
+		if err != nil {
+			return false, ErrHashInvalid
+		}
+		return subtle.ConstantTimeCompare(got, key) == 1, nil
+	}
+	return false, ErrHashAlgorithm
+}
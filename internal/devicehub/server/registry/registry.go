@@ -0,0 +1,472 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/filestore"
+	dp "github.com/mkrainbow/rtio/pkg/deviceproto"
+	"github.com/mkrainbow/rtio/pkg/metrics"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrRegistryLoad     = errors.New("ErrRegistryLoad")
+	ErrRegistryReadOnly = errors.New("ErrRegistryReadOnly")
+	ErrDeviceNotFound   = errors.New("ErrDeviceNotFound")
+	ErrDeviceExists     = errors.New("ErrDeviceExists")
+	ErrDeviceIDInvalid  = errors.New("ErrDeviceIDInvalid")
+	ErrSecretInvalid    = errors.New("ErrSecretInvalid")
+)
+
+const (
+	SecretLen = 18 // bytes, base64 encoded in 24 chars
+)
+
+var (
+	metricDevices = metrics.NewGauge("rtio_device_registry_devices", "Devices loaded from the device registry.")
+)
+
+// Device is a registry entry, only the salted hash of the secret is stored.
+type Device struct {
+	ID         string `json:"id"`
+	SecretHash string `json:"secret_hash"`
+	Created    int64  `json:"created,omitempty"` // unix seconds
+	Rotated    int64  `json:"rotated,omitempty"` // unix seconds
+}
+
+type registryFile struct {
+	Devices []*Device `json:"devices"`
+}
+
+// Registry is the devices loaded from a file, json or csv by extension, or
+// from the json and csv files of a directory. The csv columns are id,
+// secret_hash, created and rotated.
+type Registry struct {
+	path    string
+	stamp   string // files with mod time and size, tells changes
+	devices map[string]*Device
+	changes map[string]*Device // not saved yet, nil for removed
+	lock    sync.RWMutex
+}
+
+// LoadRegistry loads the registry from path, an absent file is an empty registry.
+func LoadRegistry(path string) (*Registry, error) {
+	r := &Registry{
+		path:    path,
+		devices: make(map[string]*Device),
+		changes: make(map[string]*Device),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// files lists the registry files with the stamp of them.
+func (r *Registry) files() ([]string, string, error) {
+	info, err := os.Stat(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	files := []string{r.path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(r.path)
+		if err != nil {
+			return nil, "", err
+		}
+		files = files[:0]
+		for _, e := range entries {
+			ext := filepath.Ext(e.Name())
+			if !e.IsDir() && (ext == ".json" || ext == ".csv") {
+				files = append(files, filepath.Join(r.path, e.Name()))
+			}
+		}
+	}
+	stamp := strings.Builder{}
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, "", err
+		}
+		fmt.Fprintf(&stamp, "%s:%d:%d;", f, info.ModTime().UnixNano(), info.Size())
+	}
+	return files, stamp.String(), nil
+}
+
+func parseJSON(buf []byte) ([]*Device, error) {
+	f := &registryFile{}
+	if err := json.Unmarshal(buf, f); err != nil {
+		return nil, err
+	}
+	return f.Devices, nil
+}
+
+func parseCSV(buf []byte) ([]*Device, error) {
+	reader := csv.NewReader(bytes.NewReader(buf))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	var devices []*Device
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return devices, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: id and secret_hash required", len(devices)+1)
+		}
+		if record[0] == "id" { // header
+			continue
+		}
+		d := &Device{ID: strings.TrimSpace(record[0]), SecretHash: strings.TrimSpace(record[1])}
+		if len(record) > 2 {
+			d.Created, _ = strconv.ParseInt(record[2], 10, 64)
+		}
+		if len(record) > 3 {
+			d.Rotated, _ = strconv.ParseInt(record[3], 10, 64)
+		}
+		devices = append(devices, d)
+	}
+}
+
+// read reads the devices of the files.
+func (r *Registry) read() (map[string]*Device, string, error) {
+	files, stamp, err := r.files()
+	if err != nil {
+		log.Error().Err(err).Str("path", r.path).Msg("Failed to stat device registry")
+		return nil, "", ErrRegistryLoad
+	}
+	devices := make(map[string]*Device)
+	for _, f := range files {
+		buf, err := os.ReadFile(f)
+		if err != nil {
+			log.Error().Err(err).Str("file", f).Msg("Failed to read device registry")
+			return nil, "", ErrRegistryLoad
+		}
+		var l []*Device
+		if filepath.Ext(f) == ".csv" {
+			l, err = parseCSV(buf)
+		} else {
+			l, err = parseJSON(buf)
+		}
+		if err != nil {
+			log.Error().Err(err).Str("file", f).Msg("Failed to parse device registry")
+			return nil, "", ErrRegistryLoad
+		}
+		for _, d := range l {
+			if _, ok := devices[d.ID]; ok {
+				log.Warn().Str("deviceid", d.ID).Str("file", f).Msg("Duplicate device in registry, ignored")
+				continue
+			}
+			devices[d.ID] = d
+		}
+	}
+	return devices, stamp, nil
+}
+
+func (r *Registry) load() error {
+	devices, stamp, err := r.read()
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.apply(devices, stamp)
+	log.Info().Int("devices", len(devices)).Str("path", r.path).Msg("Device registry loaded")
+	return nil
+}
+
+// apply sets the devices read from the files, with the changes not saved.
+func (r *Registry) apply(devices map[string]*Device, stamp string) {
+	for id, d := range r.changes {
+		if d == nil {
+			delete(devices, id)
+		} else {
+			devices[id] = d
+		}
+	}
+	r.devices = devices
+	r.stamp = stamp
+	metricDevices.Set(float64(len(devices)))
+}
+
+// set changes a device, nil removes it.
+func (r *Registry) set(id string, d *Device) {
+	if d == nil {
+		delete(r.devices, id)
+	} else {
+		r.devices[id] = d
+	}
+	r.changes[id] = d
+}
+
+// ReloadLoop reloads the registry when its files changed, such as after 'rtio device add'.
+func (r *Registry) ReloadLoop(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debug().Msg("Device registry reload ctx done")
+			return
+		case <-t.C:
+			_, stamp, err := r.files()
+			if err != nil {
+				continue
+			}
+			r.lock.RLock()
+			changed := stamp != r.stamp
+			r.lock.RUnlock()
+			if changed {
+				r.load() // keep previous devices on failure
+			}
+		}
+	}
+}
+
+// Save writes the changes by Add, Remove and Rotate to the file, a directory
+// is read only. The file is locked and read again, so changes saved by others
+// meanwhile, such as by 'rtio device' or other hubs, are kept.
+func (r *Registry) Save() error {
+	if info, err := os.Stat(r.path); err == nil && info.IsDir() {
+		return ErrRegistryReadOnly
+	}
+	unlock, err := filestore.Lock(r.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	read, _, err := r.read()
+	if err != nil {
+		return err
+	}
+	r.apply(read, r.stamp)
+	buf, err := r.encode(r.list())
+	if err != nil {
+		return err
+	}
+	if err := filestore.WriteFile(r.path, buf, 0600); err != nil {
+		return err
+	}
+	if _, stamp, err := r.files(); err == nil {
+		r.stamp = stamp
+	}
+	r.changes = make(map[string]*Device)
+	return nil
+}
+
+// encode encodes devices in the format of the file.
+func (r *Registry) encode(devices []*Device) ([]byte, error) {
+	var buf []byte
+	var err error
+	if filepath.Ext(r.path) == ".csv" {
+		b := &bytes.Buffer{}
+		w := csv.NewWriter(b)
+		w.Write([]string{"id", "secret_hash", "created", "rotated"})
+		for _, d := range devices {
+			w.Write([]string{d.ID, d.SecretHash, strconv.FormatInt(d.Created, 10), strconv.FormatInt(d.Rotated, 10)})
+		}
+		w.Flush()
+		buf, err = b.Bytes(), w.Error()
+	} else {
+		buf, err = json.MarshalIndent(&registryFile{Devices: devices}, "", "  ")
+	}
+	return buf, err
+}
+
+// NewDeviceID generates a random UUID.
+func NewDeviceID() (string, error) {
+	b, err := randBytes(16)
+	if err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// NewSecret generates a random device secret.
+func NewSecret() (string, error) {
+	b, err := randBytes(SecretLen)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func checkSecretLen(secret string) error {
+	if len(secret) < int(dp.DeviceSecretLenMin) || len(secret) > int(dp.DeviceSecretLenMax) {
+		return ErrSecretInvalid
+	}
+	return nil
+}
+
+// Add adds a device, a random id or secret when empty, returns the id and the
+// secret, which is not recoverable from the registry.
+func (r *Registry) Add(id, secret, algorithm string) (string, string, error) {
+	var err error
+	if id == "" {
+		if id, err = NewDeviceID(); err != nil {
+			return "", "", err
+		}
+	}
+	if len(id) != int(dp.DeviceIDLen) || strings.ContainsAny(id, ",:") {
+		return "", "", ErrDeviceIDInvalid
+	}
+	if secret == "" {
+		if secret, err = NewSecret(); err != nil {
+			return "", "", err
+		}
+	}
+	if err := checkSecretLen(secret); err != nil {
+		return "", "", err
+	}
+	hash, err := HashSecret(secret, algorithm)
+	if err != nil {
+		return "", "", err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.devices[id]; ok {
+		return "", "", ErrDeviceExists
+	}
+	r.set(id, &Device{ID: id, SecretHash: hash, Created: time.Now().Unix()})
+	return id, secret, nil
+}
+
+func (r *Registry) Remove(id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.devices[id]; !ok {
+		return ErrDeviceNotFound
+	}
+	r.set(id, nil)
+	return nil
+}
+
+// Rotate replaces the secret of a device, a random one when empty, returns the secret.
+func (r *Registry) Rotate(id, secret, algorithm string) (string, error) {
+	var err error
+	if secret == "" {
+		if secret, err = NewSecret(); err != nil {
+			return "", err
+		}
+	}
+	if err := checkSecretLen(secret); err != nil {
+		return "", err
+	}
+	hash, err := HashSecret(secret, algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	d, ok := r.devices[id]
+	if !ok {
+		return "", ErrDeviceNotFound
+	}
+	r.set(id, &Device{ID: id, SecretHash: hash, Created: d.Created, Rotated: time.Now().Unix()})
+	return secret, nil
+}
+
+// UpdateSecret stores the secret rotated by the hub, hashed by the algorithm
+// of the old one, and saves the registry.
+func (r *Registry) UpdateSecret(deviceID, deviceSecret string) error {
+	if info, err := os.Stat(r.path); err == nil && info.IsDir() {
+		return ErrRegistryReadOnly
+	}
+	r.lock.RLock()
+	d, ok := r.devices[deviceID]
+	r.lock.RUnlock()
+	if !ok {
+		return ErrDeviceNotFound
+	}
+	if _, err := r.Rotate(deviceID, deviceSecret, hashAlgorithm(d.SecretHash)); err != nil {
+		return err
+	}
+	if err := r.Save(); err != nil {
+		r.lock.Lock()
+		r.devices[deviceID] = d // the device is rolled back to the old secret
+		delete(r.changes, deviceID)
+		r.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// List devices ordered by id.
+func (r *Registry) List() []*Device {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.list()
+}
+
+func (r *Registry) list() []*Device {
+	l := make([]*Device, 0, len(r.devices))
+	for _, d := range r.devices {
+		l = append(l, d)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].ID < l[j].ID })
+	return l
+}
+
+// Verify checks the device secret against the registry, an unknown device fails.
+func (r *Registry) Verify(deviceID, deviceSecret string) (bool, error) {
+	r.lock.RLock()
+	d, ok := r.devices[deviceID]
+	r.lock.RUnlock()
+	if !ok {
+		log.Warn().Str("deviceid", deviceID).Msg("Not Found device")
+		return false, nil
+	}
+	ok, err := CheckSecret(d.SecretHash, deviceSecret)
+	if err != nil {
+		log.Error().Err(err).Str("deviceid", deviceID).Msg("Invalid secret hash in registry")
+		return false, err
+	}
+	return ok, nil
+}
@@ -0,0 +1,259 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+const (
+	testDeviceID     = "cfa09baa-4913-4ad7-a936-3e26f9671b09"
+	testDeviceSecret = "mb6bgso4EChvyzA05thF9+wH"
+)
+
+func TestHashSecret(t *testing.T) {
+	for _, algorithm := range []string{HashBcrypt, HashArgon2id, HashScrypt} {
+		hash, err := HashSecret(testDeviceSecret, algorithm)
+		assert.NilError(t, err, algorithm)
+
+		ok, err := CheckSecret(hash, testDeviceSecret)
+		assert.NilError(t, err, algorithm)
+		assert.Equal(t, true, ok, algorithm)
+
+		ok, err = CheckSecret(hash, "wrong-secret-wrong-secret")
+		assert.NilError(t, err, algorithm)
+		assert.Equal(t, false, ok, algorithm)
+	}
+
+	_, err := HashSecret(testDeviceSecret, "md5")
+	assert.Equal(t, ErrHashAlgorithm, err)
+	_, err = CheckSecret("plain", testDeviceSecret)
+	assert.Equal(t, ErrHashAlgorithm, err)
+	_, err = CheckSecret("$scrypt$ln=40,r=8,p=1$AAAA$AAAA", testDeviceSecret)
+	assert.Equal(t, ErrHashInvalid, err)
+}
+
+func TestRegistrySaveLoad(t *testing.T) {
+	for _, name := range []string{"devices.json", "devices.csv"} {
+		path := filepath.Join(t.TempDir(), name)
+		r, err := LoadRegistry(path)
+		assert.NilError(t, err)
+		assert.Equal(t, 0, len(r.List()))
+
+		id, secret, err := r.Add(testDeviceID, testDeviceSecret, HashScrypt)
+		assert.NilError(t, err)
+		assert.Equal(t, testDeviceID, id)
+		assert.Equal(t, testDeviceSecret, secret)
+		_, _, err = r.Add(testDeviceID, "", "")
+		assert.Equal(t, ErrDeviceExists, err)
+		_, _, err = r.Add("short-id", "", "")
+		assert.Equal(t, ErrDeviceIDInvalid, err)
+
+		id2, secret2, err := r.Add("", "", "")
+		assert.NilError(t, err)
+		assert.Equal(t, 36, len(id2))
+		assert.Equal(t, 24, len(secret2))
+		assert.NilError(t, r.Save())
+
+		r, err = LoadRegistry(path)
+		assert.NilError(t, err, name)
+		assert.Equal(t, 2, len(r.List()))
+		ok, err := r.Verify(testDeviceID, testDeviceSecret)
+		assert.NilError(t, err)
+		assert.Equal(t, true, ok)
+		ok, _ = r.Verify(id2, secret2)
+		assert.Equal(t, true, ok)
+		ok, _ = r.Verify(id2, testDeviceSecret)
+		assert.Equal(t, false, ok)
+
+		secret3, err := r.Rotate(id2, "", "")
+		assert.NilError(t, err)
+		ok, _ = r.Verify(id2, secret2)
+		assert.Equal(t, false, ok)
+		ok, _ = r.Verify(id2, secret3)
+		assert.Equal(t, true, ok)
+
+		assert.NilError(t, r.Remove(testDeviceID))
+		assert.Equal(t, ErrDeviceNotFound, r.Remove(testDeviceID))
+		ok, _ = r.Verify(testDeviceID, testDeviceSecret)
+		assert.Equal(t, false, ok)
+	}
+}
+
+func TestRegistryDir(t *testing.T) {
+	dir := t.TempDir()
+	hash, err := HashSecret(testDeviceSecret, HashBcrypt)
+	assert.NilError(t, err)
+	csv := "# factory batch 1\nid,secret_hash,created,rotated\n" + testDeviceID + "," + hash + ",1700000000,0\n"
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "batch1.csv"), []byte(csv), 0600))
+	// duplicate device ignored
+	json := `{"devices":[{"id":"` + testDeviceID + `","secret_hash":"bad"}]}`
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "batch2.json"), []byte(json), 0600))
+
+	r, err := LoadRegistry(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(r.List()))
+	assert.Equal(t, int64(1700000000), r.List()[0].Created)
+	ok, err := r.Verify(testDeviceID, testDeviceSecret)
+	assert.NilError(t, err)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, ErrRegistryReadOnly, r.Save())
+
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0600))
+	_, err = LoadRegistry(dir)
+	assert.Equal(t, ErrRegistryLoad, err)
+}
+
+func TestRegistryUpdateSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.csv")
+	r, err := LoadRegistry(path)
+	assert.NilError(t, err)
+	_, _, err = r.Add(testDeviceID, testDeviceSecret, HashScrypt)
+	assert.NilError(t, err)
+
+	newSecret, err := NewSecret()
+	assert.NilError(t, err)
+	assert.NilError(t, r.UpdateSecret(testDeviceID, newSecret))
+	assert.Equal(t, ErrDeviceNotFound, r.UpdateSecret("cfa09baa-4913-4ad7-a936-3e26f9671b10", newSecret))
+
+	r, err = LoadRegistry(path)
+	assert.NilError(t, err)
+	ok, _ := r.Verify(testDeviceID, testDeviceSecret)
+	assert.Equal(t, false, ok)
+	ok, _ = r.Verify(testDeviceID, newSecret)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, HashScrypt, hashAlgorithm(r.List()[0].SecretHash))
+}
+
+func TestRegistrySaveMerge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	a, err := LoadRegistry(path)
+	assert.NilError(t, err)
+	_, _, err = a.Add(testDeviceID, testDeviceSecret, HashScrypt)
+	assert.NilError(t, err)
+	assert.NilError(t, a.Save())
+
+	// b, such as 'rtio device add', and a, a hub rotating, save in turn
+	b, err := LoadRegistry(path)
+	assert.NilError(t, err)
+	id2, _, err := b.Add("", "", HashScrypt)
+	assert.NilError(t, err)
+	assert.NilError(t, b.Save())
+	newSecret, err := NewSecret()
+	assert.NilError(t, err)
+	assert.NilError(t, a.UpdateSecret(testDeviceID, newSecret))
+	assert.NilError(t, b.Remove(id2))
+	assert.NilError(t, b.Save())
+
+	r, err := LoadRegistry(path)
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(r.List()))
+	ok, _ := r.Verify(testDeviceID, newSecret)
+	assert.Equal(t, true, ok)
+	matches, _ := filepath.Glob(path + ".*.tmp")
+	assert.Equal(t, 0, len(matches))
+}
+
+func TestRegistryReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	r, err := LoadRegistry(path)
+	assert.NilError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.ReloadLoop(ctx, 10*time.Millisecond)
+
+	// another process, such as 'rtio device add'
+	w, err := LoadRegistry(path)
+	assert.NilError(t, err)
+	_, _, err = w.Add(testDeviceID, testDeviceSecret, HashBcrypt)
+	assert.NilError(t, err)
+	assert.NilError(t, w.Save())
+
+	for i := 0; i < 100 && len(r.List()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	ok, err := r.Verify(testDeviceID, testDeviceSecret)
+	assert.NilError(t, err)
+	assert.Equal(t, true, ok)
+}
+
+func TestClaims(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "claims.json")
+	c, err := LoadClaims(path)
+	assert.NilError(t, err)
+
+	token, err := c.Add("batch1", "", 2, time.Time{})
+	assert.NilError(t, err)
+	assert.Equal(t, 32, len(token))
+	_, err = c.Add("batch1", "", 0, time.Time{})
+	assert.Equal(t, ErrClaimExists, err)
+	expired, err := c.Add("batch2", "batch2-claim-token-0001", 0, time.Now().Add(-time.Second))
+	assert.NilError(t, err)
+	_, err = c.Add("batch3", "short", 0, time.Time{})
+	assert.Equal(t, ErrClaimInvalid, err)
+	assert.NilError(t, c.Save())
+
+	batch, id, err := c.Use(token, "SN0001")
+	assert.NilError(t, err)
+	assert.Equal(t, "batch1", batch)
+	assert.Equal(t, "", id)
+	assert.NilError(t, c.Bind(batch, "SN0001", testDeviceID))
+	_, _, err = c.Use(token, "")
+	assert.NilError(t, err)
+	_, _, err = c.Use(token, "SN0002")
+	assert.Equal(t, ErrClaimExhausted, err)
+	_, _, err = c.Use(expired, "")
+	assert.Equal(t, ErrClaimExpired, err)
+	_, _, err = c.Use("unknown-claim-token-0001", "")
+	assert.Equal(t, ErrClaimNotFound, err)
+
+	// an enrolled serial gets its device ID again without counting
+	batch, id, err = c.Use(token, "SN0001")
+	assert.NilError(t, err)
+	assert.Equal(t, "batch1", batch)
+	assert.Equal(t, testDeviceID, id)
+
+	// uses are saved, removal by another process applies at once
+	other, err := LoadClaims(path)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, other.List()[0].Used)
+	assert.NilError(t, other.Remove("batch2"))
+	assert.NilError(t, other.Save())
+	_, _, err = c.Use(expired, "")
+	assert.Equal(t, ErrClaimNotFound, err)
+
+	// a claim added meanwhile is kept by the save of another
+	_, err = other.Add("batch4", "", 0, time.Time{})
+	assert.NilError(t, err)
+	_, err = c.Add("batch5", "", 0, time.Time{})
+	assert.NilError(t, err)
+	assert.NilError(t, other.Save())
+	assert.NilError(t, c.Save())
+	c, err = LoadClaims(path)
+	assert.NilError(t, err)
+	assert.Equal(t, 3, len(c.List()))
+	assert.Equal(t, 2, c.List()[0].Used)
+}
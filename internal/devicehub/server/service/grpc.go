@@ -0,0 +1,112 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/backendmetric"
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/pkg/config"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+)
+
+const (
+	SchemeGRPC  = "grpc://"  // plaintext
+	SchemeGRPCS = "grpcs://" // TLS
+)
+
+// grpcTarget gets the target of a gRPC device service URL, such as grpc://host:port.
+func grpcTarget(url string) (target string, tls bool, ok bool) {
+	if t, found := strings.CutPrefix(url, SchemeGRPC); found {
+		return t, false, true
+	}
+	if t, found := strings.CutPrefix(url, SchemeGRPCS); found {
+		return t, true, true
+	}
+	return "", false, false
+}
+
+// grpcConns keeps a connection per gRPC device service, reused by all sessions.
+type grpcConns struct {
+	lock  sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+func (g *grpcConns) get(target string, tls bool) (devicehub.DeviceServiceClient, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	key := target
+	if tls {
+		key = SchemeGRPCS + target
+	}
+	if conn, ok := g.conns[key]; ok {
+		return devicehub.NewDeviceServiceClient(conn), nil
+	}
+	var opts []grpc.DialOption
+	if tls {
+		tlsConfig, err := rpcauth.LoadClientTLSConfig(config.StringKV.GetWithDefault("deviceservice.tls.ca", ""), "", "", "")
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load device service CA")
+			return nil, err
+		}
+		opts = rpcauth.DialOptions(tlsConfig, "")
+	} else {
+		opts = rpcauth.DialOptions(nil, "")
+	}
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		log.Error().Err(err).Str("target", target).Msg("Failed to dial device service")
+		return nil, err
+	}
+	if g.conns == nil {
+		g.conns = make(map[string]*grpc.ClientConn)
+	}
+	g.conns[key] = conn
+	return devicehub.NewDeviceServiceClient(conn), nil
+}
+
+func (c *Client) postGRPC(target string, tls bool, req *devicehub.DeviceServiceReq) ([]byte, error) {
+	client, err := c.grpc.get(target, tls)
+	if err != nil {
+		return nil, ErrServiceError
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	start := time.Now()
+	resp, err := client.Post(ctx, req)
+	backendmetric.Observe("deviceservice", start, err)
+	if err != nil {
+		log.Error().Err(err).Str("target", target).Msg("Failed to post req")
+		return nil, ErrServiceError
+	}
+	switch resp.Code {
+	case devicehub.Code_CODE_OK:
+		return resp.Data, nil
+	case devicehub.Code_CODE_BAD_REQUEST:
+		return nil, ErrBadRequest
+	}
+	return nil, ErrInternelError
+}
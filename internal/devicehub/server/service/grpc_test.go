@@ -0,0 +1,130 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"google.golang.org/grpc"
+	"gotest.tools/assert"
+)
+
+type fakeDeviceService struct {
+	devicehub.UnimplementedDeviceServiceServer
+	last *devicehub.DeviceServiceReq
+}
+
+func (s *fakeDeviceService) Post(ctx context.Context, req *devicehub.DeviceServiceReq) (*devicehub.DeviceServiceResp, error) {
+	s.last = req
+	if len(req.Data) == 0 {
+		return &devicehub.DeviceServiceResp{Id: req.Id, Code: devicehub.Code_CODE_BAD_REQUEST}, nil
+	}
+	if string(req.Data) == "slow" {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &devicehub.DeviceServiceResp{Id: req.Id, Code: devicehub.Code_CODE_OK, Data: append([]byte("re:"), req.Data...)}, nil
+}
+
+func (s *fakeDeviceService) ObGet(req *devicehub.DeviceServiceReq, stream devicehub.DeviceService_ObGetServer) error {
+	if len(req.Data) == 0 {
+		return stream.Send(&devicehub.DeviceServiceResp{Id: req.Id, Code: devicehub.Code_CODE_BAD_REQUEST})
+	}
+	for _, data := range []string{"", "n1", "n2"} {
+		if err := stream.Send(&devicehub.DeviceServiceResp{Id: req.Id, Code: devicehub.Code_CODE_CONTINUE, Data: []byte(data)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestGRPCTarget(t *testing.T) {
+
+	target, tls, ok := grpcTarget("grpc://localhost:17517")
+	assert.Equal(t, target, "localhost:17517")
+	assert.Assert(t, ok && !tls)
+	target, tls, ok = grpcTarget("grpcs://svc.example.com:443")
+	assert.Equal(t, target, "svc.example.com:443")
+	assert.Assert(t, ok && tls)
+	_, _, ok = grpcTarget("http://localhost:17517/deviceservice/aa/bb")
+	assert.Assert(t, !ok)
+}
+
+func TestPostGRPC(t *testing.T) {
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	svc := &fakeDeviceService{}
+	server := grpc.NewServer()
+	devicehub.RegisterDeviceServiceServer(server, svc)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	c := NewClient(200 * time.Millisecond)
+	url := SchemeGRPC + lis.Addr().String()
+	dev := &Device{ID: "cfa09baa-4913-4ad7-a936-3e26f9671b09", RemoteAddr: "10.0.0.1:5000", ConnectTime: 1700000000}
+
+	data, err := c.Post(9, url, dev, "/aa/bb", []byte("hello"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "re:hello")
+	assert.Equal(t, svc.last.Id, uint32(9))
+	assert.Equal(t, svc.last.DeviceId, dev.ID)
+	assert.Equal(t, svc.last.Uri, "/aa/bb")
+	assert.Equal(t, svc.last.RemoteAddr, dev.RemoteAddr)
+	assert.Equal(t, svc.last.ConnectTime, dev.ConnectTime)
+
+	_, err = c.Post(10, url, dev, "/aa/bb", nil)
+	assert.Equal(t, err, ErrBadRequest)
+
+	// bounded by the client timeout
+	start := time.Now()
+	_, err = c.Post(11, url, dev, "/aa/bb", []byte("slow"))
+	assert.Equal(t, err, ErrServiceError)
+	assert.Assert(t, time.Since(start) < 2*time.Second)
+}
+
+func TestObGetGRPC(t *testing.T) {
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	server := grpc.NewServer()
+	devicehub.RegisterDeviceServiceServer(server, &fakeDeviceService{})
+	go server.Serve(lis)
+	defer server.Stop()
+
+	c := NewClient(time.Second)
+	url := SchemeGRPC + lis.Addr().String()
+	dev := &Device{ID: "cfa09baa-4913-4ad7-a936-3e26f9671b09"}
+
+	notifyChan, err := c.ObGet(context.Background(), 1, url, dev, "/prices", []byte("all"))
+	assert.NilError(t, err)
+	var got []string
+	for data := range notifyChan {
+		got = append(got, string(data))
+	}
+	assert.DeepEqual(t, got, []string{"n1", "n2"})
+
+	_, err = c.ObGet(context.Background(), 2, url, dev, "/prices", nil)
+	assert.Equal(t, err, ErrBadRequest)
+}
@@ -0,0 +1,231 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/backendmetric"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	ObGetLineMax = 64 * 1024 // a line of http stream
+)
+
+// obStream receives the responses of an observation from a device service.
+type obStream interface {
+	recv() (*devicehub.DeviceServiceResp, error)
+	close()
+}
+
+type grpcObStream struct {
+	stream devicehub.DeviceService_ObGetClient
+}
+
+func (s *grpcObStream) recv() (*devicehub.DeviceServiceResp, error) {
+	return s.stream.Recv()
+}
+func (s *grpcObStream) close() {}
+
+// httpObStream reads a response per line, as JSON lines or as the data of
+// server-sent events.
+type httpObStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+func httpCode(code string) devicehub.Code {
+	if v, ok := devicehub.Code_value["CODE_"+code]; ok {
+		return devicehub.Code(v)
+	}
+	return devicehub.Code_CODE_INTERNAL_SERVER_ERROR
+}
+
+func (s *httpObStream) recv() (*devicehub.DeviceServiceResp, error) {
+	for s.scanner.Scan() {
+		line := strings.TrimSpace(s.scanner.Text())
+		if len(line) == 0 || line[0] == ':' {
+			continue // event end or comment
+		}
+		if line[0] != '{' {
+			field, value, _ := strings.Cut(line, ":")
+			if field != "data" {
+				continue // event, id or retry
+			}
+			line = strings.TrimSpace(value)
+		}
+		resp := &RTIOResp{}
+		if err := json.Unmarshal([]byte(line), resp); err != nil {
+			log.Error().Err(err).Str("line", line).Msg("Failed to Unmarshal ObGet resp")
+			return nil, ErrServiceError
+		}
+		data, err := base64.StdEncoding.DecodeString(resp.Data)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to decode ObGet resp")
+			return nil, ErrServiceError
+		}
+		return &devicehub.DeviceServiceResp{Id: resp.ID, Code: httpCode(resp.Code), Data: data}, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+func (s *httpObStream) close() {
+	s.body.Close()
+}
+
+func (c *Client) obGetHTTP(ctx context.Context, url string, req *RTIOReq) (obStream, error) {
+	buf, err := json.Marshal(*req)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to Marshal req")
+		return nil, ErrBadRequest
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(buf))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to NewRequest")
+		return nil, ErrBadRequest
+	}
+	httpReq.Header.Set("Accept", "text/event-stream, application/x-ndjson")
+	httpResp, err := c.stream.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		httpResp.Body.Close()
+		log.Error().Int("status", httpResp.StatusCode).Str("url", url).Msg("ObGet to device service")
+		return nil, ErrServiceError
+	}
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 4096), ObGetLineMax)
+	return &httpObStream{body: httpResp.Body, scanner: scanner}, nil
+}
+
+func (c *Client) obGetGRPC(ctx context.Context, target string, tls bool, req *devicehub.DeviceServiceReq) (obStream, error) {
+	client, err := c.grpc.get(target, tls)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := client.ObGet(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcObStream{stream: stream}, nil
+}
+
+// ObGet establishes an observation by the device on the service at url, the
+// notifications are received from the returned channel, which is closed when
+// the service terminates it or ctx done. The service answers the
+// establishment within the client timeout.
+func (c *Client) ObGet(ctx context.Context, id uint32, url string, dev *Device, uri string, reqData []byte) (<-chan []byte, error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(c.timeout, cancel)
+	start := time.Now()
+
+	var stream obStream
+	var err error
+	if target, tls, ok := grpcTarget(url); ok {
+		stream, err = c.obGetGRPC(ctx, target, tls, &devicehub.DeviceServiceReq{
+			Id:          id,
+			DeviceId:    dev.ID,
+			Uri:         uri,
+			Data:        reqData,
+			RemoteAddr:  dev.RemoteAddr,
+			ConnectTime: dev.ConnectTime,
+		})
+	} else {
+		stream, err = c.obGetHTTP(ctx, url, &RTIOReq{
+			ID:       id,
+			Method:   "obget",
+			DeviceID: dev.ID,
+			Data:     base64.StdEncoding.EncodeToString(reqData),
+		})
+	}
+	var first *devicehub.DeviceServiceResp
+	if err == nil {
+		first, err = stream.recv()
+		if err != nil {
+			stream.close()
+		}
+	}
+	if !timer.Stop() && err == nil {
+		stream.close()
+		err = context.DeadlineExceeded
+	}
+	backendmetric.Observe("deviceservice", start, err)
+	if err != nil {
+		cancel()
+		log.Error().Err(err).Str("url", url).Msg("Failed to establish ObGet")
+		if err == ErrBadRequest {
+			return nil, ErrBadRequest
+		}
+		return nil, ErrServiceError
+	}
+	switch first.Code {
+	case devicehub.Code_CODE_CONTINUE:
+	case devicehub.Code_CODE_BAD_REQUEST:
+		stream.close()
+		cancel()
+		return nil, ErrBadRequest
+	default:
+		stream.close()
+		cancel()
+		return nil, ErrInternelError
+	}
+
+	notifyChan := make(chan []byte, 1)
+	go func() {
+		defer cancel()
+		defer stream.close()
+		defer close(notifyChan)
+		resp := first
+		for {
+			if len(resp.Data) > 0 {
+				select {
+				case notifyChan <- resp.Data:
+				case <-ctx.Done():
+					return
+				}
+			}
+			resp, err = stream.recv()
+			if err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					log.Warn().Err(err).Str("url", url).Msg("ObGet stream")
+				}
+				return
+			}
+			if resp.Code != devicehub.Code_CODE_CONTINUE {
+				return
+			}
+		}
+	}()
+	return notifyChan, nil
+}
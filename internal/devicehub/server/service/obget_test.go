@@ -0,0 +1,75 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestObGetHTTP(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &RTIOReq{}
+		assert.NilError(t, json.NewDecoder(r.Body).Decode(req))
+		assert.Equal(t, req.Method, "obget")
+		if r.URL.Path == "/sse" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, ": hello\n\nevent: notify\ndata: {\"id\":%d,\"code\":\"CONTINUE\",\"data\":\"bjE=\"}\n\n", req.ID)
+			w.(http.Flusher).Flush()
+			fmt.Fprintf(w, "data: {\"id\":%d,\"code\":\"CONTINUE\",\"data\":\"bjI=\"}\n\n", req.ID)
+			fmt.Fprintf(w, "data: {\"id\":%d,\"code\":\"TERMINATE\"}\n\n", req.ID)
+			fmt.Fprintf(w, "data: {\"id\":%d,\"code\":\"CONTINUE\",\"data\":\"bjM=\"}\n\n", req.ID)
+			return
+		}
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprintf(w, "{\"id\":%d,\"code\":\"BAD_REQUEST\"}\n", req.ID)
+	}))
+	defer server.Close()
+
+	c := NewClient(200 * time.Millisecond)
+	dev := &Device{ID: "cfa09baa-4913-4ad7-a936-3e26f9671b09"}
+
+	notifyChan, err := c.ObGet(context.Background(), 1, server.URL+"/sse", dev, "/prices", nil)
+	assert.NilError(t, err)
+	var got []string
+	for data := range notifyChan {
+		got = append(got, string(data))
+	}
+	assert.DeepEqual(t, got, []string{"n1", "n2"})
+
+	_, err = c.ObGet(context.Background(), 2, server.URL+"/lines", dev, "/prices", nil)
+	assert.Equal(t, err, ErrBadRequest)
+
+	// the establishment is bounded by the client timeout
+	start := time.Now()
+	_, err = c.ObGet(context.Background(), 3, server.URL+"/slow", dev, "/prices", nil)
+	assert.Equal(t, err, ErrServiceError)
+	assert.Assert(t, time.Since(start) < 2*time.Second)
+}
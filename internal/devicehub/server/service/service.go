@@ -29,12 +29,29 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/backendmetric"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
 )
 
 type Client struct {
-	client *http.Client
+	client  *http.Client
+	stream  *http.Client // no timeout, for observations
+	grpc    grpcConns
+	timeout time.Duration
+}
+
+// Device is the device posting, with its connection.
+type Device struct {
+	ID          string
+	RemoteAddr  string
+	ConnectTime int64 // unix seconds
 }
 
+var (
+	TimeoutDefault = 5 * time.Second
+)
+
 type RTIOReq struct {
 	ID       uint32 `json:"id"`
 	Method   string `json:"method"`
@@ -54,14 +71,20 @@ var (
 	ErrInternelError = errors.New("Internel error")
 )
 
-func NewClient() *Client {
+// NewClient creates the client of device services, timeout bounds each request.
+func NewClient(timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = TimeoutDefault
+	}
 	httpTransport := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
-	client := &http.Client{Transport: httpTransport, Timeout: 5 * time.Second}
+	client := &http.Client{Transport: httpTransport, Timeout: timeout}
 
 	return &Client{
-		client: client,
+		client:  client,
+		stream:  &http.Client{Transport: httpTransport},
+		timeout: timeout,
 	}
 }
 
@@ -77,8 +100,9 @@ func (c *Client) postRequest(url string, req *RTIOReq) (*RTIOResp, error) {
 		log.Error().Err(err).Msg("Failed to NewRequest")
 		return nil, ErrBadRequest
 	}
+	start := time.Now()
 	httpResp, err := c.client.Do(httpReq)
-
+	backendmetric.Observe("deviceservice", start, err)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to post req")
 		return nil, ErrServiceError
@@ -100,11 +124,23 @@ func (c *Client) postRequest(url string, req *RTIOReq) (*RTIOResp, error) {
 	return resp, nil
 }
 
-func (c *Client) Post(id uint32, url, deviceID string, reqData []byte) ([]byte, error) {
+// Post sends the device request to the service at url, over gRPC for
+// grpc:// and grpcs:// URLs, otherwise over http.
+func (c *Client) Post(id uint32, url string, dev *Device, uri string, reqData []byte) ([]byte, error) {
+	if target, tls, ok := grpcTarget(url); ok {
+		return c.postGRPC(target, tls, &devicehub.DeviceServiceReq{
+			Id:          id,
+			DeviceId:    dev.ID,
+			Uri:         uri,
+			Data:        reqData,
+			RemoteAddr:  dev.RemoteAddr,
+			ConnectTime: dev.ConnectTime,
+		})
+	}
 	req := &RTIOReq{
 		ID:       id,
 		Method:   "copost",
-		DeviceID: deviceID,
+		DeviceID: dev.ID,
 		Data:     base64.StdEncoding.EncodeToString(reqData),
 	}
 
@@ -0,0 +1,102 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package verifier
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/metrics"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrCircuitOpen = errors.New("ErrCircuitOpen")
+)
+
+var metricCircuitOpen = metrics.NewGaugeVec("rtio_device_verifier_circuit_open",
+	"Device verifiers with the circuit open, 1 when open.", "verifier")
+
+// Breaker opens the circuit of a verifier after consecutive failures, then
+// fails at once until cooldown passed, so that a flapping verifier does not
+// stall every connecting device. After cooldown one request tries the verifier,
+// closing the circuit on success.
+type Breaker struct {
+	name      string
+	verifier  Verifier
+	failures  int
+	cooldown  time.Duration
+	lock      sync.Mutex
+	failed    int
+	openUntil time.Time // zero when closed
+	trying    bool
+}
+
+func NewBreaker(name string, v Verifier, failures int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		name:     name,
+		verifier: v,
+		failures: failures,
+		cooldown: cooldown,
+	}
+}
+
+func (b *Breaker) Verify(deviceID, deviceSecret string) (bool, error) {
+	b.lock.Lock()
+	if !b.openUntil.IsZero() {
+		if b.trying || time.Now().Before(b.openUntil) {
+			b.lock.Unlock()
+			return false, ErrCircuitOpen
+		}
+		b.trying = true
+	}
+	b.lock.Unlock()
+
+	ok, err := b.verifier.Verify(deviceID, deviceSecret)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err != nil {
+		b.failed++
+		if b.trying || b.failed >= b.failures {
+			if b.openUntil.IsZero() {
+				log.Warn().Str("verifier", b.name).Int("failures", b.failed).Msg("Device verifier circuit open")
+			}
+			b.openUntil = time.Now().Add(b.cooldown)
+			metricCircuitOpen.WithLabelValues(b.name).Set(1)
+		}
+		b.trying = false
+		return false, err
+	}
+	if !b.openUntil.IsZero() {
+		log.Info().Str("verifier", b.name).Msg("Device verifier circuit closed")
+		metricCircuitOpen.WithLabelValues(b.name).Set(0)
+	}
+	b.failed = 0
+	b.openUntil = time.Time{}
+	b.trying = false
+	return ok, nil
+}
+
+// UpdateSecret is not guarded by the circuit, as rotations are rare.
+func (b *Breaker) UpdateSecret(deviceID, deviceSecret string) error {
+	return UpdateSecret(b.verifier, deviceID, deviceSecret)
+}
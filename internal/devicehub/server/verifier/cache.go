@@ -0,0 +1,123 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package verifier
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/metrics"
+)
+
+const (
+	CacheEntriesMax = 100000
+)
+
+var metricCache = metrics.NewCounterVec("rtio_device_verify_cache_total",
+	"Device verify cache lookups by result.", "result")
+
+type cacheKey struct {
+	deviceID string
+	secret   [sha256.Size]byte // not kept in memory in plain
+}
+
+type cacheEntry struct {
+	ok     bool
+	expire time.Time
+}
+
+// Cache caches the results of a verifier by device and secret, passes for
+// ttl and rejections for negativeTTL, 0 not to cache them. Errors are not cached.
+type Cache struct {
+	verifier    Verifier
+	ttl         time.Duration
+	negativeTTL time.Duration
+	lock        sync.Mutex
+	entries     map[cacheKey]cacheEntry
+}
+
+func NewCache(v Verifier, ttl, negativeTTL time.Duration) *Cache {
+	return &Cache{
+		verifier:    v,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[cacheKey]cacheEntry),
+	}
+}
+
+func (c *Cache) Verify(deviceID, deviceSecret string) (bool, error) {
+	key := cacheKey{deviceID: deviceID, secret: sha256.Sum256([]byte(deviceSecret))}
+	now := time.Now()
+	c.lock.Lock()
+	e, found := c.entries[key]
+	c.lock.Unlock()
+	if found && now.Before(e.expire) {
+		metricCache.WithLabelValues("hit").Inc()
+		return e.ok, nil
+	}
+	metricCache.WithLabelValues("miss").Inc()
+
+	ok, err := c.verifier.Verify(deviceID, deviceSecret)
+	if err != nil {
+		return false, err
+	}
+	ttl := c.ttl
+	if !ok {
+		ttl = c.negativeTTL
+	}
+	if ttl > 0 {
+		c.set(key, cacheEntry{ok: ok, expire: now.Add(ttl)}, now)
+	}
+	return ok, nil
+}
+
+func (c *Cache) set(key cacheKey, e cacheEntry, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.entries) >= CacheEntriesMax {
+		for k, v := range c.entries {
+			if !now.Before(v.expire) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= CacheEntriesMax {
+			return
+		}
+	}
+	c.entries[key] = e
+}
+
+// Invalidate drops the results of a device, such as after its secret changed.
+func (c *Cache) Invalidate(deviceID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for k := range c.entries {
+		if k.deviceID == deviceID {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// UpdateSecret updates the cached verifier and drops the results of the old secret.
+func (c *Cache) UpdateSecret(deviceID, deviceSecret string) error {
+	err := UpdateSecret(c.verifier, deviceID, deviceSecret)
+	c.Invalidate(deviceID)
+	return err
+}
@@ -0,0 +1,84 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package verifier
+
+import (
+	"github.com/rs/zerolog/log"
+)
+
+// Chain verifies by the verifiers in order, a device passes when one of them
+// verifies it. Without a pass, the last error is returned if any verifier
+// failed, as the failed one may know the device.
+type Chain []Verifier
+
+func (c Chain) Verify(deviceID, deviceSecret string) (bool, error) {
+	var lastErr error
+	for _, v := range c {
+		ok, err := v.Verify(deviceID, deviceSecret)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, lastErr
+}
+
+// UpdateSecret updates every verifier able to store secrets, succeeds when
+// one of them stored it.
+func (c Chain) UpdateSecret(deviceID, deviceSecret string) error {
+	err := ErrSecretNotUpdatable
+	updated := false
+	for _, v := range c {
+		e := UpdateSecret(v, deviceID, deviceSecret)
+		if e == nil {
+			updated = true
+			continue
+		}
+		if e != ErrSecretNotUpdatable {
+			log.Warn().Err(e).Str("deviceid", deviceID).Msg("Device secret not updated by the verifier")
+			err = e
+		}
+	}
+	if updated {
+		return nil
+	}
+	return err
+}
+
+// FailOpen passes devices when the verifier fails, such as all circuits open,
+// instead of rejecting them.
+type FailOpen struct {
+	Verifier
+}
+
+func (f FailOpen) Verify(deviceID, deviceSecret string) (bool, error) {
+	ok, err := f.Verifier.Verify(deviceID, deviceSecret)
+	if err != nil {
+		log.Warn().Err(err).Str("deviceid", deviceID).Msg("Device verify failed, passed by fail-open")
+		return true, nil
+	}
+	return ok, nil
+}
+
+func (f FailOpen) UpdateSecret(deviceID, deviceSecret string) error {
+	return UpdateSecret(f.Verifier, deviceID, deviceSecret)
+}
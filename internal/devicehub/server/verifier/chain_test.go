@@ -0,0 +1,181 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package verifier
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+var errFake = errors.New("errFake")
+
+type fakeVerifier struct {
+	devices map[string]string
+	err     error
+	calls   int
+}
+
+func (f *fakeVerifier) Verify(deviceID, deviceSecret string) (bool, error) {
+	f.calls++
+	if f.err != nil {
+		return false, f.err
+	}
+	secret, ok := f.devices[deviceID]
+	return ok && secret == deviceSecret, nil
+}
+
+func TestChain(t *testing.T) {
+	v1 := &fakeVerifier{devices: map[string]string{"dev1": "secret1"}}
+	v2 := &fakeVerifier{devices: map[string]string{"dev2": "secret2"}}
+	chain := Chain{v1, v2}
+
+	ok, err := chain.Verify("dev1", "secret1")
+	assert.NilError(t, err)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 0, v2.calls)
+
+	ok, err = chain.Verify("dev2", "secret2")
+	assert.NilError(t, err)
+	assert.Equal(t, true, ok)
+
+	ok, err = chain.Verify("dev2", "secret1")
+	assert.NilError(t, err)
+	assert.Equal(t, false, ok)
+
+	// passed by the next verifier, an error only without a pass
+	v1.err = errFake
+	ok, err = chain.Verify("dev2", "secret2")
+	assert.NilError(t, err)
+	assert.Equal(t, true, ok)
+	_, err = chain.Verify("dev1", "secret1")
+	assert.Equal(t, errFake, err)
+
+	ok, err = FailOpen{Verifier: chain}.Verify("dev1", "secret1")
+	assert.NilError(t, err)
+	assert.Equal(t, true, ok)
+	ok, err = FailOpen{Verifier: chain}.Verify("dev2", "secret1")
+	assert.NilError(t, err)
+	assert.Equal(t, true, ok)
+}
+
+func TestCache(t *testing.T) {
+	v := &fakeVerifier{devices: map[string]string{"dev1": "secret1"}}
+	c := NewCache(v, time.Minute, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		ok, err := c.Verify("dev1", "secret1")
+		assert.NilError(t, err)
+		assert.Equal(t, true, ok)
+	}
+	assert.Equal(t, 1, v.calls)
+
+	// the secret is part of the key
+	ok, _ := c.Verify("dev1", "wrong")
+	assert.Equal(t, false, ok)
+	ok, _ = c.Verify("dev1", "wrong")
+	assert.Equal(t, false, ok)
+	assert.Equal(t, 2, v.calls)
+	time.Sleep(60 * time.Millisecond)
+	c.Verify("dev1", "wrong")
+	assert.Equal(t, 3, v.calls)
+
+	// errors are not cached
+	v.err = errFake
+	_, err := c.Verify("dev2", "secret2")
+	assert.Equal(t, errFake, err)
+	_, err = c.Verify("dev2", "secret2")
+	assert.Equal(t, errFake, err)
+	assert.Equal(t, 5, v.calls)
+
+	ok, err = c.Verify("dev1", "secret1")
+	assert.NilError(t, err)
+	assert.Equal(t, true, ok)
+	c.Invalidate("dev1")
+	_, err = c.Verify("dev1", "secret1")
+	assert.Equal(t, errFake, err)
+}
+
+func TestBreaker(t *testing.T) {
+	v := &fakeVerifier{devices: map[string]string{"dev1": "secret1"}, err: errFake}
+	b := NewBreaker("fake", v, 3, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		_, err := b.Verify("dev1", "secret1")
+		assert.Equal(t, errFake, err)
+	}
+	_, err := b.Verify("dev1", "secret1")
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, 3, v.calls)
+
+	// the retry after cooldown fails, open again at once
+	time.Sleep(60 * time.Millisecond)
+	_, err = b.Verify("dev1", "secret1")
+	assert.Equal(t, errFake, err)
+	_, err = b.Verify("dev1", "secret1")
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, 4, v.calls)
+
+	v.err = nil
+	time.Sleep(60 * time.Millisecond)
+	ok, err := b.Verify("dev1", "secret1")
+	assert.NilError(t, err)
+	assert.Equal(t, true, ok)
+	ok, err = b.Verify("dev1", "wrong")
+	assert.NilError(t, err)
+	assert.Equal(t, false, ok)
+}
+
+// fakeUpdater stores rotated secrets, fakeVerifier does not.
+type fakeUpdater struct {
+	fakeVerifier
+}
+
+func (f *fakeUpdater) UpdateSecret(deviceID, deviceSecret string) error {
+	if f.err != nil {
+		return f.err
+	}
+	if _, ok := f.devices[deviceID]; !ok {
+		return errFake
+	}
+	f.devices[deviceID] = deviceSecret
+	return nil
+}
+
+func TestUpdateSecret(t *testing.T) {
+	u := &fakeUpdater{fakeVerifier{devices: map[string]string{"dev1": "secret1"}}}
+	v := &fakeVerifier{devices: map[string]string{"dev2": "secret2"}}
+	cache := NewCache(u, time.Minute, time.Minute)
+	chain := Chain{v, FailOpen{NewBreaker("fake", cache, 5, time.Second)}}
+
+	ok, _ := chain.Verify("dev1", "secret1")
+	assert.Equal(t, true, ok)
+	assert.NilError(t, chain.UpdateSecret("dev1", "secret1-new"))
+	// the cached pass of the old secret dropped
+	ok, _ = chain.Verify("dev1", "secret1")
+	assert.Equal(t, false, ok)
+	ok, _ = chain.Verify("dev1", "secret1-new")
+	assert.Equal(t, true, ok)
+
+	assert.Equal(t, errFake, chain.UpdateSecret("dev2", "secret2-new"))
+	assert.Equal(t, ErrSecretNotUpdatable, Chain{v}.UpdateSecret("dev2", "secret2-new"))
+	assert.Equal(t, ErrSecretNotUpdatable, UpdateSecret(v, "dev2", "secret2-new"))
+}
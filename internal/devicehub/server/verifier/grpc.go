@@ -0,0 +1,144 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package verifier
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/backendmetric"
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/pkg/config"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+	"github.com/mkrainbow/rtio/pkg/rtioutil"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+)
+
+const (
+	SchemeGRPC  = "grpc://"  // plaintext
+	SchemeGRPCS = "grpcs://" // TLS
+)
+
+// GRPCClient verifies devices by a devicehub.DeviceVerifier service.
+type GRPCClient struct {
+	target  string
+	client  devicehub.DeviceVerifierClient
+	timeout time.Duration
+}
+
+// NewGRPCClient creates the gRPC verifier of a grpc:// or grpcs:// URL, the
+// grpcs:// cert is verified by the CA of config deviceverifier.tls.ca.
+func NewGRPCClient(url string, timeout time.Duration) (*GRPCClient, error) {
+	if timeout <= 0 {
+		timeout = TimeoutDefault
+	}
+	target, tls := strings.CutPrefix(url, SchemeGRPCS)
+	if !tls {
+		target = strings.TrimPrefix(url, SchemeGRPC)
+	}
+	opts := rpcauth.DialOptions(nil, "")
+	if tls {
+		tlsConfig, err := rpcauth.LoadClientTLSConfig(config.StringKV.GetWithDefault("deviceverifier.tls.ca", ""), "", "", "")
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load device verifier CA")
+			return nil, err
+		}
+		opts = rpcauth.DialOptions(tlsConfig, "")
+	}
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		log.Error().Err(err).Str("target", target).Msg("Failed to dial device verifier")
+		return nil, err
+	}
+	return &GRPCClient{
+		target:  target,
+		client:  devicehub.NewDeviceVerifierClient(conn),
+		timeout: timeout,
+	}, nil
+}
+
+func (c *GRPCClient) Verify(deviceID, deviceSecret string) (bool, error) {
+	id, err := rtioutil.GenUint32ID()
+	if err != nil {
+		log.Error().Err(err).Msg("GenUint32ID err")
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	start := time.Now()
+	resp, err := c.client.Verify(ctx, &devicehub.DeviceVerifyReq{
+		Id:           id,
+		DeviceId:     deviceID,
+		DeviceSecret: deviceSecret,
+	})
+	backendmetric.Observe("verifier", start, err)
+	if err != nil {
+		log.Error().Err(err).Str("target", c.target).Msg("Error while call grpc verify")
+		return false, err
+	}
+	switch resp.Code {
+	case devicehub.Code_CODE_OK:
+		return true, nil
+	case devicehub.Code_CODE_FORBIDDEN:
+		return false, nil
+	case devicehub.Code_CODE_NOT_FOUNT:
+		log.Warn().Str("deviceid", deviceID).Msg("Not Found device")
+		return false, nil
+	}
+	log.Error().Str("deviceid", deviceID).Str("code", resp.Code.String()).Msg("Failed to verify device")
+	return false, ErrVerifierCode
+}
+
+func (c *GRPCClient) UpdateSecret(deviceID, deviceSecret string) error {
+	id, err := rtioutil.GenUint32ID()
+	if err != nil {
+		log.Error().Err(err).Msg("GenUint32ID err")
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	start := time.Now()
+	resp, err := c.client.UpdateSecret(ctx, &devicehub.DeviceVerifyReq{
+		Id:           id,
+		DeviceId:     deviceID,
+		DeviceSecret: deviceSecret,
+	})
+	backendmetric.Observe("verifier", start, err)
+	if err != nil {
+		log.Error().Err(err).Str("target", c.target).Msg("Error while call grpc updatesecret")
+		return err
+	}
+	if resp.Code != devicehub.Code_CODE_OK {
+		log.Error().Str("deviceid", deviceID).Str("code", resp.Code.String()).Msg("Failed to update device secret")
+		return ErrVerifierCode
+	}
+	return nil
+}
+
+// New creates the verifier of a URL, gRPC by the grpc:// and grpcs:// schemes,
+// otherwise http.
+func New(url string, timeout time.Duration) (Verifier, error) {
+	if strings.HasPrefix(url, SchemeGRPC) || strings.HasPrefix(url, SchemeGRPCS) {
+		return NewGRPCClient(url, timeout)
+	}
+	return NewClient(url, timeout)
+}
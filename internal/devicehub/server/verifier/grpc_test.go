@@ -0,0 +1,86 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package verifier
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"google.golang.org/grpc"
+	"gotest.tools/assert"
+)
+
+type fakeDeviceVerifier struct {
+	devicehub.UnimplementedDeviceVerifierServer
+}
+
+func (s *fakeDeviceVerifier) Verify(ctx context.Context, req *devicehub.DeviceVerifyReq) (*devicehub.DeviceVerifyResp, error) {
+	resp := &devicehub.DeviceVerifyResp{Id: req.Id, Code: devicehub.Code_CODE_OK}
+	switch {
+	case req.DeviceId != "cfa09baa-4913-4ad7-a936-3e26f9671b09":
+		resp.Code = devicehub.Code_CODE_NOT_FOUNT
+	case req.DeviceSecret == "":
+		resp.Code = devicehub.Code_CODE_INTERNAL_SERVER_ERROR
+	case req.DeviceSecret != "mb6bgso4EChvyzA05thF9+wH":
+		resp.Code = devicehub.Code_CODE_FORBIDDEN
+	}
+	return resp, nil
+}
+
+func (s *fakeDeviceVerifier) UpdateSecret(ctx context.Context, req *devicehub.DeviceVerifyReq) (*devicehub.DeviceVerifyResp, error) {
+	resp := &devicehub.DeviceVerifyResp{Id: req.Id, Code: devicehub.Code_CODE_OK}
+	if req.DeviceId != "cfa09baa-4913-4ad7-a936-3e26f9671b09" {
+		resp.Code = devicehub.Code_CODE_NOT_FOUNT
+	}
+	return resp, nil
+}
+
+func TestGRPCVerify(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	s := grpc.NewServer()
+	devicehub.RegisterDeviceVerifierServer(s, &fakeDeviceVerifier{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	v, err := New(SchemeGRPC+lis.Addr().String(), 0)
+	assert.NilError(t, err)
+	_, isGRPC := v.(*GRPCClient)
+	assert.Equal(t, true, isGRPC)
+
+	ok, err := v.Verify("cfa09baa-4913-4ad7-a936-3e26f9671b09", "mb6bgso4EChvyzA05thF9+wH")
+	assert.NilError(t, err)
+	assert.Equal(t, true, ok)
+	ok, err = v.Verify("cfa09baa-4913-4ad7-a936-3e26f9671b09", "mb6bgso4EChvyzA05thF9+wh")
+	assert.NilError(t, err)
+	assert.Equal(t, false, ok)
+	ok, err = v.Verify("cfa09baa-4913-4ad7-a936-3e26f9671b00", "mb6bgso4EChvyzA05thF9+wH")
+	assert.NilError(t, err)
+	assert.Equal(t, false, ok)
+	_, err = v.Verify("cfa09baa-4913-4ad7-a936-3e26f9671b09", "")
+	assert.Equal(t, ErrVerifierCode, err)
+
+	err = UpdateSecret(v, "cfa09baa-4913-4ad7-a936-3e26f9671b09", "Pq0Hk2t8W1xYz9abCdEfGhIj")
+	assert.NilError(t, err)
+	err = UpdateSecret(v, "cfa09baa-4913-4ad7-a936-3e26f9671b00", "Pq0Hk2t8W1xYz9abCdEfGhIj")
+	assert.Equal(t, ErrVerifierCode, err)
+}
@@ -20,17 +20,50 @@ package verifier
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"time"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/mkrainbow/rtio/internal/devicehub/server/backendmetric"
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/pkg/config"
 	"github.com/mkrainbow/rtio/pkg/rtioutil"
 )
 
+var (
+	ErrVerifierCode       = errors.New("ErrVerifierCode")
+	ErrSecretNotUpdatable = errors.New("ErrSecretNotUpdatable")
+)
+
+const (
+	TimeoutDefault = 5 * time.Second
+)
+
+// Verifier verifies the device secret, false when the device is not known
+// or the secret not match, error when verifying failed.
+type Verifier interface {
+	Verify(deviceID, deviceSecret string) (bool, error)
+}
+
+// SecretUpdater stores the device secret rotated by the hub, error when the
+// device is not known or the secret not stored.
+type SecretUpdater interface {
+	UpdateSecret(deviceID, deviceSecret string) error
+}
+
+// UpdateSecret of the verifier, ErrSecretNotUpdatable if it can not store secrets.
+func UpdateSecret(v Verifier, deviceID, deviceSecret string) error {
+	u, ok := v.(SecretUpdater)
+	if !ok {
+		return ErrSecretNotUpdatable
+	}
+	return u.UpdateSecret(deviceID, deviceSecret)
+}
+
 type Client struct {
 	client *http.Client
 	url    string
@@ -48,16 +81,26 @@ type VerifyResp struct {
 	Code string `json:"code"`
 }
 
-func NewClient(url string) *Client {
+// NewClient creates the http verifier, https certs are verified by the CA
+// of config deviceverifier.tls.ca, the system CAs if empty.
+func NewClient(url string, timeout time.Duration) (*Client, error) {
+	if timeout <= 0 {
+		timeout = TimeoutDefault
+	}
+	tlsConfig, err := rpcauth.LoadClientTLSConfig(config.StringKV.GetWithDefault("deviceverifier.tls.ca", ""), "", "", "")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load device verifier CA")
+		return nil, err
+	}
 	httpTransport := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		TLSClientConfig: tlsConfig,
 	}
-	client := &http.Client{Transport: httpTransport, Timeout: 5 * time.Second}
+	client := &http.Client{Transport: httpTransport, Timeout: timeout}
 
 	return &Client{
 		client: client,
 		url:    url,
-	}
+	}, nil
 }
 
 func (c *Client) httpVerify(req *VerifyReq) (*VerifyResp, error) {
@@ -72,8 +115,9 @@ func (c *Client) httpVerify(req *VerifyReq) (*VerifyResp, error) {
 		log.Error().Err(err).Msg("Failed to NewRequest")
 		return nil, err
 	}
+	start := time.Now()
 	httpResp, err := c.client.Do(httpReq)
-
+	backendmetric.Observe("verifier", start, err)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to post req")
 		return nil, err
@@ -124,5 +168,28 @@ func (c *Client) Verify(deviceID, deviceSecret string) (bool, error) {
 		return false, nil
 	}
 	log.Error().Str("deviceid", deviceID).Str("code", resp.Code).Msg("Failed to verify device")
-	return false, nil
+	return false, ErrVerifierCode
+}
+
+func (c *Client) UpdateSecret(deviceID, deviceSecret string) error {
+	id, err := rtioutil.GenUint32ID()
+	if err != nil {
+		log.Error().Err(err).Msg("GenUint32ID err")
+		return err
+	}
+	resp, err := c.httpVerify(&VerifyReq{
+		ID:           id,
+		Method:       "updatesecret",
+		DeviceID:     deviceID,
+		DeviceSecret: deviceSecret,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error while call http updatesecret")
+		return err
+	}
+	if resp.Code == "OK" {
+		return nil
+	}
+	log.Error().Str("deviceid", deviceID).Str("code", resp.Code).Msg("Failed to update device secret")
+	return ErrVerifierCode
 }
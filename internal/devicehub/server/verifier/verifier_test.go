@@ -18,10 +18,15 @@
 
 package verifier
 
-import "testing"
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
 
 func TestVerifyOK(t *testing.T) {
-	c := NewClient("http://0.0.0.0:17217/deviceverifier")
+	c, err := NewClient("http://0.0.0.0:17217/deviceverifier", 0)
+	assert.NilError(t, err)
 	req := &VerifyReq{
 		ID:           12345,
 		Method:       "verify",
@@ -44,7 +49,8 @@ func TestVerifyOK(t *testing.T) {
 }
 
 func TestVerifyErrorMethod(t *testing.T) {
-	c := NewClient("http://0.0.0.0:17217/deviceverifier")
+	c, err := NewClient("http://0.0.0.0:17217/deviceverifier", 0)
+	assert.NilError(t, err)
 	req := &VerifyReq{
 		ID:           12345,
 		Method:       "other",
@@ -66,7 +72,8 @@ func TestVerifyErrorMethod(t *testing.T) {
 }
 
 func TestVerifyErrorSecret(t *testing.T) {
-	c := NewClient("http://0.0.0.0:17217/deviceverifier")
+	c, err := NewClient("http://0.0.0.0:17217/deviceverifier", 0)
+	assert.NilError(t, err)
 	req := &VerifyReq{
 		ID:           12345,
 		Method:       "verify",
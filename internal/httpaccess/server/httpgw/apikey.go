@@ -0,0 +1,361 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/filestore"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrAPIKeyInvalid     = errors.New("Invalid API key")
+	ErrAPIKeyExpired     = errors.New("API key expired")
+	ErrAPIKeyRevoked     = errors.New("API key revoked")
+	ErrAPIKeyRateLimited = errors.New("API key rate limited")
+	ErrAPIKeyNotFound    = errors.New("API key not found")
+	ErrAPIKeyStoreLoad   = errors.New("API key store load failed")
+)
+
+const (
+	RTIOAPIKeyPrefix    = "rtio"
+	RTIOAPIKeyIDLen     = 8  // bytes, hex encoded in key
+	RTIOAPIKeySecretLen = 32 // bytes, hex encoded in key
+)
+
+// APIKey is a key store entry, only the salted SHA-256 of the secret is stored.
+type APIKey struct {
+	ID      string      `json:"id"`
+	Name    string      `json:"name"`
+	Salt    string      `json:"salt"`
+	Hash    string      `json:"hash"`
+	Scope   AccessScope `json:"scope"`
+	Created int64       `json:"created"`
+	Expires int64       `json:"expires"` // unix seconds, 0 for never
+	Rate    int         `json:"rate"`    // requests per second, 0 for unlimited
+	Revoked bool        `json:"revoked"`
+}
+
+type apiKeyFile struct {
+	Keys []*APIKey `json:"keys"`
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// APIKeyStore is the key store loaded from a local file. Keys have the form
+// rtio_<id>_<secret>, the id selects the entry and the secret is verified by hash.
+type APIKeyStore struct {
+	file    string
+	modTime time.Time
+	keys    map[string]*APIKey
+	changes map[string]*APIKey // created or revoked, not saved yet
+	buckets map[string]*rateBucket
+	lock    sync.Mutex
+}
+
+func hashAPIKeySecret(salt, secret string) string {
+	sum := sha256.Sum256([]byte(salt + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func splitAPIKey(key string) (string, string, error) {
+	seg := strings.Split(key, "_")
+	if len(seg) != 3 || seg[0] != RTIOAPIKeyPrefix ||
+		len(seg[1]) != RTIOAPIKeyIDLen*2 || len(seg[2]) != RTIOAPIKeySecretLen*2 {
+		return "", "", ErrAPIKeyInvalid
+	}
+	return seg[1], seg[2], nil
+}
+
+// LoadAPIKeyStore loads key store from file, an absent file is an empty store.
+func LoadAPIKeyStore(file string) (*APIKeyStore, error) {
+	s := &APIKeyStore{
+		file:    file,
+		keys:    make(map[string]*APIKey),
+		changes: make(map[string]*APIKey),
+		buckets: make(map[string]*rateBucket),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// read reads the file, an absent file is an empty store.
+func (s *APIKeyStore) read() (*apiKeyFile, time.Time, error) {
+	f := &apiKeyFile{}
+	info, err := os.Stat(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, time.Time{}, nil
+	}
+	if err != nil {
+		log.Error().Err(err).Str("file", s.file).Msg("Failed to stat API key store")
+		return nil, time.Time{}, ErrAPIKeyStoreLoad
+	}
+	buf, err := os.ReadFile(s.file)
+	if err != nil {
+		log.Error().Err(err).Str("file", s.file).Msg("Failed to read API key store")
+		return nil, time.Time{}, ErrAPIKeyStoreLoad
+	}
+	if err := json.Unmarshal(buf, f); err != nil {
+		log.Error().Err(err).Str("file", s.file).Msg("Failed to unmarshal API key store")
+		return nil, time.Time{}, ErrAPIKeyStoreLoad
+	}
+	return f, info.ModTime(), nil
+}
+
+func (s *APIKeyStore) load() error {
+	f, modTime, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.applyLocked(f, modTime)
+	log.Info().Int("keys", len(s.keys)).Str("file", s.file).Msg("API key store loaded")
+	return nil
+}
+
+// applyLocked sets the keys read from the file, with the changes not saved.
+func (s *APIKeyStore) applyLocked(f *apiKeyFile, modTime time.Time) {
+	keys := make(map[string]*APIKey, len(f.Keys)+len(s.changes))
+	for _, k := range f.Keys {
+		keys[k.ID] = k
+	}
+	for id, k := range s.changes {
+		keys[id] = k
+	}
+	s.keys = keys
+	s.modTime = modTime
+}
+
+// Save writes the changes to the file. The file is locked and read again, so
+// changes saved by others meanwhile, such as another 'rtio apikey', are kept.
+func (s *APIKeyStore) Save() error {
+	unlock, err := filestore.Lock(s.file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	f, modTime, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.applyLocked(f, modTime)
+	buf, err := json.MarshalIndent(&apiKeyFile{Keys: s.listLocked()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := filestore.WriteFile(s.file, buf, 0600); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.file); err == nil {
+		s.modTime = info.ModTime()
+	}
+	s.changes = make(map[string]*APIKey)
+	return nil
+}
+
+// ReloadLoop reloads the store when the file changed, such as after 'rtio apikey revoke'.
+func (s *APIKeyStore) ReloadLoop(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debug().Msg("API key store reload ctx done")
+			return
+		case <-t.C:
+			info, err := os.Stat(s.file)
+			if err != nil {
+				continue
+			}
+			s.lock.Lock()
+			changed := !info.ModTime().Equal(s.modTime)
+			s.lock.Unlock()
+			if changed {
+				s.load() // keep previous keys on failure
+			}
+		}
+	}
+}
+
+// Create adds a key and returns the key string, which is not recoverable from the store.
+func (s *APIKeyStore) Create(name string, scope AccessScope, expires time.Time, rate int) (string, *APIKey, error) {
+	id, err := randHex(RTIOAPIKeyIDLen)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randHex(RTIOAPIKeySecretLen)
+	if err != nil {
+		return "", nil, err
+	}
+	salt, err := randHex(16)
+	if err != nil {
+		return "", nil, err
+	}
+	k := &APIKey{
+		ID:      id,
+		Name:    name,
+		Salt:    salt,
+		Hash:    hashAPIKeySecret(salt, secret),
+		Scope:   scope,
+		Created: time.Now().Unix(),
+		Rate:    rate,
+	}
+	if !expires.IsZero() {
+		k.Expires = expires.Unix()
+	}
+
+	s.lock.Lock()
+	s.keys[id] = k
+	s.changes[id] = k
+	s.lock.Unlock()
+	return RTIOAPIKeyPrefix + "_" + id + "_" + secret, k, nil
+}
+
+func (s *APIKeyStore) Revoke(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	k.Revoked = true
+	s.changes[id] = k
+	return nil
+}
+
+func (s *APIKeyStore) listLocked() []*APIKey {
+	l := make([]*APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		l = append(l, k)
+	}
+	return l
+}
+
+// List Items no order.
+func (s *APIKeyStore) List() []*APIKey {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.listLocked()
+}
+
+// allow takes a token from the key bucket, burst is one second of rate.
+func (s *APIKeyStore) allow(k *APIKey, now time.Time) bool {
+	if k.Rate <= 0 {
+		return true
+	}
+	b, ok := s.buckets[k.ID]
+	if !ok {
+		b = &rateBucket{tokens: float64(k.Rate), last: now}
+		s.buckets[k.ID] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * float64(k.Rate)
+	if b.tokens > float64(k.Rate) {
+		b.tokens = float64(k.Rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Authenticate verifies the key and its rate limit, returns the key scope and
+// the caller "apikey:id" for the audit log.
+func (s *APIKeyStore) Authenticate(key string) (*AccessScope, string, error) {
+	k, err := s.authenticateKey(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return &k.Scope, "apikey:" + k.ID, nil
+}
+
+// authenticateKey is Authenticate returning a copy of the key entry.
+func (s *APIKeyStore) authenticateKey(key string) (*APIKey, error) {
+	id, secret, err := splitAPIKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, ErrAPIKeyInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKeySecret(k.Salt, secret)), []byte(k.Hash)) != 1 {
+		return nil, ErrAPIKeyInvalid
+	}
+	if k.Revoked {
+		return nil, ErrAPIKeyRevoked
+	}
+	now := time.Now()
+	if k.Expires != 0 && now.Unix() >= k.Expires {
+		return nil, ErrAPIKeyExpired
+	}
+	if !s.allow(k, now) {
+		return nil, ErrAPIKeyRateLimited
+	}
+	entry := *k
+	return &entry, nil
+}
+
+// httpGetAPIKey gets key from 'X-API-Key' or 'Authorization: ApiKey <key>'.
+func httpGetAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	const prefix = "ApiKey "
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) > len(prefix) && authHeader[:len(prefix)] == prefix {
+		return authHeader[len(prefix):]
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+// changeLast changes the last char of a key or secret, to a wrong one.
+func changeLast(s string) string {
+	if strings.HasSuffix(s, "0") {
+		return s[:len(s)-1] + "1"
+	}
+	return s[:len(s)-1] + "0"
+}
+
+func TestAPIKeyStore(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "apikeys.json")
+	s, err := LoadAPIKeyStore(file)
+	assert.NilError(t, err)
+
+	scope := AccessScope{Devices: []string{"cfa09baa-*"}, Methods: []string{"copost"}}
+	key, k, err := s.Create("job", scope, time.Time{}, 2)
+	assert.NilError(t, err)
+	expired, _, err := s.Create("old", scope, time.Now().Add(-time.Second), 0)
+	assert.NilError(t, err)
+	assert.NilError(t, s.Save())
+
+	// reload from file, secrets are not stored
+	s, err = LoadAPIKeyStore(file)
+	assert.NilError(t, err)
+	assert.Equal(t, len(s.List()), 2)
+
+	got, caller, err := s.Authenticate(key)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, *got, scope)
+	assert.Equal(t, caller, "apikey:"+k.ID)
+
+	_, _, err = s.Authenticate(changeLast(key))
+	assert.Equal(t, err, ErrAPIKeyInvalid)
+	_, _, err = s.Authenticate("rtio_abc")
+	assert.Equal(t, err, ErrAPIKeyInvalid)
+	_, _, err = s.Authenticate(expired)
+	assert.Equal(t, err, ErrAPIKeyExpired)
+
+	// rate 2/s, one used above
+	_, _, err = s.Authenticate(key)
+	assert.NilError(t, err)
+	_, _, err = s.Authenticate(key)
+	assert.Equal(t, err, ErrAPIKeyRateLimited)
+
+	assert.NilError(t, s.Revoke(k.ID))
+	_, _, err = s.Authenticate(key)
+	assert.Equal(t, err, ErrAPIKeyRevoked)
+	assert.Equal(t, s.Revoke("0000000000000000"), ErrAPIKeyNotFound)
+}
+
+func TestAPIKeyStoreSaveMerge(t *testing.T) {
+
+	// two 'rtio apikey' runs on the file, neither drops the other's changes
+	file := filepath.Join(t.TempDir(), "apikeys.json")
+	s, err := LoadAPIKeyStore(file)
+	assert.NilError(t, err)
+	_, k, err := s.Create("job", AccessScope{Devices: []string{"*"}}, time.Time{}, 0)
+	assert.NilError(t, err)
+	assert.NilError(t, s.Save())
+
+	a, err := LoadAPIKeyStore(file)
+	assert.NilError(t, err)
+	b, err := LoadAPIKeyStore(file)
+	assert.NilError(t, err)
+	_, created, err := a.Create("other", AccessScope{Devices: []string{"*"}}, time.Time{}, 0)
+	assert.NilError(t, err)
+	assert.NilError(t, b.Revoke(k.ID))
+	assert.NilError(t, a.Save())
+	assert.NilError(t, b.Save())
+
+	s, err = LoadAPIKeyStore(file)
+	assert.NilError(t, err)
+	assert.Equal(t, len(s.List()), 2)
+	assert.Equal(t, s.keys[k.ID].Revoked, true)
+	assert.Equal(t, s.keys[created.ID].Name, "other")
+}
+
+func TestHTTPGetAPIKey(t *testing.T) {
+
+	r, _ := http.NewRequest("POST", "http://localhost/"+testDeviceID, nil)
+	assert.Equal(t, httpGetAPIKey(r), "")
+	r.Header.Set("Authorization", "ApiKey rtio_a_b")
+	assert.Equal(t, httpGetAPIKey(r), "rtio_a_b")
+	r.Header.Set("X-API-Key", "rtio_c_d")
+	assert.Equal(t, httpGetAPIKey(r), "rtio_c_d")
+	r.Header.Del("X-API-Key")
+	r.Header.Set("Authorization", "Bearer xxx")
+	assert.Equal(t, httpGetAPIKey(r), "")
+}
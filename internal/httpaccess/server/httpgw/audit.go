@@ -0,0 +1,57 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/audit"
+)
+
+// auditEntry records a copost or obget once, an obget when it is established
+// or fails, others when served.
+type auditEntry struct {
+	caller   string // empty when authentication disabled
+	deviceID string
+	req      *RTIOReq
+	start    time.Time
+	recorded bool
+}
+
+func (e *auditEntry) record(code string) {
+	if e == nil || e.recorded || !audit.Enabled() {
+		return
+	}
+	e.recorded = true
+	data, _ := base64.StdEncoding.DecodeString(e.req.Data)
+	r := &audit.Record{
+		Source:   audit.SourceHTTP,
+		Caller:   e.caller,
+		ID:       e.req.ID,
+		DeviceID: e.deviceID,
+		Method:   e.req.Method,
+		URI:      e.req.URI,
+		Payload:  data,
+		Sealed:   e.req.Sealed,
+		Code:     code,
+		Latency:  time.Since(e.start),
+	}
+	audit.Log(r)
+}
@@ -0,0 +1,161 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrForbiddenDevice = errors.New("Forbidden device")
+	ErrForbiddenURI    = errors.New("Forbidden URI")
+	ErrForbiddenMethod = errors.New("Forbidden method")
+	ErrPolicyLoad      = errors.New("Policy file load failed")
+	ErrScopeClaim      = errors.New("Invalid scope claim")
+)
+
+// JWT custom claims for access scope, each is a string or a non-empty string
+// list. A token with a claim of another type is rejected.
+const (
+	RTIOClaimDevices = "rtio_devices"
+	RTIOClaimURIs    = "rtio_uris"
+	RTIOClaimMethods = "rtio_methods"
+)
+
+// AccessScope is what a caller is allowed to access. Patterns match exactly,
+// or by prefix when ending with '*', "*" matches all. Empty URIs or Methods
+// means no restriction, empty Devices means no device.
+type AccessScope struct {
+	Devices []string `json:"devices"`
+	URIs    []string `json:"uris"`
+	Methods []string `json:"methods"`
+}
+
+// Policy is the policy file for non-JWT deployments, a request is allowed
+// when any scope allows it.
+type Policy struct {
+	Scopes []AccessScope `json:"scopes"`
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if rpcauth.MatchPattern(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *AccessScope) authorize(deviceID, method, uri string) error {
+	if !matchAny(a.Devices, deviceID) {
+		return ErrForbiddenDevice
+	}
+	if len(a.Methods) > 0 && !matchAny(a.Methods, method) {
+		return ErrForbiddenMethod
+	}
+	if len(a.URIs) > 0 && !matchAny(a.URIs, uri) {
+		return ErrForbiddenURI
+	}
+	return nil
+}
+
+func (p *Policy) authorize(deviceID, method, uri string) error {
+	err := ErrForbiddenDevice
+	for i := range p.Scopes {
+		if err = p.Scopes[i].authorize(deviceID, method, uri); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func loadPolicy(file string) (*Policy, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		log.Error().Err(err).Str("file", file).Msg("Failed to read policy file")
+		return nil, ErrPolicyLoad
+	}
+	p := &Policy{}
+	if err := json.Unmarshal(buf, p); err != nil {
+		log.Error().Err(err).Str("file", file).Msg("Failed to unmarshal policy file")
+		return nil, ErrPolicyLoad
+	}
+	log.Info().Int("scopes", len(p.Scopes)).Str("file", file).Msg("Policy loaded")
+	return p, nil
+}
+
+// claimStrings gets the claim, ok is false when it is absent. A present claim
+// that gives no pattern is ErrScopeClaim, it must not read as unrestricted.
+func claimStrings(claims jwt.MapClaims, key string) (l []string, ok bool, err error) {
+	v, ok := claims[key]
+	if !ok {
+		return nil, false, nil
+	}
+	switch v := v.(type) {
+	case string:
+		return []string{v}, true, nil
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, true, ErrScopeClaim
+		}
+		l = make([]string, 0, len(v))
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, true, ErrScopeClaim
+			}
+			l = append(l, s)
+		}
+		return l, true, nil
+	}
+	return nil, true, ErrScopeClaim
+}
+
+// scopeFromClaims gets scope from custom claims, the subject is the only
+// device when rtio_devices absent.
+func scopeFromClaims(claims jwt.MapClaims) (*AccessScope, error) {
+	scope := &AccessScope{}
+	devices, ok, err := claimStrings(claims, RTIOClaimDevices)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		scope.Devices = devices
+	} else {
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return nil, err
+		}
+		scope.Devices = []string{sub}
+	}
+	if scope.URIs, _, err = claimStrings(claims, RTIOClaimURIs); err != nil {
+		return nil, err
+	}
+	if scope.Methods, _, err = claimStrings(claims, RTIOClaimMethods); err != nil {
+		return nil, err
+	}
+	return scope, nil
+}
@@ -0,0 +1,86 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gotest.tools/assert"
+)
+
+func TestScopeFromClaims(t *testing.T) {
+
+	scope, err := scopeFromClaims(jwt.MapClaims{"sub": testDeviceID})
+	assert.NilError(t, err)
+	assert.NilError(t, scope.authorize(testDeviceID, "copost", "/greeter"))
+	assert.Equal(t, scope.authorize("cfa09baa-4913-4ad7-a936-3e26f9671b11", "copost", "/greeter"), ErrForbiddenDevice)
+
+	scope, err = scopeFromClaims(jwt.MapClaims{
+		"sub":            "batch-job",
+		RTIOClaimDevices: []interface{}{"cfa09baa-*", testDeviceID},
+		RTIOClaimURIs:    []interface{}{"/printer/*", "/greeter"},
+		RTIOClaimMethods: "obget",
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, scope.authorize("cfa09baa-0000-0000-0000-000000000000", "obget", "/printer/status"))
+	assert.NilError(t, scope.authorize(testDeviceID, "obget", "/greeter"))
+	assert.Equal(t, scope.authorize("dfa09baa-0000-0000-0000-000000000000", "obget", "/greeter"), ErrForbiddenDevice)
+	assert.Equal(t, scope.authorize(testDeviceID, "copost", "/greeter"), ErrForbiddenMethod)
+	assert.Equal(t, scope.authorize(testDeviceID, "obget", "/greeter/1"), ErrForbiddenURI)
+
+	// a claim present but giving no pattern is not unrestricted
+	for _, v := range []interface{}{[]interface{}{}, []interface{}{"/greeter", 1}, 1, map[string]interface{}{}} {
+		for _, claim := range []string{RTIOClaimDevices, RTIOClaimURIs, RTIOClaimMethods} {
+			_, err = scopeFromClaims(jwt.MapClaims{"sub": testDeviceID, claim: v})
+			assert.Equal(t, err, ErrScopeClaim, claim)
+		}
+	}
+}
+
+func TestPolicyAuthorize(t *testing.T) {
+
+	p := &Policy{Scopes: []AccessScope{
+		{Devices: []string{"*"}, URIs: []string{"/greeter"}, Methods: []string{"copost"}},
+		{Devices: []string{testDeviceID}},
+	}}
+	assert.NilError(t, p.authorize("cfa09baa-0000-0000-0000-000000000000", "copost", "/greeter"))
+	assert.NilError(t, p.authorize(testDeviceID, "obget", "/printer"))
+	assert.Assert(t, p.authorize("cfa09baa-0000-0000-0000-000000000000", "obget", "/greeter") != nil)
+
+	empty := &Policy{}
+	assert.Equal(t, empty.authorize(testDeviceID, "copost", "/greeter"), ErrForbiddenDevice)
+}
+
+func TestServeForbidden(t *testing.T) {
+
+	h := &rtioHTTPHandler{policy: &Policy{Scopes: []AccessScope{{Devices: []string{"cfa09baa-*"}}}}}
+	w := httptest.NewRecorder()
+	body := `{"method":"copost","uri":"/greeter","id":1,"data":"aGVsbG8="}`
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/dfa09baa-4913-4ad7-a936-3e26f9671b10", strings.NewReader(body)))
+	assert.Equal(t, w.Code, http.StatusForbidden)
+	resp := &RTIOResp{}
+	assert.NilError(t, json.Unmarshal(w.Body.Bytes(), resp))
+	assert.Equal(t, resp.Code, RTIOCodeForbidden)
+	assert.Equal(t, resp.ID, uint32(1))
+}
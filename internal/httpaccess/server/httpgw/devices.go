@@ -0,0 +1,215 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	RTIODevicesPath            = "/devices"
+	RTIODeviceListLimitDefault = 100
+)
+
+type RTIODeviceStatus struct {
+	DeviceID    string `json:"deviceid"`
+	Online      bool   `json:"online"`
+	RemoteAddr  string `json:"remoteaddr,omitempty"`
+	BodyCapSize uint32 `json:"bodycapsize,omitempty"`
+	ConnectTime int64  `json:"connecttime,omitempty"` // unix seconds
+}
+
+type RTIODeviceStatusResp struct {
+	Code   string            `json:"code"`
+	Device *RTIODeviceStatus `json:"device,omitempty"`
+}
+
+type RTIODeviceListResp struct {
+	Code    string              `json:"code"`
+	Devices []*RTIODeviceStatus `json:"devices"`
+}
+
+func isDevicesPath(path string) bool {
+	return path == RTIODevicesPath || strings.HasPrefix(path, RTIODevicesPath+"/")
+}
+
+func (a *AccessScope) allowDevice(deviceID string) bool {
+	return matchAny(a.Devices, deviceID)
+}
+
+func (p *Policy) allowDevice(deviceID string) bool {
+	for i := range p.Scopes {
+		if p.Scopes[i].allowDevice(deviceID) {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceFilters are the device patterns of the scope and of the policy, for
+// the hub to filter the devices listed before the limit.
+func (s *rtioHTTPHandler) deviceFilters(scope *AccessScope) []*devicehub.DevicePatterns {
+	var filters []*devicehub.DevicePatterns
+	if scope != nil {
+		filters = append(filters, &devicehub.DevicePatterns{Patterns: scope.Devices})
+	}
+	if s.policy != nil {
+		f := &devicehub.DevicePatterns{}
+		for i := range s.policy.Scopes {
+			f.Patterns = append(f.Patterns, s.policy.Scopes[i].Devices...)
+		}
+		filters = append(filters, f)
+	}
+	return filters
+}
+
+// authorizeDevice checks device only, for read-only device routes.
+func (s *rtioHTTPHandler) authorizeDevice(scope *AccessScope, deviceID string) bool {
+	if scope != nil && !scope.allowDevice(deviceID) {
+		return false
+	}
+	if s.policy != nil && !s.policy.allowDevice(deviceID) {
+		return false
+	}
+	return true
+}
+
+// deviceRespStatus is the HTTP status of the response code, hub errors are
+// INTERNAL_SERVER_ERROR and 500.
+func deviceRespStatus(code string) int {
+	switch code {
+	case RTIOCodeOk:
+		return http.StatusOK
+	case RTIOCodeBadRequest:
+		return http.StatusBadRequest
+	case RTIOCodeForbidden:
+		return http.StatusForbidden
+	case RTIOCodeNotFound:
+		return http.StatusNotFound
+	case RTIOCodeTooManyRequests:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// serveDevices serves 'GET /devices?prefix=&limit=' and 'GET /devices/{id}/status'.
+func (s *rtioHTTPHandler) serveDevices(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	scope, _, err := s.authenticate(r)
+	if err != nil {
+		if err == ErrAPIKeyRateLimited {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		} else {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		}
+		log.Warn().Err(err).Msg("handle devices reqest, Failed to authenticate")
+		return
+	}
+
+	seg := strings.Split(strings.TrimPrefix(r.URL.Path, RTIODevicesPath), "/")
+	switch {
+	case len(seg) == 1 && seg[0] == "":
+		s.serveDeviceList(w, r, scope)
+	case len(seg) == 3 && seg[2] == "status" &&
+		len(seg[1]) >= RTIODeviceIDLenMin && len(seg[1]) <= RTIODeviceIDLenMax:
+		s.serveDeviceStatus(w, r, scope, seg[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *rtioHTTPHandler) serveDeviceStatus(w http.ResponseWriter, r *http.Request, scope *AccessScope, deviceID string) {
+
+	resp := &RTIODeviceStatusResp{Code: RTIOCodeInternalServerError}
+	if !s.authorizeDevice(scope, deviceID) {
+		log.Warn().Str("deviceid", deviceID).Msg("Failed to authorize device status")
+		resp.Code = RTIOCodeForbidden
+		writeJSON(w, deviceRespStatus(resp.Code), resp)
+		return
+	}
+
+	queryResp, err := s.hub.DeviceQuery(r.Context(), &devicehub.DeviceQueryReq{DeviceId: deviceID})
+	if err != nil {
+		log.Error().Err(err).Msg("Fail to query device, device hub error")
+		writeJSON(w, deviceRespStatus(resp.Code), resp)
+		return
+	}
+	resp.Code = RTIOCodeOk
+	resp.Device = &RTIODeviceStatus{DeviceID: deviceID}
+	if queryResp.Code == devicehub.Code_CODE_OK {
+		resp.Device.Online = true
+		resp.Device.RemoteAddr = queryResp.RemoteAddr
+		resp.Device.BodyCapSize = queryResp.BodyCapSize
+		resp.Device.ConnectTime = queryResp.ConnectTime
+	}
+	writeJSON(w, deviceRespStatus(resp.Code), resp)
+}
+
+func (s *rtioHTTPHandler) serveDeviceList(w http.ResponseWriter, r *http.Request, scope *AccessScope) {
+
+	resp := &RTIODeviceListResp{Code: RTIOCodeInternalServerError, Devices: []*RTIODeviceStatus{}}
+	query := r.URL.Query()
+	limit := RTIODeviceListLimitDefault
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			resp.Code = RTIOCodeBadRequest
+			writeJSON(w, deviceRespStatus(resp.Code), resp)
+			return
+		}
+		limit = n
+	}
+
+	listResp, err := s.hub.DeviceList(r.Context(), &devicehub.DeviceListReq{
+		Prefix:  query.Get("prefix"),
+		Limit:   uint32(limit),
+		Filters: s.deviceFilters(scope),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Fail to list devices, device hub error")
+		writeJSON(w, deviceRespStatus(resp.Code), resp)
+		return
+	}
+	resp.Code = transHubCode(listResp.Code)
+	for _, d := range listResp.Devices {
+		if !s.authorizeDevice(scope, d.DeviceId) {
+			continue
+		}
+		resp.Devices = append(resp.Devices, &RTIODeviceStatus{
+			DeviceID:    d.DeviceId,
+			Online:      true,
+			RemoteAddr:  d.RemoteAddr,
+			BodyCapSize: d.BodyCapSize,
+			ConnectTime: d.ConnectTime,
+		})
+	}
+	writeJSON(w, deviceRespStatus(resp.Code), resp)
+}
@@ -0,0 +1,138 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"google.golang.org/grpc"
+	"gotest.tools/assert"
+)
+
+type fakeHub struct {
+	devicehub.AccessServiceClient
+	mu      sync.Mutex // devices and filters, hubs are called concurrently
+	devices []*devicehub.DeviceInfo
+	filters []*devicehub.DevicePatterns
+	err     error // returned by DeviceList if set
+}
+
+func (h *fakeHub) online(deviceID string) (*devicehub.DeviceInfo, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, d := range h.devices {
+		if d.DeviceId == deviceID {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+func (h *fakeHub) DeviceQuery(ctx context.Context, in *devicehub.DeviceQueryReq, opts ...grpc.CallOption) (*devicehub.DeviceQueryResp, error) {
+	if d, ok := h.online(in.DeviceId); ok {
+		return &devicehub.DeviceQueryResp{Id: in.Id, Code: devicehub.Code_CODE_OK,
+			BodyCapSize: d.BodyCapSize, RemoteAddr: d.RemoteAddr, ConnectTime: d.ConnectTime}, nil
+	}
+	return &devicehub.DeviceQueryResp{Id: in.Id, Code: devicehub.Code_CODE_NOT_FOUNT}, nil
+}
+
+func (h *fakeHub) DeviceList(ctx context.Context, in *devicehub.DeviceListReq, opts ...grpc.CallOption) (*devicehub.DeviceListResp, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.filters = in.Filters
+	if h.err != nil {
+		return nil, h.err
+	}
+	return &devicehub.DeviceListResp{Id: in.Id, Code: devicehub.Code_CODE_OK, Devices: h.devices}, nil
+}
+
+func TestServeDevices(t *testing.T) {
+
+	hub := &fakeHub{devices: []*devicehub.DeviceInfo{
+		{DeviceId: testDeviceID, BodyCapSize: 512, RemoteAddr: "10.0.0.1:5000", ConnectTime: 1700000000},
+		{DeviceId: "dfa09baa-4913-4ad7-a936-3e26f9671b10", BodyCapSize: 512, RemoteAddr: "10.0.0.2:5000", ConnectTime: 1700000001},
+	}}
+	h := &rtioHTTPHandler{hub: hub, policy: &Policy{Scopes: []AccessScope{{Devices: []string{"cfa09baa-*"}}}}}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/devices/"+testDeviceID+"/status", nil))
+	status := &RTIODeviceStatusResp{}
+	assert.NilError(t, json.Unmarshal(w.Body.Bytes(), status))
+	assert.Equal(t, status.Code, RTIOCodeOk)
+	assert.Equal(t, status.Device.Online, true)
+	assert.Equal(t, status.Device.ConnectTime, int64(1700000000))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/devices/cfa09baa-4913-4ad7-a936-3e26f9671b11/status", nil))
+	status = &RTIODeviceStatusResp{}
+	assert.NilError(t, json.Unmarshal(w.Body.Bytes(), status))
+	assert.Equal(t, status.Code, RTIOCodeOk)
+	assert.Equal(t, status.Device.Online, false)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/devices/dfa09baa-4913-4ad7-a936-3e26f9671b10/status", nil))
+	assert.Equal(t, w.Code, http.StatusForbidden)
+	status = &RTIODeviceStatusResp{}
+	assert.NilError(t, json.Unmarshal(w.Body.Bytes(), status))
+	assert.Equal(t, status.Code, RTIOCodeForbidden)
+
+	// out of policy devices are filtered
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/devices?prefix=&limit=10", nil))
+	list := &RTIODeviceListResp{}
+	assert.NilError(t, json.Unmarshal(w.Body.Bytes(), list))
+	assert.Equal(t, list.Code, RTIOCodeOk)
+	assert.Equal(t, len(list.Devices), 1)
+	assert.Equal(t, list.Devices[0].DeviceID, testDeviceID)
+	// passed to the hub to filter before the limit
+	assert.Equal(t, len(hub.filters), 1)
+	assert.DeepEqual(t, hub.filters[0].Patterns, []string{"cfa09baa-*"})
+
+	// the HTTP status follows the code
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/devices?limit=-1", nil))
+	assert.Equal(t, w.Code, http.StatusBadRequest)
+	list = &RTIODeviceListResp{}
+	assert.NilError(t, json.Unmarshal(w.Body.Bytes(), list))
+	assert.Equal(t, list.Code, RTIOCodeBadRequest)
+
+	hub.err = errors.New("hub gone")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/devices", nil))
+	assert.Equal(t, w.Code, http.StatusInternalServerError)
+	list = &RTIODeviceListResp{}
+	assert.NilError(t, json.Unmarshal(w.Body.Bytes(), list))
+	assert.Equal(t, list.Code, RTIOCodeInternalServerError)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/devices/"+testDeviceID, nil))
+	assert.Equal(t, w.Code, http.StatusNotFound)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/devices", nil))
+	assert.Equal(t, w.Code, http.StatusMethodNotAllowed)
+}
@@ -20,27 +20,34 @@ package httpgw
 
 import (
 	"context"
-	"crypto"
+	"crypto/sha256"
 	"crypto/tls"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"sync"
 
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/internal/upgrade"
 	"github.com/mkrainbow/rtio/pkg/config"
+	"github.com/mkrainbow/rtio/pkg/drain"
+	"github.com/mkrainbow/rtio/pkg/health"
 	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -60,10 +67,12 @@ var (
 	ErrJWTPubKeyEmpty      = errors.New("JWT keyfile is empty")
 	ErrJWTPubKeyLoadFailed = errors.New("JWT keyfile is empty")
 	ErrJWTTokenInvalid     = errors.New("JWT token invalid") // min token length, 36+124+0(ignore sign string)
+
+	ErrHubNotConnected = errors.New("ErrHubNotConnected")
 )
 
 const (
-	RTIOHttpBodyLenMax         = 864 // URILenMax(128) + Base64DataLenMax  + other(64) = 832
+	RTIOHttpBodyLenMax         = 896 // URILenMax(128) + Base64DataLenMax  + other(96) = 896
 	RTIODeviceIDLenMin         = 30
 	RTIODeviceIDLenMax         = 40
 	RTIODeviceURILenMin        = 4
@@ -86,13 +95,16 @@ const (
 	RTIOCodeTooManyRequests     = "TOO_MANY_REQUESTS"
 	RTIOCodeTooManyObservers    = "TOO_MANY_OBSERVERS"
 	RTIOCodeRequestTimeout      = "REQUEST_TIMEOUT"
+	RTIOCodeForbidden           = "FORBIDDEN"
 )
 
 type RTIOReq struct {
-	ID     uint32 `json:"id"`
-	Method string `json:"method"`
-	URI    string `json:"uri"`
-	Data   string `json:"data"`
+	ID      uint32 `json:"id"`
+	Method  string `json:"method"`
+	URI     string `json:"uri"`
+	Data    string `json:"data"`
+	Timeout uint32 `json:"timeout,omitempty"` // milliseconds, option
+	Sealed  bool   `json:"sealed,omitempty"`  // data is an envelope, option
 }
 
 type RTIOResp struct {
@@ -103,8 +115,14 @@ type RTIOResp struct {
 }
 
 type rtioHTTPHandler struct {
-	hub       devicehub.AccessServiceClient
-	jwtPubKey crypto.PublicKey
+	hub     devicehub.AccessServiceClient
+	jwtKeys *jwtKeySet
+	apiKeys *APIKeyStore
+	policy  *Policy
+	issuer  *jwtIssuer
+
+	revocations  *RevocationList
+	introspector *introspector
 }
 
 func transHubCode(code devicehub.Code) string {
@@ -134,20 +152,13 @@ func transHubCode(code devicehub.Code) string {
 		return RTIOCodeTooManyObservers
 	case devicehub.Code_CODE_REQUEST_TIMEOUT:
 		return RTIOCodeRequestTimeout
+	case devicehub.Code_CODE_FORBIDDEN:
+		return RTIOCodeForbidden
 	default:
 		return RTIOCodeInternalServerError
 	}
 }
 
-func loadPubKey(keyfile string) (crypto.PublicKey, error) {
-	key, err := os.ReadFile(keyfile)
-	if err != nil {
-		return nil, err
-	}
-
-	return jwt.ParseEdPublicKeyFromPEM(key)
-}
-
 func getBinaryData(req *RTIOReq) ([]byte, error) {
 
 	data, err := base64.StdEncoding.DecodeString(req.Data)
@@ -239,57 +250,145 @@ func httpWriteRTIORespStream(w http.ResponseWriter, f http.Flusher, resp *RTIORe
 	f.Flush()
 	log.Debug().Int("datalen", len).Msg("Write RTIOResp with Stream")
 }
-func (s *rtioHTTPHandler) validateJWT(token string) (string, error) {
+func (s *rtioHTTPHandler) validateJWT(token string) (*AccessScope, string, error) {
 	tokenLen := len(token)
 	if tokenLen < RTIOJWTTokenLenMin {
 		log.Err(ErrJWTTokenInvalid).Int("tokenlen", tokenLen).Msg("Failed to validate JWT")
-		return "", ErrJWTTokenInvalid
+		return nil, "", ErrJWTTokenInvalid
 	}
 	log.Debug().Str("token", "*"+token[tokenLen-8:]).Msg("Failed to validate JWT")
 
-	t, err := jwt.Parse(string(token), func(t *jwt.Token) (interface{}, error) {
-		return s.jwtPubKey, nil
-	}, jwt.WithValidMethods([]string{"EdDSA"}), // only suppored ed25519
-		jwt.WithLeeway(time.Duration(10)*time.Second)) // with 10s leeway
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"EdDSA", "RS256", "ES256"}),
+		jwt.WithLeeway(time.Duration(config.IntKV.GetWithDefault("jwt.leeway", 10)) * time.Second),
+	}
+	if iss := config.StringKV.GetWithDefault("jwt.issuer", ""); iss != "" {
+		opts = append(opts, jwt.WithIssuer(iss))
+	}
+	if aud := config.StringKV.GetWithDefault("jwt.audience", ""); aud != "" {
+		opts = append(opts, jwt.WithAudience(aud))
+	}
+	t, err := jwt.Parse(string(token), s.jwtKeys.keyFunc, opts...)
 
 	if err != nil {
 		log.Err(err).Msg("Failed to validate JWT")
-		return "", err
+		return nil, "", err
 	}
 
-	sub, err := t.Claims.GetSubject()
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok {
+		log.Err(ErrJWTTokenInvalid).Msg("Failed to validate JWT, claims type")
+		return nil, "", ErrJWTTokenInvalid
+	}
+	if err := s.checkRevoked(token, claims); err != nil {
+		log.Warn().Err(err).Msg("Failed to validate JWT")
+		return nil, "", err
+	}
+	scope, err := scopeFromClaims(claims)
 	if err != nil {
 		log.Err(err).Msg("Failed to validate JWT")
-		return "", err
+		return nil, "", err
+	}
+	caller := ""
+	if sub, err := claims.GetSubject(); err == nil {
+		caller = "jwt:" + sub
+	}
+	return scope, caller, nil
+}
+
+// checkRevoked checks a valid token with the revocation list, then with the
+// introspection endpoint if configured.
+func (s *rtioHTTPHandler) checkRevoked(token string, claims jwt.MapClaims) error {
+	if s.revocations != nil {
+		if err := s.revocations.check(claims); err != nil {
+			metricJWTRevoked.Inc()
+			return err
+		}
+	}
+	if s.introspector != nil {
+		var exp time.Time
+		if e, err := claims.GetExpirationTime(); err == nil && e != nil {
+			exp = e.Time
+		}
+		return s.introspector.check(token, exp)
 	}
-	return sub, nil
+	return nil
 }
 
-func (s *rtioHTTPHandler) validateToken(r *http.Request) (string, error) {
+func (s *rtioHTTPHandler) validateToken(r *http.Request) (*AccessScope, string, error) {
 
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return "", ErrHTTPMissingAuthorizationHeader
+		return nil, "", ErrHTTPMissingAuthorizationHeader
 	}
 
 	const prefix = "Bearer "
 	if len(authHeader) < len(prefix) || authHeader[:len(prefix)] != prefix {
-		return "", ErrHTTPInvalidAuthorizationHeader
+		return nil, "", ErrHTTPInvalidAuthorizationHeader
 	}
 	tokenString := authHeader[len(prefix):]
 
-	sub, err := s.validateJWT(tokenString)
+	scope, caller, err := s.validateJWT(tokenString)
 	if err != nil {
-		return "", ErrHTTPInvalidJWT
+		return nil, "", ErrHTTPInvalidJWT
 	}
-	return sub, nil
+	return scope, caller, nil
 }
+
+// authenticate gets the caller scope by API key if present, otherwise by JWT,
+// scope is nil when neither enabled. caller is "jwt:sub" or "apikey:id", for
+// the audit log.
+func (s *rtioHTTPHandler) authenticate(r *http.Request) (scope *AccessScope, caller string, err error) {
+	if s.apiKeys != nil {
+		if key := httpGetAPIKey(r); key != "" {
+			return s.apiKeys.Authenticate(key)
+		}
+	}
+	if config.BoolKV.GetWithDefault("enable.jwt", false) {
+		return s.validateToken(r)
+	}
+	if s.apiKeys != nil {
+		return nil, "", ErrHTTPMissingAuthorizationHeader
+	}
+	return nil, "", nil
+}
+
+// authorize checks request with the JWT scope (if JWT enabled) and the policy (if configured).
+func (s *rtioHTTPHandler) authorize(scope *AccessScope, deviceID string, rtioReq *RTIOReq) error {
+	if scope != nil {
+		if err := scope.authorize(deviceID, rtioReq.Method, rtioReq.URI); err != nil {
+			return err
+		}
+	}
+	if s.policy != nil {
+		if err := s.policy.authorize(deviceID, rtioReq.Method, rtioReq.URI); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// idempotencyKey scopes the Idempotency-Key header, or else the request id,
+// by the http caller, since the hub sees the gateway as the caller. Empty if
+// neither is given.
+func idempotencyKey(caller, key string, id uint32) string {
+	kind := "k"
+	if key == "" {
+		if id == 0 {
+			return ""
+		}
+		kind, key = "i", strconv.FormatUint(uint64(id), 10)
+	}
+	sum := sha256.Sum256([]byte(caller + "\x00" + kind + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
 func (s *rtioHTTPHandler) serveCoPost(w http.ResponseWriter, r *http.Request,
-	deviceID string, rtioReq *RTIOReq, rtioResp *RTIOResp) {
+	deviceID string, rtioReq *RTIOReq, rtioResp *RTIOResp, caller string) {
 
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, Idempotency-Key")
 
 	data, err := getBinaryData(rtioReq)
 	if err != nil {
@@ -300,13 +399,19 @@ func (s *rtioHTTPHandler) serveCoPost(w http.ResponseWriter, r *http.Request,
 	}
 
 	req := &devicehub.CoReq{
-		DeviceId: deviceID,
-		Uri:      rtioReq.URI,
-		Id:       uint32(rtioReq.ID),
-		Data:     data,
+		DeviceId:  deviceID,
+		Uri:       rtioReq.URI,
+		Id:        uint32(rtioReq.ID),
+		Data:      data,
+		TimeoutMs: rtioReq.Timeout,
+		Sealed:    rtioReq.Sealed,
 	}
 
-	resp, err := s.hub.CoPost(r.Context(), req)
+	ctx := r.Context()
+	if key := idempotencyKey(caller, r.Header.Get("Idempotency-Key"), req.Id); key != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "idempotency-key", key)
+	}
+	resp, err := s.hub.CoPost(ctx, req)
 	if err != nil {
 		rtioResp.Code = RTIOCodeInternalServerError
 		log.Error().Err(err).Msg("Fail to copost, device hub error")
@@ -321,7 +426,7 @@ func (s *rtioHTTPHandler) serveCoPost(w http.ResponseWriter, r *http.Request,
 }
 
 func (s *rtioHTTPHandler) serveObGet(w http.ResponseWriter, r *http.Request,
-	deviceID string, rtioReq *RTIOReq, rtioResp *RTIOResp) {
+	deviceID string, rtioReq *RTIOReq, rtioResp *RTIOResp, entry *auditEntry) {
 
 	f, ok := w.(http.Flusher)
 	if !ok {
@@ -332,7 +437,7 @@ func (s *rtioHTTPHandler) serveObGet(w http.ResponseWriter, r *http.Request,
 	w.Header().Set("Transfer-Encoding", "chunked")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, Idempotency-Key")
 
 	data, err := getBinaryData(rtioReq)
 	if err != nil {
@@ -343,10 +448,12 @@ func (s *rtioHTTPHandler) serveObGet(w http.ResponseWriter, r *http.Request,
 	}
 
 	req := &devicehub.ObGetReq{
-		DeviceId: deviceID,
-		Uri:      rtioReq.URI,
-		Id:       uint32(rtioReq.ID),
-		Data:     data,
+		DeviceId:  deviceID,
+		Uri:       rtioReq.URI,
+		Id:        uint32(rtioReq.ID),
+		Data:      data,
+		TimeoutMs: rtioReq.Timeout,
+		Sealed:    rtioReq.Sealed,
 	}
 
 	respStream, err := s.hub.ObGet(r.Context(), req)
@@ -377,6 +484,7 @@ func (s *rtioHTTPHandler) serveObGet(w http.ResponseWriter, r *http.Request,
 		rtioResp.Code = transHubCode(resp.Code)
 		rtioResp.FrameID = resp.Fid
 		rtioResp.Data = base64.StdEncoding.EncodeToString(resp.Data)
+		entry.record(rtioResp.Code)
 		httpWriteRTIORespStream(w, f, rtioResp)
 	}
 }
@@ -384,6 +492,27 @@ func (s *rtioHTTPHandler) serveObGet(w http.ResponseWriter, r *http.Request,
 func (s *rtioHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	log.Debug().Msg("handle rtio http reqest")
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	w = rec
+	var rtioReq *RTIOReq
+	var rtioResp *RTIOResp
+	var entry *auditEntry
+	defer func() {
+		observeHTTPRequest(r, rtioReq, rtioResp, rec.status, start)
+		if rtioResp != nil {
+			entry.record(rtioResp.Code)
+		}
+	}()
+
+	if isDevicesPath(r.URL.Path) {
+		s.serveDevices(w, r)
+		return
+	}
+	if s.issuer != nil && isIssuerPath(r.URL.Path) {
+		s.issuer.ServeHTTP(w, r)
+		return
+	}
 	deviceID, err := httpGetDeviceID(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
@@ -391,21 +520,18 @@ func (s *rtioHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if config.BoolKV.GetWithDefault("enable.jwt", false) {
-		subject, err := s.validateToken(r)
-		if err != nil {
+	scope, caller, err := s.authenticate(r)
+	if err != nil {
+		if err == ErrAPIKeyRateLimited {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		} else {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
-			log.Warn().Err(err).Msg("handle rtio http reqest, Failed to verify token")
-			return
-		}
-		if subject != deviceID {
-			http.Error(w, "JWT subject invalid", http.StatusUnauthorized)
-			log.Warn().Str("subject", subject).Str("deviceid", deviceID).Err(err).Msg("handle rtio http reqest, subject not match")
-			return
 		}
+		log.Warn().Err(err).Msg("handle rtio http reqest, Failed to authenticate")
+		return
 	}
 
-	rtioReq, err := httpGetRTIOReq(r)
+	rtioReq, err = httpGetRTIOReq(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		log.Warn().Err(err).Msg("Failed to get RTIOReq")
@@ -413,10 +539,11 @@ func (s *rtioHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Info().Str("deviceID", deviceID).Uint32("id", rtioReq.ID).Msg("handle rtio http reqest")
-	rtioResp := &RTIOResp{
+	rtioResp = &RTIOResp{
 		ID:   rtioReq.ID,
 		Code: RTIOCodeInternalServerError,
 	}
+	entry = &auditEntry{caller: caller, deviceID: deviceID, req: rtioReq, start: start}
 
 	err = verifyRTIOReq(rtioReq)
 	if err != nil {
@@ -430,65 +557,118 @@ func (s *rtioHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = s.authorize(scope, deviceID, rtioReq)
+	if err != nil {
+		rtioResp.Code = RTIOCodeForbidden
+		log.Warn().Err(err).Str("deviceid", deviceID).Str("method", rtioReq.Method).Str("uri", rtioReq.URI).Msg("Failed to authorize RTIOReq")
+		w.WriteHeader(http.StatusForbidden)
+		httpWriteRTIOResp(w, rtioResp)
+		return
+	}
+
 	if rtioReq.Method == "copost" {
-		s.serveCoPost(w, r, deviceID, rtioReq, rtioResp)
+		s.serveCoPost(w, r, deviceID, rtioReq, rtioResp, caller)
 	} else if rtioReq.Method == "obget" {
-		s.serveObGet(w, r, deviceID, rtioReq, rtioResp)
+		s.serveObGet(w, r, deviceID, rtioReq, rtioResp, entry)
 	}
 
 }
 
-func InitHttpsGateway(ctx context.Context, rpcAddr, gwAddr string,
-	wait *sync.WaitGroup,
-	certFile, keyFile string) error {
-
-	conn, err := grpc.NewClient(
-		rpcAddr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
-
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to dial server")
-		return err
+// hubConnCheck is the readiness check of the gRPC connection to the device hub.
+func hubConnCheck(conn *grpc.ClientConn) health.CheckFunc {
+	conn.Connect()
+	return func() error {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if state == connectivity.Idle {
+			conn.Connect()
+		}
+		return fmt.Errorf("%w, state %s", ErrHubNotConnected, state)
 	}
-	log.Info().Str("rpcaddr", rpcAddr).Msg("connected")
+}
 
+// newHandler creates the handler calling hub, with the auth enabled by config.
+func newHandler(ctx context.Context, hub devicehub.AccessServiceClient) (*rtioHTTPHandler, error) {
+	var err error
 	rtioHandler := &rtioHTTPHandler{
-		hub: devicehub.NewAccessServiceClient(conn),
+		hub: hub,
 	}
 
+	if config.BoolKV.GetWithDefault("enable.apikey", false) {
+		rtioHandler.apiKeys, err = LoadAPIKeyStore(config.StringKV.GetWithDefault("apikey.store", ""))
+		if err != nil {
+			return nil, err
+		}
+		go rtioHandler.apiKeys.ReloadLoop(ctx, 5*time.Second)
+	}
+	var issuerKeys *IssuerKeyStore
+	if config.BoolKV.GetWithDefault("enable.jwtissuer", false) {
+		rtioHandler.issuer, err = newJWTIssuer(ctx, rtioHandler.apiKeys)
+		if err != nil {
+			return nil, err
+		}
+		issuerKeys = rtioHandler.issuer.keys
+	}
 	if config.BoolKV.GetWithDefault("enable.jwt", false) {
-		keyPem := config.StringKV.GetWithDefault("jwt.ed25519", "")
-		if keyPem == "" {
-			log.Error().Err(ErrJWTPubKeyEmpty).Msg("jwt ed25519 public key file empty")
-			return ErrJWTPubKeyEmpty
+		rtioHandler.jwtKeys, err = initJWTKeys(ctx, issuerKeys)
+		if err != nil {
+			return nil, err
+		}
+		rtioHandler.revocations, err = initRevocations(ctx)
+		if err != nil {
+			return nil, err
 		}
-		rtioHandler.jwtPubKey, err = loadPubKey(keyPem)
+		if url := config.StringKV.GetWithDefault("jwt.introspection.url", ""); url != "" {
+			rtioHandler.introspector = newIntrospector(url,
+				config.StringKV.GetWithDefault("jwt.introspection.clientid", ""),
+				config.StringKV.GetWithDefault("jwt.introspection.clientsecret", ""),
+				time.Duration(config.IntKV.GetWithDefault("jwt.introspection.timeout", 5000))*time.Millisecond,
+				time.Duration(config.IntKV.GetWithDefault("jwt.introspection.cache.ttl", 60))*time.Second)
+		}
+	}
+	if policyFile := config.StringKV.GetWithDefault("httpaccess.policy", ""); policyFile != "" {
+		rtioHandler.policy, err = loadPolicy(policyFile)
 		if err != nil {
-			log.Error().Err(ErrJWTPubKeyLoadFailed).Msg("jwt ed25519 public key load failed")
-			return ErrJWTPubKeyLoadFailed
+			return nil, err
 		}
 	}
+	return rtioHandler, nil
+}
 
-	if certFile == "" || keyFile == "" {
-		log.Error().Msg("TLS certfile or keyfile is empty")
-		return errors.New("TLS certfile or keyfile is empty")
+// serve serves the handler on gwAddr, with TLS if certFile and keyFile not empty.
+func serve(ctx context.Context, rtioHandler *rtioHTTPHandler, gwAddr string,
+	wait *sync.WaitGroup, certFile, keyFile string) error {
+
+	gwServer := &http.Server{
+		Addr:    gwAddr,
+		Handler: rtioHandler,
 	}
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to load key pair")
-		return errors.New("Failed to load key pair")
+	withTLS := certFile != "" && keyFile != ""
+	if withTLS {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load key pair")
+			return errors.New("Failed to load key pair")
+		}
+		gwServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
 	}
-	gwServer := &http.Server{
-		Addr:      gwAddr,
-		Handler:   rtioHandler,
-		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	listener, err := upgrade.Listen("gateway", gwAddr)
+	if err != nil {
+		log.Error().Err(err).Msg("gateway listen failed")
+		return err
 	}
-	log.Info().Str("gwaddr", gwAddr).Msg("gateway started with TLS")
+	log.Info().Str("gwaddr", gwAddr).Bool("tls", withTLS).Msg("gateway started")
 	wait.Add(1)
 	go func() {
 		defer wait.Done()
-		err = gwServer.ListenAndServeTLS(certFile, keyFile)
+		var err error
+		if withTLS {
+			err = gwServer.ServeTLS(listener, certFile, keyFile)
+		} else {
+			err = gwServer.Serve(listener)
+		}
 		if err != nil {
 			if err == http.ErrServerClosed {
 				log.Info().Msg("gateway http closed")
@@ -503,63 +683,66 @@ func InitHttpsGateway(ctx context.Context, rpcAddr, gwAddr string,
 		log.Info().Msg("gateway ctx down")
 		gwServer.Shutdown(ctx)
 	}()
+	// stop accepting and wait for requests in flight
+	drain.Register("gateway", func(ctx context.Context) { gwServer.Shutdown(ctx) })
 
 	return nil
 }
 
-func InitHttpGateway(ctx context.Context, rpcAddr, gwAddr string, wait *sync.WaitGroup) error {
+// initGateway serves the gateway with the hub in the same process.
+func initGateway(ctx context.Context, rpcAddr, gwAddr string,
+	wait *sync.WaitGroup, certFile, keyFile string) error {
 
-	conn, err := grpc.NewClient(
-		rpcAddr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+	dialOpts, err := rpcauth.InternalDialOptions()
+	if err != nil {
+		return err
+	}
+	conn, err := grpc.NewClient(rpcAddr, dialOpts...)
 
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to dial server")
 		return err
 	}
 	log.Info().Str("rpcaddr", rpcAddr).Msg("connected")
+	health.Register("gateway.hubconn", hubConnCheck(conn))
 
-	rtioHandler := &rtioHTTPHandler{
-		hub: devicehub.NewAccessServiceClient(conn),
+	rtioHandler, err := newHandler(ctx, devicehub.NewAccessServiceClient(conn))
+	if err != nil {
+		return err
 	}
+	return serve(ctx, rtioHandler, gwAddr, wait, certFile, keyFile)
+}
 
-	if config.BoolKV.GetWithDefault("enable.jwt", false) {
-		keyPem := config.StringKV.GetWithDefault("jwt.ed25519", "")
-		if keyPem == "" {
-			log.Error().Err(ErrJWTPubKeyEmpty).Msg("jwt ed25519 public key file empty")
-			return ErrJWTPubKeyEmpty
-		}
-		rtioHandler.jwtPubKey, err = loadPubKey(keyPem)
-		if err != nil {
-			log.Error().Err(ErrJWTPubKeyLoadFailed).Msg("jwt ed25519 public key load failed")
-			return ErrJWTPubKeyLoadFailed
-		}
-	}
+func InitHttpsGateway(ctx context.Context, rpcAddr, gwAddr string,
+	wait *sync.WaitGroup,
+	certFile, keyFile string) error {
 
-	gwServer := &http.Server{
-		Addr:    gwAddr,
-		Handler: rtioHandler,
+	if certFile == "" || keyFile == "" {
+		log.Error().Msg("TLS certfile or keyfile is empty")
+		return errors.New("TLS certfile or keyfile is empty")
 	}
-	log.Info().Str("gwaddr", gwAddr).Msg("gateway started")
-	wait.Add(1)
-	go func() {
-		defer wait.Done()
-		err = gwServer.ListenAndServe()
-		if err != nil {
-			if err == http.ErrServerClosed {
-				log.Info().Msg("gateway http closed")
-				return
-			}
-			log.Error().Err(err).Msg("gateway serve failed")
-		}
-	}()
+	return initGateway(ctx, rpcAddr, gwAddr, wait, certFile, keyFile)
+}
 
-	go func() {
-		<-ctx.Done()
-		log.Info().Msg("gateway ctx down")
-		gwServer.Shutdown(ctx)
-	}()
+func InitHttpGateway(ctx context.Context, rpcAddr, gwAddr string, wait *sync.WaitGroup) error {
+	return initGateway(ctx, rpcAddr, gwAddr, wait, "", "")
+}
 
-	return nil
+// InitStandaloneGateway serves the gateway apart from the hubs, calls are
+// routed to the hub of the device. TLS is used if certFile and keyFile not empty.
+func InitStandaloneGateway(ctx context.Context, hubs HubPoolOptions, gwAddr string,
+	wait *sync.WaitGroup, certFile, keyFile string) error {
+
+	pool, err := NewHubPool(ctx, hubs)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to init hubs")
+		return err
+	}
+	health.Register("gateway.hubs", pool.check)
+
+	rtioHandler, err := newHandler(ctx, pool)
+	if err != nil {
+		return err
+	}
+	return serve(ctx, rtioHandler, gwAddr, wait, certFile, keyFile)
 }
@@ -0,0 +1,454 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/devicehub/server/cluster"
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	HubRetryMax          = 3
+	HubRetryBackoff      = 200 * time.Millisecond
+	HubOwnerTTL          = 10 * time.Second
+	HubLookupTimeout     = 2 * time.Second
+	HubDNSRefresh        = 30 * time.Second
+	HubHealthRetry       = time.Second
+	HubDeviceListTimeout = 5 * time.Second
+
+	ErrNoHub         = errors.New("ErrNoHub")
+	ErrHubsNotServed = errors.New("ErrHubsNotServed")
+)
+
+const (
+	hubHealthService = "devicehub.AccessService"
+)
+
+// HubPoolOptions are the device hubs of a standalone gateway.
+type HubPoolOptions struct {
+	Addrs   []string    // static hub rpc addresses
+	DNSName string      // host:port, resolved to hub addresses periodically
+	TLS     *tls.Config // nil for plaintext
+	Token   string      // bearer token for hubs with authentication
+}
+
+type hubEndpoint struct {
+	addr    string
+	conn    *grpc.ClientConn
+	client  devicehub.AccessServiceClient
+	serving atomic.Bool
+	cancel  context.CancelFunc
+}
+
+// watchHealth follows grpc.health.v1 of the hub, not serving when draining.
+func (h *hubEndpoint) watchHealth(ctx context.Context) {
+	client := healthpb.NewHealthClient(h.conn)
+	for {
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: hubHealthService})
+		for err == nil {
+			var resp *healthpb.HealthCheckResponse
+			if resp, err = stream.Recv(); err == nil {
+				serving := resp.Status == healthpb.HealthCheckResponse_SERVING
+				if h.serving.Swap(serving) != serving {
+					log.Info().Str("hub", h.addr).Str("status", resp.Status.String()).Msg("hub health")
+				}
+			}
+		}
+		h.serving.Store(false)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(HubHealthRetry):
+		}
+	}
+}
+
+type hubOwner struct {
+	addr   string
+	expire time.Time
+}
+
+// HubPool is the AccessService client of many hubs. Calls for a device go to
+// the hub holding its session, found by DeviceQuery and cached, and are
+// retried on another hub when the hub is draining or gone.
+type HubPool struct {
+	opts   HubPoolOptions
+	ctx    context.Context
+	lock   sync.RWMutex
+	hubs   map[string]*hubEndpoint
+	next   atomic.Uint32 // round robin
+	owners sync.Map      // device id -> hubOwner
+}
+
+func NewHubPool(ctx context.Context, opts HubPoolOptions) (*HubPool, error) {
+	p := &HubPool{
+		opts: opts,
+		ctx:  ctx,
+		hubs: make(map[string]*hubEndpoint),
+	}
+	addrs := append([]string{}, opts.Addrs...)
+	if opts.DNSName != "" {
+		resolved, err := p.resolve()
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, resolved...)
+	}
+	if err := p.update(addrs); err != nil {
+		return nil, err
+	}
+	if opts.DNSName != "" {
+		go p.refreshLoop()
+	}
+	go func() {
+		<-ctx.Done()
+		p.update(nil)
+	}()
+	return p, nil
+}
+
+func (p *HubPool) resolve() ([]string, error) {
+	host, port, err := net.SplitHostPort(p.opts.DNSName)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(p.ctx, HubLookupTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip, port))
+	}
+	return addrs, nil
+}
+
+func (p *HubPool) refreshLoop() {
+	t := time.NewTicker(HubDNSRefresh)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-t.C:
+			resolved, err := p.resolve()
+			if err != nil {
+				log.Error().Err(err).Str("name", p.opts.DNSName).Msg("resolve hubs")
+				continue
+			}
+			p.update(append(append([]string{}, p.opts.Addrs...), resolved...))
+		}
+	}
+}
+
+// update connects to new hubs and closes the removed.
+func (p *HubPool) update(addrs []string) error {
+	dialOpts := rpcauth.DialOptions(p.opts.TLS, p.opts.Token)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	keep := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		keep[addr] = true
+		if _, ok := p.hubs[addr]; ok {
+			continue
+		}
+		conn, err := grpc.NewClient(addr, dialOpts...)
+		if err != nil {
+			log.Error().Err(err).Str("hub", addr).Msg("Failed to dial hub")
+			return err
+		}
+		h := &hubEndpoint{addr: addr, conn: conn, client: devicehub.NewAccessServiceClient(conn)}
+		var ctx context.Context
+		ctx, h.cancel = context.WithCancel(p.ctx)
+		go h.watchHealth(ctx)
+		p.hubs[addr] = h
+		log.Info().Str("hub", addr).Msg("hub added")
+	}
+	for addr, h := range p.hubs {
+		if !keep[addr] {
+			h.cancel()
+			h.conn.Close()
+			delete(p.hubs, addr)
+			log.Info().Str("hub", addr).Msg("hub removed")
+		}
+	}
+	return nil
+}
+
+func (p *HubPool) list() []*hubEndpoint {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	hubs := make([]*hubEndpoint, 0, len(p.hubs))
+	for _, h := range p.hubs {
+		hubs = append(hubs, h)
+	}
+	sort.Slice(hubs, func(i, j int) bool { return hubs[i].addr < hubs[j].addr })
+	return hubs
+}
+
+func (p *HubPool) get(addr string) (*hubEndpoint, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	h, ok := p.hubs[addr]
+	return h, ok
+}
+
+// serving gets hubs serving, or all if none is known serving.
+func (p *HubPool) serving() []*hubEndpoint {
+	all := p.list()
+	hubs := make([]*hubEndpoint, 0, len(all))
+	for _, h := range all {
+		if h.serving.Load() {
+			hubs = append(hubs, h)
+		}
+	}
+	if len(hubs) == 0 {
+		return all
+	}
+	return hubs
+}
+
+// check is the readiness check, ready if any hub is serving.
+func (p *HubPool) check() error {
+	for _, h := range p.list() {
+		if h.serving.Load() {
+			return nil
+		}
+	}
+	return ErrHubsNotServed
+}
+
+// lookup asks serving hubs for the device, the call is marked forwarded so a
+// clustered hub answers for its own sessions only. The other queries are
+// canceled and waited for once a hub is found.
+func (p *HubPool) lookup(ctx context.Context, deviceID string, hubs []*hubEndpoint) (*hubEndpoint, bool) {
+	ctx, cancel := context.WithTimeout(cluster.ForwardContext(ctx), HubLookupTimeout)
+	var wait sync.WaitGroup
+	defer func() {
+		cancel()
+		wait.Wait()
+	}()
+	found := make(chan *hubEndpoint, len(hubs))
+	for _, h := range hubs {
+		wait.Add(1)
+		go func(h *hubEndpoint) {
+			defer wait.Done()
+			resp, err := h.client.DeviceQuery(ctx, &devicehub.DeviceQueryReq{DeviceId: deviceID})
+			if err == nil && resp.Code == devicehub.Code_CODE_OK {
+				found <- h
+				return
+			}
+			found <- nil
+		}(h)
+	}
+	for range hubs {
+		if h := <-found; h != nil {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+// route gets the hub for the device, known is true if the hub holds the device session.
+func (p *HubPool) route(ctx context.Context, deviceID string) (h *hubEndpoint, known bool, err error) {
+	if v, ok := p.owners.Load(deviceID); ok {
+		owner := v.(hubOwner)
+		if h, ok := p.get(owner.addr); ok && h.serving.Load() && time.Now().Before(owner.expire) {
+			return h, true, nil
+		}
+		p.owners.Delete(deviceID)
+	}
+	hubs := p.serving()
+	if len(hubs) == 0 {
+		return nil, false, status.Error(codes.Unavailable, ErrNoHub.Error())
+	}
+	if len(hubs) > 1 {
+		if h, ok := p.lookup(ctx, deviceID, hubs); ok {
+			p.owners.Store(deviceID, hubOwner{addr: h.addr, expire: time.Now().Add(HubOwnerTTL)})
+			return h, true, nil
+		}
+	}
+	return hubs[p.next.Add(1)%uint32(len(hubs))], false, nil
+}
+
+// retry forgets the owner and waits, if the call failed for the hub going away
+// or the device moving to another hub.
+func (p *HubPool) retry(ctx context.Context, attempt int, deviceID string, known bool, code devicehub.Code, err error) bool {
+	if attempt+1 >= HubRetryMax {
+		return false
+	}
+	if err != nil {
+		if status.Code(err) != codes.Unavailable {
+			return false
+		}
+	} else if !known || code != devicehub.Code_CODE_DEVICEID_OFFLINE {
+		return false
+	}
+	p.owners.Delete(deviceID)
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(HubRetryBackoff):
+		return true
+	}
+}
+
+func (p *HubPool) CoPost(ctx context.Context, in *devicehub.CoReq, opts ...grpc.CallOption) (*devicehub.CoResp, error) {
+	for attempt := 0; ; attempt++ {
+		h, known, err := p.route(ctx, in.DeviceId)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := h.client.CoPost(ctx, in, opts...)
+		var code devicehub.Code
+		if err == nil {
+			code = resp.Code
+		}
+		if !p.retry(ctx, attempt, in.DeviceId, known, code, err) {
+			return resp, err
+		}
+		log.Debug().Str("hub", h.addr).Uint32("reqid", in.Id).Int("attempt", attempt).Msg("copost retry")
+	}
+}
+
+// CoPostStream is not routed, streams are for apps calling a hub directly.
+func (p *HubPool) CoPostStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[devicehub.CoReq, devicehub.CoResp], error) {
+	return nil, status.Error(codes.Unimplemented, "CoPostStream not routed by the gateway")
+}
+
+// firstFrameStream returns the frame received to check for retry first.
+type firstFrameStream struct {
+	grpc.ServerStreamingClient[devicehub.ObGetResp]
+	first  *devicehub.ObGetResp
+	cancel context.CancelFunc
+}
+
+func (s *firstFrameStream) Recv() (*devicehub.ObGetResp, error) {
+	if first := s.first; first != nil {
+		s.first = nil
+		return first, nil
+	}
+	resp, err := s.ServerStreamingClient.Recv()
+	if err != nil {
+		s.cancel()
+	}
+	return resp, err
+}
+
+func (p *HubPool) ObGet(ctx context.Context, in *devicehub.ObGetReq, opts ...grpc.CallOption) (grpc.ServerStreamingClient[devicehub.ObGetResp], error) {
+	for attempt := 0; ; attempt++ {
+		h, known, err := p.route(ctx, in.DeviceId)
+		if err != nil {
+			return nil, err
+		}
+		streamCtx, cancel := context.WithCancel(ctx)
+		stream, err := h.client.ObGet(streamCtx, in, opts...)
+		var first *devicehub.ObGetResp
+		var code devicehub.Code
+		if err == nil {
+			if first, err = stream.Recv(); err == nil {
+				code = first.Code
+			}
+		}
+		if !p.retry(ctx, attempt, in.DeviceId, known, code, err) {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			return &firstFrameStream{ServerStreamingClient: stream, first: first, cancel: cancel}, nil
+		}
+		cancel()
+		log.Debug().Str("hub", h.addr).Uint32("reqid", in.Id).Int("attempt", attempt).Msg("obget retry")
+	}
+}
+
+func (p *HubPool) DeviceQuery(ctx context.Context, in *devicehub.DeviceQueryReq, opts ...grpc.CallOption) (*devicehub.DeviceQueryResp, error) {
+	h, _, err := p.route(ctx, in.DeviceId)
+	if err != nil {
+		return nil, err
+	}
+	return h.client.DeviceQuery(ctx, in, opts...)
+}
+
+func (p *HubPool) RotateDeviceSecret(ctx context.Context, in *devicehub.RotateDeviceSecretReq, opts ...grpc.CallOption) (*devicehub.RotateDeviceSecretResp, error) {
+	h, _, err := p.route(ctx, in.DeviceId)
+	if err != nil {
+		return nil, err
+	}
+	return h.client.RotateDeviceSecret(ctx, in, opts...)
+}
+
+// DeviceList merges devices of all serving hubs.
+func (p *HubPool) DeviceList(ctx context.Context, in *devicehub.DeviceListReq, opts ...grpc.CallOption) (*devicehub.DeviceListResp, error) {
+	hubs := p.serving()
+	if len(hubs) == 0 {
+		return nil, status.Error(codes.Unavailable, ErrNoHub.Error())
+	}
+	ctx, cancel := context.WithTimeout(cluster.ForwardContext(ctx), HubDeviceListTimeout)
+	defer cancel()
+	type result struct {
+		resp *devicehub.DeviceListResp
+		err  error
+	}
+	results := make(chan result, len(hubs))
+	for _, h := range hubs {
+		go func(h *hubEndpoint) {
+			resp, err := h.client.DeviceList(ctx, in, opts...)
+			results <- result{resp: resp, err: err}
+		}(h)
+	}
+	merged := &devicehub.DeviceListResp{Id: in.Id, Code: devicehub.Code_CODE_OK}
+	var lastErr error
+	failed := 0
+	for range hubs {
+		r := <-results
+		if r.err != nil {
+			lastErr = r.err
+			failed++
+			continue
+		}
+		merged.Devices = append(merged.Devices, r.resp.Devices...)
+	}
+	if failed == len(hubs) {
+		return nil, lastErr
+	}
+	sort.Slice(merged.Devices, func(i, j int) bool { return merged.Devices[i].DeviceId < merged.Devices[j].DeviceId })
+	if in.Limit > 0 && len(merged.Devices) > int(in.Limit) {
+		merged.Devices = merged.Devices[:in.Limit]
+	}
+	return merged, nil
+}
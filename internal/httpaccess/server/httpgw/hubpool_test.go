@@ -0,0 +1,143 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/rpcproto/devicehub"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gotest.tools/assert"
+)
+
+// poolHub is a hub of the pool, unavailable as if it is gone.
+type poolHub struct {
+	fakeHub
+	unavailable atomic.Bool
+	posts       int
+}
+
+// move moves the sessions of the hub to another, as if the devices reconnected.
+func (h *poolHub) move(to *poolHub) {
+	h.mu.Lock()
+	devices := h.devices
+	h.devices = nil
+	h.mu.Unlock()
+	to.mu.Lock()
+	to.devices = append(to.devices, devices...)
+	to.mu.Unlock()
+}
+
+func (h *poolHub) CoPost(ctx context.Context, in *devicehub.CoReq, opts ...grpc.CallOption) (*devicehub.CoResp, error) {
+	h.posts++
+	if h.unavailable.Load() {
+		return nil, status.Error(codes.Unavailable, "gone")
+	}
+	if _, ok := h.online(in.DeviceId); ok {
+		return &devicehub.CoResp{Id: in.Id, Code: devicehub.Code_CODE_OK}, nil
+	}
+	return &devicehub.CoResp{Id: in.Id, Code: devicehub.Code_CODE_DEVICEID_OFFLINE}, nil
+}
+
+func (h *poolHub) DeviceQuery(ctx context.Context, in *devicehub.DeviceQueryReq, opts ...grpc.CallOption) (*devicehub.DeviceQueryResp, error) {
+	if h.unavailable.Load() {
+		return nil, status.Error(codes.Unavailable, "gone")
+	}
+	return h.fakeHub.DeviceQuery(ctx, in, opts...)
+}
+
+func newTestPool(hubs map[string]*poolHub) *HubPool {
+	p := &HubPool{ctx: context.Background(), hubs: make(map[string]*hubEndpoint)}
+	for addr, hub := range hubs {
+		h := &hubEndpoint{addr: addr, client: hub}
+		h.serving.Store(true)
+		p.hubs[addr] = h
+	}
+	return p
+}
+
+func TestHubPoolRoute(t *testing.T) {
+	a := &poolHub{}
+	b := &poolHub{fakeHub: fakeHub{devices: []*devicehub.DeviceInfo{{DeviceId: testDeviceID}}}}
+	p := newTestPool(map[string]*poolHub{"a:17018": a, "b:17018": b})
+
+	for i := 0; i < 3; i++ {
+		resp, err := p.CoPost(context.Background(), &devicehub.CoReq{Id: uint32(i), DeviceId: testDeviceID})
+		assert.NilError(t, err)
+		assert.Equal(t, resp.Code, devicehub.Code_CODE_OK)
+	}
+	assert.Equal(t, a.posts, 0)
+	assert.Equal(t, b.posts, 3)
+
+	// a draining hub gets no calls
+	p.hubs["b:17018"].serving.Store(false)
+	h, _, err := p.route(context.Background(), testDeviceID)
+	assert.NilError(t, err)
+	assert.Equal(t, h.addr, "a:17018")
+
+	assert.NilError(t, p.check())
+	p.hubs["a:17018"].serving.Store(false)
+	assert.Equal(t, p.check(), ErrHubsNotServed)
+}
+
+func TestHubPoolRetry(t *testing.T) {
+	old := HubRetryBackoff
+	HubRetryBackoff = time.Millisecond
+	defer func() { HubRetryBackoff = old }()
+
+	a := &poolHub{fakeHub: fakeHub{devices: []*devicehub.DeviceInfo{{DeviceId: testDeviceID}}}}
+	b := &poolHub{}
+	p := newTestPool(map[string]*poolHub{"a:17018": a, "b:17018": b})
+	_, _, err := p.route(context.Background(), testDeviceID) // owner a cached
+	assert.NilError(t, err)
+
+	// a is gone and the device reconnected to b
+	a.unavailable.Store(true)
+	a.move(b)
+	resp, err := p.CoPost(context.Background(), &devicehub.CoReq{Id: 1, DeviceId: testDeviceID})
+	assert.NilError(t, err)
+	assert.Equal(t, resp.Code, devicehub.Code_CODE_OK)
+	assert.Equal(t, a.posts, 1)
+	assert.Equal(t, b.posts, 1)
+
+	// offline without a known owner is not retried
+	p.hubs["a:17018"].serving.Store(false)
+	resp, err = p.CoPost(context.Background(), &devicehub.CoReq{Id: 2, DeviceId: "dfa09baa-4913-4ad7-a936-3e26f9671b10"})
+	assert.NilError(t, err)
+	assert.Equal(t, resp.Code, devicehub.Code_CODE_DEVICEID_OFFLINE)
+	assert.Equal(t, a.posts+b.posts, 3)
+}
+
+func TestHubPoolDeviceList(t *testing.T) {
+	a := &poolHub{fakeHub: fakeHub{devices: []*devicehub.DeviceInfo{{DeviceId: "c"}, {DeviceId: "a"}}}}
+	b := &poolHub{fakeHub: fakeHub{devices: []*devicehub.DeviceInfo{{DeviceId: "b"}}}}
+	p := newTestPool(map[string]*poolHub{"a:17018": a, "b:17018": b})
+
+	resp, err := p.DeviceList(context.Background(), &devicehub.DeviceListReq{Id: 1, Limit: 2})
+	assert.NilError(t, err)
+	assert.Equal(t, len(resp.Devices), 2)
+	assert.Equal(t, resp.Devices[0].DeviceId, "a")
+	assert.Equal(t, resp.Devices[1].DeviceId, "b")
+}
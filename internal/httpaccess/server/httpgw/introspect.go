@@ -0,0 +1,177 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrJWTInactive         = errors.New("JWT inactive by introspection")
+	ErrIntrospectionFailed = errors.New("JWT introspection failed")
+)
+
+const (
+	RTIOIntrospectionBodyLenMax = 1 << 16
+	RTIOIntrospectionCacheMax   = 100000
+)
+
+// introspectionResp is the response of RFC 7662 2.2, only active is used.
+type introspectionResp struct {
+	Active bool `json:"active"`
+}
+
+type introspectionEntry struct {
+	active bool
+	until  time.Time
+}
+
+// introspector asks an RFC 7662 endpoint whether tokens are active, results
+// are cached for ttl, and not beyond the token exp.
+type introspector struct {
+	url          string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+	ttl          time.Duration
+	cache        map[string]*introspectionEntry
+	lock         sync.Mutex
+}
+
+func newIntrospector(url, clientID, clientSecret string, timeout, ttl time.Duration) *introspector {
+	return &introspector{
+		url:          url,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: timeout},
+		ttl:          ttl,
+		cache:        make(map[string]*introspectionEntry),
+	}
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (i *introspector) cached(key string, now time.Time) (*introspectionEntry, bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	e, ok := i.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(e.until) {
+		delete(i.cache, key)
+		return nil, false
+	}
+	return e, true
+}
+
+func (i *introspector) store(key string, e *introspectionEntry, now time.Time) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if len(i.cache) >= RTIOIntrospectionCacheMax {
+		for k, old := range i.cache {
+			if !now.Before(old.until) {
+				delete(i.cache, k)
+			}
+		}
+		if len(i.cache) >= RTIOIntrospectionCacheMax {
+			i.cache = make(map[string]*introspectionEntry)
+		}
+	}
+	i.cache[key] = e
+}
+
+func (i *introspector) introspect(token string) (bool, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest(http.MethodPost, i.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.clientID != "" {
+		req.SetBasicAuth(i.clientID, i.clientSecret)
+	}
+	httpResp, err := i.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		log.Error().Int("status", httpResp.StatusCode).Str("url", i.url).Msg("JWT introspection")
+		return false, ErrIntrospectionFailed
+	}
+	buf, err := io.ReadAll(io.LimitReader(httpResp.Body, RTIOIntrospectionBodyLenMax))
+	if err != nil {
+		return false, err
+	}
+	resp := &introspectionResp{}
+	if err := json.Unmarshal(buf, resp); err != nil {
+		return false, err
+	}
+	return resp.Active, nil
+}
+
+// check tells ErrJWTInactive if the endpoint says the token is not active,
+// ErrIntrospectionFailed if it cannot tell, the token is rejected either way.
+func (i *introspector) check(token string, exp time.Time) error {
+	now := time.Now()
+	key := tokenHash(token)
+	e, ok := i.cached(key, now)
+	if ok {
+		metricIntrospection.WithLabelValues("cache").Inc()
+	} else {
+		active, err := i.introspect(token)
+		if err != nil {
+			log.Error().Err(err).Str("url", i.url).Msg("Failed to introspect JWT")
+			metricIntrospection.WithLabelValues("error").Inc()
+			return ErrIntrospectionFailed
+		}
+		result := "active"
+		if !active {
+			result = "inactive"
+		}
+		metricIntrospection.WithLabelValues(result).Inc()
+		e = &introspectionEntry{active: active, until: now.Add(i.ttl)}
+		if !exp.IsZero() && exp.Before(e.until) {
+			e.until = exp
+		}
+		if i.ttl > 0 {
+			i.store(key, e, now)
+		}
+	}
+	if !e.active {
+		return ErrJWTInactive
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/rpcauth"
+	"github.com/mkrainbow/rtio/pkg/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrIssuerGrantType = errors.New("Unsupported grant type")
+	ErrIssuerScope     = errors.New("Scope not allowed by the API key")
+)
+
+const (
+	RTIOIssuerTokenPath     = "/jwtissuer/token"
+	RTIOIssuerJWKSPath      = "/jwtissuer/jwks.json"
+	RTIOIssuerBodyLenMax    = 4096
+	RTIOIssuerTTLDefault    = 3600
+	RTIOIssuerTTLMaxDefault = 86400
+	RTIOIssuerJWKSMaxAge    = 60
+	RTIOIssuerDefaultIssuer = "rtio"
+	RTIOIssuerGrantType     = "client_credentials"
+)
+
+// OAuth 2.0 error codes (RFC 6749 5.2) of the token endpoint.
+const (
+	issuerErrInvalidRequest = "invalid_request"
+	issuerErrInvalidClient  = "invalid_client"
+	issuerErrUnsupported    = "unsupported_grant_type"
+	issuerErrInvalidScope   = "invalid_scope"
+	issuerErrServer         = "server_error"
+	issuerErrSlowDown       = "slow_down"
+)
+
+// IssuerTokenResp is the token response of RFC 6749 4.4.3.
+type IssuerTokenResp struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+type issuerErrorResp struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// jwtIssuer issues Ed25519 JWTs to callers authenticated by API keys, scoped
+// by the key and validated by validateJWT.
+type jwtIssuer struct {
+	keys     *IssuerKeyStore
+	apiKeys  *APIKeyStore
+	issuer   string
+	audience string
+	ttl      time.Duration
+	ttlMax   time.Duration
+}
+
+func isIssuerPath(path string) bool {
+	return path == RTIOIssuerTokenPath || path == RTIOIssuerJWKSPath
+}
+
+// newJWTIssuer loads the issuer keys from configs, with a key generated when
+// the store is empty. apiKeys is the gateway key store, loaded here if nil.
+func newJWTIssuer(ctx context.Context, apiKeys *APIKeyStore) (*jwtIssuer, error) {
+	keys, err := LoadIssuerKeyStore(config.StringKV.GetWithDefault("jwtissuer.keys", "jwtkeys.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(keys.List()) == 0 {
+		k, err := keys.Rotate(0, 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := keys.Save(); err != nil {
+			log.Error().Err(err).Msg("Failed to save JWT issuer key store")
+			return nil, err
+		}
+		log.Info().Str("kid", k.Kid).Msg("JWT issuer key generated")
+	}
+	go keys.ReloadLoop(ctx, 5*time.Second)
+
+	if apiKeys == nil {
+		apiKeys, err = LoadAPIKeyStore(config.StringKV.GetWithDefault("apikey.store", ""))
+		if err != nil {
+			return nil, err
+		}
+		go apiKeys.ReloadLoop(ctx, 5*time.Second)
+	}
+
+	ttlMax := time.Duration(config.IntKV.GetWithDefault("jwtissuer.ttl.max", RTIOIssuerTTLMaxDefault)) * time.Second
+	ttl := time.Duration(config.IntKV.GetWithDefault("jwtissuer.ttl", RTIOIssuerTTLDefault)) * time.Second
+	if ttl <= 0 || ttl > ttlMax {
+		ttl = ttlMax
+	}
+	return &jwtIssuer{
+		keys:     keys,
+		apiKeys:  apiKeys,
+		issuer:   config.StringKV.GetWithDefault("jwt.issuer", ""),
+		audience: config.StringKV.GetWithDefault("jwt.audience", ""),
+		ttl:      ttl,
+		ttlMax:   ttlMax,
+	}, nil
+}
+
+// coveredBy tells whether pattern p matches only what some allowed pattern matches.
+func coveredBy(allowed []string, p string) bool {
+	for _, a := range allowed {
+		if rpcauth.CoversPattern(a, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// narrowPatterns gets the requested patterns if all are covered by allowed,
+// allowed patterns if none requested. unrestricted means empty allowed allows all.
+func narrowPatterns(allowed, requested []string, unrestricted bool) ([]string, error) {
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+	if len(allowed) == 0 && unrestricted {
+		return requested, nil
+	}
+	for _, p := range requested {
+		if !coveredBy(allowed, p) {
+			return nil, ErrIssuerScope
+		}
+	}
+	return requested, nil
+}
+
+func splitParam(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// narrowScope narrows the key scope by the optional devices, uris and methods parameters.
+func narrowScope(scope *AccessScope, r *http.Request) (*AccessScope, error) {
+	devices, err := narrowPatterns(scope.Devices, splitParam(r.PostForm.Get("devices")), false)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, ErrIssuerScope
+	}
+	uris, err := narrowPatterns(scope.URIs, splitParam(r.PostForm.Get("uris")), true)
+	if err != nil {
+		return nil, err
+	}
+	methods, err := narrowPatterns(scope.Methods, splitParam(r.PostForm.Get("methods")), true)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessScope{Devices: devices, URIs: uris, Methods: methods}, nil
+}
+
+// clientKey gets the API key from the client credentials, by HTTP Basic or
+// form, otherwise from the API key headers.
+func clientKey(r *http.Request) string {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != "" && secret != "" {
+		return RTIOAPIKeyPrefix + "_" + id + "_" + secret
+	}
+	return httpGetAPIKey(r)
+}
+
+func writeIssuerError(w http.ResponseWriter, status int, code, desc string) {
+	metricIssuerTokens.WithLabelValues(code).Inc()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="rtio"`)
+	}
+	w.WriteHeader(status)
+	buf, _ := json.Marshal(&issuerErrorResp{Error: code, Description: desc})
+	w.Write(buf)
+}
+
+// sign issues the token of the key scope, expiring at exp.
+func (i *jwtIssuer) sign(keyID string, scope *AccessScope, now, exp time.Time) (string, error) {
+	kid, priv, err := i.keys.signingKey(now)
+	if err != nil {
+		return "", err
+	}
+	jti, err := randHex(16)
+	if err != nil {
+		return "", err
+	}
+	iss := i.issuer
+	if iss == "" {
+		iss = RTIOIssuerDefaultIssuer
+	}
+	claims := jwt.MapClaims{
+		"iss":            iss,
+		"sub":            keyID,
+		"iat":            now.Unix(),
+		"nbf":            now.Unix(),
+		"exp":            exp.Unix(),
+		"jti":            jti,
+		RTIOClaimDevices: scope.Devices,
+	}
+	if i.audience != "" {
+		claims["aud"] = i.audience
+	}
+	if len(scope.URIs) > 0 {
+		claims[RTIOClaimURIs] = scope.URIs
+	}
+	if len(scope.Methods) > 0 {
+		claims[RTIOClaimMethods] = scope.Methods
+	}
+	token := jwt.NewWithClaims(&jwt.SigningMethodEd25519{}, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(priv)
+}
+
+func (i *jwtIssuer) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, RTIOIssuerBodyLenMax)
+	if err := r.ParseForm(); err != nil {
+		writeIssuerError(w, http.StatusBadRequest, issuerErrInvalidRequest, "malformed form body")
+		return
+	}
+	if r.PostForm.Get("grant_type") != RTIOIssuerGrantType {
+		log.Warn().Err(ErrIssuerGrantType).Str("granttype", r.PostForm.Get("grant_type")).Msg("Failed to issue JWT")
+		writeIssuerError(w, http.StatusBadRequest, issuerErrUnsupported, "")
+		return
+	}
+	key := clientKey(r)
+	if key == "" {
+		writeIssuerError(w, http.StatusUnauthorized, issuerErrInvalidClient, "missing client credentials")
+		return
+	}
+	k, err := i.apiKeys.authenticateKey(key)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to issue JWT, authenticate")
+		if err == ErrAPIKeyRateLimited {
+			writeIssuerError(w, http.StatusTooManyRequests, issuerErrSlowDown, err.Error())
+		} else {
+			writeIssuerError(w, http.StatusUnauthorized, issuerErrInvalidClient, err.Error())
+		}
+		return
+	}
+	scope, err := narrowScope(&k.Scope, r)
+	if err != nil {
+		log.Warn().Err(err).Str("keyid", k.ID).Msg("Failed to issue JWT")
+		writeIssuerError(w, http.StatusBadRequest, issuerErrInvalidScope, err.Error())
+		return
+	}
+
+	ttl := i.ttl
+	if s := r.PostForm.Get("expires_in"); s != "" {
+		sec, err := strconv.Atoi(s)
+		if err != nil || sec <= 0 {
+			writeIssuerError(w, http.StatusBadRequest, issuerErrInvalidRequest, "invalid expires_in")
+			return
+		}
+		ttl = time.Duration(sec) * time.Second
+	}
+	if ttl > i.ttlMax {
+		ttl = i.ttlMax
+	}
+	now := time.Now()
+	exp := now.Add(ttl)
+	if k.Expires != 0 && exp.Unix() > k.Expires {
+		exp = time.Unix(k.Expires, 0) // not outliving the API key
+	}
+
+	token, err := i.sign(k.ID, scope, now, exp)
+	if err != nil {
+		log.Error().Err(err).Str("keyid", k.ID).Msg("Failed to sign JWT")
+		writeIssuerError(w, http.StatusInternalServerError, issuerErrServer, "")
+		return
+	}
+	log.Info().Str("keyid", k.ID).Str("token", "*"+token[len(token)-8:]).Time("exp", exp).Msg("JWT issued")
+	metricIssuerTokens.WithLabelValues("ok").Inc()
+
+	buf, err := json.Marshal(&IssuerTokenResp{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   exp.Unix() - now.Unix(),
+	})
+	if err != nil {
+		writeIssuerError(w, http.StatusInternalServerError, issuerErrServer, "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(buf)
+}
+
+func (i *jwtIssuer) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	buf, err := json.Marshal(i.keys.JWKS())
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(RTIOIssuerJWKSMaxAge))
+	w.Write(buf)
+}
+
+func (i *jwtIssuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == RTIOIssuerJWKSPath {
+		i.serveJWKS(w, r)
+		return
+	}
+	i.serveToken(w, r)
+}
@@ -0,0 +1,199 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/config"
+
+	"gotest.tools/assert"
+)
+
+func TestIssuerKeyRotate(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "jwtkeys.json")
+	s, err := LoadIssuerKeyStore(file)
+	assert.NilError(t, err)
+	_, _, err = s.signingKey(time.Now())
+	assert.Equal(t, err, ErrIssuerKeyNone)
+
+	k1, err := s.Rotate(0, 0)
+	assert.NilError(t, err)
+	kid, _, err := s.signingKey(time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, kid, k1.Kid)
+
+	// the new key is published before signing, the old one stays after
+	k2, err := s.Rotate(time.Hour, 2*time.Hour)
+	assert.NilError(t, err)
+	assert.NilError(t, s.Save())
+	s, err = LoadIssuerKeyStore(file)
+	assert.NilError(t, err)
+	assert.Equal(t, len(s.JWKS().Keys), 2)
+	kid, _, err = s.signingKey(time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, kid, k1.Kid)
+	kid, _, err = s.signingKey(time.Now().Add(90 * time.Minute))
+	assert.NilError(t, err)
+	assert.Equal(t, kid, k2.Kid)
+	_, ok := s.publicKey(k1.Kid)
+	assert.Assert(t, ok)
+
+	assert.Equal(t, s.Prune(), 0)
+	s.List()[0].Expires = time.Now().Unix() - 1
+	assert.Equal(t, s.Prune(), 1)
+	_, ok = s.publicKey(k1.Kid)
+	assert.Assert(t, !ok)
+	assert.Equal(t, s.JWKS().Keys[0].Kid, k2.Kid)
+}
+
+func TestIssuerKeySaveMerge(t *testing.T) {
+
+	// a gateway creating its first key and 'rtio jwtkey rotate' at once keep both
+	file := filepath.Join(t.TempDir(), "jwtkeys.json")
+	a, err := LoadIssuerKeyStore(file)
+	assert.NilError(t, err)
+	b, err := LoadIssuerKeyStore(file)
+	assert.NilError(t, err)
+	k1, err := a.Rotate(0, 0)
+	assert.NilError(t, err)
+	k2, err := b.Rotate(time.Hour, time.Hour)
+	assert.NilError(t, err)
+	assert.NilError(t, a.Save())
+	assert.NilError(t, b.Save())
+
+	// pruned keys are removed, keys rotated meanwhile are kept
+	assert.Equal(t, len(b.List()), 2)
+	for _, k := range b.List() {
+		if k.Kid == k1.Kid {
+			k.Expires = time.Now().Unix() - 1
+		}
+	}
+	assert.Equal(t, b.Prune(), 1)
+	k3, err := a.Rotate(0, time.Hour)
+	assert.NilError(t, err)
+	assert.NilError(t, a.Save())
+	assert.NilError(t, b.Save())
+
+	s, err := LoadIssuerKeyStore(file)
+	assert.NilError(t, err)
+	assert.Equal(t, len(s.List()), 2)
+	assert.Assert(t, !containsKid(s.List(), k1.Kid))
+	assert.Assert(t, containsKid(s.List(), k2.Kid))
+	assert.Assert(t, containsKid(s.List(), k3.Kid))
+}
+
+func TestNarrowPatterns(t *testing.T) {
+
+	got, err := narrowPatterns([]string{"cfa09baa-*"}, nil, false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got, []string{"cfa09baa-*"})
+	got, err = narrowPatterns([]string{"cfa09baa-*"}, []string{testDeviceID, "cfa09baa-4913*"}, false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got, []string{testDeviceID, "cfa09baa-4913*"})
+	_, err = narrowPatterns([]string{"cfa09baa-*"}, []string{"cfa*"}, false)
+	assert.Equal(t, err, ErrIssuerScope)
+	_, err = narrowPatterns([]string{testDeviceID}, []string{"*"}, false)
+	assert.Equal(t, err, ErrIssuerScope)
+	_, err = narrowPatterns(nil, []string{testDeviceID}, false)
+	assert.Equal(t, err, ErrIssuerScope)
+	got, err = narrowPatterns(nil, []string{"/led"}, true)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got, []string{"/led"})
+}
+
+func postToken(h http.Handler, form url.Values, id, secret string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", RTIOIssuerTokenPath, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if id != "" {
+		r.SetBasicAuth(id, secret)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestIssuerToken(t *testing.T) {
+
+	dir := t.TempDir()
+	apiKeys, err := LoadAPIKeyStore(filepath.Join(dir, "apikeys.json"))
+	assert.NilError(t, err)
+	key, k, err := apiKeys.Create("job", AccessScope{Devices: []string{"cfa09baa-*"}, Methods: []string{"copost"}}, time.Time{}, 0)
+	assert.NilError(t, err)
+	_, secret, err := splitAPIKey(key)
+	assert.NilError(t, err)
+
+	config.StringKV.Set("jwtissuer.keys", filepath.Join(dir, "jwtkeys.json"))
+	config.StringKV.Set("jwt.audience", "rtio")
+	defer config.StringKV.Set("jwt.audience", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	issuer, err := newJWTIssuer(ctx, apiKeys)
+	assert.NilError(t, err)
+	assert.Equal(t, len(issuer.keys.List()), 1) // generated
+	jwtKeys, err := initJWTKeys(ctx, issuer.keys)
+	assert.NilError(t, err)
+	h := &rtioHTTPHandler{jwtKeys: jwtKeys, issuer: issuer}
+
+	form := url.Values{"grant_type": {"client_credentials"}, "devices": {testDeviceID}, "expires_in": {"600"}}
+	w := postToken(h, form, k.ID, secret)
+	assert.Equal(t, w.Code, http.StatusOK)
+	resp := &IssuerTokenResp{}
+	assert.NilError(t, json.Unmarshal(w.Body.Bytes(), resp))
+	assert.Equal(t, resp.TokenType, "Bearer")
+	assert.Equal(t, resp.ExpiresIn, int64(600))
+
+	scope, caller, err := h.validateJWT(resp.AccessToken)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, scope, &AccessScope{Devices: []string{testDeviceID}, Methods: []string{"copost"}})
+	assert.Equal(t, caller, "jwt:"+k.ID)
+
+	// API key header instead of client credentials
+	r := httptest.NewRequest("POST", RTIOIssuerTokenPath, strings.NewReader("grant_type=client_credentials"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-API-Key", key)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, w.Code, http.StatusOK)
+
+	w = postToken(h, form, k.ID, changeLast(secret))
+	assert.Equal(t, w.Code, http.StatusUnauthorized)
+	w = postToken(h, url.Values{"grant_type": {"password"}}, k.ID, secret)
+	assert.Equal(t, w.Code, http.StatusBadRequest)
+	w = postToken(h, url.Values{"grant_type": {"client_credentials"}, "methods": {"obget"}}, k.ID, secret)
+	assert.Equal(t, w.Code, http.StatusBadRequest)
+	assert.Assert(t, strings.Contains(w.Body.String(), "invalid_scope"))
+
+	r = httptest.NewRequest("GET", RTIOIssuerJWKSPath, nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, w.Code, http.StatusOK)
+	keys, err := parseJWKS(w.Body.Bytes())
+	assert.NilError(t, err)
+	assert.Equal(t, len(keys), 1)
+}
@@ -0,0 +1,345 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/filestore"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrIssuerKeyStoreLoad = errors.New("JWT issuer key store load failed")
+	ErrIssuerKeyNone      = errors.New("JWT issuer has no active key")
+	ErrIssuerKeyInvalid   = errors.New("JWT issuer key invalid")
+)
+
+const (
+	RTIOIssuerKeyIDLen = 8 // bytes, hex encoded in kid
+)
+
+// IssuerKey is an Ed25519 signing key of the JWT issuer. A key is published in
+// the JWKS from its creation until it expires, and signs tokens from Activates
+// until a newer key activates.
+type IssuerKey struct {
+	Kid       string `json:"kid"`
+	Seed      string `json:"seed"` // base64url of the ed25519 seed
+	Created   int64  `json:"created"`
+	Activates int64  `json:"activates"`
+	Expires   int64  `json:"expires"` // unix seconds, 0 for never, set when rotated out
+}
+
+type issuerKeyFile struct {
+	Keys []*IssuerKey `json:"keys"`
+}
+
+// IssuerKeyStore is the key store of the JWT issuer loaded from a local file.
+type IssuerKeyStore struct {
+	file    string
+	modTime time.Time
+	keys    []*IssuerKey
+	changes map[string]*IssuerKey // by kid, not saved yet, nil for pruned
+	lock    sync.Mutex
+}
+
+func (k *IssuerKey) privateKey() (ed25519.PrivateKey, error) {
+	seed, err := base64.RawURLEncoding.DecodeString(k.Seed)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, ErrIssuerKeyInvalid
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func (k *IssuerKey) published(now int64) bool {
+	return k.Expires == 0 || now < k.Expires
+}
+
+func (k *IssuerKey) active(now int64) bool {
+	return k.Activates <= now && k.published(now)
+}
+
+// LoadIssuerKeyStore loads key store from file, an absent file is an empty store.
+func LoadIssuerKeyStore(file string) (*IssuerKeyStore, error) {
+	s := &IssuerKeyStore{file: file, changes: make(map[string]*IssuerKey)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// read reads the file, an absent file is an empty store.
+func (s *IssuerKeyStore) read() (*issuerKeyFile, time.Time, error) {
+	f := &issuerKeyFile{}
+	info, err := os.Stat(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, time.Time{}, nil
+	}
+	if err != nil {
+		log.Error().Err(err).Str("file", s.file).Msg("Failed to stat JWT issuer key store")
+		return nil, time.Time{}, ErrIssuerKeyStoreLoad
+	}
+	buf, err := os.ReadFile(s.file)
+	if err != nil {
+		log.Error().Err(err).Str("file", s.file).Msg("Failed to read JWT issuer key store")
+		return nil, time.Time{}, ErrIssuerKeyStoreLoad
+	}
+	if err := json.Unmarshal(buf, f); err != nil {
+		log.Error().Err(err).Str("file", s.file).Msg("Failed to unmarshal JWT issuer key store")
+		return nil, time.Time{}, ErrIssuerKeyStoreLoad
+	}
+	for _, k := range f.Keys {
+		if _, err := k.privateKey(); err != nil {
+			log.Error().Err(err).Str("kid", k.Kid).Str("file", s.file).Msg("Failed to load JWT issuer key")
+			return nil, time.Time{}, ErrIssuerKeyStoreLoad
+		}
+	}
+	return f, info.ModTime(), nil
+}
+
+func (s *IssuerKeyStore) load() error {
+	f, modTime, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.applyLocked(f, modTime)
+	log.Info().Int("keys", len(s.keys)).Str("file", s.file).Msg("JWT issuer key store loaded")
+	return nil
+}
+
+// applyLocked sets the keys read from the file, with the changes not saved.
+func (s *IssuerKeyStore) applyLocked(f *issuerKeyFile, modTime time.Time) {
+	keys := make([]*IssuerKey, 0, len(f.Keys)+len(s.changes))
+	for _, k := range f.Keys {
+		if c, ok := s.changes[k.Kid]; ok {
+			k = c
+		}
+		if k != nil {
+			keys = append(keys, k)
+		}
+	}
+	for kid, c := range s.changes {
+		if c == nil {
+			continue
+		}
+		if !containsKid(f.Keys, kid) {
+			keys = append(keys, c)
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].Created < keys[j].Created })
+	s.keys = keys
+	s.modTime = modTime
+}
+
+func containsKid(keys []*IssuerKey, kid string) bool {
+	for _, k := range keys {
+		if k.Kid == kid {
+			return true
+		}
+	}
+	return false
+}
+
+// Save writes the changes to the file, readable by the owner only. The file is
+// locked and read again, so keys rotated by others meanwhile are kept.
+func (s *IssuerKeyStore) Save() error {
+	unlock, err := filestore.Lock(s.file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	f, modTime, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.applyLocked(f, modTime)
+	buf, err := json.MarshalIndent(&issuerKeyFile{Keys: s.keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := filestore.WriteFile(s.file, buf, 0600); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.file); err == nil {
+		s.modTime = info.ModTime()
+	}
+	s.changes = make(map[string]*IssuerKey)
+	return nil
+}
+
+// ReloadLoop reloads the store when the file changed, such as after 'rtio jwtkey rotate'.
+func (s *IssuerKeyStore) ReloadLoop(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debug().Msg("JWT issuer key store reload ctx done")
+			return
+		case <-t.C:
+			info, err := os.Stat(s.file)
+			if err != nil {
+				continue
+			}
+			s.lock.Lock()
+			changed := !info.ModTime().Equal(s.modTime)
+			s.lock.Unlock()
+			if changed {
+				s.load() // keep previous keys on failure
+			}
+		}
+	}
+}
+
+// Rotate adds a key signing from prepublish later, published at once so that
+// verifiers can fetch it before. Keys in use expire overlap after the new key
+// activates, overlap should cover the longest token lifetime.
+func (s *IssuerKeyStore) Rotate(prepublish, overlap time.Duration) (*IssuerKey, error) {
+	kid, err := randHex(RTIOIssuerKeyIDLen)
+	if err != nil {
+		return nil, err
+	}
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	k := &IssuerKey{
+		Kid:       kid,
+		Seed:      base64.RawURLEncoding.EncodeToString(seed),
+		Created:   now.Unix(),
+		Activates: now.Add(prepublish).Unix(),
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, old := range s.keys {
+		if old.Expires == 0 {
+			old.Expires = now.Add(prepublish + overlap).Unix()
+			s.changes[old.Kid] = old
+		}
+	}
+	s.keys = append(s.keys, k)
+	s.changes[k.Kid] = k
+	return k, nil
+}
+
+// Prune removes the expired keys, returns the number removed.
+func (s *IssuerKeyStore) Prune() int {
+	now := time.Now().Unix()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	keys := s.keys[:0]
+	for _, k := range s.keys {
+		if k.published(now) {
+			keys = append(keys, k)
+		} else {
+			s.changes[k.Kid] = nil
+		}
+	}
+	n := len(s.keys) - len(keys)
+	s.keys = keys
+	return n
+}
+
+// List Items by creation.
+func (s *IssuerKeyStore) List() []*IssuerKey {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	l := append([]*IssuerKey(nil), s.keys...)
+	sort.SliceStable(l, func(i, j int) bool { return l[i].Created < l[j].Created })
+	return l
+}
+
+// signingKey is the latest activated key not expired.
+func (s *IssuerKeyStore) signingKey(now time.Time) (string, ed25519.PrivateKey, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var latest *IssuerKey
+	for _, k := range s.keys {
+		if k.active(now.Unix()) && (latest == nil || k.Activates >= latest.Activates) {
+			latest = k
+		}
+	}
+	if latest == nil {
+		return "", nil, ErrIssuerKeyNone
+	}
+	priv, err := latest.privateKey()
+	if err != nil {
+		return "", nil, err
+	}
+	return latest.Kid, priv, nil
+}
+
+// publicKey gets a published key by kid, for tokens validated by this rtio.
+func (s *IssuerKeyStore) publicKey(kid string) (ed25519.PublicKey, bool) {
+	now := time.Now().Unix()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, k := range s.keys {
+		if k.Kid == kid && k.published(now) {
+			priv, err := k.privateKey()
+			if err != nil {
+				return nil, false
+			}
+			return priv.Public().(ed25519.PublicKey), true
+		}
+	}
+	return nil, false
+}
+
+// JWKS is the public keys published, including ones not activated yet.
+func (s *IssuerKeyStore) JWKS() *JWKS {
+	now := time.Now().Unix()
+	set := &JWKS{Keys: []JWK{}}
+	for _, k := range s.List() {
+		if !k.published(now) {
+			continue
+		}
+		priv, err := k.privateKey()
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, JWK{
+			Kty: "OKP",
+			Kid: k.Kid,
+			Use: "sig",
+			Alg: "EdDSA",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(priv.Public().(ed25519.PublicKey)),
+		})
+	}
+	return set
+}
@@ -0,0 +1,318 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrJWKSLoadFailed    = errors.New("JWKS load failed")
+	ErrJWKSEmpty         = errors.New("JWKS has no usable key")
+	ErrJWKUnsupported    = errors.New("JWK type or curve unsupported")
+	ErrJWKInvalid        = errors.New("JWK invalid")
+	ErrJWTKeyNotFound    = errors.New("JWT key not found for kid")
+	ErrJWTAlgNotMatchKey = errors.New("JWT alg not match key type")
+)
+
+const (
+	RTIOJWKSBodyLenMax        = 1 << 20
+	RTIOJWKSRefreshSecondsMin = 10
+)
+
+// JWK is a JSON Web Key (RFC 7517), only fields used for RSA, EC and OKP public keys.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwtKeySet holds the verification keys selected by kid. The key with empty
+// kid is the legacy ed25519 key from -jwt.ed25519, used when token has no kid.
+// Keys of the built-in issuer are looked up first.
+type jwtKeySet struct {
+	source string // JWKS file path or URL
+	client *http.Client
+	keys   map[string]crypto.PublicKey
+	issuer *IssuerKeyStore
+	lock   sync.RWMutex
+}
+
+func newJWTKeySet(source string) *jwtKeySet {
+	httpTransport := &http.Transport{
+		TLSClientConfig: &tls.Config{},
+	}
+	return &jwtKeySet{
+		source: source,
+		client: &http.Client{Transport: httpTransport, Timeout: 5 * time.Second},
+		keys:   make(map[string]crypto.PublicKey),
+	}
+}
+
+func loadPubKey(keyfile string) (crypto.PublicKey, error) {
+	key, err := os.ReadFile(keyfile)
+	if err != nil {
+		return nil, err
+	}
+
+	return jwt.ParseEdPublicKeyFromPEM(key)
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(buf) == 0 {
+		return nil, ErrJWKInvalid
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
+
+func parseJWK(k *JWK) (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, ErrJWKInvalid
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, ErrJWKUnsupported
+		}
+		x, err := decodeJWKInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !pub.Curve.IsOnCurve(x, y) {
+			return nil, ErrJWKInvalid
+		}
+		return pub, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, ErrJWKUnsupported
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrJWKInvalid
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, ErrJWKUnsupported
+}
+
+func parseJWKS(buf []byte) (map[string]crypto.PublicKey, error) {
+	set := &JWKS{}
+	if err := json.Unmarshal(buf, set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for i := range set.Keys {
+		k := &set.Keys[i]
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := parseJWK(k)
+		if err != nil {
+			log.Warn().Err(err).Str("kid", k.Kid).Str("kty", k.Kty).Msg("JWKS skip key")
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return nil, ErrJWKSEmpty
+	}
+	return keys, nil
+}
+
+func (s *jwtKeySet) readSource() ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		return os.ReadFile(s.source)
+	}
+	httpResp, err := s.client.Get(s.source)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		log.Error().Int("status", httpResp.StatusCode).Str("source", s.source).Msg("JWKS fetch")
+		return nil, ErrJWKSLoadFailed
+	}
+	return io.ReadAll(io.LimitReader(httpResp.Body, RTIOJWKSBodyLenMax))
+}
+
+// refresh reloads keys from source, the legacy key (empty kid) is kept.
+func (s *jwtKeySet) refresh() error {
+	buf, err := s.readSource()
+	if err != nil {
+		log.Error().Err(err).Str("source", s.source).Msg("JWKS read")
+		return ErrJWKSLoadFailed
+	}
+	keys, err := parseJWKS(buf)
+	if err != nil {
+		log.Error().Err(err).Str("source", s.source).Msg("JWKS parse")
+		return ErrJWKSLoadFailed
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if legacy, ok := s.keys[""]; ok {
+		if _, ok := keys[""]; !ok {
+			keys[""] = legacy
+		}
+	}
+	s.keys = keys
+	log.Info().Int("keys", len(keys)).Str("source", s.source).Msg("JWKS loaded")
+	return nil
+}
+
+func (s *jwtKeySet) refreshLoop(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debug().Msg("JWKS refresh ctx done")
+			return
+		case <-t.C:
+			s.refresh() // keep previous keys on failure
+		}
+	}
+}
+
+func (s *jwtKeySet) setKey(kid string, key crypto.PublicKey) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.keys[kid] = key
+}
+
+func (s *jwtKeySet) getKey(kid string) (crypto.PublicKey, bool) {
+	if s.issuer != nil && kid != "" {
+		if key, ok := s.issuer.publicKey(kid); ok {
+			return key, true
+		}
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if key, ok := s.keys[kid]; ok {
+		return key, true
+	}
+	// token without kid is acceptable only when there is exactly one key
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// keyFunc selects key by kid and checks that the alg matches the key type.
+func (s *jwtKeySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := s.getKey(kid)
+	if !ok {
+		return nil, ErrJWTKeyNotFound
+	}
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, ErrJWTAlgNotMatchKey
+		}
+	case *ecdsa.PublicKey:
+		if _, ok := t.Method.(*jwt.SigningMethodECDSA); !ok {
+			return nil, ErrJWTAlgNotMatchKey
+		}
+	case ed25519.PublicKey:
+		if _, ok := t.Method.(*jwt.SigningMethodEd25519); !ok {
+			return nil, ErrJWTAlgNotMatchKey
+		}
+	}
+	return key, nil
+}
+
+// initJWTKeys loads the legacy ed25519 key and/or JWKS from configs and starts
+// the JWKS refresh route. issuer is the built-in issuer keys, nil if disabled.
+func initJWTKeys(ctx context.Context, issuer *IssuerKeyStore) (*jwtKeySet, error) {
+	keyPem := config.StringKV.GetWithDefault("jwt.ed25519", "")
+	source := config.StringKV.GetWithDefault("jwt.jwks", "")
+	if keyPem == "" && source == "" && issuer == nil {
+		log.Error().Err(ErrJWTPubKeyEmpty).Msg("jwt ed25519 public key file and jwks empty")
+		return nil, ErrJWTPubKeyEmpty
+	}
+
+	keys := newJWTKeySet(source)
+	keys.issuer = issuer
+	if keyPem != "" {
+		pub, err := loadPubKey(keyPem)
+		if err != nil {
+			log.Error().Err(ErrJWTPubKeyLoadFailed).Msg("jwt ed25519 public key load failed")
+			return nil, ErrJWTPubKeyLoadFailed
+		}
+		keys.setKey("", pub)
+	}
+	if source != "" {
+		if err := keys.refresh(); err != nil {
+			return nil, err
+		}
+		refreshSeconds := config.IntKV.GetWithDefault("jwt.jwks.refresh", 300)
+		if refreshSeconds < RTIOJWKSRefreshSecondsMin {
+			refreshSeconds = RTIOJWKSRefreshSecondsMin
+		}
+		go keys.refreshLoop(ctx, time.Duration(refreshSeconds)*time.Second)
+	}
+	return keys, nil
+}
@@ -0,0 +1,147 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gotest.tools/assert"
+)
+
+const testDeviceID = "cfa09baa-4913-4ad7-a936-3e26f9671b10"
+
+func b64Int(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	assert.NilError(t, err)
+	return s
+}
+
+func TestJWKSValidate(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+
+	set := &JWKS{Keys: []JWK{
+		{Kty: "RSA", Kid: "rsa1", Use: "sig", N: b64Int(rsaKey.N), E: b64Int(big.NewInt(int64(rsaKey.E)))},
+		{Kty: "EC", Kid: "ec1", Crv: "P-256", X: b64Int(ecKey.X), Y: b64Int(ecKey.Y)},
+		{Kty: "OKP", Kid: "ed1", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(edPub)},
+		{Kty: "RSA", Kid: "enc1", Use: "enc", N: b64Int(rsaKey.N), E: "AQAB"},
+	}}
+	buf, err := json.Marshal(set)
+	assert.NilError(t, err)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NilError(t, os.WriteFile(file, buf, 0600))
+
+	keys := newJWTKeySet(file)
+	assert.NilError(t, keys.refresh())
+	assert.Equal(t, len(keys.keys), 3)
+
+	config.StringKV.Set("jwt.issuer", "https://idp.example.com")
+	config.StringKV.Set("jwt.audience", "rtio")
+	defer config.StringKV.Set("jwt.issuer", "")
+	defer config.StringKV.Set("jwt.audience", "")
+
+	h := &rtioHTTPHandler{jwtKeys: keys}
+	claims := jwt.MapClaims{
+		"iss": "https://idp.example.com",
+		"aud": "rtio",
+		"sub": testDeviceID,
+		"exp": time.Now().Unix() + 60,
+	}
+
+	scope, _, err := h.validateJWT(signTestToken(t, jwt.SigningMethodRS256, "rsa1", rsaKey, claims))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, scope.Devices, []string{testDeviceID})
+
+	scope, _, err = h.validateJWT(signTestToken(t, jwt.SigningMethodES256, "ec1", ecKey, claims))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, scope.Devices, []string{testDeviceID})
+
+	scope, _, err = h.validateJWT(signTestToken(t, &jwt.SigningMethodEd25519{}, "ed1", edPriv, claims))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, scope.Devices, []string{testDeviceID})
+
+	// unknown kid
+	_, _, err = h.validateJWT(signTestToken(t, jwt.SigningMethodRS256, "rsa2", rsaKey, claims))
+	assert.Assert(t, err != nil)
+
+	// kid of a key with another type
+	_, _, err = h.validateJWT(signTestToken(t, jwt.SigningMethodRS256, "ec1", rsaKey, claims))
+	assert.Assert(t, err != nil)
+
+	// wrong audience
+	claims["aud"] = "other"
+	_, _, err = h.validateJWT(signTestToken(t, jwt.SigningMethodRS256, "rsa1", rsaKey, claims))
+	assert.Assert(t, err != nil)
+}
+
+func TestJWKSLegacyKeyKept(t *testing.T) {
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+
+	set := &JWKS{Keys: []JWK{
+		{Kty: "RSA", Kid: "rsa1", N: b64Int(rsaKey.N), E: "AQAB"},
+	}}
+	buf, err := json.Marshal(set)
+	assert.NilError(t, err)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NilError(t, os.WriteFile(file, buf, 0600))
+
+	keys := newJWTKeySet(file)
+	keys.setKey("", edPub)
+	assert.NilError(t, keys.refresh())
+
+	h := &rtioHTTPHandler{jwtKeys: keys}
+	claims := jwt.MapClaims{
+		"sub": testDeviceID,
+		"exp": time.Now().Unix() + 60,
+	}
+	scope, _, err := h.validateJWT(signTestToken(t, &jwt.SigningMethodEd25519{}, "", edPriv, claims))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, scope.Devices, []string{testDeviceID})
+}
@@ -0,0 +1,74 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mkrainbow/rtio/pkg/metrics"
+)
+
+var (
+	metricRequests = metrics.NewCounterVec("rtio_http_requests_total",
+		"Gateway requests by route, http status and rtio code.", "route", "status", "code")
+	metricDuration = metrics.NewHistogramVec("rtio_http_request_duration_seconds",
+		"Gateway latency by route and rtio code, for obget until the stream ends.", nil, "route", "code")
+	metricIssuerTokens = metrics.NewCounterVec("rtio_jwtissuer_tokens_total",
+		"Tokens issued by the JWT issuer, ok or the OAuth error code.", "result")
+	metricJWTRevoked = metrics.NewCounter("rtio_jwt_revoked_total",
+		"JWTs rejected by the revocation list.")
+	metricIntrospection = metrics.NewCounterVec("rtio_jwt_introspection_total",
+		"JWT introspection results, active, inactive, error or cache.", "result")
+)
+
+// statusRecorder records the status code written by handlers.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func observeHTTPRequest(r *http.Request, rtioReq *RTIOReq, rtioResp *RTIOResp, status int, start time.Time) {
+	route := "invalid"
+	if isDevicesPath(r.URL.Path) {
+		route = "devices"
+	} else if isIssuerPath(r.URL.Path) {
+		route = "jwtissuer"
+	} else if rtioReq != nil && (rtioReq.Method == "copost" || rtioReq.Method == "obget") {
+		route = rtioReq.Method
+	}
+	code := ""
+	if rtioResp != nil {
+		code = rtioResp.Code
+	}
+	metricRequests.WithLabelValues(route, strconv.Itoa(status), code).Inc()
+	metricDuration.WithLabelValues(route, code).ObserveSince(start)
+}
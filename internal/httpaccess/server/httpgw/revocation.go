@@ -0,0 +1,390 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mkrainbow/rtio/internal/admin"
+	"github.com/mkrainbow/rtio/internal/filestore"
+	"github.com/mkrainbow/rtio/pkg/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrJWTRevoked          = errors.New("JWT revoked")
+	ErrRevocationLoad      = errors.New("JWT revocation list load failed")
+	ErrRevocationInvalid   = errors.New("JWT revocation needs jti or sub")
+	ErrRevocationNotFound  = errors.New("JWT revocation not found")
+	ErrRevocationNoStorage = errors.New("JWT revocation list has no file")
+)
+
+const (
+	RTIORevocationsPath       = "/jwt/revocations"
+	RTIORevocationBodyLenMax  = 4096
+	RTIORevocationReloadCheck = 5 * time.Second
+)
+
+// JTIRevocation revokes the token of the jti, kept until the token expires.
+type JTIRevocation struct {
+	JTI string `json:"jti"`
+	Exp int64  `json:"exp,omitempty"` // unix seconds of the token exp, 0 to keep forever
+}
+
+// SubjectRevocation revokes the tokens of the subject issued before Before,
+// tokens without iat included.
+type SubjectRevocation struct {
+	Sub    string `json:"sub"`
+	Before int64  `json:"before"` // unix seconds
+}
+
+type revocationFile struct {
+	JTIs     []*JTIRevocation     `json:"jtis"`
+	Subjects []*SubjectRevocation `json:"subjects"`
+}
+
+// RevocationList is the revoked JWTs, loaded from a local file and updated
+// by the admin API.
+type RevocationList struct {
+	file     string
+	modTime  time.Time
+	jtis     map[string]*JTIRevocation
+	subjects map[string]*SubjectRevocation
+	// changes not saved yet, nil for removed
+	jtiChanges     map[string]*JTIRevocation
+	subjectChanges map[string]*SubjectRevocation
+	lock           sync.RWMutex
+}
+
+func NewRevocationList() *RevocationList {
+	return &RevocationList{
+		jtis:           make(map[string]*JTIRevocation),
+		subjects:       make(map[string]*SubjectRevocation),
+		jtiChanges:     make(map[string]*JTIRevocation),
+		subjectChanges: make(map[string]*SubjectRevocation),
+	}
+}
+
+// LoadRevocationList loads the list from file, an absent file is an empty list.
+func LoadRevocationList(file string) (*RevocationList, error) {
+	l := NewRevocationList()
+	l.file = file
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// read reads the file, an absent file is an empty list.
+func (l *RevocationList) read() (*revocationFile, time.Time, error) {
+	f := &revocationFile{}
+	info, err := os.Stat(l.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, time.Time{}, nil
+	}
+	if err != nil {
+		log.Error().Err(err).Str("file", l.file).Msg("Failed to stat JWT revocation list")
+		return nil, time.Time{}, ErrRevocationLoad
+	}
+	buf, err := os.ReadFile(l.file)
+	if err != nil {
+		log.Error().Err(err).Str("file", l.file).Msg("Failed to read JWT revocation list")
+		return nil, time.Time{}, ErrRevocationLoad
+	}
+	if err := json.Unmarshal(buf, f); err != nil {
+		log.Error().Err(err).Str("file", l.file).Msg("Failed to unmarshal JWT revocation list")
+		return nil, time.Time{}, ErrRevocationLoad
+	}
+	return f, info.ModTime(), nil
+}
+
+func (l *RevocationList) load() error {
+	f, modTime, err := l.read()
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.applyLocked(f, modTime)
+	log.Info().Int("jtis", len(l.jtis)).Int("subjects", len(l.subjects)).Str("file", l.file).Msg("JWT revocation list loaded")
+	return nil
+}
+
+// applyLocked sets the revocations read from the file, with the changes not
+// saved.
+func (l *RevocationList) applyLocked(f *revocationFile, modTime time.Time) {
+	jtis := make(map[string]*JTIRevocation, len(f.JTIs))
+	for _, r := range f.JTIs {
+		jtis[r.JTI] = r
+	}
+	for jti, r := range l.jtiChanges {
+		if r == nil {
+			delete(jtis, jti)
+		} else {
+			jtis[jti] = r
+		}
+	}
+	subjects := make(map[string]*SubjectRevocation, len(f.Subjects))
+	for _, r := range f.Subjects {
+		subjects[r.Sub] = r
+	}
+	for sub, r := range l.subjectChanges {
+		if r == nil {
+			delete(subjects, sub)
+		} else {
+			subjects[sub] = r
+		}
+	}
+	l.jtis = jtis
+	l.subjects = subjects
+	l.modTime = modTime
+}
+
+func (l *RevocationList) listLocked() *revocationFile {
+	f := &revocationFile{
+		JTIs:     make([]*JTIRevocation, 0, len(l.jtis)),
+		Subjects: make([]*SubjectRevocation, 0, len(l.subjects)),
+	}
+	for _, r := range l.jtis {
+		f.JTIs = append(f.JTIs, r)
+	}
+	for _, r := range l.subjects {
+		f.Subjects = append(f.Subjects, r)
+	}
+	return f
+}
+
+// Save writes the changes to the file, and prunes the revocations of expired
+// tokens. The file is locked and read again, so changes saved by other nodes
+// meanwhile are kept.
+func (l *RevocationList) Save() error {
+	if l.file == "" {
+		return ErrRevocationNoStorage
+	}
+	unlock, err := filestore.Lock(l.file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	f, modTime, err := l.read()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.applyLocked(f, modTime)
+	for jti, r := range l.jtis {
+		if r.Exp != 0 && r.Exp <= now {
+			delete(l.jtis, jti)
+		}
+	}
+	buf, err := json.MarshalIndent(l.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := filestore.WriteFile(l.file, buf, 0600); err != nil {
+		return err
+	}
+	if info, err := os.Stat(l.file); err == nil {
+		l.modTime = info.ModTime()
+	}
+	l.jtiChanges = make(map[string]*JTIRevocation)
+	l.subjectChanges = make(map[string]*SubjectRevocation)
+	return nil
+}
+
+// ReloadLoop reloads the list when the file changed, such as by another node.
+func (l *RevocationList) ReloadLoop(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debug().Msg("JWT revocation list reload ctx done")
+			return
+		case <-t.C:
+			info, err := os.Stat(l.file)
+			if err != nil {
+				continue
+			}
+			l.lock.RLock()
+			changed := !info.ModTime().Equal(l.modTime)
+			l.lock.RUnlock()
+			if changed {
+				l.load() // keep previous revocations on failure
+			}
+		}
+	}
+}
+
+func (l *RevocationList) RevokeJTI(jti string, exp int64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.jtis[jti] = &JTIRevocation{JTI: jti, Exp: exp}
+	l.jtiChanges[jti] = l.jtis[jti]
+}
+
+// RevokeSubject revokes the tokens of sub issued before, a later revocation
+// of the same subject replaces it.
+func (l *RevocationList) RevokeSubject(sub string, before time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.subjects[sub] = &SubjectRevocation{Sub: sub, Before: before.Unix()}
+	l.subjectChanges[sub] = l.subjects[sub]
+}
+
+// Remove removes the revocation of jti or sub.
+func (l *RevocationList) Remove(jti, sub string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, ok := l.jtis[jti]; jti != "" && ok {
+		delete(l.jtis, jti)
+		l.jtiChanges[jti] = nil
+		return nil
+	}
+	if _, ok := l.subjects[sub]; sub != "" && ok {
+		delete(l.subjects, sub)
+		l.subjectChanges[sub] = nil
+		return nil
+	}
+	return ErrRevocationNotFound
+}
+
+// check tells ErrJWTRevoked if the token is revoked by jti or by subject.
+func (l *RevocationList) check(claims jwt.MapClaims) error {
+	jti, _ := claims["jti"].(string)
+	sub, _ := claims.GetSubject()
+
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if _, ok := l.jtis[jti]; jti != "" && ok {
+		return ErrJWTRevoked
+	}
+	if r, ok := l.subjects[sub]; sub != "" && ok {
+		iat, err := claims.GetIssuedAt()
+		if err != nil || iat == nil || iat.Unix() < r.Before {
+			return ErrJWTRevoked
+		}
+	}
+	return nil
+}
+
+// initRevocations loads the revocation list of config jwt.revocations, kept in
+// memory only if empty, and serves it on the admin API.
+func initRevocations(ctx context.Context) (*RevocationList, error) {
+	l := NewRevocationList()
+	if file := config.StringKV.GetWithDefault("jwt.revocations", ""); file != "" {
+		var err error
+		l, err = LoadRevocationList(file)
+		if err != nil {
+			return nil, err
+		}
+		go l.ReloadLoop(ctx, RTIORevocationReloadCheck)
+	}
+	if !admin.HandleAuthorized(RTIORevocationsPath, l) {
+		log.Warn().Msg("JWT revocation admin API disabled, set admin.token or a loopback admin.addr")
+	}
+	return l, nil
+}
+
+// revocationReq is the body of POST to the admin API, by jti or by sub.
+type revocationReq struct {
+	JTI    string `json:"jti"`
+	Exp    int64  `json:"exp"`
+	Sub    string `json:"sub"`
+	Before int64  `json:"before"` // unix seconds, now if 0
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(buf)
+}
+
+// ServeHTTP is the admin API, GET lists, POST revokes, DELETE removes by
+// the jti or sub query parameter. Changes are saved when the list has a file.
+func (l *RevocationList) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		l.lock.RLock()
+		f := l.listLocked()
+		l.lock.RUnlock()
+		writeJSON(w, http.StatusOK, f)
+		return
+	case http.MethodPost:
+		buf, err := io.ReadAll(io.LimitReader(r.Body, RTIORevocationBodyLenMax))
+		req := &revocationReq{}
+		if err == nil {
+			err = json.Unmarshal(buf, req)
+		}
+		if err == nil && req.JTI == "" && req.Sub == "" {
+			err = ErrRevocationInvalid
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.JTI != "" {
+			l.RevokeJTI(req.JTI, req.Exp)
+			log.Info().Str("jti", req.JTI).Int64("exp", req.Exp).Msg("JWT revoked")
+		}
+		if req.Sub != "" {
+			before := time.Now()
+			if req.Before != 0 {
+				before = time.Unix(req.Before, 0)
+			}
+			l.RevokeSubject(req.Sub, before)
+			log.Info().Str("sub", req.Sub).Time("before", before).Msg("JWT subject revoked")
+		}
+	case http.MethodDelete:
+		if err := l.Remove(r.URL.Query().Get("jti"), r.URL.Query().Get("sub")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if l.file != "" {
+		if err := l.Save(); err != nil {
+			log.Error().Err(err).Str("file", l.file).Msg("Failed to save JWT revocation list")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
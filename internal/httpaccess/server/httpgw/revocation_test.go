@@ -0,0 +1,177 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package httpgw
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gotest.tools/assert"
+)
+
+func TestRevocationList(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "revocations.json")
+	l, err := LoadRevocationList(file)
+	assert.NilError(t, err)
+
+	now := time.Now()
+	l.RevokeJTI("leaked", now.Add(time.Hour).Unix())
+	l.RevokeJTI("expired", now.Add(-time.Second).Unix())
+	l.RevokeSubject(testDeviceID, now)
+	assert.NilError(t, l.Save())
+
+	// revocations of expired tokens are pruned
+	l, err = LoadRevocationList(file)
+	assert.NilError(t, err)
+	f := l.listLocked()
+	assert.Equal(t, len(f.JTIs), 1)
+	assert.Equal(t, len(f.Subjects), 1)
+
+	assert.Equal(t, l.check(jwt.MapClaims{"jti": "leaked", "sub": "other"}), ErrJWTRevoked)
+	assert.NilError(t, l.check(jwt.MapClaims{"jti": "fine", "sub": "other"}))
+	assert.Equal(t, l.check(jwt.MapClaims{"sub": testDeviceID, "iat": float64(now.Unix() - 10)}), ErrJWTRevoked)
+	assert.Equal(t, l.check(jwt.MapClaims{"sub": testDeviceID}), ErrJWTRevoked)
+	assert.NilError(t, l.check(jwt.MapClaims{"sub": testDeviceID, "iat": float64(now.Unix() + 1)}))
+
+	assert.NilError(t, l.Remove("", testDeviceID))
+	assert.NilError(t, l.check(jwt.MapClaims{"sub": testDeviceID}))
+	assert.Equal(t, l.Remove("unknown", ""), ErrRevocationNotFound)
+}
+
+func TestRevocationSaveMerge(t *testing.T) {
+
+	// two gateways share the file, neither drops the other's revocations
+	file := filepath.Join(t.TempDir(), "revocations.json")
+	a, err := LoadRevocationList(file)
+	assert.NilError(t, err)
+	b, err := LoadRevocationList(file)
+	assert.NilError(t, err)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	a.RevokeJTI("from-a", exp)
+	b.RevokeJTI("from-b", exp)
+	assert.NilError(t, a.Save())
+	assert.NilError(t, b.Save())
+	assert.NilError(t, b.Remove("from-a", ""))
+	assert.NilError(t, b.Save())
+	a.RevokeSubject(testDeviceID, time.Now())
+	assert.NilError(t, a.Save())
+
+	l, err := LoadRevocationList(file)
+	assert.NilError(t, err)
+	f := l.listLocked()
+	assert.Equal(t, len(f.JTIs), 1)
+	assert.Equal(t, f.JTIs[0].JTI, "from-b")
+	assert.Equal(t, len(f.Subjects), 1)
+}
+
+func TestRevocationAPI(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "revocations.json")
+	l, err := LoadRevocationList(file)
+	assert.NilError(t, err)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	assert.Equal(t, do("POST", RTIORevocationsPath, `{"jti":"leaked"}`).Code, http.StatusNoContent)
+	assert.Equal(t, do("POST", RTIORevocationsPath, `{"sub":"`+testDeviceID+`"}`).Code, http.StatusNoContent)
+	assert.Equal(t, do("POST", RTIORevocationsPath, `{}`).Code, http.StatusBadRequest)
+	w := do("GET", RTIORevocationsPath, "")
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Assert(t, strings.Contains(w.Body.String(), `"jti":"leaked"`))
+
+	// saved to the file
+	saved, err := LoadRevocationList(file)
+	assert.NilError(t, err)
+	assert.Equal(t, saved.check(jwt.MapClaims{"jti": "leaked"}), ErrJWTRevoked)
+
+	assert.Equal(t, do("DELETE", RTIORevocationsPath+"?jti=leaked", "").Code, http.StatusNoContent)
+	assert.Equal(t, do("DELETE", RTIORevocationsPath+"?jti=leaked", "").Code, http.StatusNotFound)
+	assert.Equal(t, do("PUT", RTIORevocationsPath, "").Code, http.StatusMethodNotAllowed)
+}
+
+func TestValidateJWTRevoked(t *testing.T) {
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+	keys := newJWTKeySet("")
+	keys.setKey("", edPub)
+
+	var calls, active atomic.Int32
+	active.Store(1)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "rtio" || secret != "s3cret" || r.PostFormValue("token") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if active.Load() == 1 {
+			w.Write([]byte(`{"active":true,"sub":"x"}`))
+		} else {
+			w.Write([]byte(`{"active":false}`))
+		}
+	}))
+	defer endpoint.Close()
+
+	h := &rtioHTTPHandler{
+		jwtKeys:      keys,
+		revocations:  NewRevocationList(),
+		introspector: newIntrospector(endpoint.URL, "rtio", "s3cret", time.Second, time.Minute),
+	}
+	sign := func(jti string) string {
+		return signTestToken(t, &jwt.SigningMethodEd25519{}, "", edPriv, jwt.MapClaims{
+			"sub": testDeviceID,
+			"jti": jti,
+			"iat": time.Now().Unix(),
+			"exp": time.Now().Unix() + 60,
+		})
+	}
+
+	token := sign("a")
+	_, _, err = h.validateJWT(token)
+	assert.NilError(t, err)
+	_, _, err = h.validateJWT(token)
+	assert.NilError(t, err)
+	assert.Equal(t, calls.Load(), int32(1)) // cached
+
+	active.Store(0)
+	_, _, err = h.validateJWT(sign("b"))
+	assert.Equal(t, err, ErrJWTInactive)
+
+	h.revocations.RevokeJTI("a", 0)
+	_, _, err = h.validateJWT(token)
+	assert.Equal(t, err, ErrJWTRevoked)
+
+	h.introspector = newIntrospector(endpoint.URL, "rtio", "wrong", time.Second, time.Minute)
+	_, _, err = h.validateJWT(sign("c"))
+	assert.Equal(t, err, ErrIntrospectionFailed)
+}
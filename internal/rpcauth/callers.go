@@ -0,0 +1,255 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package rpcauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/mkrainbow/rtio/pkg/metrics"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrCallersLoad       = errors.New("ErrCallersLoad")
+	ErrUnauthenticated   = errors.New("ErrUnauthenticated")
+	ErrForbiddenRPC      = errors.New("ErrForbiddenRPC")
+	ErrForbiddenDeviceID = errors.New("ErrForbiddenDeviceID")
+	ErrForbiddenAdmin    = errors.New("ErrForbiddenAdmin")
+	ErrAdminAuthDisabled = errors.New("ErrAdminAuthDisabled")
+
+	metricAuthFailures = metrics.NewCounterVec("rtio_rpc_auth_failures_total",
+		"Backend RPC calls rejected, unauthenticated or forbidden.", "reason")
+)
+
+const (
+	healthServicePrefix = "/grpc.health.v1.Health/"
+)
+
+// Caller is a backend RPC caller, authenticated by token or by the common
+// name of its client cert. Device patterns match exactly, or by prefix when
+// ending with '*'. Empty RPCs means all RPCs, empty Devices means no device.
+// Admin RPCs, such as RotateDeviceSecret, need Admin as well.
+type Caller struct {
+	Name        string   `json:"name"`
+	TokenSHA256 string   `json:"token_sha256"` // hex SHA-256 of the token
+	CertCN      string   `json:"cert_cn"`
+	RPCs        []string `json:"rpcs"` // such as CoPost, ObGet, DeviceQuery, DeviceList
+	Devices     []string `json:"devices"`
+	Admin       bool     `json:"admin"`
+}
+
+type callersFile struct {
+	Callers []*Caller `json:"callers"`
+}
+
+// CallerStore is the callers loaded from a local file.
+type CallerStore struct {
+	byToken map[string]*Caller
+	byCN    map[string]*Caller
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func LoadCallers(file string) (*CallerStore, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		log.Error().Err(err).Str("file", file).Msg("Failed to read callers file")
+		return nil, ErrCallersLoad
+	}
+	f := &callersFile{}
+	if err := json.Unmarshal(buf, f); err != nil {
+		log.Error().Err(err).Str("file", file).Msg("Failed to unmarshal callers file")
+		return nil, ErrCallersLoad
+	}
+	s := &CallerStore{
+		byToken: make(map[string]*Caller),
+		byCN:    make(map[string]*Caller),
+	}
+	for _, c := range f.Callers {
+		if c.TokenSHA256 != "" {
+			s.byToken[strings.ToLower(c.TokenSHA256)] = c
+		}
+		if c.CertCN != "" {
+			s.byCN[c.CertCN] = c
+		}
+	}
+	log.Info().Int("callers", len(f.Callers)).Str("file", file).Msg("RPC callers loaded")
+	return s, nil
+}
+
+// MatchPattern reports whether s matches the pattern, a trailing * matches a prefix.
+func MatchPattern(pattern, s string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(s, pattern[:len(pattern)-1])
+	}
+	return pattern == s
+}
+
+// CoversPattern reports whether the pattern matches all that p matches, so p
+// narrows it.
+func CoversPattern(pattern, p string) bool {
+	if strings.HasSuffix(p, "*") && !strings.HasSuffix(pattern, "*") {
+		return false
+	}
+	return MatchPattern(pattern, strings.TrimSuffix(p, "*"))
+}
+
+func (c *Caller) allowRPC(rpc string) bool {
+	if len(c.RPCs) == 0 {
+		return true
+	}
+	for _, r := range c.RPCs {
+		if r == rpc {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowDevice reports whether the caller may access the device.
+func (c *Caller) AllowDevice(deviceID string) bool {
+	for _, p := range c.Devices {
+		if MatchPattern(p, deviceID) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate finds the caller by bearer token, or else by verified client cert.
+func (s *CallerStore) authenticate(ctx context.Context) (*Caller, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, v := range md.Get(AuthorizationKey) {
+			token, found := strings.CutPrefix(v, BearerPrefix)
+			if !found {
+				continue
+			}
+			// looked up by hash, timing does not tell the token
+			if c, ok := s.byToken[hashToken(token)]; ok {
+				return c, nil
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			if c, ok := s.byCN[info.State.VerifiedChains[0][0].Subject.CommonName]; ok {
+				return c, nil
+			}
+		}
+	}
+	return nil, ErrUnauthenticated
+}
+
+type callerKey struct{}
+
+// CallerFrom gets the authenticated caller, false if authentication disabled.
+func CallerFrom(ctx context.Context) (*Caller, bool) {
+	c, ok := ctx.Value(callerKey{}).(*Caller)
+	return c, ok
+}
+
+// AuthorizeDevice checks the device against the caller of ctx, allowed if
+// authentication disabled.
+func AuthorizeDevice(ctx context.Context, deviceID string) error {
+	c, ok := CallerFrom(ctx)
+	if !ok || c.AllowDevice(deviceID) {
+		return nil
+	}
+	metricAuthFailures.WithLabelValues("device").Inc()
+	log.Warn().Str("rpccaller", c.Name).Str("deviceid", deviceID).Msg("RPC device forbidden")
+	return status.Error(codes.PermissionDenied, ErrForbiddenDeviceID.Error())
+}
+
+// AuthorizeAdmin checks the caller of ctx may call admin RPCs, refused if
+// authentication disabled.
+func AuthorizeAdmin(ctx context.Context) error {
+	c, ok := CallerFrom(ctx)
+	if !ok {
+		metricAuthFailures.WithLabelValues("admin").Inc()
+		log.Warn().Msg("RPC admin refused, caller authentication disabled")
+		return status.Error(codes.PermissionDenied, ErrAdminAuthDisabled.Error())
+	}
+	if !c.Admin {
+		metricAuthFailures.WithLabelValues("admin").Inc()
+		log.Warn().Str("rpccaller", c.Name).Msg("RPC admin forbidden")
+		return status.Error(codes.PermissionDenied, ErrForbiddenAdmin.Error())
+	}
+	return nil
+}
+
+// check authenticates the call and checks the RPC, health checks are not authenticated.
+func (s *CallerStore) check(ctx context.Context, fullMethod string) (context.Context, error) {
+	if strings.HasPrefix(fullMethod, healthServicePrefix) {
+		return ctx, nil
+	}
+	c, err := s.authenticate(ctx)
+	if err != nil {
+		metricAuthFailures.WithLabelValues("unauthenticated").Inc()
+		log.Warn().Str("method", fullMethod).Msg("RPC unauthenticated")
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if !c.allowRPC(path.Base(fullMethod)) {
+		metricAuthFailures.WithLabelValues("rpc").Inc()
+		log.Warn().Str("rpccaller", c.Name).Str("method", fullMethod).Msg("RPC forbidden")
+		return nil, status.Error(codes.PermissionDenied, ErrForbiddenRPC.Error())
+	}
+	return context.WithValue(ctx, callerKey{}, c), nil
+}
+
+func (s *CallerStore) UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.check(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+type callerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *callerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *CallerStore) StreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.check(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &callerStream{ServerStream: ss, ctx: ctx})
+}
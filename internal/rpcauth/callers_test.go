@@ -0,0 +1,112 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package rpcauth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"gotest.tools/assert"
+)
+
+func loadTestCallers(t *testing.T) *CallerStore {
+	file := filepath.Join(t.TempDir(), "callers.json")
+	err := os.WriteFile(file, []byte(`{"callers":[
+		{"name":"app1","token_sha256":"`+hashToken("token1")+`","rpcs":["CoPost","ObGet"],"devices":["cfa09baa-*"]},
+		{"name":"app2","cert_cn":"app2.example.com","devices":["*"],"admin":true}
+	]}`), 0600)
+	assert.NilError(t, err)
+	s, err := LoadCallers(file)
+	assert.NilError(t, err)
+	return s
+}
+
+func tokenContext(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(AuthorizationKey, BearerPrefix+token))
+}
+
+func certContext(cn string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	info := credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: info})
+}
+
+func TestCallerCheck(t *testing.T) {
+	s := loadTestCallers(t)
+
+	ctx, err := s.check(tokenContext("token1"), "/devicehub.AccessService/CoPost")
+	assert.NilError(t, err)
+	c, ok := CallerFrom(ctx)
+	assert.Assert(t, ok)
+	assert.Equal(t, c.Name, "app1")
+	assert.NilError(t, AuthorizeDevice(ctx, "cfa09baa-4913-4ad7-a936-3e26f9671b09"))
+	err = AuthorizeDevice(ctx, "dfa09baa-4913-4ad7-a936-3e26f9671b09")
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+
+	err = AuthorizeAdmin(ctx)
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+	err = AuthorizeAdmin(context.Background())
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+
+	_, err = s.check(tokenContext("token1"), "/devicehub.AccessService/DeviceList")
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+
+	_, err = s.check(tokenContext("token2"), "/devicehub.AccessService/CoPost")
+	assert.Equal(t, status.Code(err), codes.Unauthenticated)
+	_, err = s.check(context.Background(), "/devicehub.AccessService/CoPost")
+	assert.Equal(t, status.Code(err), codes.Unauthenticated)
+
+	// health checks are not authenticated
+	_, err = s.check(context.Background(), "/grpc.health.v1.Health/Watch")
+	assert.NilError(t, err)
+
+	ctx, err = s.check(certContext("app2.example.com"), "/devicehub.AccessService/DeviceList")
+	assert.NilError(t, err)
+	c, _ = CallerFrom(ctx)
+	assert.Equal(t, c.Name, "app2")
+	assert.NilError(t, AuthorizeAdmin(ctx))
+	_, err = s.check(certContext("app3.example.com"), "/devicehub.AccessService/DeviceList")
+	assert.Equal(t, status.Code(err), codes.Unauthenticated)
+
+	// authentication disabled
+	assert.NilError(t, AuthorizeDevice(context.Background(), "dfa09baa-4913-4ad7-a936-3e26f9671b09"))
+}
+
+func TestPattern(t *testing.T) {
+	assert.Assert(t, MatchPattern("*", "cfa09baa"))
+	assert.Assert(t, MatchPattern("cfa*", "cfa09baa"))
+	assert.Assert(t, !MatchPattern("cfa", "cfa09baa"))
+
+	assert.Assert(t, CoversPattern("cfa*", "cfa09baa"))
+	assert.Assert(t, CoversPattern("cfa*", "cfa09*"))
+	assert.Assert(t, CoversPattern("*", "*"))
+	assert.Assert(t, !CoversPattern("cfa09*", "cfa*"))
+	assert.Assert(t, !CoversPattern("cfa09baa", "cfa09baa*"))
+	assert.Assert(t, !CoversPattern("cfa09baa", "*"))
+}
@@ -0,0 +1,154 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+// Package rpcauth secures the backend RPC with TLS, and authenticates
+// callers by bearer token or client cert.
+package rpcauth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+
+	"github.com/mkrainbow/rtio/pkg/config"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+var (
+	ErrCAInvalid    = errors.New("ErrCAInvalid")
+	ErrTLSKeyPair   = errors.New("ErrTLSKeyPair")
+	ErrTLSKeyAbsent = errors.New("ErrTLSKeyAbsent")
+)
+
+const (
+	// AuthorizationKey is the metadata key of the bearer token.
+	AuthorizationKey = "authorization"
+	BearerPrefix     = "Bearer "
+)
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, ErrCAInvalid
+	}
+	return pool, nil
+}
+
+// LoadClientTLSConfig loads the CA verifying servers, system CAs if caFile is
+// empty, and the client cert for mTLS if certFile and keyFile are not empty.
+func LoadClientTLSConfig(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: serverName}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// LoadServerTLSConfig loads the server cert, client certs are verified by
+// clientCAFile if not empty. A client without cert is allowed, it may
+// authenticate by token.
+func LoadServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, ErrTLSKeyAbsent
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load key pair")
+		return nil, ErrTLSKeyPair
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if clientCAFile != "" {
+		if config.ClientCAs, err = loadCertPool(clientCAFile); err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// tokenCreds sends the bearer token with each call, only over TLS when secure.
+type tokenCreds struct {
+	token  string
+	secure bool
+}
+
+func (c tokenCreds) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{AuthorizationKey: BearerPrefix + c.token}, nil
+}
+
+// RequireTransportSecurity is true with TLS, so that the token is never sent
+// in plain, plaintext is for trusted networks and tests.
+func (c tokenCreds) RequireTransportSecurity() bool {
+	return c.secure
+}
+
+// DialOptions gets options for calling the backend RPC, plaintext if
+// tlsConfig is nil, and no token if token is empty.
+func DialOptions(tlsConfig *tls.Config, token string) []grpc.DialOption {
+	opts := make([]grpc.DialOption, 0, 2)
+	if tlsConfig != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if token != "" {
+		if tlsConfig == nil {
+			log.Warn().Msg("Backend RPC token sent over insecure transport, enable TLS out of trusted networks")
+		}
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCreds{token: token, secure: tlsConfig != nil}))
+	}
+	return opts
+}
+
+// InternalDialOptions gets options for calls of the hub itself, from the
+// gateway in the same process and from cluster peers, set by config.
+func InternalDialOptions() ([]grpc.DialOption, error) {
+	var tlsConfig *tls.Config
+	if config.BoolKV.GetWithDefault("enable.backend.rpc.tls", false) {
+		var err error
+		tlsConfig, err = LoadClientTLSConfig(
+			config.StringKV.GetWithDefault("backend.rpc.tls.ca", ""), "", "",
+			config.StringKV.GetWithDefault("backend.rpc.tls.servername", ""))
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load backend rpc CA")
+			return nil, err
+		}
+	}
+	return DialOptions(tlsConfig, config.StringKV.GetWithDefault("backend.rpc.token", "")), nil
+}
@@ -0,0 +1,40 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package rpcauth
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestTokenCreds(t *testing.T) {
+	c := tokenCreds{token: "token1", secure: true}
+	md, err := c.GetRequestMetadata(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, md[AuthorizationKey], "Bearer token1")
+	assert.Equal(t, c.RequireTransportSecurity(), true)
+	assert.Equal(t, tokenCreds{token: "token1"}.RequireTransportSecurity(), false)
+
+	assert.Equal(t, len(DialOptions(&tls.Config{}, "token1")), 2)
+	assert.Equal(t, len(DialOptions(nil, "token1")), 2)
+	assert.Equal(t, len(DialOptions(nil, "")), 1)
+}
@@ -0,0 +1,431 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+// Package upgrade hands listening sockets and device connections over to a
+// newly exec'd binary through a Unix socket, for zero-downtime upgrade.
+//
+// The old process starts the new one with one end of a socketpair, sends the
+// listeners, waits for the new one to be ready, then exports connections.
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	EnvUpgradeFD         = "RTIO_UPGRADE_FD"
+	UpgradeReadyTimeout  = 30 * time.Second
+	UpgradeExportTimeout = 30 * time.Second
+	messageLenMax        = 64 * 1024
+	oobLenMax            = 1024
+)
+
+var (
+	ErrUpgradeInProgress = errors.New("ErrUpgradeInProgress")
+	ErrUpgradeChildExit  = errors.New("ErrUpgradeChildExit")
+	ErrUpgradeMessage    = errors.New("ErrUpgradeMessage")
+)
+
+const (
+	msgListeners = "listeners"
+	msgReady     = "ready"
+	msgConn      = "conn"
+	msgDone      = "done"
+)
+
+type message struct {
+	Type  string          `json:"type"`
+	Names []string        `json:"names,omitempty"` // listener names, in order of fds
+	Name  string          `json:"name,omitempty"`  // handoff name of conn
+	State json.RawMessage `json:"state,omitempty"` // conn state
+}
+
+// ExportFunc stops the connections of a component and sends each with its state.
+type ExportFunc func(ctx context.Context, send func(state []byte, f *os.File) error)
+
+// ImportFunc resumes a connection in the new process.
+type ImportFunc func(state []byte, f *os.File) error
+
+type handoff struct {
+	export ExportFunc
+	imp    ImportFunc
+}
+
+var (
+	lock       sync.Mutex
+	listeners  = make(map[string]net.Listener) // listeners of this process, by name
+	inherited  = make(map[string]net.Listener) // listeners from the parent, by name
+	handoffs   = make(map[string]handoff)
+	parentConn *net.UnixConn // set in the new process until Ready
+	upgrading  bool
+)
+
+func send(c *net.UnixConn, m *message, files ...*os.File) error {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var oob []byte
+	if len(files) > 0 {
+		fds := make([]int, len(files))
+		for i, f := range files {
+			// not f.Fd(), which sets the fd shared with the listener or conn to blocking
+			rc, err := f.SyscallConn()
+			if err != nil {
+				return err
+			}
+			if err := rc.Control(func(fd uintptr) { fds[i] = int(fd) }); err != nil {
+				return err
+			}
+		}
+		oob = syscall.UnixRights(fds...)
+	}
+	_, _, err = c.WriteMsgUnix(buf, oob, nil)
+	runtime.KeepAlive(files)
+	return err
+}
+
+func recv(c *net.UnixConn) (*message, []*os.File, error) {
+	buf := make([]byte, messageLenMax)
+	oob := make([]byte, oobLenMax)
+	n, oobn, _, _, err := c.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, nil, err
+	}
+	var files []*os.File
+	if oobn > 0 {
+		scms, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, scm := range scms {
+			fds, err := syscall.ParseUnixRights(&scm)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, fd := range fds {
+				files = append(files, os.NewFile(uintptr(fd), "upgrade"))
+			}
+		}
+	}
+	m := &message{}
+	if err := json.Unmarshal(buf[:n], m); err != nil {
+		return nil, files, err
+	}
+	return m, files, nil
+}
+
+func fileUnixConn(f *os.File) (*net.UnixConn, error) {
+	c, err := net.FileConn(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		c.Close()
+		return nil, ErrUpgradeMessage
+	}
+	return uc, nil
+}
+
+// Init receives listeners from the parent, when started by an upgrade.
+func Init() error {
+	v := os.Getenv(EnvUpgradeFD)
+	if v == "" {
+		return nil
+	}
+	os.Unsetenv(EnvUpgradeFD)
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	c, err := fileUnixConn(os.NewFile(uintptr(fd), "upgrade"))
+	if err != nil {
+		return err
+	}
+	c.SetReadDeadline(time.Now().Add(UpgradeReadyTimeout))
+	m, files, err := recv(c)
+	if err != nil {
+		c.Close()
+		return err
+	}
+	if m.Type != msgListeners || len(m.Names) != len(files) {
+		c.Close()
+		return ErrUpgradeMessage
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	for i, f := range files {
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			log.Error().Err(err).Str("name", m.Names[i]).Msg("upgrade inherit listener")
+			continue
+		}
+		inherited[m.Names[i]] = l
+		log.Info().Str("name", m.Names[i]).Str("addr", l.Addr().String()).Msg("upgrade inherited listener")
+	}
+	parentConn = c
+	return nil
+}
+
+// Listen returns the listener inherited from the parent by name, or listens on addr.
+func Listen(name, addr string) (net.Listener, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	l, ok := inherited[name]
+	if ok {
+		delete(inherited, name)
+	} else {
+		var err error
+		if l, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+	listeners[name] = l
+	return l, nil
+}
+
+// RegisterHandoff registers connection handoff of a component, export is used
+// in the old process and imp in the new.
+func RegisterHandoff(name string, export ExportFunc, imp ImportFunc) {
+	lock.Lock()
+	defer lock.Unlock()
+	handoffs[name] = handoff{export: export, imp: imp}
+}
+
+// Ready tells the parent the servers are started, then imports connections
+// until the parent is done. It does nothing when not started by an upgrade.
+func Ready(ctx context.Context) error {
+	lock.Lock()
+	c := parentConn
+	parentConn = nil
+	for name, l := range inherited { // not used by this version
+		l.Close()
+		delete(inherited, name)
+	}
+	lock.Unlock()
+	if c == nil {
+		return nil
+	}
+	defer c.Close()
+
+	if err := send(c, &message{Type: msgReady}); err != nil {
+		return err
+	}
+	c.SetReadDeadline(time.Time{}) // set by Init
+	stop := context.AfterFunc(ctx, func() { c.SetReadDeadline(time.Now()) })
+	defer stop()
+	imported := 0
+	for {
+		m, files, err := recv(c)
+		if err != nil {
+			return err
+		}
+		switch m.Type {
+		case msgDone:
+			log.Info().Int("imported", imported).Msg("upgrade done")
+			return nil
+		case msgConn:
+			lock.Lock()
+			h, ok := handoffs[m.Name]
+			lock.Unlock()
+			if !ok || len(files) != 1 {
+				log.Error().Str("name", m.Name).Int("files", len(files)).Msg("upgrade import, unknown conn")
+				for _, f := range files {
+					f.Close()
+				}
+				continue
+			}
+			if err := h.imp(m.State, files[0]); err != nil {
+				log.Error().Err(err).Str("name", m.Name).Msg("upgrade import")
+				continue
+			}
+			imported++
+		default:
+			for _, f := range files {
+				f.Close()
+			}
+			return ErrUpgradeMessage
+		}
+	}
+}
+
+func listenerFile(l net.Listener) (*os.File, error) {
+	fl, ok := l.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, ErrUpgradeMessage
+	}
+	return fl.File()
+}
+
+// Upgrade execs the binary with the same arguments and hands listeners over,
+// then exports connections if exportConns. The caller should shut down after
+// it returns nil, the old process keeps serving if it returns an error.
+func Upgrade(ctx context.Context, exportConns bool) error {
+	lock.Lock()
+	if upgrading {
+		lock.Unlock()
+		return ErrUpgradeInProgress
+	}
+	upgrading = true
+	names := make([]string, 0, len(listeners))
+	files := make([]*os.File, 0, len(listeners))
+	for name, l := range listeners {
+		f, err := listenerFile(l)
+		if err != nil {
+			log.Warn().Err(err).Str("name", name).Msg("upgrade listener not passed")
+			continue
+		}
+		names = append(names, name)
+		files = append(files, f)
+	}
+	lock.Unlock()
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	err := upgrade(ctx, names, files, exportConns)
+	if err != nil {
+		lock.Lock()
+		upgrading = false
+		lock.Unlock()
+	}
+	return err
+}
+
+func upgrade(ctx context.Context, names []string, files []*os.File, exportConns bool) error {
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	c, err := fileUnixConn(os.NewFile(uintptr(fds[0]), "upgrade"))
+	if err != nil {
+		syscall.Close(fds[1])
+		return err
+	}
+	defer c.Close()
+	childFile := os.NewFile(uintptr(fds[1]), "upgrade")
+
+	exe, err := os.Executable()
+	if err != nil {
+		childFile.Close()
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{childFile} // fd 3
+	cmd.Env = append(os.Environ(), EnvUpgradeFD+"=3")
+	err = cmd.Start()
+	childFile.Close()
+	if err != nil {
+		return err
+	}
+	log.Info().Int("pid", cmd.Process.Pid).Str("exe", exe).Msg("upgrade child started")
+	exited := make(chan struct{})
+	go func() {
+		err := cmd.Wait()
+		log.Info().Err(err).Int("pid", cmd.Process.Pid).Msg("upgrade child exit")
+		close(exited)
+	}()
+	fail := func(err error) error {
+		cmd.Process.Kill()
+		return err
+	}
+
+	if err := send(c, &message{Type: msgListeners, Names: names}, files...); err != nil {
+		return fail(err)
+	}
+	ready := make(chan error, 1)
+	go func() {
+		c.SetReadDeadline(time.Now().Add(UpgradeReadyTimeout))
+		m, files, err := recv(c)
+		for _, f := range files {
+			f.Close()
+		}
+		if err == nil && m.Type != msgReady {
+			err = ErrUpgradeMessage
+		}
+		ready <- err
+	}()
+	select {
+	case err := <-ready:
+		if err != nil {
+			return fail(err)
+		}
+	case <-exited:
+		return ErrUpgradeChildExit
+	case <-ctx.Done():
+		return fail(ctx.Err())
+	}
+	log.Info().Int("pid", cmd.Process.Pid).Msg("upgrade child ready")
+
+	if exportConns {
+		exportCtx, exportCancel := context.WithTimeout(ctx, UpgradeExportTimeout)
+		exportAll(exportCtx, c)
+		exportCancel()
+	}
+	return send(c, &message{Type: msgDone})
+}
+
+func exportAll(ctx context.Context, c *net.UnixConn) {
+	lock.Lock()
+	hs := make(map[string]handoff, len(handoffs))
+	for name, h := range handoffs {
+		hs[name] = h
+	}
+	lock.Unlock()
+
+	sendLock := sync.Mutex{}
+	wait := &sync.WaitGroup{}
+	for name, h := range hs {
+		wait.Add(1)
+		go func(name string, h handoff) {
+			defer wait.Done()
+			exported := 0
+			h.export(ctx, func(state []byte, f *os.File) error {
+				sendLock.Lock()
+				defer sendLock.Unlock()
+				err := send(c, &message{Type: msgConn, Name: name, State: state}, f)
+				if err == nil {
+					exported++
+				}
+				return err
+			})
+			log.Info().Str("name", name).Int("exported", exported).Msg("upgrade export")
+		}(name, h)
+	}
+	wait.Wait()
+}
@@ -0,0 +1,80 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package upgrade
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func socketpair(t *testing.T) (*net.UnixConn, *net.UnixConn) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_SEQPACKET|syscall.SOCK_CLOEXEC, 0)
+	assert.NilError(t, err)
+	a, err := fileUnixConn(os.NewFile(uintptr(fds[0]), "a"))
+	assert.NilError(t, err)
+	b, err := fileUnixConn(os.NewFile(uintptr(fds[1]), "b"))
+	assert.NilError(t, err)
+	return a, b
+}
+
+func TestSendListener(t *testing.T) {
+
+	parent, child := socketpair(t)
+	defer parent.Close()
+	defer child.Close()
+
+	l, err := Listen("test", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer l.Close()
+	f, err := listenerFile(l)
+	assert.NilError(t, err)
+	defer f.Close()
+
+	assert.NilError(t, send(parent, &message{Type: msgListeners, Names: []string{"test"}}, f))
+	m, files, err := recv(child)
+	assert.NilError(t, err)
+	assert.Equal(t, m.Type, msgListeners)
+	assert.DeepEqual(t, m.Names, []string{"test"})
+	assert.Equal(t, len(files), 1)
+
+	inheritedListener, err := net.FileListener(files[0])
+	files[0].Close()
+	assert.NilError(t, err)
+	defer inheritedListener.Close()
+	assert.Equal(t, inheritedListener.Addr().String(), l.Addr().String())
+
+	// accepts on the same socket after the original closed
+	l.Close()
+	conn, err := net.Dial("tcp", inheritedListener.Addr().String())
+	assert.NilError(t, err)
+	defer conn.Close()
+	accepted, err := inheritedListener.Accept()
+	assert.NilError(t, err)
+	accepted.Close()
+}
+
+func TestReadyNotUpgraded(t *testing.T) {
+	assert.NilError(t, Init())
+	assert.NilError(t, Ready(context.Background()))
+}
@@ -28,6 +28,7 @@ const (
 	Code_ParaInvalid = RemoteCode(0x04)
 	Code_LengthErr   = RemoteCode(0x05)
 	Code_ResNotFound = RemoteCode(0x06)
+	Code_TryLater    = RemoteCode(0x07) // server busy or device locked out, with retry-after
 )
 
 func (c RemoteCode) String() string {
@@ -46,6 +47,8 @@ func (c RemoteCode) String() string {
 		return "Code_LengthErr"
 	case Code_ResNotFound:
 		return "Code_ResNotFound"
+	case Code_TryLater:
+		return "Code_TryLater"
 	default:
 	}
 	return "Code_UndefineError"
@@ -35,6 +35,7 @@ const (
 	MsgType_DeviceSendResp   MsgType = 6
 	MsgType_ServerSendReq    MsgType = 7
 	MsgType_ServerSendResp   MsgType = 8
+	MsgType_ServerGoaway     MsgType = 9 // server asks the device to reconnect, no response
 )
 
 func (t MsgType) String() string {
@@ -57,6 +58,8 @@ func (t MsgType) String() string {
 		return "MsgType_ServerSendReq"
 	case MsgType_ServerSendResp:
 		return "MsgType_ServerSendResp"
+	case MsgType_ServerGoaway:
+		return "MsgType_ServerGoaway"
 	default:
 	}
 	return "MsgType_UndefineError"
@@ -107,7 +110,8 @@ type VerifydReq struct {
 }
 
 type VerifyResp struct {
-	Header *Header
+	Header     *Header
+	RetryAfter uint16 // seconds, body of Code_TryLater
 }
 type PingReq struct {
 	Header  *Header
@@ -116,6 +120,10 @@ type PingReq struct {
 type PingResp struct {
 	Header *Header
 }
+type Goaway struct {
+	Header     *Header
+	RetryAfter uint16 // seconds, optional body
+}
 type SendReq struct {
 	Header *Header
 	Body   []byte
@@ -247,9 +255,37 @@ func DecodeVerifyResp(buf []byte) (*VerifyResp, error) {
 	}
 	resp := new(VerifyResp)
 	resp.Header = header
+	if header.BodyLen == 2 && len(buf) >= int(HeaderLen)+2 {
+		resp.RetryAfter = (uint16(buf[HeaderLen]) << 8) + uint16(buf[HeaderLen+1])
+	}
 	return resp, nil
 }
+
+// DecodeRetryAfterBody gets the retry-after of a VerifyResp or Goaway body, 0 if absent.
+func DecodeRetryAfterBody(header *Header, buf []byte) (uint16, error) {
+	if nil == header {
+		return 0, ErrHeaderNil
+	}
+	if header.BodyLen == 0 {
+		return 0, nil
+	} else if header.BodyLen != 2 || len(buf) < 2 {
+		return 0, ErrLengthError
+	}
+	return (uint16(buf[0]) << 8) + uint16(buf[1]), nil
+}
+
+// EncodeVerifyResp encodes the response, with the retry-after body for Code_TryLater.
 func EncodeVerifyResp(resp *VerifyResp) ([]byte, error) {
+	if resp.Header.Code == Code_TryLater {
+		buf := make([]byte, int(HeaderLen)+2)
+		resp.Header.BodyLen = 2
+		if err := EncodeHeader(resp.Header, buf); err != nil {
+			return nil, err
+		}
+		buf[HeaderLen] = byte(resp.RetryAfter >> 8)
+		buf[HeaderLen+1] = byte(resp.RetryAfter)
+		return buf, nil
+	}
 	buf := make([]byte, int(HeaderLen))
 	if err := EncodeHeader(resp.Header, buf); err != nil {
 		return nil, err
@@ -298,6 +334,26 @@ func EncodePingResp(resp *PingResp) ([]byte, error) {
 	return buf, nil
 }
 
+// EncodeGoaway encodes the goaway, with the retry-after body if not 0.
+func EncodeGoaway(g *Goaway) ([]byte, error) {
+	if g.RetryAfter > 0 {
+		buf := make([]byte, int(HeaderLen)+2)
+		g.Header.BodyLen = 2
+		if err := EncodeHeader(g.Header, buf); err != nil {
+			return nil, err
+		}
+		buf[HeaderLen] = byte(g.RetryAfter >> 8)
+		buf[HeaderLen+1] = byte(g.RetryAfter)
+		return buf, nil
+	}
+	buf := make([]byte, int(HeaderLen))
+	g.Header.BodyLen = 0
+	if err := EncodeHeader(g.Header, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
 func DecodeSendReq(buf []byte) (*SendReq, error) {
 	header, err := DecodeHeader(buf)
 	if err != nil {
@@ -39,6 +39,10 @@ const (
 	HeaderLen_ObGetNotifyResp = 3
 )
 
+// reserveSealed is the S bit of the Reserve in CoReq and obGetEstebReq sent by
+// the server, the Data is an end-to-end envelope the server does not inspect.
+const reserveSealed uint8 = 0x08
+
 const (
 	OBGET_OBSERVERS_MAX = 256
 )
@@ -92,6 +96,7 @@ func (c StatusCode) Error() string {
 type CoReq struct {
 	HeaderID uint16 // redundant for low level message headerid
 	Method   Method
+	Sealed   bool
 	URI      uint32
 	Data     []byte
 }
@@ -105,6 +110,7 @@ type CoResp struct {
 type ObGetEstabReq struct {
 	HeaderID uint16 // redundant for low level message headerid
 	Method   Method
+	Sealed   bool
 	ObID     uint16
 	URI      uint32
 	Data     []byte
@@ -143,6 +149,7 @@ func DecodeCoReq(headerID uint16, buf []byte) (*CoReq, error) {
 	req := &CoReq{
 		HeaderID: headerID,
 		Method:   Method((buf[0] >> 4) & 0x0F),
+		Sealed:   buf[0]&reserveSealed != 0,
 		URI:      (uint32(buf[1]) << 24) + (uint32(buf[2]) << 16) + (uint32(buf[3]) << 8) + uint32(buf[4]),
 		Data:     buf[5:],
 	}
@@ -153,6 +160,9 @@ func EncodeCoReq(req *CoReq, buf []byte) error {
 		return ErrNotEnought
 	}
 	buf[0] = (uint8(req.Method) << 4) & 0xF0
+	if req.Sealed {
+		buf[0] |= reserveSealed
+	}
 	buf[1] = uint8(req.URI>>24) & 0xFF
 	buf[2] = uint8(req.URI>>16) & 0xFF
 	buf[3] = uint8(req.URI>>8) & 0xFF
@@ -263,6 +273,9 @@ func EncodeObGetEstabReq(req *ObGetEstabReq, buf []byte) error {
 		return ErrNotEnought
 	}
 	buf[0] = (uint8(req.Method) << 4) & 0xF0
+	if req.Sealed {
+		buf[0] |= reserveSealed
+	}
 	buf[1] = uint8(req.ObID>>8) & 0xFF
 	buf[2] = uint8(req.ObID) & 0xFF
 	buf[3] = uint8(req.URI>>24) & 0xFF
@@ -298,6 +311,7 @@ func DecodeObGetEstabReq(headerID uint16, buf []byte) (*ObGetEstabReq, error) {
 	req := &ObGetEstabReq{
 		HeaderID: headerID,
 		Method:   Method((buf[0] >> 4) & 0x0F),
+		Sealed:   buf[0]&reserveSealed != 0,
 		ObID:     (uint16(buf[1]) << 8) + uint16(buf[2]),
 		URI:      (uint32(buf[3]) << 24) + (uint32(buf[4]) << 16) + (uint32(buf[5]) << 8) + uint32(buf[6]),
 		Data:     buf[7:],
@@ -428,3 +442,89 @@ func DecodeObGetNotifyResp(headerID uint16, buf []byte) (*ObGetNotifyResp, error
 	}
 	return resp, nil
 }
+
+// Device-initiated ObservedGet (M2S), the establish over DeviceSendReq and
+// the notifications over ServerSendReq.
+
+// IsObGetEstabReq tells an obGetEstabReq from an obGetNotifyReq of the same
+// message type, the Reserve of obGetEstabReq is where obGetNotifyReq has its Status.
+// The S bit is ignored, a notification is Continue or Terminate.
+func IsObGetEstabReq(buf []byte) bool {
+	return len(buf) >= HeaderLen_RestMin && StatusCode(buf[0]&0x07) == StatusCode_Unknown
+}
+func EncodeObGetEstabReq_OverDeviceSendReq(req *ObGetEstabReq, buf []byte) error {
+	if len(buf) < int(HeaderLen+HeaderLen_ObGetEstabReq)+len(req.Data) {
+		return ErrNotEnought
+	}
+	if err := EncodeObGetEstabReq(req, buf[HeaderLen:]); err != nil {
+		return err
+	}
+	header := &Header{
+		Version: Version,
+		Type:    MsgType_DeviceSendReq,
+		ID:      req.HeaderID,
+		BodyLen: HeaderLen_ObGetEstabReq + uint16(len(req.Data)),
+		Code:    Code_Success,
+	}
+	if err := EncodeHeader(header, buf[:HeaderLen]); err != nil {
+		return err
+	}
+	return nil
+}
+func EncodeObGetEstabResp_OverDeviceSendResp(resp *ObGetEstabResp, buf []byte) error {
+	if len(buf) < int(HeaderLen+HeaderLen_ObGetEstabResp) {
+		return ErrNotEnought
+	}
+	if err := EncodeObGetEstabResp(resp, buf[HeaderLen:]); err != nil {
+		return err
+	}
+	header := &Header{
+		Version: Version,
+		Type:    MsgType_DeviceSendResp,
+		ID:      resp.HeaderID,
+		BodyLen: HeaderLen_ObGetEstabResp,
+		Code:    Code_Success,
+	}
+	if err := EncodeHeader(header, buf[:HeaderLen]); err != nil {
+		return err
+	}
+	return nil
+}
+func EncodeObGetNotifyReq_OverServerSendReq(req *ObGetNotifyReq, buf []byte) error {
+	if len(buf) < int(HeaderLen+HeaderLen_ObGetNotifyReq)+len(req.Data) {
+		return ErrNotEnought
+	}
+	if err := EncodeObGetNotifyReq(req, buf[HeaderLen:]); err != nil {
+		return err
+	}
+	header := &Header{
+		Version: Version,
+		Type:    MsgType_ServerSendReq,
+		ID:      req.HeaderID,
+		BodyLen: HeaderLen_ObGetNotifyReq + uint16(len(req.Data)),
+		Code:    Code_Success,
+	}
+	if err := EncodeHeader(header, buf[:HeaderLen]); err != nil {
+		return err
+	}
+	return nil
+}
+func EncodeObGetNotifyResp_OverServerSendResp(resp *ObGetNotifyResp, buf []byte) error {
+	if len(buf) < int(HeaderLen+HeaderLen_ObGetNotifyResp) {
+		return ErrNotEnought
+	}
+	if err := EncodeObGetNotifyResp(resp, buf[HeaderLen:]); err != nil {
+		return err
+	}
+	header := &Header{
+		Version: Version,
+		Type:    MsgType_ServerSendResp,
+		ID:      resp.HeaderID,
+		BodyLen: HeaderLen_ObGetNotifyResp,
+		Code:    Code_Success,
+	}
+	if err := EncodeHeader(header, buf[:HeaderLen]); err != nil {
+		return err
+	}
+	return nil
+}
@@ -223,3 +223,89 @@ func TestDecodeSendResp(t *testing.T) {
 	t.Logf("req=%v", req)
 
 }
+
+func TestEncodeGoaway(t *testing.T) {
+	g := &Goaway{
+		Header: &Header{
+			Version: Version,
+			Type:    MsgType_ServerGoaway,
+			ID:      0x0102,
+		},
+	}
+	buf, err := EncodeGoaway(g)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, buf, []byte{0x90, 0x01, 0x02, 0x00, 0x00})
+
+	header, err := DecodeHeader(buf)
+	assert.NilError(t, err)
+	assert.Equal(t, header.Type, MsgType_ServerGoaway)
+	assert.Equal(t, header.BodyLen, uint16(0))
+}
+
+func TestEncodeRetryAfter(t *testing.T) {
+	buf, err := EncodeGoaway(&Goaway{
+		Header: &Header{
+			Version: Version,
+			Type:    MsgType_ServerGoaway,
+			ID:      0x0102,
+		},
+		RetryAfter: 0x0304,
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, buf, []byte{0x90, 0x01, 0x02, 0x00, 0x02, 0x03, 0x04})
+	header, err := DecodeHeader(buf)
+	assert.NilError(t, err)
+	retryAfter, err := DecodeRetryAfterBody(header, buf[HeaderLen:])
+	assert.NilError(t, err)
+	assert.Equal(t, retryAfter, uint16(0x0304))
+
+	buf, err = EncodeVerifyResp(&VerifyResp{
+		Header: &Header{
+			Version: Version,
+			Type:    MsgType_DeviceVerifyResp,
+			ID:      0x0102,
+			Code:    Code_TryLater,
+		},
+		RetryAfter: 30,
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, buf, []byte{0x27, 0x01, 0x02, 0x00, 0x02, 0x00, 30})
+	resp, err := DecodeVerifyResp(buf)
+	assert.NilError(t, err)
+	assert.Equal(t, resp.Header.Code, Code_TryLater)
+	assert.Equal(t, resp.RetryAfter, uint16(30))
+
+	// retry-after only with Code_TryLater
+	buf, err = EncodeVerifyResp(&VerifyResp{
+		Header:     &Header{Version: Version, Type: MsgType_DeviceVerifyResp, ID: 1, Code: Code_VerifyFail},
+		RetryAfter: 30,
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(buf), int(HeaderLen))
+}
+
+func TestEncodeSealed(t *testing.T) {
+	buf := make([]byte, HeaderLen_CoReq+2)
+	err := EncodeCoReq(&CoReq{Method: Method_ConstrainedPost, Sealed: true, URI: 0x01020304, Data: []byte{0x05, 0x06}}, buf)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, buf, []byte{0x28, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06})
+	coReq, err := DecodeCoReq(1, buf)
+	assert.NilError(t, err)
+	assert.Equal(t, coReq.Sealed, true)
+	assert.Equal(t, coReq.Method, Method_ConstrainedPost)
+
+	buf = make([]byte, HeaderLen_ObGetEstabReq)
+	err = EncodeObGetEstabReq(&ObGetEstabReq{Method: Method_ObservedGet, Sealed: true, ObID: 1, URI: 2}, buf)
+	assert.NilError(t, err)
+	assert.Equal(t, buf[0], uint8(0x38))
+	assert.Assert(t, IsObGetEstabReq(buf))
+	obReq, err := DecodeObGetEstabReq(1, buf)
+	assert.NilError(t, err)
+	assert.Equal(t, obReq.Sealed, true)
+
+	// notifications are not taken as sealed establishes
+	buf = make([]byte, HeaderLen_ObGetNotifyReq)
+	err = EncodeObGetNotifyReq(&ObGetNotifyReq{Method: Method_ObservedGet, Code: StatusCode_Terminate, ObID: 1}, buf)
+	assert.NilError(t, err)
+	assert.Assert(t, !IsObGetEstabReq(buf))
+}
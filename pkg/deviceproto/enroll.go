@@ -0,0 +1,142 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package deviceproto
+
+import (
+	"bytes"
+)
+
+// Enrollment is the variant of DeviceVerifyReq with the E bit of Specifics
+// set, VerifyData is ClaimToken[:Serial]. The server answers DeviceVerifyResp
+// with DeviceID:DeviceSecret as body on success.
+const (
+	ClaimTokenLenMin   uint16 = 16
+	ClaimTokenLenMax   uint16 = 128
+	DeviceSerialLenMax uint16 = 64
+	specificsEnroll    uint8  = 0x20
+)
+
+type EnrollReq struct {
+	Header     *Header
+	ClaimToken string
+	Serial     string // optional, such as the hardware serial number
+}
+
+type EnrollResp struct {
+	Header       *Header
+	DeviceID     string
+	DeviceSecret string
+}
+
+// IsEnrollReqBody tells whether a DeviceVerifyReq body is an enrollment.
+func IsEnrollReqBody(buf []byte) bool {
+	return len(buf) > 0 && buf[0]&specificsEnroll != 0
+}
+
+func EncodeEnrollReq(req *EnrollReq) ([]byte, error) {
+	if len(req.ClaimToken) < int(ClaimTokenLenMin) || len(req.ClaimToken) > int(ClaimTokenLenMax) ||
+		bytes.IndexByte([]byte(req.ClaimToken), ':') != -1 || len(req.Serial) > int(DeviceSerialLenMax) {
+		return nil, ErrVerifyData
+	}
+	enrollData := req.ClaimToken
+	if req.Serial != "" {
+		enrollData += ":" + req.Serial
+	}
+	bodyLen := len(enrollData) + 1
+	buf := make([]byte, int(HeaderLen)+bodyLen)
+	buf[HeaderLen] = specificsEnroll
+	copy(buf[HeaderLen+1:], enrollData)
+	req.Header.BodyLen = uint16(bodyLen)
+	if err := EncodeHeader(req.Header, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func DecodeEnrollReqBody(header *Header, buf []byte) (*EnrollReq, error) {
+	if nil == header {
+		return nil, ErrHeaderNil
+	}
+	if len(buf) < int(1+ClaimTokenLenMin) {
+		return nil, ErrNotEnought
+	}
+	if len(buf) > int(1+ClaimTokenLenMax+1+DeviceSerialLenMax) {
+		return nil, ErrExceedLength
+	}
+	if !IsEnrollReqBody(buf) {
+		return nil, ErrVerifyData
+	}
+	req := &EnrollReq{Header: header}
+	enrollData := buf[1:]
+	if p := bytes.IndexByte(enrollData, ':'); p != -1 {
+		req.ClaimToken = string(enrollData[:p])
+		req.Serial = string(enrollData[p+1:])
+	} else {
+		req.ClaimToken = string(enrollData)
+	}
+	if len(req.ClaimToken) < int(ClaimTokenLenMin) || len(req.ClaimToken) > int(ClaimTokenLenMax) ||
+		len(req.Serial) > int(DeviceSerialLenMax) {
+		return nil, ErrVerifyData
+	}
+	return req, nil
+}
+
+// EncodeEnrollResp encodes the response, with DeviceID:DeviceSecret as body
+// for Code_Success, use EncodeVerifyResp for other codes.
+func EncodeEnrollResp(resp *EnrollResp) ([]byte, error) {
+	if resp.Header.Code != Code_Success {
+		return EncodeVerifyResp(&VerifyResp{Header: resp.Header})
+	}
+	if len(resp.DeviceID) != int(DeviceIDLen) ||
+		len(resp.DeviceSecret) < int(DeviceSecretLenMin) || len(resp.DeviceSecret) > int(DeviceSecretLenMax) {
+		return nil, ErrVerifyData
+	}
+	verifyData := resp.DeviceID + ":" + resp.DeviceSecret
+	buf := make([]byte, int(HeaderLen)+len(verifyData))
+	resp.Header.BodyLen = uint16(len(verifyData))
+	if err := EncodeHeader(resp.Header, buf); err != nil {
+		return nil, err
+	}
+	copy(buf[HeaderLen:], verifyData)
+	return buf, nil
+}
+
+// DecodeEnrollRespBody gets the credentials of a Code_Success response.
+func DecodeEnrollRespBody(header *Header, buf []byte) (*EnrollResp, error) {
+	if nil == header {
+		return nil, ErrHeaderNil
+	}
+	resp := &EnrollResp{Header: header}
+	if header.Code != Code_Success {
+		return resp, nil
+	}
+	if len(buf) < int(header.BodyLen) {
+		return nil, ErrNotEnought
+	}
+	p := bytes.IndexByte(buf[:header.BodyLen], ':')
+	if p != int(DeviceIDLen) {
+		return nil, ErrVerifyData
+	}
+	resp.DeviceID = string(buf[:p])
+	resp.DeviceSecret = string(buf[p+1 : header.BodyLen])
+	if len(resp.DeviceSecret) < int(DeviceSecretLenMin) || len(resp.DeviceSecret) > int(DeviceSecretLenMax) {
+		return nil, ErrVerifyData
+	}
+	return resp, nil
+}
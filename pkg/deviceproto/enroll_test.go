@@ -0,0 +1,69 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package deviceproto
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestEncodeEnrollReq(t *testing.T) {
+	header := &Header{Version: Version, Type: MsgType_DeviceVerifyReq, ID: 0x1234}
+	buf, err := EncodeEnrollReq(&EnrollReq{Header: header, ClaimToken: "batch1-0123456789abcdef", Serial: "SN0001"})
+	assert.NilError(t, err)
+	h, err := DecodeHeader(buf)
+	assert.NilError(t, err)
+	assert.Equal(t, MsgType_DeviceVerifyReq, h.Type)
+	assert.Equal(t, true, IsEnrollReqBody(buf[HeaderLen:]))
+
+	req, err := DecodeEnrollReqBody(h, buf[HeaderLen:])
+	assert.NilError(t, err)
+	assert.Equal(t, "batch1-0123456789abcdef", req.ClaimToken)
+	assert.Equal(t, "SN0001", req.Serial)
+
+	// not taken for a verify request, nor an enrollment by old servers
+	_, err = DecodeVerifyReqBody(h, buf[HeaderLen:])
+	assert.Assert(t, err != nil)
+	verifyBuf, err := EncodeVerifyReq(&VerifydReq{Header: header, DeviceID: "cfa09baa-4913-4ad7-a936-3e26f9671b09", DeviceSecret: "mb6bgso4EChvyzA05thF9+wH"})
+	assert.NilError(t, err)
+	assert.Equal(t, false, IsEnrollReqBody(verifyBuf[HeaderLen:]))
+
+	_, err = EncodeEnrollReq(&EnrollReq{Header: header, ClaimToken: "short"})
+	assert.Equal(t, ErrVerifyData, err)
+	_, err = EncodeEnrollReq(&EnrollReq{Header: header, ClaimToken: "batch1:0123456789abcdef"})
+	assert.Equal(t, ErrVerifyData, err)
+}
+
+func TestEncodeEnrollResp(t *testing.T) {
+	header := &Header{Version: Version, Type: MsgType_DeviceVerifyResp, ID: 0x1234, Code: Code_Success}
+	buf, err := EncodeEnrollResp(&EnrollResp{Header: header, DeviceID: "cfa09baa-4913-4ad7-a936-3e26f9671b09", DeviceSecret: "mb6bgso4EChvyzA05thF9+wH"})
+	assert.NilError(t, err)
+	h, err := DecodeHeader(buf)
+	assert.NilError(t, err)
+	resp, err := DecodeEnrollRespBody(h, buf[HeaderLen:])
+	assert.NilError(t, err)
+	assert.Equal(t, "cfa09baa-4913-4ad7-a936-3e26f9671b09", resp.DeviceID)
+	assert.Equal(t, "mb6bgso4EChvyzA05thF9+wH", resp.DeviceSecret)
+
+	header.Code = Code_VerifyFail
+	buf, err = EncodeEnrollResp(&EnrollResp{Header: header})
+	assert.NilError(t, err)
+	assert.Equal(t, int(HeaderLen), len(buf))
+}
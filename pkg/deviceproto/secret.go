@@ -0,0 +1,102 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package deviceproto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+// Secret rotation, the server posts the new secret to URI_SecretRotation by
+// ConstrainedPost, the device responds the ack after persisting it.
+//
+// Request data: Version(1) | Nonce(12) | AES-256-GCM(NewSecret) with Tag(16),
+// key = HMAC-SHA256(OldSecret, "rtio-secret-rotation"), additional data = DeviceID.
+// Response data: HMAC-SHA256(NewSecret, "rtio-secret-rotation-ack" | Nonce).
+const (
+	URI_SecretRotation     = "/rtio/secret"
+	SecretRotationVersion  = 1
+	secretRotationNonceLen = 12
+	secretRotationKeyInfo  = "rtio-secret-rotation"
+	secretRotationAckInfo  = "rtio-secret-rotation-ack"
+)
+
+var (
+	ErrSecretRotation = errors.New("ErrSecretRotation")
+)
+
+func secretRotationAEAD(secret string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(secretRotationKeyInfo))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealSecret encrypts the new secret by the current secret of the device.
+func SealSecret(deviceID, secret, newSecret string) ([]byte, error) {
+	if len(newSecret) < int(DeviceSecretLenMin) || len(newSecret) > int(DeviceSecretLenMax) {
+		return nil, ErrVerifyData
+	}
+	aead, err := secretRotationAEAD(secret)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1+secretRotationNonceLen, 1+secretRotationNonceLen+len(newSecret)+aead.Overhead())
+	buf[0] = SecretRotationVersion
+	if _, err := rand.Read(buf[1:]); err != nil {
+		return nil, err
+	}
+	return aead.Seal(buf, buf[1:], []byte(newSecret), []byte(deviceID)), nil
+}
+
+// OpenSecret decrypts the new secret sealed by SealSecret.
+func OpenSecret(deviceID, secret string, data []byte) (string, error) {
+	if len(data) < 1+secretRotationNonceLen || data[0] != SecretRotationVersion {
+		return "", ErrSecretRotation
+	}
+	aead, err := secretRotationAEAD(secret)
+	if err != nil {
+		return "", err
+	}
+	plain, err := aead.Open(nil, data[1:1+secretRotationNonceLen], data[1+secretRotationNonceLen:], []byte(deviceID))
+	if err != nil {
+		return "", ErrSecretRotation
+	}
+	if len(plain) < int(DeviceSecretLenMin) || len(plain) > int(DeviceSecretLenMax) {
+		return "", ErrSecretRotation
+	}
+	return string(plain), nil
+}
+
+// SecretRotationAck proves the device got the new secret of the sealed data.
+func SecretRotationAck(newSecret string, data []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(newSecret))
+	mac.Write([]byte(secretRotationAckInfo))
+	if len(data) >= 1+secretRotationNonceLen {
+		mac.Write(data[1 : 1+secretRotationNonceLen])
+	}
+	return mac.Sum(nil)
+}
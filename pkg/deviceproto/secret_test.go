@@ -0,0 +1,57 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package deviceproto
+
+import (
+	"crypto/hmac"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestSealSecret(t *testing.T) {
+	deviceID := "cfa09baa-4913-4ad7-a936-3e26f9671b09"
+	secret := "mb6bgso4EChvyzA05thF9+wH"
+	newSecret := "Pq0Hk2t8W1xYz9abCdEfGhIj"
+
+	data, err := SealSecret(deviceID, secret, newSecret)
+	assert.NilError(t, err)
+	assert.Equal(t, uint8(SecretRotationVersion), data[0])
+
+	s, err := OpenSecret(deviceID, secret, data)
+	assert.NilError(t, err)
+	assert.Equal(t, newSecret, s)
+	assert.Equal(t, true, hmac.Equal(SecretRotationAck(newSecret, data), SecretRotationAck(s, data)))
+
+	// sealed for another device or by another secret
+	_, err = OpenSecret("cfa09baa-4913-4ad7-a936-3e26f9671b10", secret, data)
+	assert.Equal(t, ErrSecretRotation, err)
+	_, err = OpenSecret(deviceID, newSecret, data)
+	assert.Equal(t, ErrSecretRotation, err)
+	_, err = OpenSecret(deviceID, secret, data[:10])
+	assert.Equal(t, ErrSecretRotation, err)
+
+	// nonce differs each time
+	data2, err := SealSecret(deviceID, secret, newSecret)
+	assert.NilError(t, err)
+	assert.Equal(t, false, hmac.Equal(SecretRotationAck(newSecret, data), SecretRotationAck(newSecret, data2)))
+
+	_, err = SealSecret(deviceID, secret, "short")
+	assert.Equal(t, ErrVerifyData, err)
+}
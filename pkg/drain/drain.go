@@ -0,0 +1,79 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+// Package drain runs the graceful shutdown steps of components in the process.
+package drain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Func stops accepting new work and returns when in-flight work is done,
+// it must return soon after ctx done.
+type Func func(ctx context.Context)
+
+type namedFunc struct {
+	name string
+	f    Func
+}
+
+type Drainer struct {
+	lock  sync.Mutex
+	funcs []namedFunc
+}
+
+func NewDrainer() *Drainer {
+	return &Drainer{}
+}
+
+var Default = NewDrainer()
+
+func (d *Drainer) Register(name string, f Func) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.funcs = append(d.funcs, namedFunc{name: name, f: f})
+}
+
+// Drain runs all funcs concurrently, returns when all returned.
+func (d *Drainer) Drain(ctx context.Context) {
+	d.lock.Lock()
+	funcs := append([]namedFunc(nil), d.funcs...)
+	d.lock.Unlock()
+
+	wait := &sync.WaitGroup{}
+	for _, nf := range funcs {
+		wait.Add(1)
+		go func(nf namedFunc) {
+			defer wait.Done()
+			log.Info().Str("name", nf.name).Msg("drain start")
+			nf.f(ctx)
+			log.Info().Str("name", nf.name).Err(ctx.Err()).Msg("drain end")
+		}(nf)
+	}
+	wait.Wait()
+}
+
+func Register(name string, f Func) {
+	Default.Register(name, f)
+}
+func Drain(ctx context.Context) {
+	Default.Drain(ctx)
+}
@@ -0,0 +1,62 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package drain
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestDrain(t *testing.T) {
+	d := NewDrainer()
+	var drained atomic.Int32
+	started := make(chan struct{})
+	d.Register("fast", func(ctx context.Context) {
+		drained.Add(1)
+	})
+	d.Register("slow", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		drained.Add(1)
+	})
+
+	// funcs run concurrently, Drain returns when all returned
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Drain(ctx)
+		close(done)
+	}()
+	<-started
+	select {
+	case <-done:
+		t.Fatal("drained before the slow func returned")
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+	<-done
+	assert.Equal(t, drained.Load(), int32(2))
+
+	// nothing registered
+	NewDrainer().Drain(context.Background())
+}
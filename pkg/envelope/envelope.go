@@ -0,0 +1,327 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+// Package envelope seals payloads end to end between the app and the device,
+// the hub routes envelopes as opaque bytes.
+//
+// Envelope: Version(1) | KeyID(2) | Nonce(12) | AES-256-GCM(Timestamp(8) | Counter(8) | Payload) with Tag(16),
+// additional data = Version | KeyID | Nonce | Direction | len(DeviceID)(2) | DeviceID | URI.
+// Timestamp is in Unix milliseconds, a keyring rejects stale and replayed envelopes.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	Version   = 1
+	KeySize   = 32
+	HeaderLen = 15 // Version, KeyID and Nonce
+	StampLen  = 16 // Timestamp and Counter
+	Overhead  = HeaderLen + StampLen + 16
+	nonceLen  = 12
+	deriveKey = "rtio-envelope"
+
+	// ReplayWindow is how far the timestamp of an envelope may be from the
+	// clock of the keyring opening it, envelopes seen within it are replays.
+	ReplayWindow = 5 * time.Minute
+)
+
+// Direction binds an envelope to the way it goes, a request can not be
+// replayed as a response.
+type Direction uint8
+
+const (
+	ToDevice   Direction = 1 // CoPost and ObGet requests by the app
+	FromDevice Direction = 2 // responses and notifications by the device
+)
+
+var (
+	ErrKeySize     = errors.New("ErrEnvelopeKeySize")
+	ErrMalformed   = errors.New("ErrEnvelopeMalformed")
+	ErrVersion     = errors.New("ErrEnvelopeVersion")
+	ErrKeyNotFound = errors.New("ErrEnvelopeKeyNotFound")
+	ErrOpen        = errors.New("ErrEnvelopeOpen")
+	ErrKeyCurrent  = errors.New("ErrEnvelopeKeyCurrent")
+	ErrStale       = errors.New("ErrEnvelopeStale")
+	ErrReplay      = errors.New("ErrEnvelopeReplay")
+)
+
+// Stamp is sealed with the payload, the counter tells apart the envelopes of a
+// sender within a millisecond.
+type Stamp struct {
+	Timestamp int64 // Unix milliseconds
+	Counter   uint64
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrKeySize
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func additionalData(header []byte, dir Direction, deviceID, uri string) []byte {
+	ad := make([]byte, 0, len(header)+3+len(deviceID)+len(uri))
+	ad = append(ad, header...)
+	ad = append(ad, byte(dir))
+	ad = binary.BigEndian.AppendUint16(ad, uint16(len(deviceID)))
+	ad = append(ad, deviceID...)
+	return append(ad, uri...)
+}
+
+// Seal seals the stamp and payload with the key of keyID for the device and URI.
+func Seal(key []byte, keyID uint16, stamp Stamp, dir Direction, deviceID, uri string, payload []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	env := make([]byte, HeaderLen, Overhead+len(payload))
+	env[0] = Version
+	binary.BigEndian.PutUint16(env[1:3], keyID)
+	if _, err := rand.Read(env[3:HeaderLen]); err != nil {
+		return nil, err
+	}
+	plain := make([]byte, StampLen, StampLen+len(payload))
+	binary.BigEndian.PutUint64(plain[0:8], uint64(stamp.Timestamp))
+	binary.BigEndian.PutUint64(plain[8:16], stamp.Counter)
+	plain = append(plain, payload...)
+	return aead.Seal(env, env[3:HeaderLen], plain, additionalData(env[:HeaderLen], dir, deviceID, uri)), nil
+}
+
+// KeyID returns the key ID of the envelope, for choosing the key to open it.
+func KeyID(env []byte) (uint16, error) {
+	if len(env) < Overhead {
+		return 0, ErrMalformed
+	}
+	if env[0] != Version {
+		return 0, ErrVersion
+	}
+	return binary.BigEndian.Uint16(env[1:3]), nil
+}
+
+// Open opens the envelope with the key of its key ID, ErrOpen when it was not
+// sealed by the key for the direction, device and URI, or altered. The stamp
+// is not checked, see Keyring.Open.
+func Open(key []byte, dir Direction, deviceID, uri string, env []byte) ([]byte, Stamp, error) {
+	if _, err := KeyID(env); err != nil {
+		return nil, Stamp{}, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, Stamp{}, err
+	}
+	plain, err := aead.Open(nil, env[3:HeaderLen], env[HeaderLen:], additionalData(env[:HeaderLen], dir, deviceID, uri))
+	if err != nil {
+		return nil, Stamp{}, ErrOpen
+	}
+	stamp := Stamp{
+		Timestamp: int64(binary.BigEndian.Uint64(plain[0:8])),
+		Counter:   binary.BigEndian.Uint64(plain[8:16]),
+	}
+	return plain[StampLen:], stamp, nil
+}
+
+// DeriveKey derives the key of a device from a master key, for apps keeping
+// one master instead of a key per device.
+func DeriveKey(master []byte, deviceID string, keyID uint16) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(deriveKey))
+	mac.Write(binary.BigEndian.AppendUint16(nil, keyID))
+	mac.Write([]byte(deviceID))
+	return mac.Sum(nil)
+}
+
+type deviceKeys struct {
+	current uint16
+	keys    map[uint16][]byte
+}
+
+type replayKey struct {
+	deviceID string
+	dir      Direction
+	stamp    Stamp
+}
+
+// Keyring holds the keys by device, envelopes are sealed with the current key
+// and opened with the key of their key ID, so keys rotate without a gap.
+// Opened envelopes are remembered within ReplayWindow, an envelope opened
+// twice or out of the window is rejected. Thread-safe.
+type Keyring struct {
+	mu      sync.RWMutex
+	devices map[string]*deviceKeys
+
+	counter   atomic.Uint64
+	now       func() time.Time
+	replayMu  sync.Mutex
+	seen      map[replayKey]int64 // expiry in Unix milliseconds
+	lastPrune int64
+}
+
+func NewKeyring() *Keyring {
+	k := &Keyring{
+		devices: make(map[string]*deviceKeys),
+		now:     time.Now,
+		seen:    make(map[replayKey]int64),
+	}
+	// a random start keeps the counters of the senders for a device apart
+	var b [8]byte
+	rand.Read(b[:])
+	k.counter.Store(binary.BigEndian.Uint64(b[:]))
+	return k
+}
+
+// Add adds a key of the device, the first key of a device is the current.
+func (k *Keyring) Add(deviceID string, keyID uint16, key []byte) error {
+	if len(key) != KeySize {
+		return ErrKeySize
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	d, ok := k.devices[deviceID]
+	if !ok {
+		d = &deviceKeys{current: keyID, keys: make(map[uint16][]byte)}
+		k.devices[deviceID] = d
+	}
+	d.keys[keyID] = append([]byte(nil), key...)
+	return nil
+}
+
+// SetCurrent sets the key sealing the envelopes of the device.
+func (k *Keyring) SetCurrent(deviceID string, keyID uint16) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	d, ok := k.devices[deviceID]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if _, ok := d.keys[keyID]; !ok {
+		return ErrKeyNotFound
+	}
+	d.current = keyID
+	return nil
+}
+
+// Remove removes a key of the device, the current key can not be removed
+// unless it is the last one.
+func (k *Keyring) Remove(deviceID string, keyID uint16) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	d, ok := k.devices[deviceID]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if _, ok := d.keys[keyID]; !ok {
+		return ErrKeyNotFound
+	}
+	if len(d.keys) == 1 {
+		delete(k.devices, deviceID)
+		return nil
+	}
+	if d.current == keyID {
+		return ErrKeyCurrent
+	}
+	delete(d.keys, keyID)
+	return nil
+}
+
+func (k *Keyring) key(deviceID string, keyID uint16, current bool) (uint16, []byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	d, ok := k.devices[deviceID]
+	if !ok {
+		return 0, nil, ErrKeyNotFound
+	}
+	if current {
+		keyID = d.current
+	}
+	key, ok := d.keys[keyID]
+	if !ok {
+		return 0, nil, ErrKeyNotFound
+	}
+	return keyID, key, nil
+}
+
+// Seal seals the payload with the current key of the device.
+func (k *Keyring) Seal(dir Direction, deviceID, uri string, payload []byte) ([]byte, error) {
+	keyID, key, err := k.key(deviceID, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	stamp := Stamp{Timestamp: k.now().UnixMilli(), Counter: k.counter.Add(1)}
+	return Seal(key, keyID, stamp, dir, deviceID, uri, payload)
+}
+
+// Open opens the envelope with the key of its key ID, ErrStale when its
+// timestamp is out of ReplayWindow and ErrReplay when it was opened before.
+func (k *Keyring) Open(dir Direction, deviceID, uri string, env []byte) ([]byte, error) {
+	keyID, err := KeyID(env)
+	if err != nil {
+		return nil, err
+	}
+	_, key, err := k.key(deviceID, keyID, false)
+	if err != nil {
+		return nil, err
+	}
+	payload, stamp, err := Open(key, dir, deviceID, uri, env)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.checkReplay(deviceID, dir, stamp); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// checkReplay remembers the stamp until it is out of the window.
+func (k *Keyring) checkReplay(deviceID string, dir Direction, stamp Stamp) error {
+	now := k.now().UnixMilli()
+	window := ReplayWindow.Milliseconds()
+	if stamp.Timestamp < now-window || stamp.Timestamp > now+window {
+		return ErrStale
+	}
+	k.replayMu.Lock()
+	defer k.replayMu.Unlock()
+	if now-k.lastPrune > window {
+		for key, expiry := range k.seen {
+			if expiry < now {
+				delete(k.seen, key)
+			}
+		}
+		k.lastPrune = now
+	}
+	key := replayKey{deviceID: deviceID, dir: dir, stamp: stamp}
+	if expiry, ok := k.seen[key]; ok && expiry >= now {
+		return ErrReplay
+	}
+	k.seen[key] = stamp.Timestamp + window
+	return nil
+}
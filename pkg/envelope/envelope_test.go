@@ -0,0 +1,147 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package envelope
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestSealOpen(t *testing.T) {
+	key := DeriveKey([]byte("master"), "dev1", 1)
+	assert.Equal(t, len(key), KeySize)
+
+	stamp := Stamp{Timestamp: 1700000000000, Counter: 7}
+	env, err := Seal(key, 1, stamp, ToDevice, "dev1", "/led", []byte("on"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(env), Overhead+2)
+	keyID, err := KeyID(env)
+	assert.NilError(t, err)
+	assert.Equal(t, keyID, uint16(1))
+
+	payload, opened, err := Open(key, ToDevice, "dev1", "/led", env)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, payload, []byte("on"))
+	assert.Equal(t, opened, stamp)
+
+	// bound to the direction, device and uri
+	_, _, err = Open(key, FromDevice, "dev1", "/led", env)
+	assert.Equal(t, err, ErrOpen)
+	_, _, err = Open(key, ToDevice, "dev2", "/led", env)
+	assert.Equal(t, err, ErrOpen)
+	_, _, err = Open(key, ToDevice, "dev1", "/fan", env)
+	assert.Equal(t, err, ErrOpen)
+
+	// the header is authenticated
+	altered := bytes.Clone(env)
+	altered[2] = 2
+	_, _, err = Open(key, ToDevice, "dev1", "/led", altered)
+	assert.Equal(t, err, ErrOpen)
+
+	_, err = KeyID(env[:Overhead-1])
+	assert.Equal(t, err, ErrMalformed)
+	_, err = Seal(key[:16], 1, stamp, ToDevice, "dev1", "/led", nil)
+	assert.Equal(t, err, ErrKeySize)
+}
+
+func TestKeyring(t *testing.T) {
+	app, device := NewKeyring(), NewKeyring()
+	for _, k := range []*Keyring{app, device} {
+		assert.NilError(t, k.Add("dev1", 1, DeriveKey([]byte("master"), "dev1", 1)))
+	}
+	env, err := app.Seal(ToDevice, "dev1", "/led", []byte("on"))
+	assert.NilError(t, err)
+	payload, err := device.Open(ToDevice, "dev1", "/led", env)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, payload, []byte("on"))
+
+	// rotate, the device opens both keys until the old one is removed
+	assert.NilError(t, device.Add("dev1", 2, DeriveKey([]byte("master"), "dev1", 2)))
+	assert.NilError(t, app.Add("dev1", 2, DeriveKey([]byte("master"), "dev1", 2)))
+	env, err = app.Seal(ToDevice, "dev1", "/led", []byte("on"))
+	assert.NilError(t, err)
+	assert.NilError(t, app.SetCurrent("dev1", 2))
+	env2, err := app.Seal(ToDevice, "dev1", "/led", []byte("off"))
+	assert.NilError(t, err)
+	keyID, _ := KeyID(env2)
+	assert.Equal(t, keyID, uint16(2))
+	_, err = device.Open(ToDevice, "dev1", "/led", env2)
+	assert.NilError(t, err)
+	_, err = device.Open(ToDevice, "dev1", "/led", env)
+	assert.NilError(t, err)
+
+	assert.Equal(t, app.Remove("dev1", 2), ErrKeyCurrent)
+	assert.NilError(t, device.SetCurrent("dev1", 2))
+	assert.NilError(t, device.Remove("dev1", 1))
+	_, err = device.Open(ToDevice, "dev1", "/led", env)
+	assert.Equal(t, err, ErrKeyNotFound)
+
+	_, err = app.Seal(ToDevice, "dev2", "/led", nil)
+	assert.Equal(t, err, ErrKeyNotFound)
+	assert.Equal(t, app.SetCurrent("dev1", 3), ErrKeyNotFound)
+	assert.Equal(t, app.Add("dev1", 3, []byte("short")), ErrKeySize)
+}
+
+func TestKeyringReplay(t *testing.T) {
+	app, device := NewKeyring(), NewKeyring()
+	for _, k := range []*Keyring{app, device} {
+		assert.NilError(t, k.Add("dev1", 1, DeriveKey([]byte("master"), "dev1", 1)))
+	}
+	now := time.Now()
+	device.now = func() time.Time { return now }
+
+	env, err := app.Seal(ToDevice, "dev1", "/led", []byte("on"))
+	assert.NilError(t, err)
+	env2, err := app.Seal(ToDevice, "dev1", "/led", []byte("on"))
+	assert.NilError(t, err)
+	_, err = device.Open(ToDevice, "dev1", "/led", env)
+	assert.NilError(t, err)
+	_, err = device.Open(ToDevice, "dev1", "/led", env)
+	assert.Equal(t, err, ErrReplay)
+	// the same payload sealed again has the next counter
+	_, err = device.Open(ToDevice, "dev1", "/led", env2)
+	assert.NilError(t, err)
+
+	// out of the window, on either side of the clock
+	key := DeriveKey([]byte("master"), "dev1", 1)
+	for _, ts := range []time.Time{now.Add(-ReplayWindow - time.Second), now.Add(ReplayWindow + time.Second)} {
+		stale, err := Seal(key, 1, Stamp{Timestamp: ts.UnixMilli(), Counter: 1}, ToDevice, "dev1", "/led", nil)
+		assert.NilError(t, err)
+		_, err = device.Open(ToDevice, "dev1", "/led", stale)
+		assert.Equal(t, err, ErrStale)
+	}
+
+	// the stamp is authenticated
+	altered := bytes.Clone(env)
+	altered[HeaderLen] ^= 1
+	_, err = device.Open(ToDevice, "dev1", "/led", altered)
+	assert.Equal(t, err, ErrOpen)
+
+	// seen stamps are pruned once out of the window
+	now = now.Add(2*ReplayWindow + time.Second)
+	app.now = func() time.Time { return now }
+	fresh, err := app.Seal(ToDevice, "dev1", "/led", nil)
+	assert.NilError(t, err)
+	_, err = device.Open(ToDevice, "dev1", "/led", fresh)
+	assert.NilError(t, err)
+	assert.Equal(t, len(device.seen), 1)
+}
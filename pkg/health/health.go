@@ -0,0 +1,108 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+// Package health keeps readiness checks of components in the process.
+package health
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrShuttingDown = errors.New("ErrShuttingDown")
+)
+
+type CheckFunc func() error
+
+type Result struct {
+	Name string
+	Err  error
+}
+
+type Checker struct {
+	lock         sync.Mutex
+	checks       map[string]CheckFunc
+	shuttingDown atomic.Bool
+}
+
+func NewChecker() *Checker {
+	return &Checker{checks: make(map[string]CheckFunc)}
+}
+
+var Default = NewChecker()
+
+// Register adds or replaces the readiness check of name.
+func (c *Checker) Register(name string, check CheckFunc) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.checks[name] = check
+}
+
+// SetShuttingDown makes the process not ready, it is not reversible.
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+func (c *Checker) ShuttingDown() bool {
+	return c.shuttingDown.Load()
+}
+
+// Check runs all checks, results are sorted by name.
+func (c *Checker) Check() (bool, []Result) {
+	c.lock.Lock()
+	results := make([]Result, 0, len(c.checks)+1)
+	checks := make(map[string]CheckFunc, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.lock.Unlock()
+
+	ready := true
+	if c.shuttingDown.Load() {
+		ready = false
+		results = append(results, Result{Name: "shutdown", Err: ErrShuttingDown})
+	}
+	for name, check := range checks {
+		err := check()
+		if err != nil {
+			ready = false
+		}
+		results = append(results, Result{Name: name, Err: err})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return ready, results
+}
+
+// Ready is true when all checks pass and not shutting down.
+func (c *Checker) Ready() bool {
+	ready, _ := c.Check()
+	return ready
+}
+
+func Register(name string, check CheckFunc) {
+	Default.Register(name, check)
+}
+func SetShuttingDown() {
+	Default.SetShuttingDown()
+}
+func Ready() bool {
+	return Default.Ready()
+}
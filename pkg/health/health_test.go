@@ -0,0 +1,57 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package health
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestChecker(t *testing.T) {
+	c := NewChecker()
+	assert.Equal(t, c.Ready(), true)
+
+	errDown := errors.New("ErrDown")
+	var err error
+	c.Register("b", func() error { return err })
+	c.Register("a", func() error { return nil })
+	ready, results := c.Check()
+	assert.Equal(t, ready, true)
+	assert.DeepEqual(t, results, []Result{{Name: "a"}, {Name: "b"}})
+
+	err = errDown
+	ready, results = c.Check()
+	assert.Equal(t, ready, false)
+	assert.Equal(t, results[1].Err, errDown)
+
+	// replaced by name
+	c.Register("b", func() error { return nil })
+	assert.Equal(t, c.Ready(), true)
+
+	assert.Equal(t, c.ShuttingDown(), false)
+	c.SetShuttingDown()
+	assert.Equal(t, c.ShuttingDown(), true)
+	ready, results = c.Check()
+	assert.Equal(t, ready, false)
+	assert.Equal(t, len(results), 3)
+	assert.Equal(t, results[2].Name, "shutdown")
+	assert.Equal(t, results[2].Err, ErrShuttingDown)
+}
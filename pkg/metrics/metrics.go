@@ -0,0 +1,353 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+// Package metrics is a minimal metrics registry with counters, gauges and
+// histograms, exposed in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// atomicFloat is a float64 updated by CAS.
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) Add(v float64) {
+	for {
+		old := f.bits.Load()
+		n := math.Float64bits(math.Float64frombits(old) + v)
+		if f.bits.CompareAndSwap(old, n) {
+			return
+		}
+	}
+}
+func (f *atomicFloat) Set(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+type Counter struct {
+	v atomicFloat
+}
+
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add v must not be negative.
+func (c *Counter) Add(v float64) {
+	c.v.Add(v)
+}
+
+type Gauge struct {
+	v atomicFloat
+}
+
+func (g *Gauge) Set(v float64) {
+	g.v.Set(v)
+}
+func (g *Gauge) Inc() {
+	g.v.Add(1)
+}
+func (g *Gauge) Dec() {
+	g.v.Add(-1)
+}
+func (g *Gauge) Add(v float64) {
+	g.v.Add(v)
+}
+
+type Histogram struct {
+	upperBounds []float64
+	counts      []atomic.Uint64 // the last is +Inf
+	sum         atomicFloat
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		upperBounds: buckets,
+		counts:      make([]atomic.Uint64, len(buckets)+1),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	h.counts[i].Add(1)
+	h.sum.Add(v)
+}
+
+// ObserveSince observes seconds elapsed since start.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+type family struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+	buckets    []float64
+	fn         func() float64 // for gauge func
+	children   sync.Map       // label values joined by 0xff -> metric
+}
+
+func (f *family) child(values []string, create func() any) any {
+	if len(values) != len(f.labelNames) {
+		panic("metrics: " + f.name + " label values count not match")
+	}
+	key := strings.Join(values, "\xff")
+	if v, ok := f.children.Load(key); ok {
+		return v
+	}
+	v, _ := f.children.LoadOrStore(key, create())
+	return v
+}
+
+type Registry struct {
+	lock     sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+var Default = NewRegistry()
+
+func (r *Registry) register(f *family) *family {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if old, ok := r.families[f.name]; ok {
+		return old // same metric from more than one instance, such as servers
+	}
+	r.families[f.name] = f
+	return f
+}
+
+type CounterVec struct {
+	f *family
+}
+
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.f.child(values, func() any { return &Counter{} }).(*Counter)
+}
+
+type GaugeVec struct {
+	f *family
+}
+
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return v.f.child(values, func() any { return &Gauge{} }).(*Gauge)
+}
+
+type HistogramVec struct {
+	f *family
+}
+
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.f.child(values, func() any { return newHistogram(v.f.buckets) }).(*Histogram)
+}
+
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{f: r.register(&family{name: name, help: help, typ: typeCounter, labelNames: labelNames})}
+}
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{f: r.register(&family{name: name, help: help, typ: typeGauge, labelNames: labelNames})}
+}
+
+// NewHistogramVec buckets are upper bounds in increasing order, nil for DefaultBuckets.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &HistogramVec{f: r.register(&family{name: name, help: help, typ: typeHistogram, labelNames: labelNames, buckets: buckets})}
+}
+
+// NewGaugeFunc registers a gauge whose value is got by fn when collecting.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&family{name: name, help: help, typ: typeGauge, fn: fn})
+}
+
+// NewCounter registers a counter without labels.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).WithLabelValues()
+}
+
+// NewGauge registers a gauge without labels.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).WithLabelValues()
+}
+
+func NewCounter(name, help string) *Counter {
+	return Default.NewCounter(name, help)
+}
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labelNames...)
+}
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labelNames...)
+}
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labelNames...)
+}
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.NewGaugeFunc(name, help, fn)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func writeLabels(w *bufio.Writer, names, values []string, extraName, extraValue string) {
+	if len(names) == 0 && extraName == "" {
+		return
+	}
+	w.WriteByte('{')
+	for i := range names {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(names[i])
+		w.WriteString(`="`)
+		labelValueEscaper.WriteString(w, values[i])
+		w.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(extraName)
+		w.WriteString(`="`)
+		w.WriteString(extraValue)
+		w.WriteByte('"')
+	}
+	w.WriteByte('}')
+}
+
+func (f *family) write(w *bufio.Writer) {
+	w.WriteString("# HELP " + f.name + " " + f.help + "\n")
+	w.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+	if f.fn != nil {
+		w.WriteString(f.name + " " + formatFloat(f.fn()) + "\n")
+		return
+	}
+
+	keys := make([]string, 0)
+	f.children.Range(func(k, v any) bool {
+		keys = append(keys, k.(string))
+		return true
+	})
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, _ := f.children.Load(k)
+		var values []string
+		if len(f.labelNames) > 0 {
+			values = strings.Split(k, "\xff")
+		}
+		switch m := v.(type) {
+		case *Counter:
+			w.WriteString(f.name)
+			writeLabels(w, f.labelNames, values, "", "")
+			w.WriteString(" " + formatFloat(m.v.Load()) + "\n")
+		case *Gauge:
+			w.WriteString(f.name)
+			writeLabels(w, f.labelNames, values, "", "")
+			w.WriteString(" " + formatFloat(m.v.Load()) + "\n")
+		case *Histogram:
+			var cumulative uint64
+			for i := range m.counts {
+				cumulative += m.counts[i].Load()
+				le := "+Inf"
+				if i < len(m.upperBounds) {
+					le = formatFloat(m.upperBounds[i])
+				}
+				w.WriteString(f.name + "_bucket")
+				writeLabels(w, f.labelNames, values, "le", le)
+				w.WriteString(" " + strconv.FormatUint(cumulative, 10) + "\n")
+			}
+			w.WriteString(f.name + "_sum")
+			writeLabels(w, f.labelNames, values, "", "")
+			w.WriteString(" " + formatFloat(m.sum.Load()) + "\n")
+			w.WriteString(f.name + "_count")
+			writeLabels(w, f.labelNames, values, "", "")
+			w.WriteString(" " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+	}
+}
+
+// WriteText writes all metrics in the Prometheus text format, sorted by name.
+func (r *Registry) WriteText(out io.Writer) error {
+	r.lock.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.lock.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	w := bufio.NewWriter(out)
+	for _, f := range families {
+		f.write(w)
+	}
+	return w.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+// Handler serves the Default registry.
+func Handler() http.Handler {
+	return Default
+}
@@ -0,0 +1,69 @@
+/*
+*
+* Copyright 2023-2025 mkrainbow.com.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*      http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+ */
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestWriteText(t *testing.T) {
+
+	r := NewRegistry()
+	c := r.NewCounterVec("test_requests_total", "Requests.", "method", "code")
+	c.WithLabelValues("copost", "OK").Inc()
+	c.WithLabelValues("copost", "OK").Add(2)
+	c.WithLabelValues("obget", `a"b`).Inc()
+	assert.Equal(t, r.NewCounterVec("test_requests_total", "Requests.", "method", "code").WithLabelValues("copost", "OK"),
+		c.WithLabelValues("copost", "OK")) // registered once by name
+
+	g := r.NewGauge("test_sessions", "Sessions.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	r.NewGaugeFunc("test_depth", "Depth.", func() float64 { return 7 })
+
+	h := r.NewHistogramVec("test_duration_seconds", "Duration.", []float64{0.1, 1}, "method")
+	h.WithLabelValues("copost").Observe(0.05)
+	h.WithLabelValues("copost").Observe(0.5)
+	h.WithLabelValues("copost").Observe(3)
+
+	var sb strings.Builder
+	assert.NilError(t, r.WriteText(&sb))
+	assert.Equal(t, sb.String(), `# HELP test_depth Depth.
+# TYPE test_depth gauge
+test_depth 7
+# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="copost",le="0.1"} 1
+test_duration_seconds_bucket{method="copost",le="1"} 2
+test_duration_seconds_bucket{method="copost",le="+Inf"} 3
+test_duration_seconds_sum{method="copost"} 3.55
+test_duration_seconds_count{method="copost"} 3
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{method="copost",code="OK"} 3
+test_requests_total{method="obget",code="a\"b"} 1
+# HELP test_sessions Sessions.
+# TYPE test_sessions gauge
+test_sessions 1
+`)
+}
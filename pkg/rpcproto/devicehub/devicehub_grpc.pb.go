@@ -19,9 +19,12 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	AccessService_CoPost_FullMethodName      = "/devicehub.AccessService/CoPost"
-	AccessService_ObGet_FullMethodName       = "/devicehub.AccessService/ObGet"
-	AccessService_DeviceQuery_FullMethodName = "/devicehub.AccessService/DeviceQuery"
+	AccessService_CoPost_FullMethodName             = "/devicehub.AccessService/CoPost"
+	AccessService_CoPostStream_FullMethodName       = "/devicehub.AccessService/CoPostStream"
+	AccessService_ObGet_FullMethodName              = "/devicehub.AccessService/ObGet"
+	AccessService_DeviceQuery_FullMethodName        = "/devicehub.AccessService/DeviceQuery"
+	AccessService_DeviceList_FullMethodName         = "/devicehub.AccessService/DeviceList"
+	AccessService_RotateDeviceSecret_FullMethodName = "/devicehub.AccessService/RotateDeviceSecret"
 )
 
 // AccessServiceClient is the client API for AccessService service.
@@ -29,8 +32,12 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type AccessServiceClient interface {
 	CoPost(ctx context.Context, in *CoReq, opts ...grpc.CallOption) (*CoResp, error)
+	// many CoPosts, responses in any order matched by id
+	CoPostStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CoReq, CoResp], error)
 	ObGet(ctx context.Context, in *ObGetReq, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ObGetResp], error)
 	DeviceQuery(ctx context.Context, in *DeviceQueryReq, opts ...grpc.CallOption) (*DeviceQueryResp, error)
+	DeviceList(ctx context.Context, in *DeviceListReq, opts ...grpc.CallOption) (*DeviceListResp, error)
+	RotateDeviceSecret(ctx context.Context, in *RotateDeviceSecretReq, opts ...grpc.CallOption) (*RotateDeviceSecretResp, error)
 }
 
 type accessServiceClient struct {
@@ -51,9 +58,22 @@ func (c *accessServiceClient) CoPost(ctx context.Context, in *CoReq, opts ...grp
 	return out, nil
 }
 
+func (c *accessServiceClient) CoPostStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CoReq, CoResp], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AccessService_ServiceDesc.Streams[0], AccessService_CoPostStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CoReq, CoResp]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AccessService_CoPostStreamClient = grpc.BidiStreamingClient[CoReq, CoResp]
+
 func (c *accessServiceClient) ObGet(ctx context.Context, in *ObGetReq, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ObGetResp], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &AccessService_ServiceDesc.Streams[0], AccessService_ObGet_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &AccessService_ServiceDesc.Streams[1], AccessService_ObGet_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -80,13 +100,37 @@ func (c *accessServiceClient) DeviceQuery(ctx context.Context, in *DeviceQueryRe
 	return out, nil
 }
 
+func (c *accessServiceClient) DeviceList(ctx context.Context, in *DeviceListReq, opts ...grpc.CallOption) (*DeviceListResp, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeviceListResp)
+	err := c.cc.Invoke(ctx, AccessService_DeviceList_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *accessServiceClient) RotateDeviceSecret(ctx context.Context, in *RotateDeviceSecretReq, opts ...grpc.CallOption) (*RotateDeviceSecretResp, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RotateDeviceSecretResp)
+	err := c.cc.Invoke(ctx, AccessService_RotateDeviceSecret_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AccessServiceServer is the server API for AccessService service.
 // All implementations must embed UnimplementedAccessServiceServer
 // for forward compatibility.
 type AccessServiceServer interface {
 	CoPost(context.Context, *CoReq) (*CoResp, error)
+	// many CoPosts, responses in any order matched by id
+	CoPostStream(grpc.BidiStreamingServer[CoReq, CoResp]) error
 	ObGet(*ObGetReq, grpc.ServerStreamingServer[ObGetResp]) error
 	DeviceQuery(context.Context, *DeviceQueryReq) (*DeviceQueryResp, error)
+	DeviceList(context.Context, *DeviceListReq) (*DeviceListResp, error)
+	RotateDeviceSecret(context.Context, *RotateDeviceSecretReq) (*RotateDeviceSecretResp, error)
 	mustEmbedUnimplementedAccessServiceServer()
 }
 
@@ -100,12 +144,21 @@ type UnimplementedAccessServiceServer struct{}
 func (UnimplementedAccessServiceServer) CoPost(context.Context, *CoReq) (*CoResp, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CoPost not implemented")
 }
+func (UnimplementedAccessServiceServer) CoPostStream(grpc.BidiStreamingServer[CoReq, CoResp]) error {
+	return status.Errorf(codes.Unimplemented, "method CoPostStream not implemented")
+}
 func (UnimplementedAccessServiceServer) ObGet(*ObGetReq, grpc.ServerStreamingServer[ObGetResp]) error {
 	return status.Errorf(codes.Unimplemented, "method ObGet not implemented")
 }
 func (UnimplementedAccessServiceServer) DeviceQuery(context.Context, *DeviceQueryReq) (*DeviceQueryResp, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeviceQuery not implemented")
 }
+func (UnimplementedAccessServiceServer) DeviceList(context.Context, *DeviceListReq) (*DeviceListResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeviceList not implemented")
+}
+func (UnimplementedAccessServiceServer) RotateDeviceSecret(context.Context, *RotateDeviceSecretReq) (*RotateDeviceSecretResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RotateDeviceSecret not implemented")
+}
 func (UnimplementedAccessServiceServer) mustEmbedUnimplementedAccessServiceServer() {}
 func (UnimplementedAccessServiceServer) testEmbeddedByValue()                       {}
 
@@ -145,6 +198,13 @@ func _AccessService_CoPost_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AccessService_CoPostStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AccessServiceServer).CoPostStream(&grpc.GenericServerStream[CoReq, CoResp]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AccessService_CoPostStreamServer = grpc.BidiStreamingServer[CoReq, CoResp]
+
 func _AccessService_ObGet_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(ObGetReq)
 	if err := stream.RecvMsg(m); err != nil {
@@ -174,6 +234,42 @@ func _AccessService_DeviceQuery_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AccessService_DeviceList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeviceListReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccessServiceServer).DeviceList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AccessService_DeviceList_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccessServiceServer).DeviceList(ctx, req.(*DeviceListReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AccessService_RotateDeviceSecret_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RotateDeviceSecretReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AccessServiceServer).RotateDeviceSecret(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AccessService_RotateDeviceSecret_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AccessServiceServer).RotateDeviceSecret(ctx, req.(*RotateDeviceSecretReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // AccessService_ServiceDesc is the grpc.ServiceDesc for AccessService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -189,8 +285,22 @@ var AccessService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeviceQuery",
 			Handler:    _AccessService_DeviceQuery_Handler,
 		},
+		{
+			MethodName: "DeviceList",
+			Handler:    _AccessService_DeviceList_Handler,
+		},
+		{
+			MethodName: "RotateDeviceSecret",
+			Handler:    _AccessService_RotateDeviceSecret_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CoPostStream",
+			Handler:       _AccessService_CoPostStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 		{
 			StreamName:    "ObGet",
 			Handler:       _AccessService_ObGet_Handler,
@@ -199,3 +309,409 @@ var AccessService_ServiceDesc = grpc.ServiceDesc{
 	},
 	Metadata: "devicehub/devicehub.proto",
 }
+
+const (
+	ClusterService_DirectorySync_FullMethodName = "/devicehub.ClusterService/DirectorySync"
+)
+
+// ClusterServiceClient is the client API for ClusterService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ClusterServiceClient interface {
+	DirectorySync(ctx context.Context, in *DirectorySyncReq, opts ...grpc.CallOption) (*DirectorySyncResp, error)
+}
+
+type clusterServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClusterServiceClient(cc grpc.ClientConnInterface) ClusterServiceClient {
+	return &clusterServiceClient{cc}
+}
+
+func (c *clusterServiceClient) DirectorySync(ctx context.Context, in *DirectorySyncReq, opts ...grpc.CallOption) (*DirectorySyncResp, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DirectorySyncResp)
+	err := c.cc.Invoke(ctx, ClusterService_DirectorySync_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClusterServiceServer is the server API for ClusterService service.
+// All implementations must embed UnimplementedClusterServiceServer
+// for forward compatibility.
+type ClusterServiceServer interface {
+	DirectorySync(context.Context, *DirectorySyncReq) (*DirectorySyncResp, error)
+	mustEmbedUnimplementedClusterServiceServer()
+}
+
+// UnimplementedClusterServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedClusterServiceServer struct{}
+
+func (UnimplementedClusterServiceServer) DirectorySync(context.Context, *DirectorySyncReq) (*DirectorySyncResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DirectorySync not implemented")
+}
+func (UnimplementedClusterServiceServer) mustEmbedUnimplementedClusterServiceServer() {}
+func (UnimplementedClusterServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeClusterServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ClusterServiceServer will
+// result in compilation errors.
+type UnsafeClusterServiceServer interface {
+	mustEmbedUnimplementedClusterServiceServer()
+}
+
+func RegisterClusterServiceServer(s grpc.ServiceRegistrar, srv ClusterServiceServer) {
+	// If the following call pancis, it indicates UnimplementedClusterServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ClusterService_ServiceDesc, srv)
+}
+
+func _ClusterService_DirectorySync_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DirectorySyncReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServiceServer).DirectorySync(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClusterService_DirectorySync_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClusterServiceServer).DirectorySync(ctx, req.(*DirectorySyncReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ClusterService_ServiceDesc is the grpc.ServiceDesc for ClusterService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ClusterService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "devicehub.ClusterService",
+	HandlerType: (*ClusterServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "DirectorySync",
+			Handler:    _ClusterService_DirectorySync_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "devicehub/devicehub.proto",
+}
+
+const (
+	DeviceService_Post_FullMethodName  = "/devicehub.DeviceService/Post"
+	DeviceService_ObGet_FullMethodName = "/devicehub.DeviceService/ObGet"
+)
+
+// DeviceServiceClient is the client API for DeviceService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// DeviceService is served by the backend handling device requests, an
+// alternative to the http device service.
+type DeviceServiceClient interface {
+	Post(ctx context.Context, in *DeviceServiceReq, opts ...grpc.CallOption) (*DeviceServiceResp, error)
+	// ObGet serves an observation by the device. The first response
+	// establishes it with CODE_CONTINUE, further CODE_CONTINUE responses
+	// notify the device, CODE_TERMINATE or the end of the stream terminates it.
+	ObGet(ctx context.Context, in *DeviceServiceReq, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DeviceServiceResp], error)
+}
+
+type deviceServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDeviceServiceClient(cc grpc.ClientConnInterface) DeviceServiceClient {
+	return &deviceServiceClient{cc}
+}
+
+func (c *deviceServiceClient) Post(ctx context.Context, in *DeviceServiceReq, opts ...grpc.CallOption) (*DeviceServiceResp, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeviceServiceResp)
+	err := c.cc.Invoke(ctx, DeviceService_Post_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deviceServiceClient) ObGet(ctx context.Context, in *DeviceServiceReq, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DeviceServiceResp], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &DeviceService_ServiceDesc.Streams[0], DeviceService_ObGet_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DeviceServiceReq, DeviceServiceResp]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DeviceService_ObGetClient = grpc.ServerStreamingClient[DeviceServiceResp]
+
+// DeviceServiceServer is the server API for DeviceService service.
+// All implementations must embed UnimplementedDeviceServiceServer
+// for forward compatibility.
+//
+// DeviceService is served by the backend handling device requests, an
+// alternative to the http device service.
+type DeviceServiceServer interface {
+	Post(context.Context, *DeviceServiceReq) (*DeviceServiceResp, error)
+	// ObGet serves an observation by the device. The first response
+	// establishes it with CODE_CONTINUE, further CODE_CONTINUE responses
+	// notify the device, CODE_TERMINATE or the end of the stream terminates it.
+	ObGet(*DeviceServiceReq, grpc.ServerStreamingServer[DeviceServiceResp]) error
+	mustEmbedUnimplementedDeviceServiceServer()
+}
+
+// UnimplementedDeviceServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDeviceServiceServer struct{}
+
+func (UnimplementedDeviceServiceServer) Post(context.Context, *DeviceServiceReq) (*DeviceServiceResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Post not implemented")
+}
+func (UnimplementedDeviceServiceServer) ObGet(*DeviceServiceReq, grpc.ServerStreamingServer[DeviceServiceResp]) error {
+	return status.Errorf(codes.Unimplemented, "method ObGet not implemented")
+}
+func (UnimplementedDeviceServiceServer) mustEmbedUnimplementedDeviceServiceServer() {}
+func (UnimplementedDeviceServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeDeviceServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DeviceServiceServer will
+// result in compilation errors.
+type UnsafeDeviceServiceServer interface {
+	mustEmbedUnimplementedDeviceServiceServer()
+}
+
+func RegisterDeviceServiceServer(s grpc.ServiceRegistrar, srv DeviceServiceServer) {
+	// If the following call pancis, it indicates UnimplementedDeviceServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&DeviceService_ServiceDesc, srv)
+}
+
+func _DeviceService_Post_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeviceServiceReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeviceServiceServer).Post(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DeviceService_Post_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeviceServiceServer).Post(ctx, req.(*DeviceServiceReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DeviceService_ObGet_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DeviceServiceReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DeviceServiceServer).ObGet(m, &grpc.GenericServerStream[DeviceServiceReq, DeviceServiceResp]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DeviceService_ObGetServer = grpc.ServerStreamingServer[DeviceServiceResp]
+
+// DeviceService_ServiceDesc is the grpc.ServiceDesc for DeviceService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DeviceService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "devicehub.DeviceService",
+	HandlerType: (*DeviceServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Post",
+			Handler:    _DeviceService_Post_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ObGet",
+			Handler:       _DeviceService_ObGet_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "devicehub/devicehub.proto",
+}
+
+const (
+	DeviceVerifier_Verify_FullMethodName       = "/devicehub.DeviceVerifier/Verify"
+	DeviceVerifier_UpdateSecret_FullMethodName = "/devicehub.DeviceVerifier/UpdateSecret"
+)
+
+// DeviceVerifierClient is the client API for DeviceVerifier service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// DeviceVerifier is served by the backend verifying devices, an
+// alternative to the http device verifier.
+type DeviceVerifierClient interface {
+	Verify(ctx context.Context, in *DeviceVerifyReq, opts ...grpc.CallOption) (*DeviceVerifyResp, error)
+	// stores the secret rotated by the hub, CODE_NOT_FOUNT for an unknown device
+	UpdateSecret(ctx context.Context, in *DeviceVerifyReq, opts ...grpc.CallOption) (*DeviceVerifyResp, error)
+}
+
+type deviceVerifierClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDeviceVerifierClient(cc grpc.ClientConnInterface) DeviceVerifierClient {
+	return &deviceVerifierClient{cc}
+}
+
+func (c *deviceVerifierClient) Verify(ctx context.Context, in *DeviceVerifyReq, opts ...grpc.CallOption) (*DeviceVerifyResp, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeviceVerifyResp)
+	err := c.cc.Invoke(ctx, DeviceVerifier_Verify_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deviceVerifierClient) UpdateSecret(ctx context.Context, in *DeviceVerifyReq, opts ...grpc.CallOption) (*DeviceVerifyResp, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeviceVerifyResp)
+	err := c.cc.Invoke(ctx, DeviceVerifier_UpdateSecret_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeviceVerifierServer is the server API for DeviceVerifier service.
+// All implementations must embed UnimplementedDeviceVerifierServer
+// for forward compatibility.
+//
+// DeviceVerifier is served by the backend verifying devices, an
+// alternative to the http device verifier.
+type DeviceVerifierServer interface {
+	Verify(context.Context, *DeviceVerifyReq) (*DeviceVerifyResp, error)
+	// stores the secret rotated by the hub, CODE_NOT_FOUNT for an unknown device
+	UpdateSecret(context.Context, *DeviceVerifyReq) (*DeviceVerifyResp, error)
+	mustEmbedUnimplementedDeviceVerifierServer()
+}
+
+// UnimplementedDeviceVerifierServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDeviceVerifierServer struct{}
+
+func (UnimplementedDeviceVerifierServer) Verify(context.Context, *DeviceVerifyReq) (*DeviceVerifyResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Verify not implemented")
+}
+func (UnimplementedDeviceVerifierServer) UpdateSecret(context.Context, *DeviceVerifyReq) (*DeviceVerifyResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateSecret not implemented")
+}
+func (UnimplementedDeviceVerifierServer) mustEmbedUnimplementedDeviceVerifierServer() {}
+func (UnimplementedDeviceVerifierServer) testEmbeddedByValue()                        {}
+
+// UnsafeDeviceVerifierServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DeviceVerifierServer will
+// result in compilation errors.
+type UnsafeDeviceVerifierServer interface {
+	mustEmbedUnimplementedDeviceVerifierServer()
+}
+
+func RegisterDeviceVerifierServer(s grpc.ServiceRegistrar, srv DeviceVerifierServer) {
+	// If the following call pancis, it indicates UnimplementedDeviceVerifierServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&DeviceVerifier_ServiceDesc, srv)
+}
+
+func _DeviceVerifier_Verify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeviceVerifyReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeviceVerifierServer).Verify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DeviceVerifier_Verify_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeviceVerifierServer).Verify(ctx, req.(*DeviceVerifyReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DeviceVerifier_UpdateSecret_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeviceVerifyReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeviceVerifierServer).UpdateSecret(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DeviceVerifier_UpdateSecret_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeviceVerifierServer).UpdateSecret(ctx, req.(*DeviceVerifyReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// DeviceVerifier_ServiceDesc is the grpc.ServiceDesc for DeviceVerifier service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DeviceVerifier_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "devicehub.DeviceVerifier",
+	HandlerType: (*DeviceVerifierServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Verify",
+			Handler:    _DeviceVerifier_Verify_Handler,
+		},
+		{
+			MethodName: "UpdateSecret",
+			Handler:    _DeviceVerifier_UpdateSecret_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "devicehub/devicehub.proto",
+}